@@ -8,20 +8,24 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"remnawave-tg-shop-bot/internal/broadcast"
 	"remnawave-tg-shop-bot/internal/cache"
+	"remnawave-tg-shop-bot/internal/channel"
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/cryptopay"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/metrics"
 	"remnawave-tg-shop-bot/internal/moynalog"
 	"remnawave-tg-shop-bot/internal/notification"
 	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/referral"
 	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/staff"
 	"remnawave-tg-shop-bot/internal/sync"
 	"remnawave-tg-shop-bot/internal/translation"
 	"remnawave-tg-shop-bot/internal/tribute"
 	"remnawave-tg-shop-bot/internal/yookasa"
-	"strconv"
 	"strings"
 	"time"
 
@@ -75,6 +79,16 @@ func main() {
 	customerRepository := database.NewCustomerRepository(pool)
 	purchaseRepository := database.NewPurchaseRepository(pool)
 	referralRepository := database.NewReferralRepository(pool)
+	promoCodeRepository := database.NewPromoCodeRepository(pool)
+	tariffRepository := database.NewTariffRepository(pool)
+	if err := payment.SeedTariffs(ctx, tariffRepository); err != nil {
+		panic(err)
+	}
+	callbackTokenRepository := database.NewCallbackTokenRepository(pool)
+	provisioningJobRepository := database.NewProvisioningJobRepository(pool)
+	receiptRepository := database.NewReceiptRepository(pool)
+	giftCodeRepository := database.NewGiftCodeRepository(pool)
+	trialActivationRepository := database.NewTrialActivationRepository(pool)
 
 	cryptoPayClient := cryptopay.NewCryptoPayClient(config.CryptoPayUrl(), config.CryptoPayToken())
 	remnawaveClient := remnawave.NewClient(config.RemnawaveUrl(), config.RemnawaveToken(), config.RemnawaveMode())
@@ -84,7 +98,12 @@ func main() {
 		panic(err)
 	}
 
-	paymentService := payment.NewPaymentService(tm, purchaseRepository, remnawaveClient, customerRepository, b, cryptoPayClient, yookasaClient, referralRepository, cache, moynalogClient)
+	staffService := staff.NewService(database.NewStaffRepository(pool), b, config.GetAdminTelegramId())
+	if err := staffService.Load(ctx); err != nil {
+		panic(err)
+	}
+
+	paymentService := payment.NewPaymentService(tm, purchaseRepository, remnawaveClient, customerRepository, b, cryptoPayClient, yookasaClient, referralRepository, cache, moynalogClient, promoCodeRepository, tariffRepository, provisioningJobRepository, receiptRepository, staffService, giftCodeRepository, trialActivationRepository)
 
 	cronScheduler := setupInvoiceChecker(purchaseRepository, cryptoPayClient, paymentService, yookasaClient)
 	if cronScheduler != nil {
@@ -98,9 +117,37 @@ func main() {
 	subscriptionNotificationCronScheduler.Start()
 	defer subscriptionNotificationCronScheduler.Stop()
 
+	if moynalogClient != nil {
+		receiptSender := receiptSender(paymentService)
+		receiptSender.Start()
+		defer receiptSender.Stop()
+	}
+
+	provisioningRetrier := provisioningRetrier(paymentService)
+	provisioningRetrier.Start()
+	defer provisioningRetrier.Stop()
+
+	callbackTokenCleaner := callbackTokenCleaner(callbackTokenRepository)
+	callbackTokenCleaner.Start()
+	defer callbackTokenCleaner.Stop()
+
+	var channelService *channel.Service
+	if config.RequiredChannelID() != "" {
+		channelService = channel.NewService(b, config.RequiredChannelID(), config.RequiredChannelCacheTTL(), customerRepository, paymentService)
+		if config.IsChannelTrialRevoked() {
+			channelChecker := channelMembershipChecker(channelService)
+			channelChecker.Start()
+			defer channelChecker.Stop()
+		}
+	}
+
 	syncService := sync.NewSyncService(remnawaveClient, customerRepository)
 
-	h := handler.NewHandler(syncService, paymentService, tm, customerRepository, purchaseRepository, cryptoPayClient, yookasaClient, referralRepository, cache)
+	broadcastRepository := database.NewBroadcastRepository(pool)
+	broadcastService := broadcast.NewService(broadcastRepository, b, tm, config.DefaultLanguage(), config.BroadcastRatePerSecond())
+	go broadcastService.Run(ctx)
+
+	h := handler.NewHandler(syncService, paymentService, tm, customerRepository, purchaseRepository, cryptoPayClient, yookasaClient, referralRepository, cache, remnawaveClient, broadcastRepository, broadcastService, promoCodeRepository, tariffRepository, callbackTokenRepository, provisioningJobRepository, staffService, database.NewStatsRepository(pool), referral.NewService(referralRepository, customerRepository, remnawaveClient), channelService)
 
 	me, err := b.GetMe(ctx)
 	if err != nil {
@@ -133,25 +180,61 @@ func main() {
 
 	config.SetBotURL(fmt.Sprintf("https://t.me/%s", me.Username))
 
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/start", bot.MatchTypePrefix, h.StartCommandHandler, h.SuspiciousUserFilterMiddleware)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/connect", bot.MatchTypeExact, h.ConnectCommandHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeMessageText, "/sync", bot.MatchTypeExact, h.SyncUsersCommandHandler, isAdminMiddleware)
-
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackReferral, bot.MatchTypeExact, h.ReferralCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBuy, bot.MatchTypeExact, h.BuyCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTrial, bot.MatchTypeExact, h.TrialCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackActivateTrial, bot.MatchTypeExact, h.ActivateTrialCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackStart, bot.MatchTypeExact, h.StartCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackSell, bot.MatchTypePrefix, h.SellCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackConnect, bot.MatchTypeExact, h.ConnectCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
-	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackPayment, bot.MatchTypePrefix, h.PaymentCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/start", bot.MatchTypePrefix, h.StartCommandHandler, h.MetricsMiddleware("/start"), h.SuspiciousUserFilterMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/connect", bot.MatchTypeExact, h.ConnectCommandHandler, h.MetricsMiddleware("/connect"), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/sync", bot.MatchTypeExact, h.SyncUsersCommandHandler, h.MetricsMiddleware("/sync"), h.StaffMiddleware(staff.PermissionSync))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/admin", bot.MatchTypePrefix, h.AdminCommandHandler, h.MetricsMiddleware("/admin"), h.StaffMiddleware(staff.PermissionCustomers))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/broadcast", bot.MatchTypeExact, h.BroadcastCommandHandler, h.MetricsMiddleware("/broadcast"), h.StaffMiddleware(staff.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/promo", bot.MatchTypePrefix, h.PromoCommandHandler, h.MetricsMiddleware("/promo"), h.StaffMiddleware(staff.PermissionPromo))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/refund", bot.MatchTypePrefix, h.RefundCommandHandler, h.MetricsMiddleware("/refund"), h.StaffMiddleware(staff.PermissionRefund))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/provisioning", bot.MatchTypePrefix, h.ProvisioningCommandHandler, h.MetricsMiddleware("/provisioning"), h.StaffMiddleware(staff.PermissionProvisioning))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/tariffs", bot.MatchTypeExact, h.TariffsCommandHandler, h.MetricsMiddleware("/tariffs"), h.StaffMiddleware(staff.PermissionTariffs))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/stats", bot.MatchTypeExact, h.StatsCommandHandler, h.MetricsMiddleware("/stats"), h.StaffMiddleware(staff.PermissionStats))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/referrals", bot.MatchTypePrefix, h.ReferralReviewCommandHandler, h.MetricsMiddleware("/referrals"), h.StaffMiddleware(staff.PermissionReferrals))
+	b.RegisterHandler(bot.HandlerTypeMessageText, "/staff", bot.MatchTypePrefix, h.StaffCommandHandler, h.MetricsMiddleware("/staff"), h.StaffMiddleware(staff.PermissionStaff))
+	b.RegisterHandlerMatchFunc(h.IsAwaitingInput, h.InputHandler, h.MetricsMiddleware("input"), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdmin, bot.MatchTypeExact, h.AdminCallbackHandler, h.MetricsMiddleware(handler.CallbackAdmin), h.StaffMiddleware(staff.PermissionCustomers))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminSearch, bot.MatchTypeExact, h.AdminSearchCallbackHandler, h.MetricsMiddleware(handler.CallbackAdminSearch), h.StaffMiddleware(staff.PermissionCustomers))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminSync, bot.MatchTypeExact, h.AdminSyncCallbackHandler, h.MetricsMiddleware(handler.CallbackAdminSync), h.StaffMiddleware(staff.PermissionSync))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminCustomer, bot.MatchTypePrefix, h.AdminCustomerCallbackHandler, h.MetricsMiddleware(handler.CallbackAdminCustomer), h.StaffMiddleware(staff.PermissionCustomers))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminPurchases, bot.MatchTypePrefix, h.AdminPurchasesCallbackHandler, h.MetricsMiddleware(handler.CallbackAdminPurchases), h.StaffMiddleware(staff.PermissionCustomers))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminAction, bot.MatchTypePrefix, h.AdminActionCallbackHandler, h.MetricsMiddleware(handler.CallbackAdminAction), h.StaffMiddleware(staff.PermissionCustomers))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminConfirm, bot.MatchTypePrefix, h.AdminConfirmCallbackHandler, h.MetricsMiddleware(handler.CallbackAdminConfirm), h.StaffMiddleware(staff.PermissionCustomers))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminRefund, bot.MatchTypePrefix, h.AdminRefundCallbackHandler, h.MetricsMiddleware(handler.CallbackAdminRefund), h.StaffMiddleware(staff.PermissionRefund))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminStats, bot.MatchTypePrefix, h.StatsCallbackHandler, h.MetricsMiddleware(handler.CallbackAdminStats), h.StaffMiddleware(staff.PermissionStats))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackAdminBroadcast, bot.MatchTypeExact, h.AdminBroadcastCallbackHandler, h.MetricsMiddleware(handler.CallbackAdminBroadcast), h.StaffMiddleware(staff.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBroadcastAudience, bot.MatchTypePrefix, h.BroadcastAudienceCallbackHandler, h.MetricsMiddleware(handler.CallbackBroadcastAudience), h.StaffMiddleware(staff.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBroadcastSegment, bot.MatchTypePrefix, h.BroadcastSegmentCallbackHandler, h.MetricsMiddleware(handler.CallbackBroadcastSegment), h.StaffMiddleware(staff.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBroadcastStart, bot.MatchTypePrefix, h.BroadcastStartCallbackHandler, h.MetricsMiddleware(handler.CallbackBroadcastStart), h.StaffMiddleware(staff.PermissionBroadcast))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBroadcastCancel, bot.MatchTypePrefix, h.BroadcastCancelCallbackHandler, h.MetricsMiddleware(handler.CallbackBroadcastCancel), h.StaffMiddleware(staff.PermissionBroadcast))
+
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackReferralRewards, bot.MatchTypePrefix, h.ReferralRewardsCallbackHandler, h.MetricsMiddleware(handler.CallbackReferralRewards), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackReferralCard, bot.MatchTypeExact, h.ReferralCardCallbackHandler, h.MetricsMiddleware(handler.CallbackReferralCard), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	// Registered after the other referral callbacks, which share its prefix.
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackReferral, bot.MatchTypePrefix, h.ReferralCallbackHandler, h.MetricsMiddleware(handler.CallbackReferral), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBuy, bot.MatchTypeExact, h.BuyCallbackHandler, h.MetricsMiddleware(handler.CallbackBuy), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware, h.ChannelSubscriptionMiddleware(true))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackBuyGift, bot.MatchTypeExact, h.BuyGiftCallbackHandler, h.MetricsMiddleware(handler.CallbackBuyGift), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware, h.ChannelSubscriptionMiddleware(true))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackTrial, bot.MatchTypeExact, h.TrialCallbackHandler, h.MetricsMiddleware(handler.CallbackTrial), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware, h.ChannelSubscriptionMiddleware(false))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackActivateTrial, bot.MatchTypeExact, h.ActivateTrialCallbackHandler, h.MetricsMiddleware(handler.CallbackActivateTrial), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware, h.ChannelSubscriptionMiddleware(false))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackChannelCheck, bot.MatchTypeExact, h.ChannelCheckCallbackHandler, h.MetricsMiddleware(handler.CallbackChannelCheck), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackStart, bot.MatchTypeExact, h.StartCallbackHandler, h.MetricsMiddleware(handler.CallbackStart), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackSell, bot.MatchTypePrefix, h.SellCallbackHandler, h.MetricsMiddleware(handler.CallbackSell), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware, h.ChannelSubscriptionMiddleware(true))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackConnect, bot.MatchTypeExact, h.ConnectCallbackHandler, h.MetricsMiddleware(handler.CallbackConnect), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackPayment, bot.MatchTypePrefix, h.PaymentCallbackHandler, h.MetricsMiddleware(handler.CallbackPayment), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware, h.ChannelSubscriptionMiddleware(true))
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackEnterPromo, bot.MatchTypePrefix, h.EnterPromoCallbackHandler, h.MetricsMiddleware(handler.CallbackEnterPromo), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackDisableAutoPayment, bot.MatchTypeExact, h.DisableAutoPaymentCallbackHandler, h.MetricsMiddleware(handler.CallbackDisableAutoPayment), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackDevices, bot.MatchTypeExact, h.DevicesCallbackHandler, h.MetricsMiddleware(handler.CallbackDevices), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackDeleteDevice, bot.MatchTypePrefix, h.DeleteDeviceCallbackHandler, h.MetricsMiddleware(handler.CallbackDeleteDevice), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackResetDevices, bot.MatchTypeExact, h.ResetDevicesCallbackHandler, h.MetricsMiddleware(handler.CallbackResetDevices), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	b.RegisterHandler(bot.HandlerTypeCallbackQueryData, handler.CallbackResetDevicesConfirm, bot.MatchTypeExact, h.ResetDevicesConfirmCallbackHandler, h.MetricsMiddleware(handler.CallbackResetDevicesConfirm), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
 	b.RegisterHandlerMatchFunc(func(update *models.Update) bool {
 		return update.PreCheckoutQuery != nil
-	}, h.PreCheckoutCallbackHandler, h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
+	}, h.PreCheckoutCallbackHandler, h.MetricsMiddleware("pre_checkout"), h.SuspiciousUserFilterMiddleware, h.CreateCustomerIfNotExistMiddleware)
 
 	b.RegisterHandlerMatchFunc(func(update *models.Update) bool {
 		return update.Message != nil && update.Message.SuccessfulPayment != nil
-	}, h.SuccessPaymentHandler, h.SuspiciousUserFilterMiddleware)
+	}, h.SuccessPaymentHandler, h.MetricsMiddleware("successful_payment"), h.SuspiciousUserFilterMiddleware)
 
 	mux := http.NewServeMux()
 	mux.Handle("/healthcheck", fullHealthHandler(pool, remnawaveClient))
@@ -159,6 +242,16 @@ func main() {
 		tributeHandler := tribute.NewClient(paymentService, customerRepository)
 		mux.Handle(config.GetTributeWebHookUrl(), tributeHandler.WebHookHandler())
 	}
+	if config.IsCryptoPayEnabled() && config.GetCryptoPayWebHookUrl() != "" {
+		mux.Handle(config.GetCryptoPayWebHookUrl(), cryptoPayClient.WebHookHandler(paymentService))
+	}
+	if config.IsYookasaEnabled() && config.GetYookasaWebHookUrl() != "" {
+		mux.Handle(config.GetYookasaWebHookUrl(), yookasaClient.WebHookHandler(paymentService))
+	}
+	if config.GetRemnawaveWebHookUrl() != "" {
+		panelEventService := notification.NewPanelEventService(customerRepository, b, tm)
+		mux.Handle(config.GetRemnawaveWebHookUrl(), remnawave.WebHookHandler(config.RemnawaveWebhookSecret(), panelEventService))
+	}
 
 	srv := &http.Server{
 		Addr:    fmt.Sprintf(":%d", config.GetHealthCheckPort()),
@@ -171,6 +264,23 @@ func main() {
 		}
 	}()
 
+	// Metrics are served on their own port so they are not exposed together with the public webhooks.
+	var metricsSrv *http.Server
+	if config.GetMetricsPort() != 0 {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+		metricsSrv = &http.Server{
+			Addr:    fmt.Sprintf(":%d", config.GetMetricsPort()),
+			Handler: metricsMux,
+		}
+		go func() {
+			log.Printf("Metrics server listening on %s", metricsSrv.Addr)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("Metrics server error: %v", err)
+			}
+		}()
+	}
+
 	slog.Info("Bot is starting...")
 	b.Start(ctx)
 
@@ -180,6 +290,11 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Health server shutdown error: %v", err)
 	}
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Metrics server shutdown error: %v", err)
+		}
+	}
 }
 
 func fullHealthHandler(pool *pgxpool.Pool, rw *remnawave.Client) http.Handler {
@@ -220,16 +335,6 @@ func fullHealthHandler(pool *pgxpool.Pool, rw *remnawave.Client) http.Handler {
 	})
 }
 
-func isAdminMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
-	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
-		if update.Message != nil && update.Message.From.ID == config.GetAdminTelegramId() {
-			next(ctx, b, update)
-		} else {
-			return
-		}
-	}
-}
-
 func subscriptionChecker(subService *notification.SubscriptionService) *cron.Cron {
 	c := cron.New()
 
@@ -246,6 +351,71 @@ func subscriptionChecker(subService *notification.SubscriptionService) *cron.Cro
 	return c
 }
 
+func provisioningRetrier(paymentService *payment.PaymentService) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("@every 1m", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		paymentService.RetryProvisioning(ctx)
+	})
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func receiptSender(paymentService *payment.PaymentService) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("@every 1m", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		paymentService.ProcessReceipts(ctx)
+	})
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func channelMembershipChecker(channelService *channel.Service) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("@hourly", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+		defer cancel()
+		channelService.RevokeLeftTrials(ctx)
+	})
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func callbackTokenCleaner(callbackTokenRepository *database.CallbackTokenRepository) *cron.Cron {
+	c := cron.New()
+
+	_, err := c.AddFunc("@hourly", func() {
+		deleted, err := callbackTokenRepository.DeleteExpired(context.Background())
+		if err != nil {
+			slog.Error("Error deleting expired callback tokens", "error", err)
+			return
+		}
+		if deleted > 0 {
+			slog.Info("expired callback tokens deleted", "count", deleted)
+		}
+	})
+
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
 func initDatabase(ctx context.Context, connString string) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(connString)
 	if err != nil {
@@ -269,7 +439,11 @@ func setupInvoiceChecker(
 	c := cron.New(cron.WithSeconds())
 
 	if config.IsCryptoPayEnabled() {
-		_, err := c.AddFunc("*/5 * * * * *", func() {
+		schedule := "*/5 * * * * *"
+		if config.GetCryptoPayWebHookUrl() != "" {
+			schedule = "0 */5 * * * *"
+		}
+		_, err := c.AddFunc(schedule, func() {
 			ctx := context.Background()
 			checkCryptoPayInvoice(ctx, purchaseRepository, cryptoPayClient, paymentService)
 		})
@@ -280,7 +454,12 @@ func setupInvoiceChecker(
 	}
 
 	if config.IsYookasaEnabled() {
-		_, err := c.AddFunc("*/5 * * * * *", func() {
+		// With notifications configured polling only reconciles missed webhooks.
+		schedule := "*/5 * * * * *"
+		if config.GetYookasaWebHookUrl() != "" {
+			schedule = "0 */5 * * * *"
+		}
+		_, err := c.AddFunc(schedule, func() {
 			ctx := context.Background()
 			checkYookasaInvoice(ctx, purchaseRepository, yookasaClient, paymentService)
 		})
@@ -306,6 +485,7 @@ func checkYookasaInvoice(
 	)
 	if err != nil {
 		log.Printf("Error finding pending purchases: %v", err)
+		metrics.PaymentPollingErrors.WithLabelValues("yookasa").Inc()
 		return
 	}
 	if len(*pendingPurchases) == 0 {
@@ -318,33 +498,15 @@ func checkYookasaInvoice(
 
 		if err != nil {
 			slog.Error("Error getting invoice", "invoiceId", purchase.YookasaID, "error", err)
+			metrics.PaymentPollingErrors.WithLabelValues("yookasa").Inc()
 			continue
 		}
 
-		if invoice.IsCancelled() {
-			err := paymentService.CancelYookassaPayment(purchase.ID)
-			if err != nil {
-				slog.Error("Error canceling invoice", "invoiceId", invoice.ID, "purchaseId", purchase.ID, "error", err)
-			}
-			continue
-		}
-
-		if !invoice.Paid {
-			continue
-		}
-
-		purchaseId, err := strconv.Atoi(invoice.Metadata["purchaseId"])
-		if err != nil {
-			slog.Error("Error parsing purchaseId", "invoiceId", invoice.ID, "error", err)
-		}
-		ctxWithValue := context.WithValue(ctx, "username", invoice.Metadata["username"])
-		err = paymentService.ProcessPurchaseById(ctxWithValue, int64(purchaseId))
+		err = paymentService.ProcessYookasaPayment(ctx, invoice)
 		if err != nil {
-			slog.Error("Error processing invoice", "invoiceId", invoice.ID, "purchaseId", purchaseId, "error", err)
-		} else {
-			slog.Info("Invoice processed", "invoiceId", invoice.ID, "purchaseId", purchaseId)
+			slog.Error("Error processing invoice", "invoiceId", invoice.ID, "purchaseId", purchase.ID, "error", err)
+			metrics.PaymentPollingErrors.WithLabelValues("yookasa").Inc()
 		}
-
 	}
 }
 
@@ -361,6 +523,7 @@ func checkCryptoPayInvoice(
 	)
 	if err != nil {
 		log.Printf("Error finding pending purchases: %v", err)
+		metrics.PaymentPollingErrors.WithLabelValues("crypto").Inc()
 		return
 	}
 	if len(*pendingPurchases) == 0 {
@@ -383,23 +546,18 @@ func checkCryptoPayInvoice(
 	invoices, err := cryptoPayClient.GetInvoices("", "", "", stringInvoiceIDs, 0, 0)
 	if err != nil {
 		log.Printf("Error getting invoices: %v", err)
+		metrics.PaymentPollingErrors.WithLabelValues("crypto").Inc()
 		return
 	}
 
 	for _, invoice := range *invoices {
-		if invoice.InvoiceID != nil && invoice.IsPaid() {
-			payload := strings.Split(invoice.Payload, "&")
-			purchaseID, err := strconv.Atoi(strings.Split(payload[0], "=")[1])
-			username := strings.Split(payload[1], "=")[1]
-			ctxWithUsername := context.WithValue(ctx, "username", username)
-			err = paymentService.ProcessPurchaseById(ctxWithUsername, int64(purchaseID))
-			if err != nil {
-				slog.Error("Error processing invoice", "invoiceId", invoice.InvoiceID, "error", err)
-			} else {
-				slog.Info("Invoice processed", "invoiceId", invoice.InvoiceID, "purchaseId", purchaseID)
-			}
-
+		if invoice.InvoiceID == nil || !invoice.IsPaid() {
+			continue
+		}
+		err = paymentService.ProcessCryptoPayInvoice(ctx, &invoice)
+		if err != nil {
+			slog.Error("Error processing invoice", "invoiceId", *invoice.InvoiceID, "error", err)
+			metrics.PaymentPollingErrors.WithLabelValues("crypto").Inc()
 		}
 	}
-
 }
@@ -0,0 +1 @@
+ALTER TABLE customer DROP COLUMN payment_method_id;
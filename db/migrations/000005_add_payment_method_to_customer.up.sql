@@ -0,0 +1 @@
+ALTER TABLE customer ADD COLUMN payment_method_id uuid;
@@ -0,0 +1,8 @@
+UPDATE purchase SET status = 'pending' WHERE status = 'processing';
+
+ALTER TABLE purchase
+    DROP COLUMN processing_started_at,
+    DROP COLUMN provision_base_expire_at,
+    DROP COLUMN provisioned_at,
+    DROP COLUMN subscription_link,
+    DROP COLUMN subscription_expire_at;
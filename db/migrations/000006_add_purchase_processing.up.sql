@@ -0,0 +1,6 @@
+ALTER TABLE purchase
+    ADD COLUMN processing_started_at    TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN provision_base_expire_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN provisioned_at           TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN subscription_link        TEXT,
+    ADD COLUMN subscription_expire_at   TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_customer_username;
+
+ALTER TABLE customer
+    DROP COLUMN username,
+    DROP COLUMN blocked;
@@ -0,0 +1,5 @@
+ALTER TABLE customer
+    ADD COLUMN username VARCHAR(64),
+    ADD COLUMN blocked  BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_customer_username ON customer (lower(username));
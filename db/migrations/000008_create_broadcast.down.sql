@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS broadcast_recipient;
+DROP TABLE IF EXISTS broadcast;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS broadcast
+(
+    id               BIGSERIAL PRIMARY KEY,
+    admin_chat_id    BIGINT      NOT NULL,
+    segment          VARCHAR(20),
+    text             TEXT        NOT NULL DEFAULT '',
+    entities         JSONB,
+    photo_file_id    TEXT,
+    buttons          JSONB,
+    status           VARCHAR(20) NOT NULL DEFAULT 'draft',
+    created_at       TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    started_at       TIMESTAMP WITH TIME ZONE,
+    finished_at      TIMESTAMP WITH TIME ZONE
+);
+
+CREATE TABLE IF NOT EXISTS broadcast_recipient
+(
+    broadcast_id BIGINT      NOT NULL REFERENCES broadcast (id) ON DELETE CASCADE,
+    telegram_id  BIGINT      NOT NULL,
+    status       VARCHAR(20) NOT NULL DEFAULT 'pending',
+    error        TEXT,
+    sent_at      TIMESTAMP WITH TIME ZONE,
+    PRIMARY KEY (broadcast_id, telegram_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_broadcast_recipient_pending ON broadcast_recipient (broadcast_id) WHERE status = 'pending';
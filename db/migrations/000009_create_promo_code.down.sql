@@ -0,0 +1,6 @@
+ALTER TABLE purchase
+    DROP COLUMN promo_code_id,
+    DROP COLUMN discount_amount,
+    DROP COLUMN bonus_days;
+
+DROP TABLE IF EXISTS promo_code;
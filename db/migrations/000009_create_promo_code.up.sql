@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS promo_code
+(
+    id                    BIGSERIAL PRIMARY KEY,
+    code                  VARCHAR(64) NOT NULL,
+    type                  VARCHAR(20) NOT NULL,
+    value                 INTEGER     NOT NULL,
+    max_uses              INTEGER,
+    max_uses_per_customer INTEGER     NOT NULL DEFAULT 1,
+    months                INTEGER[],
+    invoice_types         VARCHAR(20)[],
+    expires_at            TIMESTAMP WITH TIME ZONE,
+    active                BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at            TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_promo_code_code ON promo_code (upper(code));
+
+ALTER TABLE purchase
+    ADD COLUMN promo_code_id   BIGINT REFERENCES promo_code (id) ON DELETE SET NULL,
+    ADD COLUMN discount_amount DECIMAL(20, 8) NOT NULL DEFAULT 0,
+    ADD COLUMN bonus_days      INTEGER        NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_purchase_promo_code_id ON purchase (promo_code_id) WHERE promo_code_id IS NOT NULL;
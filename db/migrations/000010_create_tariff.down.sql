@@ -0,0 +1,10 @@
+ALTER TABLE promo_code
+    ADD COLUMN months INTEGER[];
+
+ALTER TABLE promo_code
+    DROP COLUMN IF EXISTS tariff_ids;
+
+ALTER TABLE purchase
+    DROP COLUMN IF EXISTS tariff_id;
+
+DROP TABLE IF EXISTS tariff;
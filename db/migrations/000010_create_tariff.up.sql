@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS tariff
+(
+    id                     BIGSERIAL PRIMARY KEY,
+    name                   VARCHAR(64) NOT NULL,
+    duration_days          INTEGER     NOT NULL CHECK (duration_days > 0),
+    price_rub              INTEGER     NOT NULL DEFAULT 0,
+    price_stars            INTEGER     NOT NULL DEFAULT 0,
+    price_crypto           INTEGER     NOT NULL DEFAULT 0,
+    traffic_limit_gb       INTEGER     NOT NULL DEFAULT 0,
+    traffic_reset_strategy VARCHAR(20) NOT NULL DEFAULT 'MONTH',
+    internal_squads        UUID[],
+    external_squad         UUID,
+    device_limit           INTEGER,
+    sort_order             INTEGER     NOT NULL DEFAULT 0,
+    active                 BOOLEAN     NOT NULL DEFAULT TRUE,
+    created_at             TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_tariff_active_sort ON tariff (sort_order, id) WHERE active;
+
+ALTER TABLE purchase
+    ADD COLUMN tariff_id BIGINT REFERENCES tariff (id) ON DELETE SET NULL;
+
+-- Promo codes are now restricted to tariffs instead of subscription lengths. Codes that were
+-- restricted by length cannot be mapped automatically, so they are disabled for review.
+ALTER TABLE promo_code
+    ADD COLUMN tariff_ids BIGINT[];
+
+UPDATE promo_code
+SET active = FALSE
+WHERE cardinality(months) > 0;
+
+ALTER TABLE promo_code
+    DROP COLUMN months;
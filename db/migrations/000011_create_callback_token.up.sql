@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS callback_token
+(
+    token       VARCHAR(32) PRIMARY KEY,
+    telegram_id BIGINT      NOT NULL,
+    action      VARCHAR(32) NOT NULL,
+    payload     JSONB       NOT NULL DEFAULT '{}',
+    expires_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_callback_token_expires_at ON callback_token (expires_at);
@@ -0,0 +1,6 @@
+UPDATE purchase SET status = 'paid' WHERE status = 'refunded';
+
+ALTER TABLE purchase
+    DROP COLUMN telegram_charge_id,
+    DROP COLUMN moynalog_receipt_id,
+    DROP COLUMN refunded_at;
@@ -0,0 +1,4 @@
+ALTER TABLE purchase
+    ADD COLUMN telegram_charge_id  VARCHAR(255),
+    ADD COLUMN moynalog_receipt_id VARCHAR(64),
+    ADD COLUMN refunded_at         TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS provisioning_job
+(
+    purchase_id     BIGINT PRIMARY KEY REFERENCES purchase (id) ON DELETE CASCADE,
+    username        VARCHAR(255),
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error      TEXT,
+    alerted_at      TIMESTAMP WITH TIME ZONE,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_provisioning_job_next_attempt_at ON provisioning_job (next_attempt_at);
+
+-- Purchases left in processing were confirmed as paid before provisioning stopped.
+INSERT INTO provisioning_job (purchase_id)
+SELECT id
+FROM purchase
+WHERE status = 'processing'
+ON CONFLICT DO NOTHING;
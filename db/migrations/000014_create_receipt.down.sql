@@ -0,0 +1,10 @@
+ALTER TABLE purchase
+    ADD COLUMN moynalog_receipt_id VARCHAR(64);
+
+UPDATE purchase p
+SET moynalog_receipt_id = r.receipt_uuid
+FROM receipt r
+WHERE r.purchase_id = p.id
+  AND r.status = 'sent';
+
+DROP TABLE IF EXISTS receipt;
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS receipt
+(
+    id              BIGSERIAL PRIMARY KEY,
+    purchase_id     BIGINT         NOT NULL UNIQUE REFERENCES purchase (id) ON DELETE CASCADE,
+    amount          DECIMAL(20, 8) NOT NULL,
+    comment         TEXT           NOT NULL,
+    status          VARCHAR(20)    NOT NULL DEFAULT 'pending',
+    receipt_uuid    VARCHAR(64),
+    attempts        INTEGER        NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    last_error      TEXT,
+    alerted_at      TIMESTAMP WITH TIME ZONE,
+    created_at      TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    sent_at         TIMESTAMP WITH TIME ZONE,
+    cancelled_at    TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_receipt_due ON receipt (next_attempt_at) WHERE status IN ('pending', 'cancel_pending');
+
+INSERT INTO receipt (purchase_id, amount, comment, status, receipt_uuid, sent_at)
+SELECT id, amount, 'Подписка', 'sent', moynalog_receipt_id, paid_at
+FROM purchase
+WHERE moynalog_receipt_id IS NOT NULL;
+
+ALTER TABLE purchase
+    DROP COLUMN moynalog_receipt_id;
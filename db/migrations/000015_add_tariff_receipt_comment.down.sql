@@ -0,0 +1,2 @@
+ALTER TABLE tariff
+    DROP COLUMN receipt_comment;
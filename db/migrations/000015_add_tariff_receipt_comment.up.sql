@@ -0,0 +1,2 @@
+ALTER TABLE tariff
+    ADD COLUMN receipt_comment TEXT;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS staff
+(
+    telegram_id BIGINT PRIMARY KEY,
+    role        VARCHAR(20) NOT NULL,
+    added_by    BIGINT,
+    created_at  TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_purchase_paid_at;
+
+ALTER TABLE customer
+    DROP COLUMN trial_activated_at;
@@ -0,0 +1,4 @@
+ALTER TABLE customer
+    ADD COLUMN trial_activated_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS idx_purchase_paid_at ON purchase (paid_at) WHERE status = 'paid';
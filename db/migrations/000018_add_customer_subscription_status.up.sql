@@ -0,0 +1,2 @@
+ALTER TABLE customer
+    ADD COLUMN subscription_status VARCHAR(20);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS gift_code;
+
+ALTER TABLE purchase
+    DROP COLUMN gift;
@@ -0,0 +1,19 @@
+ALTER TABLE purchase
+    ADD COLUMN gift BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Buyer and recipient are kept as Telegram IDs, so the code outlives customers removed by /sync.
+CREATE TABLE IF NOT EXISTS gift_code
+(
+    id                   BIGSERIAL PRIMARY KEY,
+    code                 VARCHAR(32) NOT NULL UNIQUE,
+    purchase_id          BIGINT UNIQUE REFERENCES purchase (id) ON DELETE SET NULL,
+    buyer_telegram_id    BIGINT      NOT NULL,
+    tariff_id            BIGINT REFERENCES tariff (id) ON DELETE SET NULL,
+    days                 INTEGER     NOT NULL,
+    created_at           TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    expires_at           TIMESTAMP WITH TIME ZONE NOT NULL,
+    redeemed_at          TIMESTAMP WITH TIME ZONE,
+    redeemed_telegram_id BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_gift_code_buyer_telegram_id ON gift_code (buyer_telegram_id);
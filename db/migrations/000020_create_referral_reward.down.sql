@@ -0,0 +1,8 @@
+ALTER TABLE referral
+    ADD COLUMN bonus_granted BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE referral
+SET bonus_granted = TRUE
+WHERE id IN (SELECT referral_id FROM referral_reward WHERE kind = 'referrer');
+
+DROP TABLE IF EXISTS referral_reward;
@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS referral_reward
+(
+    id                    BIGSERIAL PRIMARY KEY,
+    referral_id           BIGINT REFERENCES referral (id) ON DELETE SET NULL,
+    recipient_telegram_id BIGINT      NOT NULL,
+    kind                  VARCHAR(20) NOT NULL,
+    purchase_id           BIGINT REFERENCES purchase (id) ON DELETE SET NULL,
+    days                  INTEGER     NOT NULL,
+    tier                  INTEGER,
+    created_at            TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_referral_reward_recipient ON referral_reward (recipient_telegram_id);
+CREATE INDEX IF NOT EXISTS idx_referral_reward_referral_id ON referral_reward (referral_id);
+-- A purchase earns each kind of reward once, and each tier is reached once.
+CREATE UNIQUE INDEX IF NOT EXISTS idx_referral_reward_purchase_kind ON referral_reward (purchase_id, kind) WHERE purchase_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_referral_reward_tier ON referral_reward (recipient_telegram_id, tier) WHERE kind = 'tier';
+
+-- Bonuses granted before the ledger existed. Their length was REFERRAL_DAYS at that time and is not known here.
+INSERT INTO referral_reward (referral_id, recipient_telegram_id, kind, days, created_at)
+SELECT id, referrer_id, 'referrer', 0, used_at
+FROM referral
+WHERE bonus_granted;
+
+-- Referees who already paid have had their first purchase and must not get the welcome bonus later.
+INSERT INTO referral_reward (referral_id, recipient_telegram_id, kind, days, created_at)
+SELECT r.id, r.referee_id, 'referee', 0, r.used_at
+FROM referral r
+WHERE EXISTS (SELECT 1
+              FROM purchase p
+                       JOIN customer c ON c.id = p.customer_id
+              WHERE c.telegram_id = r.referee_id
+                AND p.status = 'paid');
+
+ALTER TABLE referral
+    DROP COLUMN bonus_granted;
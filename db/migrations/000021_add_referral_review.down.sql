@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_referral_referrer_used_at;
+DROP INDEX IF EXISTS idx_referral_flagged;
+
+ALTER TABLE referral
+    DROP COLUMN reviewed_by,
+    DROP COLUMN reviewed_at,
+    DROP COLUMN pattern,
+    DROP COLUMN flag_reason,
+    DROP COLUMN status;
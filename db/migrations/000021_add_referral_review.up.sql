@@ -0,0 +1,9 @@
+ALTER TABLE referral
+    ADD COLUMN status      VARCHAR(20) NOT NULL DEFAULT 'accepted',
+    ADD COLUMN flag_reason VARCHAR(32),
+    ADD COLUMN pattern     VARCHAR(64),
+    ADD COLUMN reviewed_at TIMESTAMP WITH TIME ZONE,
+    ADD COLUMN reviewed_by BIGINT;
+
+CREATE INDEX IF NOT EXISTS idx_referral_flagged ON referral (used_at) WHERE status = 'flagged';
+CREATE INDEX IF NOT EXISTS idx_referral_referrer_used_at ON referral (referrer_id, used_at);
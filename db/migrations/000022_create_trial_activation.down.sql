@@ -0,0 +1,9 @@
+ALTER TABLE customer
+    ADD COLUMN trial_activated_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE customer c
+SET trial_activated_at = t.activated_at
+FROM trial_activation t
+WHERE t.telegram_id = c.telegram_id;
+
+DROP TABLE IF EXISTS trial_activation;
@@ -0,0 +1,28 @@
+-- Keyed by telegram id and not referencing customer, so activations survive customers removed and re-created by /sync.
+CREATE TABLE IF NOT EXISTS trial_activation
+(
+    telegram_id  BIGINT PRIMARY KEY,
+    activated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- granted_by is the staff member who granted the trial, NULL when the customer activated it.
+    granted_by   BIGINT
+);
+
+CREATE INDEX IF NOT EXISTS idx_trial_activation_activated_at ON trial_activation (activated_at);
+
+INSERT INTO trial_activation (telegram_id, activated_at)
+SELECT telegram_id, trial_activated_at
+FROM customer
+WHERE trial_activated_at IS NOT NULL
+ON CONFLICT DO NOTHING;
+
+-- Activations were not recorded before trial_activated_at existed, so every customer who already had a subscription
+-- or a purchase is treated as having used the trial. Otherwise expired former trial users and payers could take one.
+INSERT INTO trial_activation (telegram_id, activated_at)
+SELECT c.telegram_id, COALESCE(c.created_at, CURRENT_TIMESTAMP)
+FROM customer c
+WHERE c.subscription_link IS NOT NULL
+   OR EXISTS (SELECT 1 FROM purchase p WHERE p.customer_id = c.id AND p.status IN ('paid', 'refunded'))
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE customer
+    DROP COLUMN IF EXISTS trial_activated_at;
@@ -0,0 +1,2 @@
+ALTER TABLE trial_activation
+    DROP COLUMN revoked_at;
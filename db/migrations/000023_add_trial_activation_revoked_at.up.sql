@@ -0,0 +1,3 @@
+-- Set when the trial was disabled because the user left the channel required by REQUIRED_CHANNEL_ID.
+ALTER TABLE trial_activation
+    ADD COLUMN revoked_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,4 @@
+-- The subscription expiry set by the trial. While customer.expire_at still equals it, no gift, referral reward, admin
+-- change or purchase extended the subscription and it is still the trial.
+ALTER TABLE trial_activation
+    ADD COLUMN expire_at TIMESTAMP WITH TIME ZONE;
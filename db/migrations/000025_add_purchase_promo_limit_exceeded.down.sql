@@ -0,0 +1,2 @@
+ALTER TABLE purchase
+    DROP COLUMN promo_limit_exceeded;
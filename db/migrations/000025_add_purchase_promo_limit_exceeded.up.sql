@@ -0,0 +1,4 @@
+-- Set when a purchase was paid after its promo code had run out of uses, for example an invoice paid after its
+-- reservation expired. The purchase is still provisioned; staff decide whether to refund it.
+ALTER TABLE purchase
+    ADD COLUMN promo_limit_exceeded BOOLEAN NOT NULL DEFAULT FALSE;
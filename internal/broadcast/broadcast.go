@@ -0,0 +1,255 @@
+package broadcast
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/translation"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	recipientBatchSize = 100
+	maxSendAttempts    = 5
+)
+
+type broadcastRepository interface {
+	FindById(ctx context.Context, id int64) (*database.Broadcast, error)
+	FindByStatus(ctx context.Context, status database.BroadcastStatus) ([]database.Broadcast, error)
+	FindPendingRecipients(ctx context.Context, broadcastID int64, limit int) ([]int64, error)
+	MarkRecipient(ctx context.Context, broadcastID int64, telegramID int64, status database.RecipientStatus, sendErr string) error
+	Stats(ctx context.Context, broadcastID int64) (*database.BroadcastStats, error)
+	Finish(ctx context.Context, id int64) error
+}
+
+type messageSender interface {
+	SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error)
+	SendPhoto(ctx context.Context, params *bot.SendPhotoParams) (*models.Message, error)
+}
+
+// Service delivers broadcasts one at a time so the global send rate stays under the configured limit.
+// Every recipient gets a single message, so the per-chat limit is only reached through 429 responses,
+// which are retried after the delay Telegram asks for.
+type Service struct {
+	repository broadcastRepository
+	sender     messageSender
+	tm         *translation.Manager
+	lang       string
+	interval   time.Duration
+	queue      chan int64
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+func NewService(repository broadcastRepository, sender messageSender, tm *translation.Manager, lang string, ratePerSecond int) *Service {
+	return &Service{
+		repository: repository,
+		sender:     sender,
+		tm:         tm,
+		lang:       lang,
+		interval:   time.Second / time.Duration(ratePerSecond),
+		queue:      make(chan int64, 100),
+		sleep:      sleepContext,
+	}
+}
+
+// Enqueue schedules a started broadcast for delivery.
+func (s *Service) Enqueue(id int64) {
+	s.queue <- id
+}
+
+// Send delivers the broadcast content to a single chat, e.g. as a preview for the admin.
+func (s *Service) Send(ctx context.Context, b *database.Broadcast, chatID int64) error {
+	m, err := newMessage(b)
+	if err != nil {
+		return err
+	}
+	return m.send(ctx, s.sender, chatID)
+}
+
+// Run resumes broadcasts interrupted by a restart and then delivers queued ones until ctx is done.
+func (s *Service) Run(ctx context.Context) {
+	running, err := s.repository.FindByStatus(ctx, database.BroadcastStatusRunning)
+	if err != nil {
+		slog.Error("Error finding running broadcasts", "error", err)
+	}
+	for _, b := range running {
+		slog.Info("Resuming broadcast", "broadcast_id", b.ID)
+		s.deliver(ctx, b.ID)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			s.deliver(ctx, id)
+		}
+	}
+}
+
+func (s *Service) deliver(ctx context.Context, id int64) {
+	b, err := s.repository.FindById(ctx, id)
+	if err != nil {
+		slog.Error("Error finding broadcast", "broadcast_id", id, "error", err)
+		return
+	}
+	if b == nil || b.Status != database.BroadcastStatusRunning {
+		return
+	}
+
+	message, err := newMessage(b)
+	if err != nil {
+		slog.Error("Error decoding broadcast", "broadcast_id", id, "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		recipients, err := s.repository.FindPendingRecipients(ctx, id, recipientBatchSize)
+		if err != nil {
+			slog.Error("Error finding broadcast recipients", "broadcast_id", id, "error", err)
+			return
+		}
+		if len(recipients) == 0 {
+			break
+		}
+
+		for _, telegramID := range recipients {
+			select {
+			case <-ctx.Done():
+				// Pending recipients are picked up again by Run after a restart.
+				return
+			case <-ticker.C:
+			}
+
+			status, sendErr := s.send(ctx, message, telegramID)
+			if ctx.Err() != nil {
+				return
+			}
+			if status != database.RecipientStatusSent {
+				slog.Warn("Broadcast message not delivered", "broadcast_id", id, "telegram_id", utils.MaskHalfInt64(telegramID), "status", status, "error", sendErr)
+			}
+			if err := s.repository.MarkRecipient(ctx, id, telegramID, status, sendErr); err != nil {
+				slog.Error("Error updating broadcast recipient", "broadcast_id", id, "error", err)
+				return
+			}
+		}
+	}
+
+	if err := s.repository.Finish(ctx, id); err != nil {
+		slog.Error("Error finishing broadcast", "broadcast_id", id, "error", err)
+		return
+	}
+	s.report(ctx, b)
+}
+
+// send delivers the message to one chat and classifies the outcome.
+func (s *Service) send(ctx context.Context, m *message, chatID int64) (database.RecipientStatus, string) {
+	var err error
+	for attempt := 0; attempt < maxSendAttempts; attempt++ {
+		err = m.send(ctx, s.sender, chatID)
+		if err == nil {
+			return database.RecipientStatusSent, ""
+		}
+
+		var tooMany *bot.TooManyRequestsError
+		if !errors.As(err, &tooMany) {
+			break
+		}
+		if err := s.sleep(ctx, time.Duration(tooMany.RetryAfter)*time.Second); err != nil {
+			return database.RecipientStatusFailed, err.Error()
+		}
+	}
+
+	if errors.Is(err, bot.ErrorForbidden) {
+		return database.RecipientStatusBlocked, err.Error()
+	}
+	return database.RecipientStatusFailed, err.Error()
+}
+
+func (s *Service) report(ctx context.Context, b *database.Broadcast) {
+	stats, err := s.repository.Stats(ctx, b.ID)
+	if err != nil {
+		slog.Error("Error getting broadcast stats", "broadcast_id", b.ID, "error", err)
+		return
+	}
+
+	slog.Info("Broadcast finished", "broadcast_id", b.ID, "delivered", stats.Delivered, "failed", stats.Failed, "blocked", stats.Blocked)
+	_, err = s.sender.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    b.AdminChatID,
+		ParseMode: models.ParseModeHTML,
+		Text:      fmt.Sprintf(s.tm.GetText(s.lang, "broadcast_finished"), b.ID, stats.Delivered, stats.Failed, stats.Blocked),
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast report", "broadcast_id", b.ID, "error", err)
+	}
+}
+
+type message struct {
+	text     string
+	entities []models.MessageEntity
+	photo    string
+	markup   models.ReplyMarkup
+}
+
+func newMessage(b *database.Broadcast) (*message, error) {
+	m := &message{text: b.Text}
+	if b.PhotoFileID != nil {
+		m.photo = *b.PhotoFileID
+	}
+	if len(b.Entities) > 0 {
+		if err := json.Unmarshal(b.Entities, &m.entities); err != nil {
+			return nil, fmt.Errorf("failed to decode entities: %w", err)
+		}
+	}
+	if len(b.Buttons) > 0 {
+		var keyboard [][]models.InlineKeyboardButton
+		if err := json.Unmarshal(b.Buttons, &keyboard); err != nil {
+			return nil, fmt.Errorf("failed to decode buttons: %w", err)
+		}
+		if len(keyboard) > 0 {
+			m.markup = models.InlineKeyboardMarkup{InlineKeyboard: keyboard}
+		}
+	}
+	return m, nil
+}
+
+func (m *message) send(ctx context.Context, sender messageSender, chatID int64) error {
+	if m.photo != "" {
+		_, err := sender.SendPhoto(ctx, &bot.SendPhotoParams{
+			ChatID:          chatID,
+			Photo:           &models.InputFileString{Data: m.photo},
+			Caption:         m.text,
+			CaptionEntities: m.entities,
+			ReplyMarkup:     m.markup,
+		})
+		return err
+	}
+	_, err := sender.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		Text:        m.text,
+		Entities:    m.entities,
+		ReplyMarkup: m.markup,
+	})
+	return err
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,208 @@
+package broadcast
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/translation"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type fakeRepository struct {
+	mu         sync.Mutex
+	broadcast  database.Broadcast
+	recipients map[int64]database.RecipientStatus
+}
+
+func newFakeRepository(status database.BroadcastStatus, recipients ...int64) *fakeRepository {
+	repo := &fakeRepository{
+		broadcast:  database.Broadcast{ID: 1, AdminChatID: 42, Text: "hello", Status: status},
+		recipients: map[int64]database.RecipientStatus{},
+	}
+	for _, id := range recipients {
+		repo.recipients[id] = database.RecipientStatusPending
+	}
+	return repo
+}
+
+func (f *fakeRepository) FindById(_ context.Context, id int64) (*database.Broadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if id != f.broadcast.ID {
+		return nil, nil
+	}
+	b := f.broadcast
+	return &b, nil
+}
+
+func (f *fakeRepository) FindByStatus(_ context.Context, status database.BroadcastStatus) ([]database.Broadcast, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.broadcast.Status != status {
+		return nil, nil
+	}
+	return []database.Broadcast{f.broadcast}, nil
+}
+
+func (f *fakeRepository) FindPendingRecipients(_ context.Context, _ int64, limit int) ([]int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var ids []int64
+	for id, status := range f.recipients {
+		if status == database.RecipientStatusPending && len(ids) < limit {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (f *fakeRepository) MarkRecipient(_ context.Context, _ int64, telegramID int64, status database.RecipientStatus, _ string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recipients[telegramID] = status
+	return nil
+}
+
+func (f *fakeRepository) Stats(_ context.Context, _ int64) (*database.BroadcastStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stats := &database.BroadcastStats{}
+	for _, status := range f.recipients {
+		switch status {
+		case database.RecipientStatusSent:
+			stats.Delivered++
+		case database.RecipientStatusFailed:
+			stats.Failed++
+		case database.RecipientStatusBlocked:
+			stats.Blocked++
+		}
+	}
+	return stats, nil
+}
+
+func (f *fakeRepository) Finish(_ context.Context, _ int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.broadcast.Status = database.BroadcastStatusDone
+	return nil
+}
+
+// fakeSender answers with a scripted error per chat; rate limited chats succeed on the next attempt.
+type fakeSender struct {
+	mu       sync.Mutex
+	errors   map[int64]error
+	attempts map[int64]int
+	reports  []string
+}
+
+func (f *fakeSender) SendMessage(_ context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	chatID := params.ChatID.(int64)
+	if chatID == 42 {
+		f.reports = append(f.reports, params.Text)
+		return &models.Message{}, nil
+	}
+	f.attempts[chatID]++
+	err := f.errors[chatID]
+	if bot.IsTooManyRequestsError(err) {
+		delete(f.errors, chatID)
+	}
+	return &models.Message{}, err
+}
+
+func (f *fakeSender) SendPhoto(_ context.Context, _ *bot.SendPhotoParams) (*models.Message, error) {
+	return nil, errors.New("unexpected photo")
+}
+
+func newTestService(repo *fakeRepository, sender *fakeSender) *Service {
+	s := NewService(repo, sender, translation.GetInstance(), "en", 1000)
+	s.sleep = func(context.Context, time.Duration) error { return nil }
+	return s
+}
+
+func TestDeliverClassifiesResults(t *testing.T) {
+	repo := newFakeRepository(database.BroadcastStatusRunning, 1, 2, 3, 4)
+	sender := &fakeSender{
+		errors: map[int64]error{
+			2: fmt.Errorf("%w, %s", bot.ErrorForbidden, "bot was blocked by the user"),
+			3: fmt.Errorf("%w, %s", bot.ErrorBadRequest, "chat not found"),
+			4: &bot.TooManyRequestsError{Message: "too many requests", RetryAfter: 1},
+		},
+		attempts: map[int64]int{},
+	}
+
+	newTestService(repo, sender).deliver(context.Background(), 1)
+
+	expected := map[int64]database.RecipientStatus{
+		1: database.RecipientStatusSent,
+		2: database.RecipientStatusBlocked,
+		3: database.RecipientStatusFailed,
+		4: database.RecipientStatusSent,
+	}
+	for id, status := range expected {
+		if repo.recipients[id] != status {
+			t.Errorf("recipient %d: expected %s, got %s", id, status, repo.recipients[id])
+		}
+	}
+	if sender.attempts[4] != 2 {
+		t.Errorf("expected rate limited message to be retried once, got %d attempts", sender.attempts[4])
+	}
+	if repo.broadcast.Status != database.BroadcastStatusDone {
+		t.Errorf("expected broadcast to be done, got %s", repo.broadcast.Status)
+	}
+	if len(sender.reports) != 1 {
+		t.Fatalf("expected one report to the admin, got %d", len(sender.reports))
+	}
+}
+
+func TestDeliverSkipsNotRunning(t *testing.T) {
+	repo := newFakeRepository(database.BroadcastStatusDraft, 1)
+	sender := &fakeSender{attempts: map[int64]int{}}
+
+	newTestService(repo, sender).deliver(context.Background(), 1)
+
+	if sender.attempts[1] != 0 {
+		t.Fatal("draft broadcast must not be delivered")
+	}
+}
+
+func TestRunResumesRunningBroadcast(t *testing.T) {
+	repo := newFakeRepository(database.BroadcastStatusRunning, 1, 2)
+	repo.recipients[1] = database.RecipientStatusSent
+	sender := &fakeSender{attempts: map[int64]int{}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		newTestService(repo, sender).Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.After(2 * time.Second)
+	for {
+		repo.mu.Lock()
+		status := repo.broadcast.Status
+		repo.mu.Unlock()
+		if status == database.BroadcastStatusDone {
+			break
+		}
+		select {
+		case <-deadline:
+			t.Fatal("broadcast was not resumed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	cancel()
+	<-done
+
+	if sender.attempts[1] != 0 || sender.attempts[2] != 1 {
+		t.Fatalf("expected only the pending recipient to be sent, got %v", sender.attempts)
+	}
+}
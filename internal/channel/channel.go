@@ -0,0 +1,124 @@
+package channel
+
+import (
+	"context"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/cache"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// recheckInterval spaces the getChatMember calls of a periodic re-check to stay well under the Bot API rate limit.
+const recheckInterval = 100 * time.Millisecond
+
+type memberGetter interface {
+	GetChatMember(ctx context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error)
+}
+
+type activeTrialFinder interface {
+	FindActiveTrials(ctx context.Context, now time.Time) ([]database.Customer, error)
+}
+
+type trialRevoker interface {
+	RevokeTrial(ctx context.Context, customer *database.Customer) (bool, error)
+}
+
+// Service checks that users joined the channel required by REQUIRED_CHANNEL_ID. Results are cached, so the gate
+// only calls getChatMember once per user within the cache TTL.
+type Service struct {
+	members   memberGetter
+	chatID    string
+	cache     *cache.Cache
+	customers activeTrialFinder
+	trials    trialRevoker
+}
+
+func NewService(members memberGetter, chatID string, ttl time.Duration, customers activeTrialFinder, trials trialRevoker) *Service {
+	return &Service{
+		members:   members,
+		chatID:    chatID,
+		cache:     cache.NewCache(ttl),
+		customers: customers,
+		trials:    trials,
+	}
+}
+
+// IsMember reports whether the user joined the channel, using the cached result when there is one.
+func (s *Service) IsMember(ctx context.Context, telegramID int64) (bool, error) {
+	if v, ok := s.cache.Get(telegramID); ok {
+		return v == 1, nil
+	}
+	return s.Check(ctx, telegramID)
+}
+
+// Check asks Telegram whether the user joined the channel and caches the answer.
+func (s *Service) Check(ctx context.Context, telegramID int64) (bool, error) {
+	member, err := s.members.GetChatMember(ctx, &bot.GetChatMemberParams{ChatID: s.chatID, UserID: telegramID})
+	if err != nil {
+		return false, err
+	}
+
+	joined := isMember(member)
+	v := 0
+	if joined {
+		v = 1
+	}
+	s.cache.Set(telegramID, v)
+	return joined, nil
+}
+
+// RevokeLeftTrials re-checks the customers with a running trial and revokes the trial of those who left the channel.
+func (s *Service) RevokeLeftTrials(ctx context.Context) {
+	customers, err := s.customers.FindActiveTrials(ctx, time.Now())
+	if err != nil {
+		slog.Error("Error finding active trials", "error", err)
+		return
+	}
+
+	ticker := time.NewTicker(recheckInterval)
+	defer ticker.Stop()
+
+	revoked := 0
+	for i := range customers {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		customer := &customers[i]
+		joined, err := s.Check(ctx, customer.TelegramID)
+		if err != nil {
+			slog.Error("Error checking channel membership", "telegramId", utils.MaskHalfInt64(customer.TelegramID), "error", err)
+			continue
+		}
+		if joined {
+			continue
+		}
+		ok, err := s.trials.RevokeTrial(ctx, customer)
+		if err != nil {
+			slog.Error("Error revoking trial", "customer_id", utils.MaskHalfInt64(customer.ID), "error", err)
+			continue
+		}
+		if ok {
+			revoked++
+		}
+	}
+	slog.Info("channel membership re-checked", "trials", len(customers), "revoked", revoked)
+}
+
+// isMember treats restricted users as members only while they are still in the channel.
+func isMember(member *models.ChatMember) bool {
+	switch member.Type {
+	case models.ChatMemberTypeOwner, models.ChatMemberTypeAdministrator, models.ChatMemberTypeMember:
+		return true
+	case models.ChatMemberTypeRestricted:
+		return member.Restricted != nil && member.Restricted.IsMember
+	default:
+		return false
+	}
+}
@@ -0,0 +1,104 @@
+package channel
+
+import (
+	"context"
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+type fakeMembers struct {
+	status map[int64]models.ChatMemberType
+	calls  int
+}
+
+func (f *fakeMembers) GetChatMember(_ context.Context, params *bot.GetChatMemberParams) (*models.ChatMember, error) {
+	f.calls++
+	status, ok := f.status[params.UserID]
+	if !ok {
+		status = models.ChatMemberTypeLeft
+	}
+	return &models.ChatMember{Type: status}, nil
+}
+
+type fakeTrials struct {
+	customers []database.Customer
+	revoked   []int64
+}
+
+func (f *fakeTrials) FindActiveTrials(context.Context, time.Time) ([]database.Customer, error) {
+	return f.customers, nil
+}
+
+func (f *fakeTrials) RevokeTrial(_ context.Context, customer *database.Customer) (bool, error) {
+	f.revoked = append(f.revoked, customer.TelegramID)
+	return true, nil
+}
+
+func TestIsMember(t *testing.T) {
+	tests := []struct {
+		name   string
+		member *models.ChatMember
+		want   bool
+	}{
+		{name: "member", member: &models.ChatMember{Type: models.ChatMemberTypeMember}, want: true},
+		{name: "owner", member: &models.ChatMember{Type: models.ChatMemberTypeOwner}, want: true},
+		{name: "left", member: &models.ChatMember{Type: models.ChatMemberTypeLeft}, want: false},
+		{name: "banned", member: &models.ChatMember{Type: models.ChatMemberTypeBanned}, want: false},
+		{name: "restricted in channel", member: &models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{IsMember: true}}, want: true},
+		{name: "restricted after leaving", member: &models.ChatMember{Type: models.ChatMemberTypeRestricted, Restricted: &models.ChatMemberRestricted{}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isMember(tt.member); got != tt.want {
+				t.Fatalf("isMember() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsMemberUsesCache(t *testing.T) {
+	members := &fakeMembers{status: map[int64]models.ChatMemberType{7: models.ChatMemberTypeMember}}
+	s := NewService(members, "@channel", time.Minute, &fakeTrials{}, &fakeTrials{})
+
+	for range 2 {
+		joined, err := s.IsMember(context.Background(), 7)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !joined {
+			t.Fatal("expected the user to be a member")
+		}
+	}
+	if members.calls != 1 {
+		t.Fatalf("expected one getChatMember call, got %d", members.calls)
+	}
+
+	// Check bypasses the cache, so a user who just left is noticed.
+	members.status[7] = models.ChatMemberTypeLeft
+	joined, err := s.Check(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if joined {
+		t.Fatal("expected the user to have left")
+	}
+	if joined, _ := s.IsMember(context.Background(), 7); joined {
+		t.Fatal("expected the cached result to be updated by Check")
+	}
+}
+
+func TestRevokeLeftTrialsOnlyRevokesUsersWhoLeft(t *testing.T) {
+	members := &fakeMembers{status: map[int64]models.ChatMemberType{1: models.ChatMemberTypeMember}}
+	trials := &fakeTrials{customers: []database.Customer{{ID: 10, TelegramID: 1}, {ID: 20, TelegramID: 2}}}
+	s := NewService(members, "@channel", time.Minute, trials, trials)
+
+	s.RevokeLeftTrials(context.Background())
+
+	if len(trials.revoked) != 1 || trials.revoked[0] != 2 {
+		t.Fatalf("expected only telegram id 2 to be revoked, got %v", trials.revoked)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
@@ -33,15 +35,31 @@ type config struct {
 	isCryptoEnabled                                           bool
 	isTelegramStarsEnabled                                    bool
 	isMoynalogEnabled                                         bool
+	moynalogReceipts                                          map[string]bool
+	moynalogStarsRate                                         float64
+	moynalogReceiptComment                                    string
 	adminTelegramId                                           int64
 	trialDays                                                 int
 	trialRemnawaveTag                                         string
 	squadUUIDs                                                map[uuid.UUID]uuid.UUID
 	referralDays                                              int
+	referralPercent                                           int
+	referralRefereeDays                                       int
+	referralRecurring                                         bool
+	referralTiers                                             []ReferralTier
+	giftCodeValidDays                                         int
+	requiredChannelID, requiredChannelURL                     string
+	requiredChannelForPurchase, requiredChannelRevokeTrial    bool
+	requiredChannelCacheTTL                                   time.Duration
 	miniApp                                                   string
 	enableAutoPayment                                         bool
 	healthCheckPort                                           int
+	metricsPort                                               int
+	broadcastRatePerSecond                                    int
 	tributeWebhookUrl, tributeAPIKey, tributePaymentUrl       string
+	yookasaWebhookUrl                                         string
+	cryptoPayWebhookUrl                                       string
+	remnawaveWebhookUrl, remnawaveWebhookSecret               string
 	isWebAppLinkEnabled                                       bool
 	daysInMonth                                               int
 	externalSquadUUID                                         uuid.UUID
@@ -74,6 +92,20 @@ func DefaultLanguage() string {
 func GetTributeWebHookUrl() string {
 	return conf.tributeWebhookUrl
 }
+func GetYookasaWebHookUrl() string {
+	return conf.yookasaWebhookUrl
+}
+func GetCryptoPayWebHookUrl() string {
+	return conf.cryptoPayWebhookUrl
+}
+func GetRemnawaveWebHookUrl() string {
+	return conf.remnawaveWebhookUrl
+}
+
+// RemnawaveWebhookSecret is WEBHOOK_SECRET_HEADER of the panel, used to check the X-Remnawave-Signature header.
+func RemnawaveWebhookSecret() string {
+	return conf.remnawaveWebhookSecret
+}
 func GetTributeAPIKey() string {
 	return conf.tributeAPIKey
 }
@@ -86,6 +118,37 @@ func GetReferralDays() int {
 	return conf.referralDays
 }
 
+// ReferralTier grants the referrer Days once their paying referrals reach Referrals.
+type ReferralTier struct {
+	Referrals int
+	Days      int
+}
+
+// ReferralPercent is the share of the purchased days granted to the referrer instead of REFERRAL_DAYS. Zero disables it.
+func ReferralPercent() int {
+	return conf.referralPercent
+}
+
+// ReferralRefereeDays is the welcome bonus of the invited customer, granted with their first paid purchase.
+func ReferralRefereeDays() int {
+	return conf.referralRefereeDays
+}
+
+// IsReferralRecurring reports whether the referrer is rewarded for every paid purchase of the referee, not only the first.
+func IsReferralRecurring() bool {
+	return conf.referralRecurring
+}
+
+// ReferralTiers are sorted by the number of referrals.
+func ReferralTiers() []ReferralTier {
+	return conf.referralTiers
+}
+
+// IsReferralEnabled reports whether any referral reward is configured.
+func IsReferralEnabled() bool {
+	return conf.referralDays > 0 || conf.referralPercent > 0 || conf.referralRefereeDays > 0 || len(conf.referralTiers) > 0
+}
+
 func GetMiniAppURL() string {
 	return conf.miniApp
 }
@@ -117,7 +180,38 @@ func TrialExternalSquadUUID() uuid.UUID {
 }
 
 func TrialTrafficLimit() int {
-	return conf.trialTrafficLimit * bytesInGigabyte
+	return conf.trialTrafficLimit * BytesInGigabyte
+}
+
+// GiftCodeValidDays is how long a gift code can be redeemed after the gift was paid.
+func GiftCodeValidDays() int {
+	return conf.giftCodeValidDays
+}
+
+// RequiredChannelID is the @username or numeric id of the channel users must join before activating the trial,
+// empty when no channel is required. The bot must be an administrator of the channel to check its members.
+func RequiredChannelID() string {
+	return conf.requiredChannelID
+}
+
+// RequiredChannelURL is the link of the subscribe button shown to users who have not joined the required channel.
+func RequiredChannelURL() string {
+	return conf.requiredChannelURL
+}
+
+// IsChannelRequiredForPurchase reports whether purchases also require joining the channel.
+func IsChannelRequiredForPurchase() bool {
+	return conf.requiredChannelForPurchase
+}
+
+// IsChannelTrialRevoked reports whether active trials are disabled when the user leaves the channel.
+func IsChannelTrialRevoked() bool {
+	return conf.requiredChannelRevokeTrial
+}
+
+// RequiredChannelCacheTTL is how long a membership check is reused before Telegram is asked again.
+func RequiredChannelCacheTTL() time.Duration {
+	return conf.requiredChannelCacheTTL
 }
 
 func TrialDays() int {
@@ -147,22 +241,6 @@ func YookasaEmail() string {
 	return conf.yookasaEmail
 }
 
-func Price1() int {
-	return conf.price1
-}
-
-func Price3() int {
-	return conf.price3
-}
-
-func Price6() int {
-	return conf.price6
-}
-
-func Price12() int {
-	return conf.price12
-}
-
 func DaysInMonth() int {
 	return conf.daysInMonth
 }
@@ -171,35 +249,23 @@ func ExternalSquadUUID() uuid.UUID {
 	return conf.externalSquadUUID
 }
 
-func Price(month int) int {
-	switch month {
-	case 1:
-		return conf.price1
-	case 3:
-		return conf.price3
-	case 6:
-		return conf.price6
-	case 12:
-		return conf.price12
-	default:
-		return conf.price1
-	}
+// LegacyPrice is a plan set with PRICE_* and STARS_PRICE_*. These variables are only used to fill
+// an empty tariff catalogue on the first start.
+type LegacyPrice struct {
+	Months     int
+	Price      int
+	StarsPrice int
 }
 
-func StarsPrice(month int) int {
-	switch month {
-	case 1:
-		return conf.starsPrice1
-	case 3:
-		return conf.starsPrice3
-	case 6:
-		return conf.starsPrice6
-	case 12:
-		return conf.starsPrice12
-	default:
-		return conf.starsPrice1
+func LegacyPrices() []LegacyPrice {
+	return []LegacyPrice{
+		{Months: 1, Price: conf.price1, StarsPrice: conf.starsPrice1},
+		{Months: 3, Price: conf.price3, StarsPrice: conf.starsPrice3},
+		{Months: 6, Price: conf.price6, StarsPrice: conf.starsPrice6},
+		{Months: 12, Price: conf.price12, StarsPrice: conf.starsPrice12},
 	}
 }
+
 func TelegramToken() string {
 	return conf.telegramToken
 }
@@ -237,7 +303,7 @@ func YookasaSecretKey() string {
 	return conf.yookasaSecretKey
 }
 func TrafficLimit() int {
-	return conf.trafficLimit * bytesInGigabyte
+	return conf.trafficLimit * BytesInGigabyte
 }
 
 func IsCryptoPayEnabled() bool {
@@ -248,6 +314,10 @@ func IsYookasaEnabled() bool {
 	return conf.isYookasaEnabled
 }
 
+func IsAutoPaymentEnabled() bool {
+	return conf.isYookasaEnabled && conf.enableAutoPayment
+}
+
 func IsTelegramStarsEnabled() bool {
 	return conf.isTelegramStarsEnabled
 }
@@ -264,6 +334,15 @@ func GetHealthCheckPort() int {
 	return conf.healthCheckPort
 }
 
+// GetMetricsPort returns the port of the Prometheus metrics server, or 0 when metrics are not served.
+func GetMetricsPort() int {
+	return conf.metricsPort
+}
+
+func BroadcastRatePerSecond() int {
+	return conf.broadcastRatePerSecond
+}
+
 func IsWepAppLinkEnabled() bool {
 	return conf.isWebAppLinkEnabled
 }
@@ -280,7 +359,7 @@ func TrafficLimitResetStrategy() string {
 	return conf.trafficLimitResetStrategy
 }
 
-const bytesInGigabyte = 1073741824
+const BytesInGigabyte = 1073741824
 
 func MoynalogUrl() string {
 	return conf.moynalogURL
@@ -298,6 +377,21 @@ func IsMoynalogEnabled() bool {
 	return conf.isMoynalogEnabled
 }
 
+// IsMoynalogReceiptEnabled reports whether purchases paid with the invoice type get a Moynalog receipt.
+func IsMoynalogReceiptEnabled(invoiceType string) bool {
+	return conf.moynalogReceipts[invoiceType]
+}
+
+// MoynalogStarsRate is the price of one Telegram Star in RUB. Zero means the RUB price of the tariff is used.
+func MoynalogStarsRate() float64 {
+	return conf.moynalogStarsRate
+}
+
+// MoynalogReceiptComment is the receipt comment template for tariffs without their own.
+func MoynalogReceiptComment() string {
+	return conf.moynalogReceiptComment
+}
+
 func mustEnv(key string) string {
 	v := os.Getenv(key)
 	if v == "" {
@@ -339,6 +433,44 @@ func envBool(key string) bool {
 	return os.Getenv(key) == "true"
 }
 
+// parseReferralTiers parses REFERRAL_TIERS, a comma separated list of referrals:days pairs such as "5:7,10:14".
+func parseReferralTiers(v string) []ReferralTier {
+	var tiers []ReferralTier
+	for _, pair := range strings.Split(v, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		referrals, days, ok := strings.Cut(pair, ":")
+		if !ok {
+			log.Panicf("invalid REFERRAL_TIERS entry %q, expected referrals:days", pair)
+		}
+		tier := ReferralTier{}
+		var err error
+		if tier.Referrals, err = strconv.Atoi(strings.TrimSpace(referrals)); err != nil || tier.Referrals <= 0 {
+			log.Panicf("invalid referrals in REFERRAL_TIERS entry %q", pair)
+		}
+		if tier.Days, err = strconv.Atoi(strings.TrimSpace(days)); err != nil || tier.Days <= 0 {
+			log.Panicf("invalid days in REFERRAL_TIERS entry %q", pair)
+		}
+		tiers = append(tiers, tier)
+	}
+	slices.SortFunc(tiers, func(a, b ReferralTier) int { return a.Referrals - b.Referrals })
+	return tiers
+}
+
+// requiredChannelURL is CHANNEL_URL, or the t.me link of a channel given by @username. A channel given by numeric id
+// has no public link, so CHANNEL_URL is required then.
+func requiredChannelURL(channelID, channelURL string) string {
+	if channelURL != "" {
+		return channelURL
+	}
+	if username, ok := strings.CutPrefix(channelID, "@"); ok {
+		return "https://t.me/" + username
+	}
+	panic("CHANNEL_URL is required when REQUIRED_CHANNEL_ID is a numeric id")
+}
+
 func InitConfig() {
 	if os.Getenv("DISABLE_ENV_FILE") != "true" {
 		if err := godotenv.Load(".env"); err != nil {
@@ -386,14 +518,24 @@ func InitConfig() {
 
 	conf.healthCheckPort = envIntDefault("HEALTH_CHECK_PORT", 8080)
 
+	conf.metricsPort = envIntDefault("METRICS_PORT", 0)
+	if conf.metricsPort < 0 || (conf.metricsPort != 0 && conf.metricsPort == conf.healthCheckPort) {
+		panic("METRICS_PORT must be a port other than HEALTH_CHECK_PORT")
+	}
+
+	conf.broadcastRatePerSecond = envIntDefault("BROADCAST_RATE_PER_SECOND", 25)
+	if conf.broadcastRatePerSecond <= 0 {
+		panic("BROADCAST_RATE_PER_SECOND must be greater than 0")
+	}
+
 	conf.trialDays = mustEnvInt("TRIAL_DAYS")
 
 	conf.enableAutoPayment = envBool("ENABLE_AUTO_PAYMENT")
 
-	conf.price1 = mustEnvInt("PRICE_1")
-	conf.price3 = mustEnvInt("PRICE_3")
-	conf.price6 = mustEnvInt("PRICE_6")
-	conf.price12 = mustEnvInt("PRICE_12")
+	conf.price1 = envIntDefault("PRICE_1", 0)
+	conf.price3 = envIntDefault("PRICE_3", 0)
+	conf.price6 = envIntDefault("PRICE_6", 0)
+	conf.price12 = envIntDefault("PRICE_12", 0)
 
 	conf.isTelegramStarsEnabled = envBool("TELEGRAM_STARS_ENABLED")
 	if conf.isTelegramStarsEnabled {
@@ -423,12 +565,18 @@ func InitConfig() {
 
 	conf.remnawaveToken = mustEnv("REMNAWAVE_TOKEN")
 
+	conf.remnawaveWebhookUrl = os.Getenv("REMNAWAVE_WEBHOOK_URL")
+	if conf.remnawaveWebhookUrl != "" {
+		conf.remnawaveWebhookSecret = mustEnv("REMNAWAVE_WEBHOOK_SECRET")
+	}
+
 	conf.databaseURL = mustEnv("DATABASE_URL")
 
 	conf.isCryptoEnabled = envBool("CRYPTO_PAY_ENABLED")
 	if conf.isCryptoEnabled {
 		conf.cryptoPayURL = mustEnv("CRYPTO_PAY_URL")
 		conf.cryptoPayToken = mustEnv("CRYPTO_PAY_TOKEN")
+		conf.cryptoPayWebhookUrl = os.Getenv("CRYPTO_PAY_WEBHOOK_URL")
 	}
 
 	conf.isYookasaEnabled = envBool("YOOKASA_ENABLED")
@@ -437,10 +585,26 @@ func InitConfig() {
 		conf.yookasaShopId = mustEnv("YOOKASA_SHOP_ID")
 		conf.yookasaSecretKey = mustEnv("YOOKASA_SECRET_KEY")
 		conf.yookasaEmail = mustEnv("YOOKASA_EMAIL")
+		conf.yookasaWebhookUrl = os.Getenv("YOOKASA_WEBHOOK_URL")
 	}
 
 	conf.trafficLimit = mustEnvInt("TRAFFIC_LIMIT")
 	conf.referralDays = mustEnvInt("REFERRAL_DAYS")
+	conf.referralPercent = envIntDefault("REFERRAL_PERCENT", 0)
+	if conf.referralPercent < 0 || conf.referralPercent > 100 {
+		panic("REFERRAL_PERCENT must be between 0 and 100")
+	}
+	conf.referralRefereeDays = envIntDefault("REFERRAL_REFEREE_DAYS", 0)
+	if conf.referralRefereeDays < 0 {
+		panic("REFERRAL_REFEREE_DAYS must not be negative")
+	}
+	conf.referralRecurring = envBool("REFERRAL_RECURRING")
+	conf.referralTiers = parseReferralTiers(os.Getenv("REFERRAL_TIERS"))
+
+	conf.giftCodeValidDays = envIntDefault("GIFT_CODE_VALID_DAYS", 90)
+	if conf.giftCodeValidDays <= 0 {
+		panic("GIFT_CODE_VALID_DAYS must be greater than 0")
+	}
 
 	conf.serverStatusURL = os.Getenv("SERVER_STATUS_URL")
 	conf.supportURL = os.Getenv("SUPPORT_URL")
@@ -448,6 +612,18 @@ func InitConfig() {
 	conf.channelURL = os.Getenv("CHANNEL_URL")
 	conf.tosURL = os.Getenv("TOS_URL")
 
+	conf.requiredChannelID = os.Getenv("REQUIRED_CHANNEL_ID")
+	if conf.requiredChannelID != "" {
+		conf.requiredChannelURL = requiredChannelURL(conf.requiredChannelID, conf.channelURL)
+		conf.requiredChannelForPurchase = envBool("REQUIRED_CHANNEL_FOR_PURCHASE")
+		conf.requiredChannelRevokeTrial = envBool("REQUIRED_CHANNEL_REVOKE_TRIAL")
+		cacheMinutes := envIntDefault("REQUIRED_CHANNEL_CACHE_MINUTES", 10)
+		if cacheMinutes <= 0 {
+			panic("REQUIRED_CHANNEL_CACHE_MINUTES must be greater than 0")
+		}
+		conf.requiredChannelCacheTTL = time.Duration(cacheMinutes) * time.Minute
+	}
+
 	conf.squadUUIDs = func() map[uuid.UUID]uuid.UUID {
 		v := os.Getenv("SQUAD_UUIDS")
 		if v != "" {
@@ -575,5 +751,18 @@ func InitConfig() {
 		conf.moynalogURL = envStringDefault("MOYNALOG_URL", "https://moynalog.ru/api/v1")
 		conf.moynalogUsername = mustEnv("MOYNALOG_USERNAME")
 		conf.moynalogPassword = mustEnv("MOYNALOG_PASSWORD")
+		conf.moynalogReceipts = map[string]bool{
+			"yookasa":  os.Getenv("MOYNALOG_RECEIPT_YOOKASA") != "false",
+			"crypto":   envBool("MOYNALOG_RECEIPT_CRYPTO"),
+			"telegram": envBool("MOYNALOG_RECEIPT_TELEGRAM"),
+		}
+		if v := os.Getenv("MOYNALOG_STARS_RATE"); v != "" {
+			rate, err := strconv.ParseFloat(v, 64)
+			if err != nil || rate < 0 {
+				log.Panicf("invalid MOYNALOG_STARS_RATE %q", v)
+			}
+			conf.moynalogStarsRate = rate
+		}
+		conf.moynalogReceiptComment = envStringDefault("MOYNALOG_RECEIPT_COMMENT", "Подписка на {days} дн.")
 	}
 }
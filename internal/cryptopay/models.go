@@ -1,6 +1,14 @@
 package cryptopay
 
-import "time"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
 
 type InvoiceRequest struct {
 	CurrencyType   string `json:"currency_type,omitempty"`
@@ -68,3 +76,46 @@ type ResponseListWrapper[T any] struct {
 	Ok     bool                 `json:"ok"`
 	Result ResultListWrapper[T] `json:"result"`
 }
+
+type InvoicePayload struct {
+	PurchaseID int64  `json:"purchaseId"`
+	Username   string `json:"username"`
+}
+
+// Encode returns the payload in the url.Values form attached to invoices.
+func (p InvoicePayload) Encode() string {
+	values := url.Values{}
+	values.Set("purchaseId", strconv.FormatInt(p.PurchaseID, 10))
+	values.Set("username", p.Username)
+	return values.Encode()
+}
+
+// ParseInvoicePayload decodes an invoice payload written either as url.Values or as a JSON object.
+func ParseInvoicePayload(payload string) (InvoicePayload, error) {
+	var result InvoicePayload
+	payload = strings.TrimSpace(payload)
+	if payload == "" {
+		return result, errors.New("empty invoice payload")
+	}
+
+	if strings.HasPrefix(payload, "{") {
+		if err := json.Unmarshal([]byte(payload), &result); err != nil {
+			return result, fmt.Errorf("invalid invoice payload: %w", err)
+		}
+	} else {
+		values, err := url.ParseQuery(payload)
+		if err != nil {
+			return result, fmt.Errorf("invalid invoice payload: %w", err)
+		}
+		result.PurchaseID, err = strconv.ParseInt(values.Get("purchaseId"), 10, 64)
+		if err != nil {
+			return result, fmt.Errorf("invalid purchaseId in invoice payload: %w", err)
+		}
+		result.Username = values.Get("username")
+	}
+
+	if result.PurchaseID <= 0 {
+		return result, errors.New("missing purchaseId in invoice payload")
+	}
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package cryptopay
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const UpdateTypeInvoicePaid = "invoice_paid"
+
+type Update struct {
+	UpdateID    int64           `json:"update_id"`
+	UpdateType  string          `json:"update_type"`
+	RequestDate string          `json:"request_date"`
+	Payload     InvoiceResponse `json:"payload"`
+}
+
+// InvoiceProcessor applies a paid invoice to the purchase it was created for.
+type InvoiceProcessor interface {
+	ProcessCryptoPayInvoice(ctx context.Context, invoice *InvoiceResponse) error
+}
+
+// VerifySignature checks the crypto-pay-api-signature header: HMAC-SHA256 of the body keyed with SHA256 of the API token.
+func VerifySignature(token string, body []byte, signature string) bool {
+	if signature == "" {
+		return false
+	}
+	secret := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func (c *Client) WebHookHandler(processor InvoiceProcessor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*60)
+		defer cancel()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("cryptopay webhook: read body error", "error", err)
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		if !VerifySignature(c.token, body, r.Header.Get("crypto-pay-api-signature")) {
+			slog.Warn("cryptopay webhook: bad signature")
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var update Update
+		if err := json.Unmarshal(body, &update); err != nil {
+			slog.Error("cryptopay webhook: unmarshal error", "error", err)
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		if update.UpdateType != UpdateTypeInvoicePaid {
+			slog.Info("cryptopay webhook: unsupported update", "update_type", update.UpdateType)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if update.Payload.InvoiceID == nil || !update.Payload.IsPaid() {
+			slog.Warn("cryptopay webhook: invoice is not paid", "update_id", update.UpdateID, "status", update.Payload.Status)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		if err := processor.ProcessCryptoPayInvoice(ctx, &update.Payload); err != nil {
+			slog.Error("cryptopay webhook: processing error", "error", err, "invoice_id", *update.Payload.InvoiceID)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
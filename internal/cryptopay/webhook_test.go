@@ -0,0 +1,86 @@
+package cryptopay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func sign(token string, body []byte) string {
+	secret := sha256.Sum256([]byte(token))
+	mac := hmac.New(sha256.New, secret[:])
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"update_id":1,"update_type":"invoice_paid"}`)
+	token := "123:token"
+
+	if !VerifySignature(token, body, sign(token, body)) {
+		t.Error("expected valid signature")
+	}
+	if VerifySignature(token, body, sign("other", body)) {
+		t.Error("expected signature with other token to be rejected")
+	}
+	if VerifySignature(token, []byte(`{}`), sign(token, body)) {
+		t.Error("expected signature for other body to be rejected")
+	}
+	if VerifySignature(token, body, "") {
+		t.Error("expected empty signature to be rejected")
+	}
+}
+
+func TestParseInvoicePayload(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected InvoicePayload
+		wantErr  bool
+	}{
+		{
+			name:     "url values",
+			payload:  "purchaseId=42&username=john_doe",
+			expected: InvoicePayload{PurchaseID: 42, Username: "john_doe"},
+		},
+		{
+			name:     "url values without username",
+			payload:  "purchaseId=42",
+			expected: InvoicePayload{PurchaseID: 42},
+		},
+		{
+			name:     "json",
+			payload:  `{"purchaseId":42,"username":"john_doe"}`,
+			expected: InvoicePayload{PurchaseID: 42, Username: "john_doe"},
+		},
+		{
+			name:     "round trip with special characters",
+			payload:  InvoicePayload{PurchaseID: 7, Username: "a&b=c"}.Encode(),
+			expected: InvoicePayload{PurchaseID: 7, Username: "a&b=c"},
+		},
+		{name: "empty", payload: "", wantErr: true},
+		{name: "no separator", payload: "42", wantErr: true},
+		{name: "missing value", payload: "purchaseId=&username=x", wantErr: true},
+		{name: "negative id", payload: "purchaseId=-1", wantErr: true},
+		{name: "broken json", payload: `{"purchaseId":`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ParseInvoicePayload(tt.payload)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseInvoicePayload(%q) expected error, got %+v", tt.payload, result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseInvoicePayload(%q) unexpected error: %v", tt.payload, err)
+			}
+			if result != tt.expected {
+				t.Errorf("ParseInvoicePayload(%q) = %+v, want %+v", tt.payload, result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,392 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type BroadcastStatus string
+
+const (
+	BroadcastStatusDraft     BroadcastStatus = "draft"
+	BroadcastStatusRunning   BroadcastStatus = "running"
+	BroadcastStatusDone      BroadcastStatus = "done"
+	BroadcastStatusCancelled BroadcastStatus = "cancelled"
+)
+
+type BroadcastSegment string
+
+const (
+	BroadcastSegmentAll       BroadcastSegment = "all"
+	BroadcastSegmentActive    BroadcastSegment = "active"
+	BroadcastSegmentExpired   BroadcastSegment = "expired"
+	BroadcastSegmentTrialOnly BroadcastSegment = "trial"
+	BroadcastSegmentNeverPaid BroadcastSegment = "never_paid"
+)
+
+var BroadcastSegments = []BroadcastSegment{
+	BroadcastSegmentAll,
+	BroadcastSegmentActive,
+	BroadcastSegmentExpired,
+	BroadcastSegmentTrialOnly,
+	BroadcastSegmentNeverPaid,
+}
+
+type RecipientStatus string
+
+const (
+	RecipientStatusPending RecipientStatus = "pending"
+	RecipientStatusSent    RecipientStatus = "sent"
+	RecipientStatusFailed  RecipientStatus = "failed"
+	RecipientStatusBlocked RecipientStatus = "blocked"
+)
+
+type Broadcast struct {
+	ID          int64           `db:"id"`
+	AdminChatID int64           `db:"admin_chat_id"`
+	Segment     *string         `db:"segment"`
+	Text        string          `db:"text"`
+	Entities    []byte          `db:"entities"`
+	PhotoFileID *string         `db:"photo_file_id"`
+	Buttons     []byte          `db:"buttons"`
+	Status      BroadcastStatus `db:"status"`
+	CreatedAt   time.Time       `db:"created_at"`
+	StartedAt   *time.Time      `db:"started_at"`
+	FinishedAt  *time.Time      `db:"finished_at"`
+}
+
+// BroadcastStats holds recipient counts by delivery status.
+type BroadcastStats struct {
+	Pending   int
+	Delivered int
+	Failed    int
+	Blocked   int
+}
+
+var broadcastColumns = []string{"id", "admin_chat_id", "segment", "text", "entities", "photo_file_id", "buttons", "status", "created_at", "started_at", "finished_at"}
+
+func scanBroadcast(row rowScanner, b *Broadcast) error {
+	return row.Scan(&b.ID, &b.AdminChatID, &b.Segment, &b.Text, &b.Entities, &b.PhotoFileID, &b.Buttons, &b.Status, &b.CreatedAt, &b.StartedAt, &b.FinishedAt)
+}
+
+type BroadcastRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewBroadcastRepository(pool *pgxpool.Pool) *BroadcastRepository {
+	return &BroadcastRepository{pool: pool}
+}
+
+func (r *BroadcastRepository) Create(ctx context.Context, b *Broadcast) (int64, error) {
+	query := sq.Insert("broadcast").
+		Columns("admin_chat_id", "text", "entities", "photo_file_id", "buttons", "status").
+		Values(b.AdminChatID, b.Text, b.Entities, b.PhotoFileID, b.Buttons, BroadcastStatusDraft).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build insert broadcast query: %w", err)
+	}
+
+	var id int64
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert broadcast: %w", err)
+	}
+	return id, nil
+}
+
+func (r *BroadcastRepository) FindById(ctx context.Context, id int64) (*Broadcast, error) {
+	query := sq.Select(broadcastColumns...).
+		From("broadcast").
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select broadcast query: %w", err)
+	}
+
+	var b Broadcast
+	if err := scanBroadcast(r.pool.QueryRow(ctx, sql, args...), &b); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query broadcast: %w", err)
+	}
+	return &b, nil
+}
+
+func (r *BroadcastRepository) FindByStatus(ctx context.Context, status BroadcastStatus) ([]Broadcast, error) {
+	query := sq.Select(broadcastColumns...).
+		From("broadcast").
+		Where(sq.Eq{"status": status}).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select broadcasts query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query broadcasts: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Broadcast
+	for rows.Next() {
+		var b Broadcast
+		if err := scanBroadcast(rows, &b); err != nil {
+			return nil, fmt.Errorf("failed to scan broadcast row: %w", err)
+		}
+		list = append(list, b)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating broadcast rows: %w", rows.Err())
+	}
+	return list, nil
+}
+
+func segmentCondition(segment BroadcastSegment) (sq.Sqlizer, error) {
+	neverPaid := sq.Expr("NOT EXISTS (SELECT 1 FROM purchase p WHERE p.customer_id = c.id AND p.status = ?)", PurchaseStatusPaid)
+
+	switch segment {
+	case BroadcastSegmentAll:
+		return sq.Expr("TRUE"), nil
+	case BroadcastSegmentActive:
+		return sq.Expr("c.expire_at > NOW()"), nil
+	case BroadcastSegmentExpired:
+		return sq.Expr("c.expire_at <= NOW()"), nil
+	case BroadcastSegmentTrialOnly:
+		return sq.And{sq.Expr("EXISTS (SELECT 1 FROM trial_activation t WHERE t.telegram_id = c.telegram_id)"), neverPaid}, nil
+	case BroadcastSegmentNeverPaid:
+		return neverPaid, nil
+	default:
+		return nil, fmt.Errorf("unknown broadcast segment: %s", segment)
+	}
+}
+
+// segmentQuery selects the given columns for every non-blocked customer in the segment.
+func segmentQuery(segment BroadcastSegment, columns ...interface{}) (sq.SelectBuilder, error) {
+	cond, err := segmentCondition(segment)
+	if err != nil {
+		return sq.SelectBuilder{}, err
+	}
+	query := sq.Select()
+	for _, column := range columns {
+		query = query.Column(column)
+	}
+	return query.
+		From("customer c").
+		Where(sq.Eq{"c.blocked": false}).
+		Where(cond).
+		PlaceholderFormat(sq.Dollar), nil
+}
+
+func (r *BroadcastRepository) CountSegment(ctx context.Context, segment BroadcastSegment) (int, error) {
+	query, err := segmentQuery(segment, "COUNT(*)")
+	if err != nil {
+		return 0, err
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build count segment query: %w", err)
+	}
+
+	var count int
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count segment: %w", err)
+	}
+	return count, nil
+}
+
+func buildInsertRecipientsQuery(id int64, segment BroadcastSegment) (sq.InsertBuilder, error) {
+	recipients, err := segmentQuery(segment, sq.Expr("?::bigint", id), "c.telegram_id")
+	if err != nil {
+		return sq.InsertBuilder{}, err
+	}
+	return sq.Insert("broadcast_recipient").
+		Columns("broadcast_id", "telegram_id").
+		Select(recipients).
+		Suffix("ON CONFLICT DO NOTHING").
+		PlaceholderFormat(sq.Dollar), nil
+}
+
+// Start snapshots the segment into broadcast_recipient and moves a draft broadcast to running.
+// It returns false if the broadcast is not a draft anymore.
+func (r *BroadcastRepository) Start(ctx context.Context, id int64, segment BroadcastSegment) (bool, error) {
+	insertRecipients, err := buildInsertRecipientsQuery(id, segment)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := sq.Update("broadcast").
+		Set("status", BroadcastStatusRunning).
+		Set("segment", segment).
+		Set("started_at", time.Now()).
+		Where(sq.Eq{"id": id, "status": BroadcastStatusDraft}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build start broadcast query: %w", err)
+	}
+
+	res, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to start broadcast: %w", err)
+	}
+	if res.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	sql, args, err = insertRecipients.ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build insert recipients query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return false, fmt.Errorf("failed to insert broadcast recipients: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+// Cancel discards a draft broadcast. It returns false if the broadcast was already started.
+func (r *BroadcastRepository) Cancel(ctx context.Context, id int64) (bool, error) {
+	return r.transition(ctx, id, BroadcastStatusDraft, BroadcastStatusCancelled)
+}
+
+func (r *BroadcastRepository) Finish(ctx context.Context, id int64) error {
+	_, err := r.transition(ctx, id, BroadcastStatusRunning, BroadcastStatusDone)
+	return err
+}
+
+func (r *BroadcastRepository) transition(ctx context.Context, id int64, from BroadcastStatus, to BroadcastStatus) (bool, error) {
+	sql, args, err := sq.Update("broadcast").
+		Set("status", to).
+		Set("finished_at", time.Now()).
+		Where(sq.Eq{"id": id, "status": from}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build update broadcast query: %w", err)
+	}
+
+	res, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update broadcast status: %w", err)
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func (r *BroadcastRepository) FindPendingRecipients(ctx context.Context, broadcastID int64, limit int) ([]int64, error) {
+	sql, args, err := sq.Select("telegram_id").
+		From("broadcast_recipient").
+		Where(sq.Eq{"broadcast_id": broadcastID, "status": RecipientStatusPending}).
+		OrderBy("telegram_id").
+		Limit(uint64(limit)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select recipients query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan recipient row: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating recipient rows: %w", rows.Err())
+	}
+	return ids, nil
+}
+
+func (r *BroadcastRepository) MarkRecipient(ctx context.Context, broadcastID int64, telegramID int64, status RecipientStatus, sendErr string) error {
+	query := sq.Update("broadcast_recipient").
+		Set("status", status).
+		Set("sent_at", time.Now()).
+		Where(sq.Eq{"broadcast_id": broadcastID, "telegram_id": telegramID}).
+		PlaceholderFormat(sq.Dollar)
+	if sendErr != "" {
+		query = query.Set("error", sendErr)
+	}
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update recipient query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to update recipient: %w", err)
+	}
+	return nil
+}
+
+func (r *BroadcastRepository) Stats(ctx context.Context, broadcastID int64) (*BroadcastStats, error) {
+	sql, args, err := sq.Select("status", "COUNT(*)").
+		From("broadcast_recipient").
+		Where(sq.Eq{"broadcast_id": broadcastID}).
+		GroupBy("status").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build broadcast stats query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query broadcast stats: %w", err)
+	}
+	defer rows.Close()
+
+	stats := &BroadcastStats{}
+	for rows.Next() {
+		var status RecipientStatus
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan broadcast stats row: %w", err)
+		}
+		switch status {
+		case RecipientStatusPending:
+			stats.Pending = count
+		case RecipientStatusSent:
+			stats.Delivered = count
+		case RecipientStatusFailed:
+			stats.Failed = count
+		case RecipientStatusBlocked:
+			stats.Blocked = count
+		}
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating broadcast stats rows: %w", rows.Err())
+	}
+	return stats, nil
+}
@@ -0,0 +1,36 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuildInsertRecipientsQuery(t *testing.T) {
+	builder, err := buildInsertRecipientsQuery(5, BroadcastSegmentTrialOnly)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	if !strings.HasPrefix(sql, "INSERT INTO broadcast_recipient (broadcast_id,telegram_id) SELECT $1::bigint, c.telegram_id FROM customer c") {
+		t.Fatalf("unexpected SQL: %s", sql)
+	}
+	if !strings.Contains(sql, "EXISTS (SELECT 1 FROM trial_activation t WHERE t.telegram_id = c.telegram_id)") || !strings.Contains(sql, "NOT EXISTS (SELECT 1 FROM purchase p WHERE p.customer_id = c.id AND p.status = $3)") {
+		t.Fatalf("expected SQL to select customers with a trial and no paid purchase, got: %s", sql)
+	}
+
+	expectedArgs := []interface{}{int64(5), false, PurchaseStatusPaid}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestSegmentQueryUnknownSegment(t *testing.T) {
+	if _, err := segmentQuery("vip", "c.telegram_id"); err == nil {
+		t.Fatal("expected error for unknown segment")
+	}
+}
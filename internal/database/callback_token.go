@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// CallbackToken is the server-side state behind an inline button. Only the token is sent to Telegram,
+// so the customer cannot change the tariff, payment method or promo code a button refers to.
+type CallbackToken struct {
+	Token      string            `db:"token"`
+	TelegramID int64             `db:"telegram_id"`
+	Action     string            `db:"action"`
+	Payload    map[string]string `db:"payload"`
+	ExpiresAt  time.Time         `db:"expires_at"`
+}
+
+type CallbackTokenRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewCallbackTokenRepository(pool *pgxpool.Pool) *CallbackTokenRepository {
+	return &CallbackTokenRepository{pool: pool}
+}
+
+func buildInsertCallbackTokensQuery(tokens []CallbackToken) (sq.InsertBuilder, error) {
+	query := sq.Insert("callback_token").
+		Columns("token", "telegram_id", "action", "payload", "expires_at").
+		PlaceholderFormat(sq.Dollar)
+
+	for _, t := range tokens {
+		payload, err := json.Marshal(t.Payload)
+		if err != nil {
+			return query, fmt.Errorf("failed to marshal callback payload: %w", err)
+		}
+		query = query.Values(t.Token, t.TelegramID, t.Action, payload, t.ExpiresAt)
+	}
+	return query, nil
+}
+
+// Create stores the tokens of one keyboard in a single insert.
+func (r *CallbackTokenRepository) Create(ctx context.Context, tokens []CallbackToken) error {
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	query, err := buildInsertCallbackTokensQuery(tokens)
+	if err != nil {
+		return err
+	}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build insert callback tokens query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to insert callback tokens: %w", err)
+	}
+	return nil
+}
+
+// FindByToken returns the token if it exists and has not expired yet.
+func (r *CallbackTokenRepository) FindByToken(ctx context.Context, token string) (*CallbackToken, error) {
+	sql, args, err := sq.Select("token", "telegram_id", "action", "payload", "expires_at").
+		From("callback_token").
+		Where(sq.Eq{"token": token}).
+		Where(sq.Gt{"expires_at": time.Now()}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select callback token query: %w", err)
+	}
+
+	var t CallbackToken
+	var payload []byte
+	err = r.pool.QueryRow(ctx, sql, args...).Scan(&t.Token, &t.TelegramID, &t.Action, &payload, &t.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query callback token: %w", err)
+	}
+	if err := json.Unmarshal(payload, &t.Payload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal callback payload: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *CallbackTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	sql, args, err := sq.Delete("callback_token").
+		Where(sq.LtOrEq{"expires_at": time.Now()}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build delete callback tokens query: %w", err)
+	}
+
+	tag, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired callback tokens: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,37 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildInsertCallbackTokensQuery(t *testing.T) {
+	expiresAt := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	tokens := []CallbackToken{
+		{Token: "a", TelegramID: 1, Action: "sell", Payload: map[string]string{"tariff": "2"}, ExpiresAt: expiresAt},
+		{Token: "b", TelegramID: 1, Action: "payment", Payload: map[string]string{"invoiceType": "crypto"}, ExpiresAt: expiresAt},
+	}
+
+	query, err := buildInsertCallbackTokensQuery(tokens)
+	if err != nil {
+		t.Fatalf("buildInsertCallbackTokensQuery() returned error: %v", err)
+	}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "INSERT INTO callback_token (token,telegram_id,action,payload,expires_at) VALUES ($1,$2,$3,$4,$5),($6,$7,$8,$9,$10)"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{
+		"a", int64(1), "sell", []byte(`{"tariff":"2"}`), expiresAt,
+		"b", int64(1), "payment", []byte(`{"invoiceType":"crypto"}`), expiresAt,
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
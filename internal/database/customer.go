@@ -9,7 +9,10 @@ import (
 	"github.com/jackc/pgx/v4/pgxpool"
 	"log/slog"
 	"remnawave-tg-shop-bot/utils"
+	"strings"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 type CustomerRepository struct {
@@ -27,10 +30,36 @@ type Customer struct {
 	CreatedAt        time.Time  `db:"created_at"`
 	SubscriptionLink *string    `db:"subscription_link"`
 	Language         string     `db:"language"`
+	PaymentMethodID  *uuid.UUID `db:"payment_method_id"`
+	Username         *string    `db:"username"`
+	Blocked          bool       `db:"blocked"`
+	// SubscriptionStatus is the user status reported by Remnawave webhooks: ACTIVE, DISABLED, LIMITED or EXPIRED.
+	SubscriptionStatus *string `db:"subscription_status"`
+}
+
+var customerColumns = []string{"id", "telegram_id", "expire_at", "created_at", "subscription_link", "language", "payment_method_id", "username", "blocked", "subscription_status"}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCustomer(row rowScanner, customer *Customer) error {
+	return row.Scan(
+		&customer.ID,
+		&customer.TelegramID,
+		&customer.ExpireAt,
+		&customer.CreatedAt,
+		&customer.SubscriptionLink,
+		&customer.Language,
+		&customer.PaymentMethodID,
+		&customer.Username,
+		&customer.Blocked,
+		&customer.SubscriptionStatus,
+	)
 }
 
 func (cr *CustomerRepository) FindByExpirationRange(ctx context.Context, startDate, endDate time.Time) (*[]Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select(customerColumns...).
 		From("customer").
 		Where(
 			sq.And{
@@ -55,14 +84,7 @@ func (cr *CustomerRepository) FindByExpirationRange(ctx context.Context, startDa
 	var customers []Customer
 	for rows.Next() {
 		var customer Customer
-		err := rows.Scan(
-			&customer.ID,
-			&customer.TelegramID,
-			&customer.ExpireAt,
-			&customer.CreatedAt,
-			&customer.SubscriptionLink,
-			&customer.Language,
-		)
+		err := scanCustomer(rows, &customer)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan customer row: %w", err)
 		}
@@ -77,7 +99,7 @@ func (cr *CustomerRepository) FindByExpirationRange(ctx context.Context, startDa
 }
 
 func (cr *CustomerRepository) FindById(ctx context.Context, id int64) (*Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select(customerColumns...).
 		From("customer").
 		Where(sq.Eq{"id": id}).
 		PlaceholderFormat(sq.Dollar)
@@ -89,14 +111,7 @@ func (cr *CustomerRepository) FindById(ctx context.Context, id int64) (*Customer
 
 	var customer Customer
 
-	err = cr.pool.QueryRow(ctx, sql, args...).Scan(
-		&customer.ID,
-		&customer.TelegramID,
-		&customer.ExpireAt,
-		&customer.CreatedAt,
-		&customer.SubscriptionLink,
-		&customer.Language,
-	)
+	err = scanCustomer(cr.pool.QueryRow(ctx, sql, args...), &customer)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -107,7 +122,7 @@ func (cr *CustomerRepository) FindById(ctx context.Context, id int64) (*Customer
 }
 
 func (cr *CustomerRepository) FindByTelegramId(ctx context.Context, telegramId int64) (*Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select(customerColumns...).
 		From("customer").
 		Where(sq.Eq{"telegram_id": telegramId}).
 		PlaceholderFormat(sq.Dollar)
@@ -119,14 +134,38 @@ func (cr *CustomerRepository) FindByTelegramId(ctx context.Context, telegramId i
 
 	var customer Customer
 
-	err = cr.pool.QueryRow(ctx, sql, args...).Scan(
-		&customer.ID,
-		&customer.TelegramID,
-		&customer.ExpireAt,
-		&customer.CreatedAt,
-		&customer.SubscriptionLink,
-		&customer.Language,
-	)
+	err = scanCustomer(cr.pool.QueryRow(ctx, sql, args...), &customer)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query customer: %w", err)
+	}
+	return &customer, nil
+}
+
+// FindByUsername looks a customer up by telegram username, ignoring case and a leading @.
+func (cr *CustomerRepository) FindByUsername(ctx context.Context, username string) (*Customer, error) {
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if username == "" {
+		return nil, nil
+	}
+
+	buildSelect := sq.Select(customerColumns...).
+		From("customer").
+		Where(sq.Expr("lower(username) = lower(?)", username)).
+		OrderBy("id DESC").
+		Limit(1).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := buildSelect.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select query: %w", err)
+	}
+
+	var customer Customer
+
+	err = scanCustomer(cr.pool.QueryRow(ctx, sql, args...), &customer)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -142,22 +181,15 @@ func (cr *CustomerRepository) Create(ctx context.Context, customer *Customer) (*
 
 func (cr *CustomerRepository) FindOrCreate(ctx context.Context, customer *Customer) (*Customer, error) {
 	query := `
-		INSERT INTO customer (telegram_id, expire_at, language)
-		VALUES ($1, $2, $3)
+		INSERT INTO customer (telegram_id, expire_at, language, username)
+		VALUES ($1, $2, $3, $4)
 		ON CONFLICT (telegram_id) DO UPDATE SET telegram_id = customer.telegram_id
-		RETURNING id, telegram_id, expire_at, created_at, subscription_link, language
+		RETURNING id, telegram_id, expire_at, created_at, subscription_link, language, payment_method_id, username, blocked, subscription_status
 	`
 
-	row := cr.pool.QueryRow(ctx, query, customer.TelegramID, customer.ExpireAt, customer.Language)
+	row := cr.pool.QueryRow(ctx, query, customer.TelegramID, customer.ExpireAt, customer.Language, customer.Username)
 	var result Customer
-	if err := row.Scan(
-		&result.ID,
-		&result.TelegramID,
-		&result.ExpireAt,
-		&result.CreatedAt,
-		&result.SubscriptionLink,
-		&result.Language,
-	); err != nil {
+	if err := scanCustomer(row, &result); err != nil {
 		return nil, fmt.Errorf("failed to find or create customer: %w", err)
 	}
 
@@ -208,7 +240,7 @@ func (cr *CustomerRepository) UpdateFields(ctx context.Context, id int64, update
 }
 
 func (cr *CustomerRepository) FindByTelegramIds(ctx context.Context, telegramIDs []int64) ([]Customer, error) {
-	buildSelect := sq.Select("id", "telegram_id", "expire_at", "created_at", "subscription_link", "language").
+	buildSelect := sq.Select(customerColumns...).
 		From("customer").
 		Where(sq.Eq{"telegram_id": telegramIDs}).
 		PlaceholderFormat(sq.Dollar)
@@ -227,14 +259,7 @@ func (cr *CustomerRepository) FindByTelegramIds(ctx context.Context, telegramIDs
 	var customers []Customer
 	for rows.Next() {
 		var customer Customer
-		err := rows.Scan(
-			&customer.ID,
-			&customer.TelegramID,
-			&customer.ExpireAt,
-			&customer.CreatedAt,
-			&customer.SubscriptionLink,
-			&customer.Language,
-		)
+		err := scanCustomer(rows, &customer)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan customer row: %w", err)
 		}
@@ -247,6 +272,46 @@ func (cr *CustomerRepository) FindByTelegramIds(ctx context.Context, telegramIDs
 	return customers, nil
 }
 
+func buildActiveTrialCustomersQuery(now time.Time) sq.SelectBuilder {
+	return sq.Select(customerColumns...).
+		From("customer c").
+		Where(sq.Expr("EXISTS (SELECT 1 FROM trial_activation t WHERE t.telegram_id = c.telegram_id " +
+			"AND t.revoked_at IS NULL AND t.expire_at = c.expire_at)")).
+		Where(sq.Gt{"c.expire_at": now}).
+		Where(sq.Eq{"c.blocked": false}).
+		OrderBy("c.id").
+		PlaceholderFormat(sq.Dollar)
+}
+
+// FindActiveTrials returns the customers whose subscription is still the trial: it was not revoked and the expiry is
+// the one the trial set, so no purchase, gift, referral reward or admin change extended it.
+func (cr *CustomerRepository) FindActiveTrials(ctx context.Context, now time.Time) ([]Customer, error) {
+	sqlStr, args, err := buildActiveTrialCustomersQuery(now).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select active trials query: %w", err)
+	}
+
+	rows, err := cr.pool.Query(ctx, sqlStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query active trials: %w", err)
+	}
+	defer rows.Close()
+
+	var customers []Customer
+	for rows.Next() {
+		var customer Customer
+		if err := scanCustomer(rows, &customer); err != nil {
+			return nil, fmt.Errorf("failed to scan customer row: %w", err)
+		}
+		customers = append(customers, customer)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over customer rows: %w", err)
+	}
+
+	return customers, nil
+}
+
 func (cr *CustomerRepository) CreateBatch(ctx context.Context, customers []Customer) error {
 	if len(customers) == 0 {
 		return nil
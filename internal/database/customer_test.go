@@ -0,0 +1,28 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildActiveTrialCustomersQuery(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sql, args, err := buildActiveTrialCustomersQuery(now).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "SELECT id, telegram_id, expire_at, created_at, subscription_link, language, payment_method_id, username, blocked, subscription_status " +
+		"FROM customer c WHERE EXISTS (SELECT 1 FROM trial_activation t WHERE t.telegram_id = c.telegram_id " +
+		"AND t.revoked_at IS NULL AND t.expire_at = c.expire_at) " +
+		"AND c.expire_at > $1 AND c.blocked = $2 ORDER BY c.id"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{now, false}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
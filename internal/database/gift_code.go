@@ -0,0 +1,144 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// GiftCode is a one-time code issued for a paid gift purchase. Redeeming it creates or extends
+// the recipient's subscription by Days with the settings of the tariff.
+type GiftCode struct {
+	ID              int64     `db:"id"`
+	Code            string    `db:"code"`
+	PurchaseID      *int64    `db:"purchase_id"`
+	BuyerTelegramID int64     `db:"buyer_telegram_id"`
+	TariffID        *int64    `db:"tariff_id"`
+	Days            int       `db:"days"`
+	CreatedAt       time.Time `db:"created_at"`
+	ExpiresAt       time.Time `db:"expires_at"`
+	// RedeemedAt and RedeemedTelegramID are nil until the code is redeemed.
+	RedeemedAt         *time.Time `db:"redeemed_at"`
+	RedeemedTelegramID *int64     `db:"redeemed_telegram_id"`
+}
+
+var giftCodeColumns = []string{
+	"id", "code", "purchase_id", "buyer_telegram_id", "tariff_id", "days", "created_at", "expires_at",
+	"redeemed_at", "redeemed_telegram_id",
+}
+
+func scanGiftCode(row rowScanner, g *GiftCode) error {
+	return row.Scan(
+		&g.ID, &g.Code, &g.PurchaseID, &g.BuyerTelegramID, &g.TariffID, &g.Days, &g.CreatedAt, &g.ExpiresAt,
+		&g.RedeemedAt, &g.RedeemedTelegramID,
+	)
+}
+
+type GiftCodeRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewGiftCodeRepository(pool *pgxpool.Pool) *GiftCodeRepository {
+	return &GiftCodeRepository{pool: pool}
+}
+
+func buildInsertGiftCodeQuery(gift *GiftCode) sq.InsertBuilder {
+	return sq.Insert("gift_code").
+		Columns("code", "purchase_id", "buyer_telegram_id", "tariff_id", "days", "expires_at").
+		Values(gift.Code, gift.PurchaseID, gift.BuyerTelegramID, gift.TariffID, gift.Days, gift.ExpiresAt).
+		Suffix("RETURNING id, created_at").
+		PlaceholderFormat(sq.Dollar)
+}
+
+func (r *GiftCodeRepository) FindByCode(ctx context.Context, code string) (*GiftCode, error) {
+	sql, args, err := sq.Select(giftCodeColumns...).
+		From("gift_code").
+		Where(sq.Eq{"code": code}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select gift code query: %w", err)
+	}
+
+	var gift GiftCode
+	if err := scanGiftCode(r.pool.QueryRow(ctx, sql, args...), &gift); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query gift code: %w", err)
+	}
+	return &gift, nil
+}
+
+func buildRedeemGiftCodeQuery(code string, telegramID int64, now time.Time) sq.UpdateBuilder {
+	return sq.Update("gift_code").
+		Set("redeemed_at", now).
+		Set("redeemed_telegram_id", telegramID).
+		Where(sq.Eq{"code": code, "redeemed_at": nil}).
+		Where(sq.Gt{"expires_at": now}).
+		Suffix("RETURNING " + strings.Join(giftCodeColumns, ", ")).
+		PlaceholderFormat(sq.Dollar)
+}
+
+// Redeem marks the code as redeemed by the recipient. It returns nil when the code does not exist,
+// is already redeemed or has expired, so concurrent redemptions cannot both succeed.
+func (r *GiftCodeRepository) Redeem(ctx context.Context, code string, telegramID int64) (*GiftCode, error) {
+	sql, args, err := buildRedeemGiftCodeQuery(code, telegramID, time.Now()).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build redeem gift code query: %w", err)
+	}
+
+	var gift GiftCode
+	if err := scanGiftCode(r.pool.QueryRow(ctx, sql, args...), &gift); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to redeem gift code: %w", err)
+	}
+	return &gift, nil
+}
+
+// ReleaseRedemption makes the code redeemable again after the subscription could not be provisioned.
+func (r *GiftCodeRepository) ReleaseRedemption(ctx context.Context, id int64, telegramID int64) error {
+	sql, args, err := sq.Update("gift_code").
+		Set("redeemed_at", nil).
+		Set("redeemed_telegram_id", nil).
+		Where(sq.Eq{"id": id, "redeemed_telegram_id": telegramID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build release gift code query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to release gift code: %w", err)
+	}
+	return nil
+}
+
+// ExpireByPurchaseID expires the unredeemed code of a refunded purchase. It returns false when the code
+// was already redeemed or there is none.
+func (r *GiftCodeRepository) ExpireByPurchaseID(ctx context.Context, purchaseID int64) (bool, error) {
+	now := time.Now()
+	sql, args, err := sq.Update("gift_code").
+		Set("expires_at", now).
+		Where(sq.Eq{"purchase_id": purchaseID, "redeemed_at": nil}).
+		Where(sq.Gt{"expires_at": now}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build expire gift code query: %w", err)
+	}
+
+	result, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to expire gift code: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
@@ -0,0 +1,27 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildRedeemGiftCodeQuery(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	sql, args, err := buildRedeemGiftCodeQuery("ABC", 7, now).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "UPDATE gift_code SET redeemed_at = $1, redeemed_telegram_id = $2 WHERE code = $3 AND redeemed_at IS NULL AND expires_at > $4 " +
+		"RETURNING id, code, purchase_id, buyer_telegram_id, tariff_id, days, created_at, expires_at, redeemed_at, redeemed_telegram_id"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{now, int64(7), "ABC", now}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
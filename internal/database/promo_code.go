@@ -0,0 +1,265 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type PromoCodeType string
+
+const (
+	PromoCodeTypePercent PromoCodeType = "percent"
+	PromoCodeTypeFixed   PromoCodeType = "fixed"
+	PromoCodeTypeDays    PromoCodeType = "days"
+)
+
+// PromoReservationTimeout is how long an unpaid purchase keeps a promo code use reserved.
+const PromoReservationTimeout = time.Hour
+
+var (
+	ErrPromoCodeLimitReached         = errors.New("promo code usage limit reached")
+	ErrPromoCodeCustomerLimitReached = errors.New("promo code already used by customer")
+)
+
+type PromoCode struct {
+	ID                 int64         `db:"id"`
+	Code               string        `db:"code"`
+	Type               PromoCodeType `db:"type"`
+	Value              int           `db:"value"`
+	MaxUses            *int          `db:"max_uses"`
+	MaxUsesPerCustomer int           `db:"max_uses_per_customer"`
+	TariffIDs          []int64       `db:"tariff_ids"`
+	InvoiceTypes       []string      `db:"invoice_types"`
+	ExpiresAt          *time.Time    `db:"expires_at"`
+	Active             bool          `db:"active"`
+	CreatedAt          time.Time     `db:"created_at"`
+}
+
+// AllowsTariff reports whether the code can be used for the given tariff.
+func (p *PromoCode) AllowsTariff(tariffID int64) bool {
+	if len(p.TariffIDs) == 0 {
+		return true
+	}
+	for _, id := range p.TariffIDs {
+		if id == tariffID {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsInvoiceType reports whether the code can be used with the given payment method.
+func (p *PromoCode) AllowsInvoiceType(invoiceType InvoiceType) bool {
+	if len(p.InvoiceTypes) == 0 {
+		return true
+	}
+	for _, t := range p.InvoiceTypes {
+		if InvoiceType(t) == invoiceType {
+			return true
+		}
+	}
+	return false
+}
+
+var promoCodeColumns = []string{"id", "code", "type", "value", "max_uses", "max_uses_per_customer", "tariff_ids", "invoice_types", "expires_at", "active", "created_at"}
+
+func scanPromoCode(row rowScanner, p *PromoCode) error {
+	return row.Scan(&p.ID, &p.Code, &p.Type, &p.Value, &p.MaxUses, &p.MaxUsesPerCustomer, &p.TariffIDs, &p.InvoiceTypes, &p.ExpiresAt, &p.Active, &p.CreatedAt)
+}
+
+type PromoCodeRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewPromoCodeRepository(pool *pgxpool.Pool) *PromoCodeRepository {
+	return &PromoCodeRepository{pool: pool}
+}
+
+func (r *PromoCodeRepository) Create(ctx context.Context, p *PromoCode) (int64, error) {
+	query := sq.Insert("promo_code").
+		Columns("code", "type", "value", "max_uses", "max_uses_per_customer", "tariff_ids", "invoice_types", "expires_at", "active").
+		Values(strings.ToUpper(p.Code), p.Type, p.Value, p.MaxUses, p.MaxUsesPerCustomer, p.TariffIDs, p.InvoiceTypes, p.ExpiresAt, true).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build insert promo code query: %w", err)
+	}
+
+	var id int64
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert promo code: %w", err)
+	}
+	return id, nil
+}
+
+func (r *PromoCodeRepository) FindById(ctx context.Context, id int64) (*PromoCode, error) {
+	return r.findOne(ctx, sq.Eq{"id": id})
+}
+
+// FindByCode looks a code up case-insensitively.
+func (r *PromoCodeRepository) FindByCode(ctx context.Context, code string) (*PromoCode, error) {
+	return r.findOne(ctx, sq.Expr("upper(code) = ?", strings.ToUpper(strings.TrimSpace(code))))
+}
+
+func (r *PromoCodeRepository) findOne(ctx context.Context, where sq.Sqlizer) (*PromoCode, error) {
+	query := sq.Select(promoCodeColumns...).
+		From("promo_code").
+		Where(where).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select promo code query: %w", err)
+	}
+
+	var p PromoCode
+	if err := scanPromoCode(r.pool.QueryRow(ctx, sql, args...), &p); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query promo code: %w", err)
+	}
+	return &p, nil
+}
+
+func (r *PromoCodeRepository) FindAll(ctx context.Context) ([]PromoCode, error) {
+	query := sq.Select(promoCodeColumns...).
+		From("promo_code").
+		OrderBy("id DESC").
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select promo codes query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query promo codes: %w", err)
+	}
+	defer rows.Close()
+
+	var list []PromoCode
+	for rows.Next() {
+		var p PromoCode
+		if err := scanPromoCode(rows, &p); err != nil {
+			return nil, fmt.Errorf("failed to scan promo code row: %w", err)
+		}
+		list = append(list, p)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating promo code rows: %w", rows.Err())
+	}
+	return list, nil
+}
+
+// SetActive enables or disables a code. It returns false if there is no such code.
+func (r *PromoCodeRepository) SetActive(ctx context.Context, code string, active bool) (bool, error) {
+	sql, args, err := sq.Update("promo_code").
+		Set("active", active).
+		Where(sq.Expr("upper(code) = ?", strings.ToUpper(strings.TrimSpace(code)))).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build update promo code query: %w", err)
+	}
+
+	res, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to update promo code: %w", err)
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// CountUses returns how many times the code has been used in total and by the customer.
+func (r *PromoCodeRepository) CountUses(ctx context.Context, promoCodeID int64, customerID int64) (int, int, error) {
+	return countPromoCodeUses(ctx, r.pool, promoCodeID, customerID)
+}
+
+type queryRower interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// buildPromoCodeUsesQuery counts paid and in-flight purchases with the code. Unpaid purchases
+// only hold a use for PromoReservationTimeout so abandoned invoices do not exhaust the code.
+// The customer's own unpaid purchases are not counted: applying the code again, for example with
+// another payment method, supersedes them, and a second payment is caught when it is claimed.
+func buildPromoCodeUsesQuery(promoCodeID int64, customerID int64, now time.Time) sq.SelectBuilder {
+	return sq.Select("COUNT(*)").
+		Column(sq.Expr("COUNT(*) FILTER (WHERE customer_id = ?)", customerID)).
+		From("purchase").
+		Where(sq.Eq{"promo_code_id": promoCodeID}).
+		Where(sq.Or{
+			sq.Eq{"status": []PurchaseStatus{PurchaseStatusPaid, PurchaseStatusProcessing}},
+			sq.And{
+				sq.Eq{"status": []PurchaseStatus{PurchaseStatusNew, PurchaseStatusPending}},
+				sq.Gt{"created_at": now.Add(-PromoReservationTimeout)},
+				sq.NotEq{"customer_id": customerID},
+			},
+		}).
+		PlaceholderFormat(sq.Dollar)
+}
+
+// buildClaimedPromoCodeUsesQuery counts the paid and in-flight purchases with the code other than the
+// given one. It is used when a purchase is claimed, because its reservation may have expired before payment.
+func buildClaimedPromoCodeUsesQuery(promoCodeID int64, customerID int64, purchaseID int64) sq.SelectBuilder {
+	return sq.Select("COUNT(*)").
+		Column(sq.Expr("COUNT(*) FILTER (WHERE customer_id = ?)", customerID)).
+		From("purchase").
+		Where(sq.Eq{"promo_code_id": promoCodeID}).
+		Where(sq.Eq{"status": []PurchaseStatus{PurchaseStatusPaid, PurchaseStatusProcessing}}).
+		Where(sq.NotEq{"id": purchaseID}).
+		PlaceholderFormat(sq.Dollar)
+}
+
+// promoCodeLimitError reports which limit, if any, another use of the code would exceed.
+func promoCodeLimitError(maxUses *int, maxUsesPerCustomer int, total int, byCustomer int) error {
+	if maxUses != nil && total >= *maxUses {
+		return ErrPromoCodeLimitReached
+	}
+	if maxUsesPerCustomer > 0 && byCustomer >= maxUsesPerCustomer {
+		return ErrPromoCodeCustomerLimitReached
+	}
+	return nil
+}
+
+// lockPromoCodeLimits locks the promo code until the transaction ends and returns its limits.
+func lockPromoCodeLimits(ctx context.Context, tx pgx.Tx, promoCodeID int64) (*int, int, error) {
+	sql, args, err := sq.Select("max_uses", "max_uses_per_customer").
+		From("promo_code").
+		Where(sq.Eq{"id": promoCodeID}).
+		Suffix("FOR UPDATE").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build lock promo code query: %w", err)
+	}
+
+	var maxUses *int
+	var maxUsesPerCustomer int
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&maxUses, &maxUsesPerCustomer); err != nil {
+		return nil, 0, fmt.Errorf("failed to lock promo code: %w", err)
+	}
+	return maxUses, maxUsesPerCustomer, nil
+}
+
+func countPromoCodeUses(ctx context.Context, db queryRower, promoCodeID int64, customerID int64) (int, int, error) {
+	sql, args, err := buildPromoCodeUsesQuery(promoCodeID, customerID, time.Now()).ToSql()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to build promo code uses query: %w", err)
+	}
+	var total, byCustomer int
+	if err := db.QueryRow(ctx, sql, args...).Scan(&total, &byCustomer); err != nil {
+		return 0, 0, fmt.Errorf("failed to count promo code uses: %w", err)
+	}
+	return total, byCustomer, nil
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildPromoCodeUsesQuery(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	sql, args, err := buildPromoCodeUsesQuery(3, 7, now).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "SELECT COUNT(*), COUNT(*) FILTER (WHERE customer_id = $1) FROM purchase WHERE promo_code_id = $2 AND (status IN ($3,$4) OR (status IN ($5,$6) AND created_at > $7 AND customer_id <> $8))"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{int64(7), int64(3), PurchaseStatusPaid, PurchaseStatusProcessing, PurchaseStatusNew, PurchaseStatusPending, now.Add(-PromoReservationTimeout), int64(7)}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestBuildClaimedPromoCodeUsesQuery(t *testing.T) {
+	sql, args, err := buildClaimedPromoCodeUsesQuery(3, 7, 42).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "SELECT COUNT(*), COUNT(*) FILTER (WHERE customer_id = $1) FROM purchase WHERE promo_code_id = $2 AND status IN ($3,$4) AND id <> $5"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{int64(7), int64(3), PurchaseStatusPaid, PurchaseStatusProcessing, int64(42)}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestPromoCodeLimitError(t *testing.T) {
+	two := 2
+	tests := []struct {
+		name               string
+		maxUses            *int
+		maxUsesPerCustomer int
+		total              int
+		byCustomer         int
+		want               error
+	}{
+		{name: "unlimited", maxUsesPerCustomer: 0, total: 100, byCustomer: 5, want: nil},
+		{name: "uses left", maxUses: &two, maxUsesPerCustomer: 1, total: 1, byCustomer: 0, want: nil},
+		{name: "total limit reached", maxUses: &two, maxUsesPerCustomer: 1, total: 2, byCustomer: 0, want: ErrPromoCodeLimitReached},
+		{name: "customer limit reached", maxUses: &two, maxUsesPerCustomer: 1, total: 1, byCustomer: 1, want: ErrPromoCodeCustomerLimitReached},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := promoCodeLimitError(tt.maxUses, tt.maxUsesPerCustomer, tt.total, tt.byCustomer); got != tt.want {
+				t.Fatalf("promoCodeLimitError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
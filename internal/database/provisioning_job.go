@@ -0,0 +1,196 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// ProvisioningJob records a purchase whose payment is confirmed but whose subscription is not extended yet.
+// The job is removed when the purchase is completed.
+type ProvisioningJob struct {
+	PurchaseID    int64      `db:"purchase_id"`
+	Username      *string    `db:"username"`
+	Attempts      int        `db:"attempts"`
+	NextAttemptAt time.Time  `db:"next_attempt_at"`
+	LastError     *string    `db:"last_error"`
+	AlertedAt     *time.Time `db:"alerted_at"`
+	CreatedAt     time.Time  `db:"created_at"`
+}
+
+var provisioningJobColumns = []string{"purchase_id", "username", "attempts", "next_attempt_at", "last_error", "alerted_at", "created_at"}
+
+func scanProvisioningJob(row rowScanner, j *ProvisioningJob) error {
+	return row.Scan(&j.PurchaseID, &j.Username, &j.Attempts, &j.NextAttemptAt, &j.LastError, &j.AlertedAt, &j.CreatedAt)
+}
+
+type ProvisioningJobRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewProvisioningJobRepository(pool *pgxpool.Pool) *ProvisioningJobRepository {
+	return &ProvisioningJobRepository{pool: pool}
+}
+
+func buildEnqueueProvisioningJobQuery(purchaseID int64, username string) sq.InsertBuilder {
+	var name *string
+	if username != "" {
+		name = &username
+	}
+
+	return sq.Insert("provisioning_job").
+		Columns("purchase_id", "username").
+		Select(sq.Select("id").
+			Column(sq.Expr("?", name)).
+			From("purchase").
+			Where(sq.Eq{"id": purchaseID, "status": []PurchaseStatus{PurchaseStatusNew, PurchaseStatusPending, PurchaseStatusProcessing}})).
+		Suffix("ON CONFLICT (purchase_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar)
+}
+
+// Enqueue records that the purchase is paid and waits for provisioning. Purchases that are already
+// completed or cancelled are skipped.
+func (r *ProvisioningJobRepository) Enqueue(ctx context.Context, purchaseID int64, username string) error {
+	sql, args, err := buildEnqueueProvisioningJobQuery(purchaseID, username).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build enqueue provisioning job query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to enqueue provisioning job: %w", err)
+	}
+	return nil
+}
+
+func (r *ProvisioningJobRepository) FindByPurchaseID(ctx context.Context, purchaseID int64) (*ProvisioningJob, error) {
+	sql, args, err := sq.Select(provisioningJobColumns...).
+		From("provisioning_job").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select provisioning job query: %w", err)
+	}
+
+	var j ProvisioningJob
+	if err := scanProvisioningJob(r.pool.QueryRow(ctx, sql, args...), &j); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query provisioning job: %w", err)
+	}
+	return &j, nil
+}
+
+// FindDue returns the jobs whose next attempt is due, oldest first.
+func (r *ProvisioningJobRepository) FindDue(ctx context.Context, now time.Time, limit uint64) ([]ProvisioningJob, error) {
+	return r.find(ctx, sq.LtOrEq{"next_attempt_at": now}, limit)
+}
+
+// FindFailed returns the jobs that failed at least once, oldest first.
+func (r *ProvisioningJobRepository) FindFailed(ctx context.Context, limit uint64) ([]ProvisioningJob, error) {
+	return r.find(ctx, sq.Gt{"attempts": 0}, limit)
+}
+
+func (r *ProvisioningJobRepository) find(ctx context.Context, where sq.Sqlizer, limit uint64) ([]ProvisioningJob, error) {
+	sql, args, err := sq.Select(provisioningJobColumns...).
+		From("provisioning_job").
+		Where(where).
+		OrderBy("created_at").
+		Limit(limit).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select provisioning jobs query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query provisioning jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ProvisioningJob
+	for rows.Next() {
+		var j ProvisioningJob
+		if err := scanProvisioningJob(rows, &j); err != nil {
+			return nil, fmt.Errorf("failed to scan provisioning job row: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating provisioning job rows: %w", rows.Err())
+	}
+	return jobs, nil
+}
+
+// RecordFailure counts a failed attempt and schedules the next one. It returns the updated job,
+// or nil if the job no longer exists.
+func (r *ProvisioningJobRepository) RecordFailure(ctx context.Context, purchaseID int64, cause string, nextAttemptAt time.Time) (*ProvisioningJob, error) {
+	sql, args, err := sq.Update("provisioning_job").
+		Set("attempts", sq.Expr("attempts + 1")).
+		Set("last_error", cause).
+		Set("next_attempt_at", nextAttemptAt).
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		Suffix("RETURNING " + strings.Join(provisioningJobColumns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build update provisioning job query: %w", err)
+	}
+
+	var j ProvisioningJob
+	if err := scanProvisioningJob(r.pool.QueryRow(ctx, sql, args...), &j); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to update provisioning job: %w", err)
+	}
+	return &j, nil
+}
+
+func (r *ProvisioningJobRepository) MarkAlerted(ctx context.Context, purchaseID int64) error {
+	return r.update(ctx, purchaseID, map[string]interface{}{"alerted_at": time.Now()})
+}
+
+// Postpone moves the next attempt without counting a failure, e.g. while another call is processing the purchase.
+func (r *ProvisioningJobRepository) Postpone(ctx context.Context, purchaseID int64, nextAttemptAt time.Time) error {
+	return r.update(ctx, purchaseID, map[string]interface{}{"next_attempt_at": nextAttemptAt})
+}
+
+func (r *ProvisioningJobRepository) update(ctx context.Context, purchaseID int64, updates map[string]interface{}) error {
+	sql, args, err := sq.Update("provisioning_job").
+		SetMap(updates).
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update provisioning job query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to update provisioning job: %w", err)
+	}
+	return nil
+}
+
+func (r *ProvisioningJobRepository) Delete(ctx context.Context, purchaseID int64) error {
+	sql, args, err := sq.Delete("provisioning_job").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build delete provisioning job query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to delete provisioning job: %w", err)
+	}
+	return nil
+}
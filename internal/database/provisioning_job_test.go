@@ -0,0 +1,24 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildEnqueueProvisioningJobQuery(t *testing.T) {
+	sql, args, err := buildEnqueueProvisioningJobQuery(42, "alice").ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "INSERT INTO provisioning_job (purchase_id,username) SELECT id, $1 FROM purchase WHERE id = $2 AND status IN ($3,$4,$5) ON CONFLICT (purchase_id) DO NOTHING"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	username := "alice"
+	expectedArgs := []interface{}{&username, int64(42), PurchaseStatusNew, PurchaseStatusPending, PurchaseStatusProcessing}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
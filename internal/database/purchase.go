@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	sq "github.com/Masterminds/squirrel"
@@ -26,8 +27,12 @@ type PurchaseStatus string
 const (
 	PurchaseStatusNew     PurchaseStatus = "new"
 	PurchaseStatusPending PurchaseStatus = "pending"
-	PurchaseStatusPaid    PurchaseStatus = "paid"
-	PurchaseStatusCancel  PurchaseStatus = "cancel"
+	// PurchaseStatusProcessing marks a purchase claimed by ProcessPurchaseById.
+	PurchaseStatusProcessing PurchaseStatus = "processing"
+	PurchaseStatusPaid       PurchaseStatus = "paid"
+	PurchaseStatusCancel     PurchaseStatus = "cancel"
+	// PurchaseStatusRefunded marks a paid purchase whose money was returned to the customer.
+	PurchaseStatusRefunded PurchaseStatus = "refunded"
 )
 
 type Purchase struct {
@@ -45,6 +50,47 @@ type Purchase struct {
 	CryptoInvoiceLink *string        `db:"crypto_invoice_url"`
 	YookasaURL        *string        `db:"yookasa_url"`
 	YookasaID         *uuid.UUID     `db:"yookasa_id"`
+
+	ProcessingStartedAt   *time.Time `db:"processing_started_at"`
+	ProvisionBaseExpireAt *time.Time `db:"provision_base_expire_at"`
+	ProvisionedAt         *time.Time `db:"provisioned_at"`
+	SubscriptionLink      *string    `db:"subscription_link"`
+	SubscriptionExpireAt  *time.Time `db:"subscription_expire_at"`
+
+	PromoCodeID    *int64  `db:"promo_code_id"`
+	DiscountAmount float64 `db:"discount_amount"`
+	BonusDays      int     `db:"bonus_days"`
+
+	// TariffID is nil for purchases made outside the tariff catalogue, such as Tribute subscriptions.
+	TariffID *int64 `db:"tariff_id"`
+
+	TelegramChargeID *string    `db:"telegram_charge_id"`
+	RefundedAt       *time.Time `db:"refunded_at"`
+
+	// Gift purchases issue a gift code instead of extending the buyer's subscription.
+	Gift bool `db:"gift"`
+
+	// PromoLimitExceeded is set when the purchase was paid after its promo code had run out of uses.
+	PromoLimitExceeded bool `db:"promo_limit_exceeded"`
+}
+
+var purchaseColumns = []string{
+	"id", "amount", "customer_id", "created_at", "month", "paid_at", "currency", "expire_at", "status", "invoice_type",
+	"crypto_invoice_id", "crypto_invoice_url", "yookasa_url", "yookasa_id",
+	"processing_started_at", "provision_base_expire_at", "provisioned_at", "subscription_link", "subscription_expire_at",
+	"promo_code_id", "discount_amount", "bonus_days", "tariff_id",
+	"telegram_charge_id", "refunded_at", "gift", "promo_limit_exceeded",
+}
+
+func scanPurchase(row rowScanner, p *Purchase) error {
+	return row.Scan(
+		&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
+		&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
+		&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
+		&p.ProcessingStartedAt, &p.ProvisionBaseExpireAt, &p.ProvisionedAt, &p.SubscriptionLink, &p.SubscriptionExpireAt,
+		&p.PromoCodeID, &p.DiscountAmount, &p.BonusDays, &p.TariffID,
+		&p.TelegramChargeID, &p.RefundedAt, &p.Gift, &p.PromoLimitExceeded,
+	)
 }
 
 type PurchaseRepository struct {
@@ -59,8 +105,8 @@ func NewPurchaseRepository(pool *pgxpool.Pool) *PurchaseRepository {
 
 func (cr *PurchaseRepository) Create(ctx context.Context, purchase *Purchase) (int64, error) {
 	buildInsert := sq.Insert("purchase").
-		Columns("amount", "customer_id", "month", "currency", "expire_at", "status", "invoice_type", "crypto_invoice_id", "crypto_invoice_url", "yookasa_url", "yookasa_id").
-		Values(purchase.Amount, purchase.CustomerID, purchase.Month, purchase.Currency, purchase.ExpireAt, purchase.Status, purchase.InvoiceType, purchase.CryptoInvoiceID, purchase.CryptoInvoiceLink, purchase.YookasaURL, purchase.YookasaID).
+		Columns("amount", "customer_id", "month", "currency", "expire_at", "status", "invoice_type", "crypto_invoice_id", "crypto_invoice_url", "yookasa_url", "yookasa_id", "promo_code_id", "discount_amount", "bonus_days", "tariff_id", "gift").
+		Values(purchase.Amount, purchase.CustomerID, purchase.Month, purchase.Currency, purchase.ExpireAt, purchase.Status, purchase.InvoiceType, purchase.CryptoInvoiceID, purchase.CryptoInvoiceLink, purchase.YookasaURL, purchase.YookasaID, purchase.PromoCodeID, purchase.DiscountAmount, purchase.BonusDays, purchase.TariffID, purchase.Gift).
 		Suffix("RETURNING id").
 		PlaceholderFormat(sq.Dollar)
 
@@ -69,6 +115,10 @@ func (cr *PurchaseRepository) Create(ctx context.Context, purchase *Purchase) (i
 		return 0, err
 	}
 
+	if purchase.PromoCodeID != nil {
+		return cr.createWithPromoCode(ctx, purchase, sql, args)
+	}
+
 	var id int64
 	err = cr.pool.QueryRow(ctx, sql, args...).Scan(&id)
 	if err != nil {
@@ -78,8 +128,41 @@ func (cr *PurchaseRepository) Create(ctx context.Context, purchase *Purchase) (i
 	return id, nil
 }
 
+// createWithPromoCode locks the promo code while checking its limits so concurrent purchases
+// cannot redeem it more times than allowed.
+func (cr *PurchaseRepository) createWithPromoCode(ctx context.Context, purchase *Purchase, insertSql string, insertArgs []interface{}) (int64, error) {
+	tx, err := cr.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	maxUses, maxUsesPerCustomer, err := lockPromoCodeLimits(ctx, tx, *purchase.PromoCodeID)
+	if err != nil {
+		return 0, err
+	}
+
+	total, byCustomer, err := countPromoCodeUses(ctx, tx, *purchase.PromoCodeID, purchase.CustomerID)
+	if err != nil {
+		return 0, err
+	}
+	if err := promoCodeLimitError(maxUses, maxUsesPerCustomer, total, byCustomer); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	if err := tx.QueryRow(ctx, insertSql, insertArgs...).Scan(&id); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return id, nil
+}
+
 func (cr *PurchaseRepository) FindByInvoiceTypeAndStatus(ctx context.Context, invoiceType InvoiceType, status PurchaseStatus) (*[]Purchase, error) {
-	buildSelect := sq.Select("*").
+	buildSelect := sq.Select(purchaseColumns...).
 		From("purchase").
 		Where(sq.And{
 			sq.Eq{"invoice_type": invoiceType},
@@ -101,22 +184,7 @@ func (cr *PurchaseRepository) FindByInvoiceTypeAndStatus(ctx context.Context, in
 	purchases := []Purchase{}
 	for rows.Next() {
 		purchase := Purchase{}
-		err = rows.Scan(
-			&purchase.ID,
-			&purchase.Amount,
-			&purchase.CustomerID,
-			&purchase.CreatedAt,
-			&purchase.Month,
-			&purchase.PaidAt,
-			&purchase.Currency,
-			&purchase.ExpireAt,
-			&purchase.Status,
-			&purchase.InvoiceType,
-			&purchase.CryptoInvoiceID,
-			&purchase.CryptoInvoiceLink,
-			&purchase.YookasaURL,
-			&purchase.YookasaID,
-		)
+		err = scanPurchase(rows, &purchase)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan purchase: %w", err)
 		}
@@ -131,7 +199,7 @@ func (cr *PurchaseRepository) FindByInvoiceTypeAndStatus(ctx context.Context, in
 }
 
 func (cr *PurchaseRepository) FindById(ctx context.Context, id int64) (*Purchase, error) {
-	buildSelect := sq.Select("*").
+	buildSelect := sq.Select(purchaseColumns...).
 		From("purchase").
 		Where(sq.Eq{"id": id}).
 		PlaceholderFormat(sq.Dollar)
@@ -142,22 +210,7 @@ func (cr *PurchaseRepository) FindById(ctx context.Context, id int64) (*Purchase
 	}
 	purchase := &Purchase{}
 
-	err = cr.pool.QueryRow(ctx, sql, args...).Scan(
-		&purchase.ID,
-		&purchase.Amount,
-		&purchase.CustomerID,
-		&purchase.CreatedAt,
-		&purchase.Month,
-		&purchase.PaidAt,
-		&purchase.Currency,
-		&purchase.ExpireAt,
-		&purchase.Status,
-		&purchase.InvoiceType,
-		&purchase.CryptoInvoiceID,
-		&purchase.CryptoInvoiceLink,
-		&purchase.YookasaURL,
-		&purchase.YookasaID,
-	)
+	err = scanPurchase(cr.pool.QueryRow(ctx, sql, args...), purchase)
 
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -200,20 +253,302 @@ func (p *PurchaseRepository) UpdateFields(ctx context.Context, id int64, updates
 	return nil
 }
 
-func (pr *PurchaseRepository) MarkAsPaid(ctx context.Context, purchaseID int64) error {
-	currentTime := time.Now()
+// ProcessingTimeout is how long a claimed purchase may stay in processing before another call may reclaim it.
+const ProcessingTimeout = 5 * time.Minute
+
+var ErrPurchaseNotClaimed = errors.New("purchase is not in processing state")
+
+// ClaimForProcessing moves a new or pending purchase (or a stale processing one) to processing.
+// It returns nil when the purchase is already claimed, paid or cancelled. A purchase with a promo code
+// is checked against the code's limits again, since its reservation may have expired before it was paid,
+// and is flagged with PromoLimitExceeded when another use was not allowed.
+func (pr *PurchaseRepository) ClaimForProcessing(ctx context.Context, purchaseID int64) (*Purchase, error) {
+	tx, err := pr.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := sq.Update("purchase").
+		Set("status", PurchaseStatusProcessing).
+		Set("processing_started_at", time.Now()).
+		Where(sq.Eq{"id": purchaseID}).
+		Where(sq.Or{
+			sq.Eq{"status": []PurchaseStatus{PurchaseStatusNew, PurchaseStatusPending}},
+			sq.And{
+				sq.Eq{"status": PurchaseStatusProcessing},
+				sq.Lt{"processing_started_at": time.Now().Add(-ProcessingTimeout)},
+			},
+		}).
+		Suffix("RETURNING " + strings.Join(purchaseColumns, ", ")).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	p := &Purchase{}
+	err = scanPurchase(tx.QueryRow(ctx, sql, args...), p)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("claim purchase: %w", err)
+	}
+
+	if p.PromoCodeID != nil && !p.PromoLimitExceeded {
+		if err := checkClaimedPromoCode(ctx, tx, p); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return p, nil
+}
+
+// checkClaimedPromoCode flags the claimed purchase if its promo code had no uses left for it.
+func checkClaimedPromoCode(ctx context.Context, tx pgx.Tx, p *Purchase) error {
+	maxUses, maxUsesPerCustomer, err := lockPromoCodeLimits(ctx, tx, *p.PromoCodeID)
+	if err != nil {
+		return err
+	}
+
+	sql, args, err := buildClaimedPromoCodeUsesQuery(*p.PromoCodeID, p.CustomerID, p.ID).ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+	var total, byCustomer int
+	if err := tx.QueryRow(ctx, sql, args...).Scan(&total, &byCustomer); err != nil {
+		return fmt.Errorf("count promo code uses: %w", err)
+	}
+	if promoCodeLimitError(maxUses, maxUsesPerCustomer, total, byCustomer) == nil {
+		return nil
+	}
+
+	sql, args, err = sq.Update("purchase").
+		Set("promo_limit_exceeded", true).
+		Where(sq.Eq{"id": p.ID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("flag purchase: %w", err)
+	}
+	p.PromoLimitExceeded = true
+	return nil
+}
+
+// SetProvisionBase records the Remnawave expiration seen right before the subscription is extended.
+func (pr *PurchaseRepository) SetProvisionBase(ctx context.Context, purchaseID int64, expireAt time.Time) error {
+	return pr.updateProcessing(ctx, purchaseID, map[string]interface{}{
+		"provision_base_expire_at": expireAt,
+	})
+}
+
+// MarkProvisioned records the Remnawave outcome so a retry does not extend the subscription again.
+func (pr *PurchaseRepository) MarkProvisioned(ctx context.Context, purchaseID int64, subscriptionLink string, expireAt time.Time) error {
+	return pr.updateProcessing(ctx, purchaseID, map[string]interface{}{
+		"provisioned_at":         time.Now(),
+		"subscription_link":      subscriptionLink,
+		"subscription_expire_at": expireAt,
+	})
+}
+
+// ReleaseClaim returns a processing purchase to pending so it can be retried.
+func (pr *PurchaseRepository) ReleaseClaim(ctx context.Context, purchaseID int64) error {
+	return pr.updateProcessing(ctx, purchaseID, map[string]interface{}{
+		"status":                PurchaseStatusPending,
+		"processing_started_at": nil,
+	})
+}
+
+func (pr *PurchaseRepository) updateProcessing(ctx context.Context, purchaseID int64, updates map[string]interface{}) error {
+	sql, args, err := sq.Update("purchase").
+		SetMap(updates).
+		Where(sq.Eq{"id": purchaseID, "status": PurchaseStatusProcessing}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	result, err := pr.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("update purchase: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrPurchaseNotClaimed
+	}
+	return nil
+}
+
+// CompletePurchase marks a processing purchase as paid, stores the subscription on the customer, removes the
+// provisioning job and queues the Moynalog receipt, if any, in one transaction.
+func (pr *PurchaseRepository) CompletePurchase(ctx context.Context, purchaseID int64, customerID int64, subscriptionLink string, expireAt time.Time, receipt *Receipt) error {
+	tx, err := pr.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := sq.Update("purchase").
+		Set("status", PurchaseStatusPaid).
+		Set("paid_at", time.Now()).
+		Where(sq.Eq{"id": purchaseID, "status": PurchaseStatusProcessing}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	result, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("update purchase: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrPurchaseNotClaimed
+	}
+
+	sql, args, err = sq.Update("customer").
+		Set("subscription_link", subscriptionLink).
+		Set("expire_at", expireAt).
+		Where(sq.Eq{"id": customerID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("update customer: %w", err)
+	}
+
+	sql, args, err = sq.Delete("provisioning_job").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("delete provisioning job: %w", err)
+	}
+
+	if err := enqueueReceipt(ctx, tx, receipt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// CompleteGiftPurchase marks a processing gift purchase as paid, stores its gift code, removes the provisioning
+// job and queues the Moynalog receipt, if any, in one transaction, so a paid gift always has exactly one code.
+func (pr *PurchaseRepository) CompleteGiftPurchase(ctx context.Context, purchaseID int64, gift *GiftCode, receipt *Receipt) error {
+	tx, err := pr.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	sql, args, err := sq.Update("purchase").
+		Set("status", PurchaseStatusPaid).
+		Set("paid_at", time.Now()).
+		Where(sq.Eq{"id": purchaseID, "status": PurchaseStatusProcessing}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	result, err := tx.Exec(ctx, sql, args...)
+	if err != nil {
+		return fmt.Errorf("update purchase: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrPurchaseNotClaimed
+	}
+
+	sql, args, err = buildInsertGiftCodeQuery(gift).ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	if err = tx.QueryRow(ctx, sql, args...).Scan(&gift.ID, &gift.CreatedAt); err != nil {
+		return fmt.Errorf("insert gift code: %w", err)
+	}
+
+	sql, args, err = sq.Delete("provisioning_job").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("delete provisioning job: %w", err)
+	}
+
+	if err := enqueueReceipt(ctx, tx, receipt); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// MarkRefunded moves a paid purchase to refunded. It returns false if the purchase is not paid,
+// so a refund cannot be started twice.
+func (pr *PurchaseRepository) MarkRefunded(ctx context.Context, purchaseID int64) (bool, error) {
+	sql, args, err := sq.Update("purchase").
+		Set("status", PurchaseStatusRefunded).
+		Set("refunded_at", time.Now()).
+		Where(sq.Eq{"id": purchaseID, "status": PurchaseStatusPaid}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("build query: %w", err)
+	}
 
-	updates := map[string]interface{}{
-		"status":  PurchaseStatusPaid,
-		"paid_at": currentTime,
+	result, err := pr.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("update purchase: %w", err)
 	}
+	return result.RowsAffected() > 0, nil
+}
 
-	return pr.UpdateFields(ctx, purchaseID, updates)
+// RevertRefund returns a purchase to paid when the payment provider rejected the refund.
+func (pr *PurchaseRepository) RevertRefund(ctx context.Context, purchaseID int64) error {
+	sql, args, err := sq.Update("purchase").
+		Set("status", PurchaseStatusPaid).
+		Set("refunded_at", nil).
+		Where(sq.Eq{"id": purchaseID, "status": PurchaseStatusRefunded}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+
+	if _, err := pr.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("update purchase: %w", err)
+	}
+	return nil
 }
 
 func buildLatestActiveTributesQuery(customerIDs []int64) sq.SelectBuilder {
 	return sq.
-		Select("*").
+		Select(purchaseColumns...).
 		From("purchase").
 		Where(sq.And{
 			sq.Eq{"invoice_type": InvoiceTypeTribute},
@@ -248,11 +583,60 @@ func (pr *PurchaseRepository) FindLatestActiveTributesByCustomerIDs(
 	var purchases []Purchase
 	for rows.Next() {
 		var p Purchase
-		if err := rows.Scan(
-			&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
-			&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
-			&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
-		); err != nil {
+		if err := scanPurchase(rows, &p); err != nil {
+			return nil, fmt.Errorf("scan purchase: %w", err)
+		}
+		purchases = append(purchases, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return &purchases, nil
+}
+
+// buildLatestPaidByInvoiceTypeQuery selects the latest own purchase of each customer; gifts are not renewed.
+func buildLatestPaidByInvoiceTypeQuery(customerIDs []int64, invoiceType InvoiceType) sq.SelectBuilder {
+	return sq.
+		Select(purchaseColumns...).
+		From("purchase").
+		Where(sq.And{
+			sq.Eq{"invoice_type": invoiceType},
+			sq.Eq{"status": PurchaseStatusPaid},
+			sq.Eq{"gift": false},
+			sq.Eq{"customer_id": customerIDs},
+			sq.Expr("paid_at = (SELECT MAX(paid_at) FROM purchase p2 WHERE p2.customer_id = purchase.customer_id AND p2.invoice_type = ? AND p2.status = ? AND NOT p2.gift)", invoiceType, PurchaseStatusPaid),
+		})
+}
+
+func (pr *PurchaseRepository) FindLatestPaidByCustomerIDsAndInvoiceType(
+	ctx context.Context,
+	customerIDs []int64,
+	invoiceType InvoiceType,
+) (*[]Purchase, error) {
+	if len(customerIDs) == 0 {
+		empty := make([]Purchase, 0)
+		return &empty, nil
+	}
+
+	builder := buildLatestPaidByInvoiceTypeQuery(customerIDs, invoiceType).PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := builder.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	rows, err := pr.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []Purchase
+	for rows.Next() {
+		var p Purchase
+		if err := scanPurchase(rows, &p); err != nil {
 			return nil, fmt.Errorf("scan purchase: %w", err)
 		}
 		purchases = append(purchases, p)
@@ -271,7 +655,7 @@ func (pr *PurchaseRepository) FindByCustomerIDAndInvoiceTypeLast(
 	invoiceType InvoiceType,
 ) (*Purchase, error) {
 
-	query := sq.Select("*").
+	query := sq.Select(purchaseColumns...).
 		From("purchase").
 		Where(sq.And{
 			sq.Eq{"customer_id": customerID},
@@ -287,11 +671,7 @@ func (pr *PurchaseRepository) FindByCustomerIDAndInvoiceTypeLast(
 	}
 
 	p := &Purchase{}
-	err = pr.pool.QueryRow(ctx, sql, args...).Scan(
-		&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
-		&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
-		&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
-	)
+	err = scanPurchase(pr.pool.QueryRow(ctx, sql, args...), p)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -302,9 +682,43 @@ func (pr *PurchaseRepository) FindByCustomerIDAndInvoiceTypeLast(
 	return p, nil
 }
 
+func (pr *PurchaseRepository) FindByCustomerID(ctx context.Context, customerID int64, limit int) ([]Purchase, error) {
+	query := sq.Select(purchaseColumns...).
+		From("purchase").
+		Where(sq.Eq{"customer_id": customerID}).
+		OrderBy("created_at DESC").
+		Limit(uint64(limit)).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	rows, err := pr.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query purchases: %w", err)
+	}
+	defer rows.Close()
+
+	var purchases []Purchase
+	for rows.Next() {
+		var p Purchase
+		if err := scanPurchase(rows, &p); err != nil {
+			return nil, fmt.Errorf("scan purchase: %w", err)
+		}
+		purchases = append(purchases, p)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate rows: %w", err)
+	}
+
+	return purchases, nil
+}
 
 func (pr *PurchaseRepository) FindSuccessfulPaidPurchaseByCustomer(ctx context.Context, customerID int64) (*Purchase, error) {
-	query := sq.Select("*").
+	query := sq.Select(purchaseColumns...).
 		From("purchase").
 		Where(sq.And{
 			sq.Eq{"customer_id": customerID},
@@ -324,11 +738,33 @@ func (pr *PurchaseRepository) FindSuccessfulPaidPurchaseByCustomer(ctx context.C
 	}
 
 	p := &Purchase{}
-	err = pr.pool.QueryRow(ctx, sql, args...).Scan(
-		&p.ID, &p.Amount, &p.CustomerID, &p.CreatedAt, &p.Month,
-		&p.PaidAt, &p.Currency, &p.ExpireAt, &p.Status, &p.InvoiceType,
-		&p.CryptoInvoiceID, &p.CryptoInvoiceLink, &p.YookasaURL, &p.YookasaID,
-	)
+	err = scanPurchase(pr.pool.QueryRow(ctx, sql, args...), p)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("query purchase: %w", err)
+	}
+
+	return p, nil
+}
+
+// FindLatestPaidByCustomer returns the customer's most recent paid purchase with any payment provider.
+func (pr *PurchaseRepository) FindLatestPaidByCustomer(ctx context.Context, customerID int64) (*Purchase, error) {
+	query := sq.Select(purchaseColumns...).
+		From("purchase").
+		Where(sq.Eq{"customer_id": customerID, "status": PurchaseStatusPaid}).
+		OrderBy("paid_at DESC").
+		Limit(1).
+		PlaceholderFormat(sq.Dollar)
+
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("build query: %w", err)
+	}
+
+	p := &Purchase{}
+	err = scanPurchase(pr.pool.QueryRow(ctx, sql, args...), p)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
@@ -0,0 +1,233 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type ReceiptStatus string
+
+const (
+	// ReceiptStatusPending is a receipt that still has to be sent to Moynalog.
+	ReceiptStatusPending ReceiptStatus = "pending"
+	ReceiptStatusSent    ReceiptStatus = "sent"
+	// ReceiptStatusCancelPending is a receipt that has to be cancelled in Moynalog after a refund or cancellation.
+	ReceiptStatusCancelPending ReceiptStatus = "cancel_pending"
+	ReceiptStatusCancelled     ReceiptStatus = "cancelled"
+)
+
+// ReceiptLease is how long a claimed receipt is hidden from other workers.
+const ReceiptLease = 5 * time.Minute
+
+// Receipt is a Moynalog income receipt for a purchase.
+type Receipt struct {
+	ID            int64         `db:"id"`
+	PurchaseID    int64         `db:"purchase_id"`
+	Amount        float64       `db:"amount"`
+	Comment       string        `db:"comment"`
+	Status        ReceiptStatus `db:"status"`
+	ReceiptUUID   *string       `db:"receipt_uuid"`
+	Attempts      int           `db:"attempts"`
+	NextAttemptAt time.Time     `db:"next_attempt_at"`
+	LastError     *string       `db:"last_error"`
+	AlertedAt     *time.Time    `db:"alerted_at"`
+	CreatedAt     time.Time     `db:"created_at"`
+	SentAt        *time.Time    `db:"sent_at"`
+	CancelledAt   *time.Time    `db:"cancelled_at"`
+}
+
+var receiptColumns = []string{"id", "purchase_id", "amount", "comment", "status", "receipt_uuid", "attempts", "next_attempt_at", "last_error", "alerted_at", "created_at", "sent_at", "cancelled_at"}
+
+func scanReceipt(row rowScanner, r *Receipt) error {
+	return row.Scan(&r.ID, &r.PurchaseID, &r.Amount, &r.Comment, &r.Status, &r.ReceiptUUID, &r.Attempts, &r.NextAttemptAt, &r.LastError, &r.AlertedAt, &r.CreatedAt, &r.SentAt, &r.CancelledAt)
+}
+
+type ReceiptRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewReceiptRepository(pool *pgxpool.Pool) *ReceiptRepository {
+	return &ReceiptRepository{pool: pool}
+}
+
+// buildEnqueueReceiptQuery records a receipt to be sent for the purchase. A purchase gets at most one receipt.
+func buildEnqueueReceiptQuery(receipt *Receipt) sq.InsertBuilder {
+	return sq.Insert("receipt").
+		Columns("purchase_id", "amount", "comment").
+		Values(receipt.PurchaseID, receipt.Amount, receipt.Comment).
+		Suffix("ON CONFLICT (purchase_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar)
+}
+
+// enqueueReceipt queues the receipt in the transaction that marks its purchase paid. A nil receipt queues nothing.
+func enqueueReceipt(ctx context.Context, tx pgx.Tx, receipt *Receipt) error {
+	if receipt == nil {
+		return nil
+	}
+	sql, args, err := buildEnqueueReceiptQuery(receipt).ToSql()
+	if err != nil {
+		return fmt.Errorf("build query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("insert receipt: %w", err)
+	}
+	return nil
+}
+
+func (r *ReceiptRepository) FindByPurchaseID(ctx context.Context, purchaseID int64) (*Receipt, error) {
+	sql, args, err := sq.Select(receiptColumns...).
+		From("receipt").
+		Where(sq.Eq{"purchase_id": purchaseID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select receipt query: %w", err)
+	}
+
+	var receipt Receipt
+	if err := scanReceipt(r.pool.QueryRow(ctx, sql, args...), &receipt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query receipt: %w", err)
+	}
+	return &receipt, nil
+}
+
+func buildClaimReceiptsQuery(where sq.Sqlizer, now time.Time, limit uint64) sq.UpdateBuilder {
+	due := sq.Select("id").
+		From("receipt").
+		Where(sq.Eq{"status": []ReceiptStatus{ReceiptStatusPending, ReceiptStatusCancelPending}}).
+		Where(sq.LtOrEq{"next_attempt_at": now}).
+		Where(where).
+		OrderBy("next_attempt_at").
+		Limit(limit).
+		Suffix("FOR UPDATE SKIP LOCKED")
+
+	return sq.Update("receipt").
+		Set("next_attempt_at", now.Add(ReceiptLease)).
+		Where(sq.Expr("id IN (?)", due)).
+		Suffix("RETURNING " + strings.Join(receiptColumns, ", ")).
+		PlaceholderFormat(sq.Dollar)
+}
+
+// ClaimDue leases the receipts waiting to be sent or cancelled, so concurrent workers do not send them twice.
+func (r *ReceiptRepository) ClaimDue(ctx context.Context, limit uint64) ([]Receipt, error) {
+	return r.claim(ctx, nil, limit)
+}
+
+// ClaimByPurchaseID leases the receipt of the purchase if it is due. It returns nil otherwise.
+func (r *ReceiptRepository) ClaimByPurchaseID(ctx context.Context, purchaseID int64) (*Receipt, error) {
+	receipts, err := r.claim(ctx, sq.Eq{"purchase_id": purchaseID}, 1)
+	if err != nil || len(receipts) == 0 {
+		return nil, err
+	}
+	return &receipts[0], nil
+}
+
+func (r *ReceiptRepository) claim(ctx context.Context, where sq.Sqlizer, limit uint64) ([]Receipt, error) {
+	sql, args, err := buildClaimReceiptsQuery(where, time.Now(), limit).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build claim receipts query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim receipts: %w", err)
+	}
+	defer rows.Close()
+
+	var receipts []Receipt
+	for rows.Next() {
+		var receipt Receipt
+		if err := scanReceipt(rows, &receipt); err != nil {
+			return nil, fmt.Errorf("failed to scan receipt row: %w", err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating receipt rows: %w", rows.Err())
+	}
+	return receipts, nil
+}
+
+// MarkSent stores the Moynalog receipt UUID. If a cancellation was requested while the receipt was being
+// sent, the receipt goes straight to cancel_pending so the new receipt is cancelled too.
+func (r *ReceiptRepository) MarkSent(ctx context.Context, id int64, receiptUUID string) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"receipt_uuid":    receiptUUID,
+		"sent_at":         time.Now(),
+		"status":          sq.Expr("CASE WHEN status = ? THEN ? ELSE ? END", ReceiptStatusPending, ReceiptStatusSent, ReceiptStatusCancelPending),
+		"next_attempt_at": time.Now(),
+		"attempts":        0,
+		"last_error":      nil,
+		"alerted_at":      nil,
+	})
+}
+
+func (r *ReceiptRepository) MarkCancelled(ctx context.Context, id int64) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"status":       ReceiptStatusCancelled,
+		"cancelled_at": time.Now(),
+		"attempts":     0,
+		"last_error":   nil,
+	})
+}
+
+// RequestCancel asks for the receipt of the purchase to be cancelled. It returns false if the purchase
+// has no receipt or it is already cancelled.
+func (r *ReceiptRepository) RequestCancel(ctx context.Context, purchaseID int64) (bool, error) {
+	sql, args, err := sq.Update("receipt").
+		Set("status", ReceiptStatusCancelPending).
+		Set("next_attempt_at", time.Now()).
+		Set("attempts", 0).
+		Set("alerted_at", nil).
+		Where(sq.Eq{"purchase_id": purchaseID, "status": []ReceiptStatus{ReceiptStatusPending, ReceiptStatusSent}}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build cancel receipt query: %w", err)
+	}
+
+	result, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to request receipt cancellation: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// RecordFailure counts a failed attempt and schedules the next one.
+func (r *ReceiptRepository) RecordFailure(ctx context.Context, id int64, cause string, nextAttemptAt time.Time) error {
+	return r.update(ctx, id, map[string]interface{}{
+		"attempts":        sq.Expr("attempts + 1"),
+		"last_error":      cause,
+		"next_attempt_at": nextAttemptAt,
+	})
+}
+
+func (r *ReceiptRepository) MarkAlerted(ctx context.Context, id int64) error {
+	return r.update(ctx, id, map[string]interface{}{"alerted_at": time.Now()})
+}
+
+func (r *ReceiptRepository) update(ctx context.Context, id int64, updates map[string]interface{}) error {
+	sql, args, err := sq.Update("receipt").
+		SetMap(updates).
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update receipt query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to update receipt: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+func TestBuildClaimReceiptsQuery(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	sql, args, err := buildClaimReceiptsQuery(sq.Eq{"purchase_id": int64(5)}, now, 1).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "UPDATE receipt SET next_attempt_at = $1 WHERE id IN (SELECT id FROM receipt WHERE status IN ($2,$3) AND next_attempt_at <= $4 AND purchase_id = $5 ORDER BY next_attempt_at LIMIT 1 FOR UPDATE SKIP LOCKED) RETURNING " +
+		"id, purchase_id, amount, comment, status, receipt_uuid, attempts, next_attempt_at, last_error, alerted_at, created_at, sent_at, cancelled_at"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{now.Add(ReceiptLease), ReceiptStatusPending, ReceiptStatusCancelPending, now, int64(5)}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestBuildEnqueueReceiptQuery(t *testing.T) {
+	sql, args, err := buildEnqueueReceiptQuery(&Receipt{PurchaseID: 5, Amount: 249.5, Comment: "Подписка"}).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "INSERT INTO receipt (purchase_id,amount,comment) VALUES ($1,$2,$3) ON CONFLICT (purchase_id) DO NOTHING"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{int64(5), 249.5, "Подписка"}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
@@ -7,15 +7,49 @@ import (
 	sq "github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"strings"
 	"time"
 )
 
+type ReferralStatus string
+
+const (
+	ReferralStatusAccepted ReferralStatus = "accepted"
+	// ReferralStatusFlagged withholds the rewards of the referral until an admin reviews it.
+	ReferralStatusFlagged  ReferralStatus = "flagged"
+	ReferralStatusApproved ReferralStatus = "approved"
+	ReferralStatusRejected ReferralStatus = "rejected"
+)
+
+const (
+	// ReferralFlagSuspicious marks a referee whose profile is flagged by utils.IsSuspiciousUser.
+	ReferralFlagSuspicious = "suspicious_profile"
+	// ReferralFlagBurst marks referees with the same name pattern invited by one referrer within a short window.
+	ReferralFlagBurst = "burst"
+)
+
 type Referral struct {
-	ID           int64     `db:"id"`
-	ReferrerID   int64     `db:"referrer_id"`
-	RefereeID    int64     `db:"referee_id"`
-	UsedAt       time.Time `db:"used_at"`
-	BonusGranted bool      `db:"bonus_granted"`
+	ID         int64          `db:"id"`
+	ReferrerID int64          `db:"referrer_id"`
+	RefereeID  int64          `db:"referee_id"`
+	UsedAt     time.Time      `db:"used_at"`
+	Status     ReferralStatus `db:"status"`
+	FlagReason *string        `db:"flag_reason"`
+	// Pattern is the normalized name of the referee used to spot bursts of similar accounts.
+	Pattern    *string    `db:"pattern"`
+	ReviewedAt *time.Time `db:"reviewed_at"`
+	ReviewedBy *int64     `db:"reviewed_by"`
+}
+
+// RewardsWithheld reports whether the referral is flagged or rejected and must not earn rewards.
+func (r Referral) RewardsWithheld() bool {
+	return r.Status == ReferralStatusFlagged || r.Status == ReferralStatusRejected
+}
+
+var referralColumns = []string{"id", "referrer_id", "referee_id", "used_at", "status", "flag_reason", "pattern", "reviewed_at", "reviewed_by"}
+
+func scanReferral(row rowScanner, ref *Referral) error {
+	return row.Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.UsedAt, &ref.Status, &ref.FlagReason, &ref.Pattern, &ref.ReviewedAt, &ref.ReviewedBy)
 }
 
 type ReferralRepository struct {
@@ -26,11 +60,11 @@ func NewReferralRepository(pool *pgxpool.Pool) *ReferralRepository {
 	return &ReferralRepository{pool: pool}
 }
 
-func (r *ReferralRepository) Create(ctx context.Context, referrerID, refereeID int64) (*Referral, error) {
+func (r *ReferralRepository) Create(ctx context.Context, referral *Referral) (*Referral, error) {
 	query := sq.Insert("referral").
-		Columns("referrer_id", "referee_id", "used_at", "bonus_granted").
-		Values(referrerID, refereeID, sq.Expr("NOW()"), false).
-		Suffix("RETURNING id, referrer_id, referee_id, used_at, bonus_granted").
+		Columns("referrer_id", "referee_id", "used_at", "status", "flag_reason", "pattern").
+		Values(referral.ReferrerID, referral.RefereeID, sq.Expr("NOW()"), referral.Status, referral.FlagReason, referral.Pattern).
+		Suffix("RETURNING " + strings.Join(referralColumns, ", ")).
 		PlaceholderFormat(sq.Dollar)
 
 	sql, args, err := query.ToSql()
@@ -38,16 +72,15 @@ func (r *ReferralRepository) Create(ctx context.Context, referrerID, refereeID i
 		return nil, fmt.Errorf("failed to build insert referral query: %w", err)
 	}
 
-	row := r.pool.QueryRow(ctx, sql, args...)
 	var ref Referral
-	if err := row.Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.UsedAt, &ref.BonusGranted); err != nil {
+	if err := scanReferral(r.pool.QueryRow(ctx, sql, args...), &ref); err != nil {
 		return nil, fmt.Errorf("failed to scan inserted referral: %w", err)
 	}
 	return &ref, nil
 }
 
 func (r *ReferralRepository) FindByReferrer(ctx context.Context, referrerID int64) ([]Referral, error) {
-	query := sq.Select("id", "referrer_id", "referee_id", "used_at", "bonus_granted").
+	query := sq.Select(referralColumns...).
 		From("referral").
 		Where(sq.Eq{"referrer_id": referrerID}).
 		OrderBy("used_at DESC").
@@ -58,16 +91,52 @@ func (r *ReferralRepository) FindByReferrer(ctx context.Context, referrerID int6
 		return nil, fmt.Errorf("failed to build select referrals by referrer query: %w", err)
 	}
 
+	return r.queryReferrals(ctx, sql, args)
+}
+
+// FindRecentByReferrer returns the referrals the referrer made since the given time.
+func (r *ReferralRepository) FindRecentByReferrer(ctx context.Context, referrerID int64, since time.Time) ([]Referral, error) {
+	sql, args, err := sq.Select(referralColumns...).
+		From("referral").
+		Where(sq.Eq{"referrer_id": referrerID}).
+		Where(sq.GtOrEq{"used_at": since}).
+		OrderBy("used_at DESC").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select recent referrals query: %w", err)
+	}
+
+	return r.queryReferrals(ctx, sql, args)
+}
+
+// FindFlagged returns the referrals waiting for review, oldest first.
+func (r *ReferralRepository) FindFlagged(ctx context.Context, limit int) ([]Referral, error) {
+	sql, args, err := sq.Select(referralColumns...).
+		From("referral").
+		Where(sq.Eq{"status": ReferralStatusFlagged}).
+		OrderBy("used_at", "id").
+		Limit(uint64(limit)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select flagged referrals query: %w", err)
+	}
+
+	return r.queryReferrals(ctx, sql, args)
+}
+
+func (r *ReferralRepository) queryReferrals(ctx context.Context, sql string, args []interface{}) ([]Referral, error) {
 	rows, err := r.pool.Query(ctx, sql, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query referrals by referrer: %w", err)
+		return nil, fmt.Errorf("failed to query referrals: %w", err)
 	}
 	defer rows.Close()
 
 	var list []Referral
 	for rows.Next() {
 		var ref Referral
-		if err := rows.Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.UsedAt, &ref.BonusGranted); err != nil {
+		if err := scanReferral(rows, &ref); err != nil {
 			return nil, fmt.Errorf("failed to scan referral row: %w", err)
 		}
 		list = append(list, ref)
@@ -97,45 +166,134 @@ func (r *ReferralRepository) CountByReferrer(ctx context.Context, referrerID int
 }
 
 func (r *ReferralRepository) FindByReferee(ctx context.Context, refereeID int64) (*Referral, error) {
-	query := sq.Select("id", "referrer_id", "referee_id", "used_at", "bonus_granted").
+	return r.findOne(ctx, sq.Eq{"referee_id": refereeID})
+}
+
+func (r *ReferralRepository) FindById(ctx context.Context, id int64) (*Referral, error) {
+	return r.findOne(ctx, sq.Eq{"id": id})
+}
+
+func (r *ReferralRepository) findOne(ctx context.Context, where sq.Eq) (*Referral, error) {
+	query := sq.Select(referralColumns...).
 		From("referral").
-		Where(sq.Eq{"referee_id": refereeID}).
+		Where(where).
 		Limit(1).
 		PlaceholderFormat(sq.Dollar)
 
 	sql, args, err := query.ToSql()
 	if err != nil {
-		return nil, fmt.Errorf("failed to build select referral by referee query: %w", err)
+		return nil, fmt.Errorf("failed to build select referral query: %w", err)
 	}
 
 	var ref Referral
-	err = r.pool.QueryRow(ctx, sql, args...).Scan(&ref.ID, &ref.ReferrerID, &ref.RefereeID, &ref.UsedAt, &ref.BonusGranted)
+	err = scanReferral(r.pool.QueryRow(ctx, sql, args...), &ref)
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
-		return nil, fmt.Errorf("failed to query referral by referee: %w", err)
+		return nil, fmt.Errorf("failed to query referral: %w", err)
 	}
 	return &ref, nil
 }
 
-func (r *ReferralRepository) MarkBonusGranted(ctx context.Context, referralID int64) error {
-	query := sq.Update("referral").
-		Set("bonus_granted", true).
-		Where(sq.Eq{"id": referralID}).
+// Flag withholds the rewards of accepted referrals; reviewed referrals keep the admin's decision.
+func (r *ReferralRepository) Flag(ctx context.Context, ids []int64, reason string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	sql, args, err := sq.Update("referral").
+		Set("status", ReferralStatusFlagged).
+		Set("flag_reason", reason).
+		Where(sq.Eq{"id": ids, "status": ReferralStatusAccepted}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build flag referrals query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to flag referrals: %w", err)
+	}
+	return nil
+}
+
+func buildReviewReferralQuery(id int64, status ReferralStatus, reviewerID int64, now time.Time) sq.UpdateBuilder {
+	return sq.Update("referral").
+		Set("status", status).
+		Set("reviewed_at", now).
+		Set("reviewed_by", reviewerID).
+		Where(sq.Eq{"id": id, "status": ReferralStatusFlagged}).
+		Suffix("RETURNING " + strings.Join(referralColumns, ", ")).
 		PlaceholderFormat(sq.Dollar)
+}
 
-	sql, args, err := query.ToSql()
+// Review records the admin's decision on a flagged referral. It returns nil when the referral is not flagged.
+func (r *ReferralRepository) Review(ctx context.Context, id int64, status ReferralStatus, reviewerID int64) (*Referral, error) {
+	sql, args, err := buildReviewReferralQuery(id, status, reviewerID, time.Now()).ToSql()
 	if err != nil {
-		return fmt.Errorf("failed to build update bonus_granted query: %w", err)
+		return nil, fmt.Errorf("failed to build review referral query: %w", err)
 	}
 
-	res, err := r.pool.Exec(ctx, sql, args...)
+	var ref Referral
+	if err := scanReferral(r.pool.QueryRow(ctx, sql, args...), &ref); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to review referral: %w", err)
+	}
+	return &ref, nil
+}
+
+// Invitee is a customer invited by a referrer with their progress and the referrer rewards they earned.
+type Invitee struct {
+	TelegramID int64
+	// Username is nil when the customer has no username or was removed by /sync.
+	Username  *string
+	InvitedAt time.Time
+	Trial     bool
+	Paid      bool
+	// BonusDays is the sum of the referrer rewards earned by the invitee's purchases, LastBonusAt the date of the latest one.
+	BonusDays   int
+	LastBonusAt *time.Time
+}
+
+func buildInviteesQuery(referrerID int64, limit, offset int) sq.SelectBuilder {
+	return sq.Select("r.referee_id", "c.username", "r.used_at", "EXISTS (SELECT 1 FROM trial_activation t WHERE t.telegram_id = r.referee_id)").
+		Column(sq.Expr("EXISTS (SELECT 1 FROM purchase p WHERE p.customer_id = c.id AND p.status = ?)", PurchaseStatusPaid)).
+		Column(sq.Expr("(SELECT COALESCE(SUM(rr.days), 0) FROM referral_reward rr WHERE rr.referral_id = r.id AND rr.kind = ?)", ReferralRewardReferrer)).
+		Column(sq.Expr("(SELECT MAX(rr.created_at) FROM referral_reward rr WHERE rr.referral_id = r.id AND rr.kind = ?)", ReferralRewardReferrer)).
+		From("referral r").
+		LeftJoin("customer c ON c.telegram_id = r.referee_id").
+		Where(sq.Eq{"r.referrer_id": referrerID}).
+		OrderBy("r.used_at DESC", "r.id DESC").
+		Limit(uint64(limit)).
+		Offset(uint64(offset)).
+		PlaceholderFormat(sq.Dollar)
+}
+
+// FindInvitees returns a page of the customers invited by the referrer, newest first.
+func (r *ReferralRepository) FindInvitees(ctx context.Context, referrerID int64, limit, offset int) ([]Invitee, error) {
+	sql, args, err := buildInviteesQuery(referrerID, limit, offset).ToSql()
 	if err != nil {
-		return fmt.Errorf("failed to execute update bonus_granted: %w", err)
+		return nil, fmt.Errorf("failed to build select invitees query: %w", err)
 	}
-	if res.RowsAffected() == 0 {
-		return errors.New("no referral record updated")
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query invitees: %w", err)
 	}
-	return nil
+	defer rows.Close()
+
+	var invitees []Invitee
+	for rows.Next() {
+		var i Invitee
+		if err := rows.Scan(&i.TelegramID, &i.Username, &i.InvitedAt, &i.Trial, &i.Paid, &i.BonusDays, &i.LastBonusAt); err != nil {
+			return nil, fmt.Errorf("failed to scan invitee row: %w", err)
+		}
+		invitees = append(invitees, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating invitee rows: %w", err)
+	}
+	return invitees, nil
 }
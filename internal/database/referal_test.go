@@ -0,0 +1,49 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildInviteesQuery(t *testing.T) {
+	sql, args, err := buildInviteesQuery(5, 10, 20).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "SELECT r.referee_id, c.username, r.used_at, EXISTS (SELECT 1 FROM trial_activation t WHERE t.telegram_id = r.referee_id), " +
+		"EXISTS (SELECT 1 FROM purchase p WHERE p.customer_id = c.id AND p.status = $1), " +
+		"(SELECT COALESCE(SUM(rr.days), 0) FROM referral_reward rr WHERE rr.referral_id = r.id AND rr.kind = $2), " +
+		"(SELECT MAX(rr.created_at) FROM referral_reward rr WHERE rr.referral_id = r.id AND rr.kind = $3) " +
+		"FROM referral r LEFT JOIN customer c ON c.telegram_id = r.referee_id WHERE r.referrer_id = $4 " +
+		"ORDER BY r.used_at DESC, r.id DESC LIMIT 10 OFFSET 20"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{PurchaseStatusPaid, ReferralRewardReferrer, ReferralRewardReferrer, int64(5)}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestBuildReviewReferralQueryOnlyChangesFlagged(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+
+	sql, args, err := buildReviewReferralQuery(4, ReferralStatusApproved, 9, now).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "UPDATE referral SET status = $1, reviewed_at = $2, reviewed_by = $3 WHERE id = $4 AND status = $5 " +
+		"RETURNING id, referrer_id, referee_id, used_at, status, flag_reason, pattern, reviewed_at, reviewed_by"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{ReferralStatusApproved, now, int64(9), int64(4), ReferralStatusFlagged}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
@@ -0,0 +1,215 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+)
+
+type ReferralRewardKind string
+
+const (
+	// ReferralRewardReferrer is granted to the inviter for a paid purchase of the invited customer.
+	ReferralRewardReferrer ReferralRewardKind = "referrer"
+	// ReferralRewardReferee is the welcome bonus of the invited customer.
+	ReferralRewardReferee ReferralRewardKind = "referee"
+	// ReferralRewardTier is granted to the inviter once their paying referrals reach a tier.
+	ReferralRewardTier ReferralRewardKind = "tier"
+)
+
+// ReferralReward is an entry of the referral ledger. Recipients are stored by telegram id, so the ledger
+// outlives customers removed by /sync.
+type ReferralReward struct {
+	ID                  int64              `db:"id"`
+	ReferralID          *int64             `db:"referral_id"`
+	RecipientTelegramID int64              `db:"recipient_telegram_id"`
+	Kind                ReferralRewardKind `db:"kind"`
+	// PurchaseID is the purchase that earned the reward, nil for tier rewards and bonuses granted before the ledger.
+	PurchaseID *int64 `db:"purchase_id"`
+	Days       int    `db:"days"`
+	// Tier is the number of paying referrals of a tier reward.
+	Tier      *int      `db:"tier"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+func buildInsertReferralRewardQuery(reward *ReferralReward) sq.InsertBuilder {
+	return sq.Insert("referral_reward").
+		Columns("referral_id", "recipient_telegram_id", "kind", "purchase_id", "days", "tier").
+		Values(reward.ReferralID, reward.RecipientTelegramID, reward.Kind, reward.PurchaseID, reward.Days, reward.Tier).
+		Suffix("ON CONFLICT DO NOTHING RETURNING id, created_at").
+		PlaceholderFormat(sq.Dollar)
+}
+
+// CreateReward records the reward before it is granted. It returns false when the purchase already earned
+// a reward of this kind or the tier was already reached, so a reward is never granted twice.
+func (r *ReferralRepository) CreateReward(ctx context.Context, reward *ReferralReward) (bool, error) {
+	sql, args, err := buildInsertReferralRewardQuery(reward).ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build insert referral reward query: %w", err)
+	}
+
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&reward.ID, &reward.CreatedAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to insert referral reward: %w", err)
+	}
+	return true, nil
+}
+
+// DeleteReward removes a reward that could not be granted, so it is granted again when the purchase is retried.
+func (r *ReferralRepository) DeleteReward(ctx context.Context, id int64) error {
+	sql, args, err := sq.Delete("referral_reward").
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build delete referral reward query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to delete referral reward: %w", err)
+	}
+	return nil
+}
+
+func buildHasRewardQuery(referralID int64, kind ReferralRewardKind, excludePurchaseID int64) sq.SelectBuilder {
+	return sq.Select("1").
+		Prefix("SELECT EXISTS (").
+		From("referral_reward").
+		Where(sq.Eq{"referral_id": referralID, "kind": kind}).
+		Where(sq.Expr("purchase_id IS DISTINCT FROM ?", excludePurchaseID)).
+		Suffix(")").
+		PlaceholderFormat(sq.Dollar)
+}
+
+// HasReward reports whether the referral earned a reward of the kind for a purchase other than excludePurchaseID.
+func (r *ReferralRepository) HasReward(ctx context.Context, referralID int64, kind ReferralRewardKind, excludePurchaseID int64) (bool, error) {
+	sql, args, err := buildHasRewardQuery(referralID, kind, excludePurchaseID).ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build referral reward exists query: %w", err)
+	}
+
+	var exists bool
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to query referral reward: %w", err)
+	}
+	return exists, nil
+}
+
+func buildCountPayingReferralsQuery(referrerID int64) sq.SelectBuilder {
+	return sq.Select("COUNT(*)").
+		From("referral r").
+		Where(sq.Eq{"r.referrer_id": referrerID}).
+		Where(sq.NotEq{"r.status": []ReferralStatus{ReferralStatusFlagged, ReferralStatusRejected}}).
+		Where(sq.Expr("EXISTS (SELECT 1 FROM purchase p JOIN customer c ON c.id = p.customer_id WHERE c.telegram_id = r.referee_id AND p.status = ?)", PurchaseStatusPaid)).
+		PlaceholderFormat(sq.Dollar)
+}
+
+// CountPayingReferrals counts the customers invited by the referrer who have at least one paid purchase. Flagged and
+// rejected referrals are not counted.
+func (r *ReferralRepository) CountPayingReferrals(ctx context.Context, referrerID int64) (int, error) {
+	sql, args, err := buildCountPayingReferralsQuery(referrerID).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build count paying referrals query: %w", err)
+	}
+
+	var count int
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count paying referrals: %w", err)
+	}
+	return count, nil
+}
+
+// FindRewardedTiers returns the tiers already granted to the referrer.
+func (r *ReferralRepository) FindRewardedTiers(ctx context.Context, referrerID int64) ([]int, error) {
+	sql, args, err := sq.Select("tier").
+		From("referral_reward").
+		Where(sq.Eq{"recipient_telegram_id": referrerID, "kind": ReferralRewardTier}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select rewarded tiers query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query rewarded tiers: %w", err)
+	}
+	defer rows.Close()
+
+	var tiers []int
+	for rows.Next() {
+		var tier int
+		if err := rows.Scan(&tier); err != nil {
+			return nil, fmt.Errorf("failed to scan rewarded tier: %w", err)
+		}
+		tiers = append(tiers, tier)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rewarded tiers: %w", err)
+	}
+	return tiers, nil
+}
+
+// ReferralRewardTotals summarises the rewards received by a customer.
+type ReferralRewardTotals struct {
+	Rewards int
+	Days    int
+}
+
+// FindRewardTotals counts the rewards received by the customer and the days they added.
+func (r *ReferralRepository) FindRewardTotals(ctx context.Context, recipientID int64) (ReferralRewardTotals, error) {
+	sql, args, err := sq.Select("COUNT(*)", "COALESCE(SUM(days), 0)").
+		From("referral_reward").
+		Where(sq.Eq{"recipient_telegram_id": recipientID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return ReferralRewardTotals{}, fmt.Errorf("failed to build referral reward totals query: %w", err)
+	}
+
+	var totals ReferralRewardTotals
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&totals.Rewards, &totals.Days); err != nil {
+		return ReferralRewardTotals{}, fmt.Errorf("failed to query referral reward totals: %w", err)
+	}
+	return totals, nil
+}
+
+// FindRewardsByRecipient returns a page of the rewards received by the customer, newest first.
+func (r *ReferralRepository) FindRewardsByRecipient(ctx context.Context, recipientID int64, limit, offset int) ([]ReferralReward, error) {
+	sql, args, err := sq.Select("id", "referral_id", "recipient_telegram_id", "kind", "purchase_id", "days", "tier", "created_at").
+		From("referral_reward").
+		Where(sq.Eq{"recipient_telegram_id": recipientID}).
+		OrderBy("created_at DESC", "id DESC").
+		Limit(uint64(limit)).
+		Offset(uint64(offset)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select referral rewards query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query referral rewards: %w", err)
+	}
+	defer rows.Close()
+
+	var rewards []ReferralReward
+	for rows.Next() {
+		var rw ReferralReward
+		if err := rows.Scan(&rw.ID, &rw.ReferralID, &rw.RecipientTelegramID, &rw.Kind, &rw.PurchaseID, &rw.Days, &rw.Tier, &rw.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan referral reward row: %w", err)
+		}
+		rewards = append(rewards, rw)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating referral reward rows: %w", err)
+	}
+	return rewards, nil
+}
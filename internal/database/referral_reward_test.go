@@ -0,0 +1,63 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildHasRewardQuery(t *testing.T) {
+	sql, args, err := buildHasRewardQuery(3, ReferralRewardReferee, 9).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "SELECT EXISTS ( SELECT 1 FROM referral_reward WHERE kind = $1 AND referral_id = $2 AND purchase_id IS DISTINCT FROM $3 )"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{ReferralRewardReferee, int64(3), int64(9)}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestBuildCountPayingReferralsQuery(t *testing.T) {
+	sql, args, err := buildCountPayingReferralsQuery(5).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "SELECT COUNT(*) FROM referral r WHERE r.referrer_id = $1 AND r.status NOT IN ($2,$3) AND EXISTS (SELECT 1 FROM purchase p " +
+		"JOIN customer c ON c.id = p.customer_id WHERE c.telegram_id = r.referee_id AND p.status = $4)"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{int64(5), ReferralStatusFlagged, ReferralStatusRejected, PurchaseStatusPaid}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestBuildInsertReferralRewardQuerySkipsConflicts(t *testing.T) {
+	tier := 5
+	sql, args, err := buildInsertReferralRewardQuery(&ReferralReward{
+		RecipientTelegramID: 7,
+		Kind:                ReferralRewardTier,
+		Days:                14,
+		Tier:                &tier,
+	}).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "INSERT INTO referral_reward (referral_id,recipient_telegram_id,kind,purchase_id,days,tier) " +
+		"VALUES ($1,$2,$3,$4,$5,$6) ON CONFLICT DO NOTHING RETURNING id, created_at"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+	if len(args) != 6 || args[1] != int64(7) || args[2] != ReferralRewardTier || args[4] != 14 {
+		t.Fatalf("unexpected args: %v", args)
+	}
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type StaffRole string
+
+const (
+	StaffRoleOwner   StaffRole = "owner"
+	StaffRoleAdmin   StaffRole = "admin"
+	StaffRoleSupport StaffRole = "support"
+	StaffRoleFinance StaffRole = "finance"
+)
+
+// StaffMember is a Telegram user with access to admin commands. ADMIN_TELEGRAM_ID is not stored here,
+// it is always an owner.
+type StaffMember struct {
+	TelegramID int64     `db:"telegram_id"`
+	Role       StaffRole `db:"role"`
+	AddedBy    *int64    `db:"added_by"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type StaffRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewStaffRepository(pool *pgxpool.Pool) *StaffRepository {
+	return &StaffRepository{pool: pool}
+}
+
+func buildSaveStaffMemberQuery(telegramID int64, role StaffRole, addedBy int64) sq.InsertBuilder {
+	return sq.Insert("staff").
+		Columns("telegram_id", "role", "added_by").
+		Values(telegramID, role, addedBy).
+		Suffix("ON CONFLICT (telegram_id) DO UPDATE SET role = EXCLUDED.role, added_by = EXCLUDED.added_by").
+		PlaceholderFormat(sq.Dollar)
+}
+
+// Save adds the staff member or changes the role of an existing one.
+func (r *StaffRepository) Save(ctx context.Context, telegramID int64, role StaffRole, addedBy int64) error {
+	sql, args, err := buildSaveStaffMemberQuery(telegramID, role, addedBy).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build save staff member query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to save staff member: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the staff member and reports whether one existed.
+func (r *StaffRepository) Delete(ctx context.Context, telegramID int64) (bool, error) {
+	sql, args, err := sq.Delete("staff").
+		Where(sq.Eq{"telegram_id": telegramID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build delete staff member query: %w", err)
+	}
+
+	tag, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete staff member: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *StaffRepository) FindAll(ctx context.Context) ([]StaffMember, error) {
+	sql, args, err := sq.Select("telegram_id", "role", "added_by", "created_at").
+		From("staff").
+		OrderBy("created_at", "telegram_id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select staff query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query staff: %w", err)
+	}
+	defer rows.Close()
+
+	var list []StaffMember
+	for rows.Next() {
+		var m StaffMember
+		if err := rows.Scan(&m.TelegramID, &m.Role, &m.AddedBy, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan staff row: %w", err)
+		}
+		list = append(list, m)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating staff rows: %w", rows.Err())
+	}
+	return list, nil
+}
@@ -0,0 +1,23 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildSaveStaffMemberQuery(t *testing.T) {
+	sql, args, err := buildSaveStaffMemberQuery(42, StaffRoleSupport, 7).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "INSERT INTO staff (telegram_id,role,added_by) VALUES ($1,$2,$3) ON CONFLICT (telegram_id) DO UPDATE SET role = EXCLUDED.role, added_by = EXCLUDED.added_by"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{int64(42), StaffRoleSupport, int64(7)}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
@@ -0,0 +1,185 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// RevenueStat is the revenue of one payment provider in one currency. Refunded purchases are not counted.
+type RevenueStat struct {
+	InvoiceType InvoiceType
+	Currency    string
+	Purchases   int
+	Amount      float64
+}
+
+type ReferrerStat struct {
+	TelegramID int64
+	Username   *string
+	Referrals  int
+	// Paying is the number of invited customers with at least one paid purchase.
+	Paying int
+}
+
+// Stats aggregates sales and customers since a point in time. Subscriber counts are a snapshot of now.
+type Stats struct {
+	Since              time.Time
+	Revenue            []RevenueStat
+	NewCustomers       int
+	Trials             int
+	TrialsConverted    int
+	ActiveSubscribers  int
+	ExpiredSubscribers int
+	TopReferrers       []ReferrerStat
+}
+
+type StatsRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewStatsRepository(pool *pgxpool.Pool) *StatsRepository {
+	return &StatsRepository{pool: pool}
+}
+
+func buildRevenueStatsQuery(since time.Time) sq.SelectBuilder {
+	return sq.Select("invoice_type", "currency", "COUNT(*)", "COALESCE(SUM(amount), 0)").
+		From("purchase").
+		Where(sq.Eq{"status": PurchaseStatusPaid}).
+		Where(sq.GtOrEq{"paid_at": since}).
+		GroupBy("invoice_type", "currency").
+		OrderBy("invoice_type", "currency").
+		PlaceholderFormat(sq.Dollar)
+}
+
+// buildTrialStatsQuery counts trials activated since the given time and how many of those customers paid afterwards.
+func buildTrialStatsQuery(since time.Time) sq.SelectBuilder {
+	return sq.Select("COUNT(*)").
+		Column(sq.Expr("COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM purchase p JOIN customer c ON c.id = p.customer_id WHERE c.telegram_id = t.telegram_id AND p.status = ? AND p.paid_at > t.activated_at))", PurchaseStatusPaid)).
+		From("trial_activation t").
+		Where(sq.GtOrEq{"t.activated_at": since}).
+		PlaceholderFormat(sq.Dollar)
+}
+
+func buildSubscriberStatsQuery(now time.Time) sq.SelectBuilder {
+	return sq.Select().
+		Column(sq.Expr("COUNT(*) FILTER (WHERE expire_at > ?)", now)).
+		Column(sq.Expr("COUNT(*) FILTER (WHERE expire_at <= ?)", now)).
+		From("customer").
+		Where(sq.NotEq{"expire_at": nil}).
+		PlaceholderFormat(sq.Dollar)
+}
+
+func buildTopReferrersQuery(since time.Time, limit uint64) sq.SelectBuilder {
+	return sq.Select("r.referrer_id", "c.username", "COUNT(*)").
+		Column(sq.Expr("COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM purchase p JOIN customer rc ON rc.id = p.customer_id WHERE rc.telegram_id = r.referee_id AND p.status = ?))", PurchaseStatusPaid)).
+		From("referral r").
+		LeftJoin("customer c ON c.telegram_id = r.referrer_id").
+		Where(sq.GtOrEq{"r.used_at": since}).
+		GroupBy("r.referrer_id", "c.username").
+		OrderBy("COUNT(*) DESC", "r.referrer_id").
+		Limit(limit).
+		PlaceholderFormat(sq.Dollar)
+}
+
+// Collect gathers the stats since the given time, with at most referrersLimit top referrers.
+func (r *StatsRepository) Collect(ctx context.Context, since, now time.Time, referrersLimit uint64) (*Stats, error) {
+	stats := &Stats{Since: since}
+
+	revenue, err := r.revenue(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	stats.Revenue = revenue
+
+	sql, args, err := sq.Select("COUNT(*)").
+		From("customer").
+		Where(sq.GtOrEq{"created_at": since}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build new customers stats query: %w", err)
+	}
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&stats.NewCustomers); err != nil {
+		return nil, fmt.Errorf("failed to query new customers stats: %w", err)
+	}
+
+	sql, args, err = buildTrialStatsQuery(since).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build trial stats query: %w", err)
+	}
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&stats.Trials, &stats.TrialsConverted); err != nil {
+		return nil, fmt.Errorf("failed to query trial stats: %w", err)
+	}
+
+	sql, args, err = buildSubscriberStatsQuery(now).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build subscriber stats query: %w", err)
+	}
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&stats.ActiveSubscribers, &stats.ExpiredSubscribers); err != nil {
+		return nil, fmt.Errorf("failed to query subscriber stats: %w", err)
+	}
+
+	referrers, err := r.topReferrers(ctx, since, referrersLimit)
+	if err != nil {
+		return nil, err
+	}
+	stats.TopReferrers = referrers
+
+	return stats, nil
+}
+
+func (r *StatsRepository) revenue(ctx context.Context, since time.Time) ([]RevenueStat, error) {
+	sql, args, err := buildRevenueStatsQuery(since).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build revenue stats query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query revenue stats: %w", err)
+	}
+	defer rows.Close()
+
+	var list []RevenueStat
+	for rows.Next() {
+		var stat RevenueStat
+		if err := rows.Scan(&stat.InvoiceType, &stat.Currency, &stat.Purchases, &stat.Amount); err != nil {
+			return nil, fmt.Errorf("failed to scan revenue stats row: %w", err)
+		}
+		list = append(list, stat)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating revenue stats rows: %w", rows.Err())
+	}
+	return list, nil
+}
+
+func (r *StatsRepository) topReferrers(ctx context.Context, since time.Time, limit uint64) ([]ReferrerStat, error) {
+	sql, args, err := buildTopReferrersQuery(since, limit).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build top referrers query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query top referrers: %w", err)
+	}
+	defer rows.Close()
+
+	var list []ReferrerStat
+	for rows.Next() {
+		var stat ReferrerStat
+		if err := rows.Scan(&stat.TelegramID, &stat.Username, &stat.Referrals, &stat.Paying); err != nil {
+			return nil, fmt.Errorf("failed to scan top referrers row: %w", err)
+		}
+		list = append(list, stat)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating top referrers rows: %w", rows.Err())
+	}
+	return list, nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildTrialStatsQuery(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sql, args, err := buildTrialStatsQuery(since).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "SELECT COUNT(*), COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM purchase p JOIN customer c ON c.id = p.customer_id " +
+		"WHERE c.telegram_id = t.telegram_id AND p.status = $1 AND p.paid_at > t.activated_at)) FROM trial_activation t WHERE t.activated_at >= $2"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{PurchaseStatusPaid, since}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestBuildTopReferrersQuery(t *testing.T) {
+	since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sql, args, err := buildTopReferrersQuery(since, 5).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "SELECT r.referrer_id, c.username, COUNT(*), COUNT(*) FILTER (WHERE EXISTS (SELECT 1 FROM purchase p JOIN customer rc ON rc.id = p.customer_id WHERE rc.telegram_id = r.referee_id AND p.status = $1)) FROM referral r LEFT JOIN customer c ON c.telegram_id = r.referrer_id WHERE r.used_at >= $2 GROUP BY r.referrer_id, c.username ORDER BY COUNT(*) DESC, r.referrer_id LIMIT 5"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{PurchaseStatusPaid, since}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
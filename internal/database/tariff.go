@@ -0,0 +1,190 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Tariff is a subscription plan from the catalogue. Name may be a translation key.
+type Tariff struct {
+	ID                   int64      `db:"id"`
+	Name                 string     `db:"name"`
+	DurationDays         int        `db:"duration_days"`
+	PriceRub             int        `db:"price_rub"`
+	PriceStars           int        `db:"price_stars"`
+	PriceCrypto          int        `db:"price_crypto"`
+	TrafficLimitGB       int        `db:"traffic_limit_gb"`
+	TrafficResetStrategy string     `db:"traffic_reset_strategy"`
+	InternalSquads       []string   `db:"internal_squads"`
+	ExternalSquad        *uuid.UUID `db:"external_squad"`
+	DeviceLimit          *int       `db:"device_limit"`
+	SortOrder            int        `db:"sort_order"`
+	Active               bool       `db:"active"`
+	CreatedAt            time.Time  `db:"created_at"`
+
+	// ReceiptComment is the Moynalog receipt comment template. Nil means MOYNALOG_RECEIPT_COMMENT is used.
+	ReceiptComment *string `db:"receipt_comment"`
+}
+
+// Price returns the tariff price in the currency of the payment method. Zero means the method is not offered.
+func (t *Tariff) Price(invoiceType InvoiceType) int {
+	switch invoiceType {
+	case InvoiceTypeTelegram:
+		return t.PriceStars
+	case InvoiceTypeCrypto:
+		return t.PriceCrypto
+	default:
+		return t.PriceRub
+	}
+}
+
+var tariffColumns = []string{"id", "name", "duration_days", "price_rub", "price_stars", "price_crypto", "traffic_limit_gb", "traffic_reset_strategy", "internal_squads", "external_squad", "device_limit", "receipt_comment", "sort_order", "active", "created_at"}
+
+func scanTariff(row rowScanner, t *Tariff) error {
+	return row.Scan(&t.ID, &t.Name, &t.DurationDays, &t.PriceRub, &t.PriceStars, &t.PriceCrypto, &t.TrafficLimitGB, &t.TrafficResetStrategy, &t.InternalSquads, &t.ExternalSquad, &t.DeviceLimit, &t.ReceiptComment, &t.SortOrder, &t.Active, &t.CreatedAt)
+}
+
+type TariffRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTariffRepository(pool *pgxpool.Pool) *TariffRepository {
+	return &TariffRepository{pool: pool}
+}
+
+func buildInsertTariffQuery(t *Tariff) sq.InsertBuilder {
+	return sq.Insert("tariff").
+		Columns("name", "duration_days", "price_rub", "price_stars", "price_crypto", "traffic_limit_gb", "traffic_reset_strategy", "internal_squads", "external_squad", "device_limit", "receipt_comment", "sort_order", "active").
+		Values(t.Name, t.DurationDays, t.PriceRub, t.PriceStars, t.PriceCrypto, t.TrafficLimitGB, t.TrafficResetStrategy, t.InternalSquads, t.ExternalSquad, t.DeviceLimit, t.ReceiptComment, t.SortOrder, t.Active).
+		Suffix("RETURNING id").
+		PlaceholderFormat(sq.Dollar)
+}
+
+func (r *TariffRepository) Create(ctx context.Context, t *Tariff) (int64, error) {
+	sql, args, err := buildInsertTariffQuery(t).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build insert tariff query: %w", err)
+	}
+
+	var id int64
+	if err := r.pool.QueryRow(ctx, sql, args...).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to insert tariff: %w", err)
+	}
+	return id, nil
+}
+
+// SeedIfEmpty creates the given tariffs only when the catalogue has none yet. It reports whether they were created.
+func (r *TariffRepository) SeedIfEmpty(ctx context.Context, tariffs []Tariff) (bool, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "LOCK TABLE tariff IN EXCLUSIVE MODE"); err != nil {
+		return false, fmt.Errorf("failed to lock tariff table: %w", err)
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM tariff)").Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check tariffs: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	for i := range tariffs {
+		sql, args, err := buildInsertTariffQuery(&tariffs[i]).ToSql()
+		if err != nil {
+			return false, fmt.Errorf("failed to build insert tariff query: %w", err)
+		}
+		if err := tx.QueryRow(ctx, sql, args...).Scan(&tariffs[i].ID); err != nil {
+			return false, fmt.Errorf("failed to insert tariff: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return true, nil
+}
+
+func (r *TariffRepository) FindById(ctx context.Context, id int64) (*Tariff, error) {
+	sql, args, err := sq.Select(tariffColumns...).
+		From("tariff").
+		Where(sq.Eq{"id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select tariff query: %w", err)
+	}
+
+	var t Tariff
+	if err := scanTariff(r.pool.QueryRow(ctx, sql, args...), &t); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query tariff: %w", err)
+	}
+	return &t, nil
+}
+
+// FindActiveByDuration returns the first active tariff with the given duration. It is used to renew
+// purchases made before the catalogue existed.
+func (r *TariffRepository) FindActiveByDuration(ctx context.Context, days int) (*Tariff, error) {
+	tariffs, err := r.find(ctx, sq.Eq{"active": true, "duration_days": days})
+	if err != nil {
+		return nil, err
+	}
+	if len(tariffs) == 0 {
+		return nil, nil
+	}
+	return &tariffs[0], nil
+}
+
+// FindActive returns the tariffs offered to customers in display order.
+func (r *TariffRepository) FindActive(ctx context.Context) ([]Tariff, error) {
+	return r.find(ctx, sq.Eq{"active": true})
+}
+
+func (r *TariffRepository) FindAll(ctx context.Context) ([]Tariff, error) {
+	return r.find(ctx, nil)
+}
+
+func (r *TariffRepository) find(ctx context.Context, where sq.Sqlizer) ([]Tariff, error) {
+	sql, args, err := sq.Select(tariffColumns...).
+		From("tariff").
+		Where(where).
+		OrderBy("sort_order", "id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select tariffs query: %w", err)
+	}
+
+	rows, err := r.pool.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tariffs: %w", err)
+	}
+	defer rows.Close()
+
+	var list []Tariff
+	for rows.Next() {
+		var t Tariff
+		if err := scanTariff(rows, &t); err != nil {
+			return nil, fmt.Errorf("failed to scan tariff row: %w", err)
+		}
+		list = append(list, t)
+	}
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error iterating tariff rows: %w", rows.Err())
+	}
+	return list, nil
+}
@@ -0,0 +1,30 @@
+package database
+
+import "testing"
+
+func TestTariffPrice(t *testing.T) {
+	tariff := Tariff{PriceRub: 300, PriceStars: 150, PriceCrypto: 290}
+
+	prices := map[InvoiceType]int{
+		InvoiceTypeYookasa:  300,
+		InvoiceTypeTelegram: 150,
+		InvoiceTypeCrypto:   290,
+	}
+	for invoiceType, want := range prices {
+		if got := tariff.Price(invoiceType); got != want {
+			t.Fatalf("%s: want %d, got %d", invoiceType, want, got)
+		}
+	}
+}
+
+func TestPromoCodeAllowsTariff(t *testing.T) {
+	unrestricted := PromoCode{}
+	if !unrestricted.AllowsTariff(5) {
+		t.Fatal("code without tariffs must allow any tariff")
+	}
+
+	restricted := PromoCode{TariffIDs: []int64{1, 2}}
+	if !restricted.AllowsTariff(2) || restricted.AllowsTariff(5) {
+		t.Fatalf("unexpected tariff restriction result for %v", restricted.TariffIDs)
+	}
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// TrialActivation records that a Telegram user received the trial. It is keyed by telegram id rather than
+// customer, so it outlives customers removed and re-created by /sync.
+type TrialActivation struct {
+	TelegramID  int64     `db:"telegram_id"`
+	ActivatedAt time.Time `db:"activated_at"`
+	// GrantedBy is the staff member who granted the trial, nil when the customer activated it.
+	GrantedBy *int64 `db:"granted_by"`
+	// RevokedAt is set when the trial was disabled because the user left the required channel.
+	RevokedAt *time.Time `db:"revoked_at"`
+	// ExpireAt is the subscription expiry set by the trial, nil for trials activated before it was recorded.
+	ExpireAt *time.Time `db:"expire_at"`
+}
+
+type TrialActivationRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewTrialActivationRepository(pool *pgxpool.Pool) *TrialActivationRepository {
+	return &TrialActivationRepository{pool: pool}
+}
+
+func (r *TrialActivationRepository) FindByTelegramId(ctx context.Context, telegramID int64) (*TrialActivation, error) {
+	sql, args, err := sq.Select("telegram_id", "activated_at", "granted_by", "revoked_at", "expire_at").
+		From("trial_activation").
+		Where(sq.Eq{"telegram_id": telegramID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build select trial activation query: %w", err)
+	}
+
+	var activation TrialActivation
+	err = r.pool.QueryRow(ctx, sql, args...).Scan(&activation.TelegramID, &activation.ActivatedAt, &activation.GrantedBy, &activation.RevokedAt, &activation.ExpireAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to query trial activation: %w", err)
+	}
+	return &activation, nil
+}
+
+func buildClaimTrialQuery(telegramID int64) sq.InsertBuilder {
+	return sq.Insert("trial_activation").
+		Columns("telegram_id").
+		Values(telegramID).
+		Suffix("ON CONFLICT (telegram_id) DO NOTHING").
+		PlaceholderFormat(sq.Dollar)
+}
+
+// Claim records the trial before it is provisioned. It returns false when the user already received a trial,
+// so concurrent activations cannot both succeed.
+func (r *TrialActivationRepository) Claim(ctx context.Context, telegramID int64) (bool, error) {
+	sql, args, err := buildClaimTrialQuery(telegramID).ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build claim trial query: %w", err)
+	}
+
+	tag, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim trial: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func buildGrantTrialQuery(telegramID, grantedBy int64, expireAt time.Time) sq.InsertBuilder {
+	return sq.Insert("trial_activation").
+		Columns("telegram_id", "granted_by", "expire_at").
+		Values(telegramID, grantedBy, expireAt).
+		Suffix("ON CONFLICT (telegram_id) DO UPDATE SET activated_at = CURRENT_TIMESTAMP, granted_by = EXCLUDED.granted_by, " +
+			"expire_at = EXCLUDED.expire_at, revoked_at = NULL").
+		PlaceholderFormat(sq.Dollar)
+}
+
+// Grant records a trial granted by a staff member, replacing an earlier activation and its revocation.
+func (r *TrialActivationRepository) Grant(ctx context.Context, telegramID, grantedBy int64, expireAt time.Time) error {
+	sql, args, err := buildGrantTrialQuery(telegramID, grantedBy, expireAt).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build grant trial query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to grant trial: %w", err)
+	}
+	return nil
+}
+
+// SetExpireAt records the subscription expiry set by the trial once it is provisioned.
+func (r *TrialActivationRepository) SetExpireAt(ctx context.Context, telegramID int64, expireAt time.Time) error {
+	sql, args, err := sq.Update("trial_activation").
+		Set("expire_at", expireAt).
+		Where(sq.Eq{"telegram_id": telegramID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build update trial expiry query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to update trial expiry: %w", err)
+	}
+	return nil
+}
+
+// Delete removes the activation so the user can activate the trial again, and reports whether one existed.
+func (r *TrialActivationRepository) Delete(ctx context.Context, telegramID int64) (bool, error) {
+	sql, args, err := sq.Delete("trial_activation").
+		Where(sq.Eq{"telegram_id": telegramID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build delete trial activation query: %w", err)
+	}
+
+	tag, err := r.pool.Exec(ctx, sql, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete trial activation: %w", err)
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// Revoke marks the trial as revoked, so it is not checked again.
+func (r *TrialActivationRepository) Revoke(ctx context.Context, telegramID int64) error {
+	sql, args, err := sq.Update("trial_activation").
+		Set("revoked_at", time.Now()).
+		Where(sq.Eq{"telegram_id": telegramID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build revoke trial query: %w", err)
+	}
+
+	if _, err := r.pool.Exec(ctx, sql, args...); err != nil {
+		return fmt.Errorf("failed to revoke trial: %w", err)
+	}
+	return nil
+}
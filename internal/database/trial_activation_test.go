@@ -0,0 +1,44 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBuildClaimTrialQuery(t *testing.T) {
+	sql, args, err := buildClaimTrialQuery(7).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "INSERT INTO trial_activation (telegram_id) VALUES ($1) ON CONFLICT (telegram_id) DO NOTHING"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{int64(7)}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
+
+func TestBuildGrantTrialQueryReplacesActivation(t *testing.T) {
+	expireAt := time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)
+	sql, args, err := buildGrantTrialQuery(7, 1, expireAt).ToSql()
+	if err != nil {
+		t.Fatalf("ToSql() returned error: %v", err)
+	}
+
+	expectedSQL := "INSERT INTO trial_activation (telegram_id,granted_by,expire_at) VALUES ($1,$2,$3) " +
+		"ON CONFLICT (telegram_id) DO UPDATE SET activated_at = CURRENT_TIMESTAMP, granted_by = EXCLUDED.granted_by, " +
+		"expire_at = EXCLUDED.expire_at, revoked_at = NULL"
+	if sql != expectedSQL {
+		t.Fatalf("unexpected SQL:\nwant: %s\ngot:  %s", expectedSQL, sql)
+	}
+
+	expectedArgs := []interface{}{int64(7), int64(1), expireAt}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Fatalf("unexpected args, want %v, got %v", expectedArgs, args)
+	}
+}
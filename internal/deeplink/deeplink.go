@@ -0,0 +1,87 @@
+package deeplink
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	referralPrefix = "ref_"
+	giftPrefix     = "gift_"
+
+	// maxParameterLength is the longest start parameter Telegram accepts.
+	maxParameterLength = 64
+)
+
+type Kind int
+
+const (
+	// KindNone is a plain /start or a parameter that is not valid.
+	KindNone Kind = iota
+	KindReferral
+	KindGift
+)
+
+// Payload is a validated /start parameter.
+type Payload struct {
+	Kind       Kind
+	ReferrerID int64
+	GiftCode   string
+}
+
+// Referral returns the start parameter of the customer's referral link.
+func Referral(telegramID int64) string {
+	return fmt.Sprintf("%s%d", referralPrefix, telegramID)
+}
+
+// Gift returns the start parameter that redeems the gift code.
+func Gift(code string) string {
+	return giftPrefix + code
+}
+
+// Parse reads the parameter of a /start message. Anything that is not a well-formed referral or gift link
+// returns KindNone, so a crafted message cannot reach the referral or gift code.
+func Parse(text string) Payload {
+	fields := strings.Fields(text)
+	if len(fields) != 2 || !isStartCommand(fields[0]) || !validParameter(fields[1]) {
+		return Payload{}
+	}
+	parameter := fields[1]
+
+	if id, ok := strings.CutPrefix(parameter, referralPrefix); ok {
+		referrerID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || referrerID <= 0 || strconv.FormatInt(referrerID, 10) != id {
+			return Payload{}
+		}
+		return Payload{Kind: KindReferral, ReferrerID: referrerID}
+	}
+
+	if code, ok := strings.CutPrefix(parameter, giftPrefix); ok {
+		if code == "" || strings.ContainsAny(code, "_-") {
+			return Payload{}
+		}
+		return Payload{Kind: KindGift, GiftCode: code}
+	}
+	return Payload{}
+}
+
+func isStartCommand(command string) bool {
+	command, _, _ = strings.Cut(command, "@")
+	return command == "/start"
+}
+
+// validParameter checks the alphabet of deep link parameters: A-Z, a-z, 0-9, _ and -, up to 64 characters.
+func validParameter(parameter string) bool {
+	if parameter == "" || len(parameter) > maxParameterLength {
+		return false
+	}
+	for _, c := range parameter {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package deeplink
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		text string
+		want Payload
+	}{
+		{"/start", Payload{}},
+		{"/start ref_12345", Payload{Kind: KindReferral, ReferrerID: 12345}},
+		{"/start@shop_bot ref_12345", Payload{Kind: KindReferral, ReferrerID: 12345}},
+		{"/start  ref_12345 ", Payload{Kind: KindReferral, ReferrerID: 12345}},
+		{"/start ref_", Payload{}},
+		{"/start ref_-5", Payload{}},
+		{"/start ref_0", Payload{}},
+		{"/start ref_007", Payload{}},
+		{"/start ref_99999999999999999999", Payload{}},
+		{"/start ref_12 extra", Payload{}},
+		{"/startref_12", Payload{}},
+		{"hello ref_12", Payload{}},
+		{"/start gift_ABCDEFGH23456789", Payload{Kind: KindGift, GiftCode: "ABCDEFGH23456789"}},
+		{"/start gift_", Payload{}},
+		{"/start gift_AB'CD", Payload{}},
+		{"/start gift_ref_1", Payload{}},
+		{"/start promo_1", Payload{}},
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.text); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestLinksRoundTrip(t *testing.T) {
+	if got := Parse("/start " + Referral(42)); got != (Payload{Kind: KindReferral, ReferrerID: 42}) {
+		t.Fatalf("referral parameter not parsed back: %+v", got)
+	}
+	if got := Parse("/start " + Gift("CODE234")); got != (Payload{Kind: KindGift, GiftCode: "CODE234"}) {
+		t.Fatalf("gift parameter not parsed back: %+v", got)
+	}
+}
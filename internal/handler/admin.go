@@ -0,0 +1,511 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/staff"
+	"remnawave-tg-shop-bot/utils"
+)
+
+const (
+	adminActionAddDays    = "add"
+	adminActionRemoveDays = "remove"
+	adminActionResetTrial = "trial"
+	adminActionGrantTrial = "grant_trial"
+	adminActionBlock      = "block"
+	adminActionUnblock    = "unblock"
+
+	adminPurchasesLimit = 10
+)
+
+var adminDaysOptions = []int{7, 30}
+
+var adminActionPermissions = map[string]staff.Permission{
+	adminActionAddDays:    staff.PermissionSubscriptions,
+	adminActionRemoveDays: staff.PermissionSubscriptions,
+	adminActionResetTrial: staff.PermissionSubscriptions,
+	adminActionGrantTrial: staff.PermissionSubscriptions,
+	adminActionBlock:      staff.PermissionBlock,
+	adminActionUnblock:    staff.PermissionBlock,
+}
+
+func (h Handler) AdminCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+
+	query := strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/admin"))
+	if query != "" {
+		h.adminSearch(ctx, b, update.Message.Chat.ID, update.Message.From.ID, langCode, query)
+		return
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      update.Message.Chat.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.translation.GetText(langCode, "admin_menu"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.adminMenuKeyboard(update.Message.From.ID, langCode)},
+	})
+	if err != nil {
+		slog.Error("Error sending admin menu", "error", err)
+	}
+}
+
+func (h Handler) AdminCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.translation.GetText(langCode, "admin_menu"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.adminMenuKeyboard(update.CallbackQuery.From.ID, langCode)},
+	})
+	if err != nil {
+		slog.Error("Error sending admin menu", "error", err)
+	}
+}
+
+// adminMenuKeyboard shows the buttons the staff member's role allows.
+func (h Handler) adminMenuKeyboard(staffID int64, langCode string) [][]models.InlineKeyboardButton {
+	var keyboard [][]models.InlineKeyboardButton
+	if h.staffService.Can(staffID, staff.PermissionCustomers) {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "admin_search_button"), CallbackData: CallbackAdminSearch}})
+	}
+	if h.staffService.Can(staffID, staff.PermissionSync) {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "admin_sync_button"), CallbackData: CallbackAdminSync}})
+	}
+	if h.staffService.Can(staffID, staff.PermissionBroadcast) {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "admin_broadcast_button"), CallbackData: CallbackAdminBroadcast}})
+	}
+	if h.staffService.Can(staffID, staff.PermissionStats) {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "admin_stats_button"), CallbackData: fmt.Sprintf("%s?p=%s", CallbackAdminStats, statsPeriodDay)}})
+	}
+	return keyboard
+}
+
+func (h Handler) AdminSearchCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	h.input.Set(update.CallbackQuery.From.ID, inputAdminSearch, "")
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "admin_search_prompt"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackAdmin}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending admin search prompt", "error", err)
+	}
+}
+
+func (h Handler) AdminSyncCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	h.syncService.Sync()
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.translation.GetText(langCode, "admin_sync_done"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.adminMenuKeyboard(update.CallbackQuery.From.ID, langCode)},
+	})
+	if err != nil {
+		slog.Error("Error sending admin sync message", "error", err)
+	}
+}
+
+func (h Handler) adminSearch(ctx context.Context, b *bot.Bot, chatID int64, staffID int64, langCode string, query string) {
+	customer, err := h.findCustomerByQuery(ctx, query)
+	if err != nil {
+		slog.Error("Error searching customer", "error", err)
+		return
+	}
+
+	if customer == nil {
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:      chatID,
+			ParseMode:   models.ParseModeHTML,
+			Text:        h.translation.GetText(langCode, "admin_customer_not_found"),
+			ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.adminMenuKeyboard(staffID, langCode)},
+		})
+		if err != nil {
+			slog.Error("Error sending admin search result", "error", err)
+		}
+		return
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      chatID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.buildAdminCustomerText(ctx, customer, langCode),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.adminCustomerKeyboard(customer, staffID, langCode)},
+	})
+	if err != nil {
+		slog.Error("Error sending admin customer card", "error", err)
+	}
+}
+
+func (h Handler) findCustomerByQuery(ctx context.Context, query string) (*database.Customer, error) {
+	query = strings.TrimSpace(query)
+	if telegramId, err := strconv.ParseInt(query, 10, 64); err == nil {
+		return h.customerRepository.FindByTelegramId(ctx, telegramId)
+	}
+	return h.customerRepository.FindByUsername(ctx, query)
+}
+
+func (h Handler) AdminCustomerCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer := h.adminCustomerFromCallback(ctx, update)
+	if customer == nil {
+		return
+	}
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.buildAdminCustomerText(ctx, customer, langCode),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.adminCustomerKeyboard(customer, update.CallbackQuery.From.ID, langCode)},
+	})
+	if err != nil {
+		slog.Error("Error sending admin customer card", "error", err)
+	}
+}
+
+func (h Handler) AdminPurchasesCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer := h.adminCustomerFromCallback(ctx, update)
+	if customer == nil {
+		return
+	}
+
+	purchases, err := h.purchaseRepository.FindByCustomerID(ctx, customer.ID, adminPurchasesLimit)
+	if err != nil {
+		slog.Error("Error finding purchases", "error", err)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_purchases_title"), customer.TelegramID))
+	if len(purchases) == 0 {
+		text.WriteString(h.translation.GetText(langCode, "admin_no_purchases"))
+	}
+	for _, p := range purchases {
+		text.WriteString(fmt.Sprintf("\n#%d · %s · %s · %.2f %s · %d mo",
+			p.ID, p.CreatedAt.Format("02.01.2006 15:04"), p.InvoiceType, p.Amount, p.Currency, p.Month))
+		text.WriteString(fmt.Sprintf(" · <b>%s</b>", p.Status))
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text.String(),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: adminCustomerCallback(customer.ID)}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending admin purchases", "error", err)
+	}
+}
+
+// AdminActionCallbackHandler asks the admin to confirm an action before it is applied.
+func (h Handler) AdminActionCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer := h.adminCustomerFromCallback(ctx, update)
+	if customer == nil {
+		return
+	}
+
+	data := parseCallbackData(update.CallbackQuery.Data)
+	action := data["a"]
+	days, _ := strconv.Atoi(data["days"])
+	if !h.checkAdminAction(ctx, b, update, action) {
+		return
+	}
+
+	var text string
+	switch action {
+	case adminActionAddDays:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_confirm_add_days"), days, customer.TelegramID)
+	case adminActionRemoveDays:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_confirm_remove_days"), days, customer.TelegramID)
+	case adminActionResetTrial:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_confirm_reset_trial"), customer.TelegramID)
+	case adminActionGrantTrial:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_confirm_grant_trial"), config.TrialDays(), customer.TelegramID)
+	case adminActionBlock:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_confirm_block"), customer.TelegramID)
+	case adminActionUnblock:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_confirm_unblock"), customer.TelegramID)
+	default:
+		slog.Error("Unknown admin action", "action", action)
+		return
+	}
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{
+				{Text: h.translation.GetText(langCode, "admin_confirm_button"), CallbackData: adminActionCallback(CallbackAdminConfirm, customer.ID, action, days)},
+				{Text: h.translation.GetText(langCode, "admin_cancel_button"), CallbackData: adminCustomerCallback(customer.ID)},
+			},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending admin confirmation", "error", err)
+	}
+}
+
+func (h Handler) AdminConfirmCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	customer := h.adminCustomerFromCallback(ctx, update)
+	if customer == nil {
+		return
+	}
+
+	data := parseCallbackData(update.CallbackQuery.Data)
+	action := data["a"]
+	days, _ := strconv.Atoi(data["days"])
+	if !h.checkAdminAction(ctx, b, update, action) {
+		return
+	}
+
+	var err error
+	switch action {
+	case adminActionAddDays:
+		_, err = h.paymentService.AddSubscriptionDays(ctx, customer, days)
+	case adminActionRemoveDays:
+		_, err = h.paymentService.AddSubscriptionDays(ctx, customer, -days)
+	case adminActionResetTrial:
+		err = h.paymentService.ResetTrial(ctx, customer)
+	case adminActionGrantTrial:
+		err = h.paymentService.GrantTrial(ctx, customer, update.CallbackQuery.From.ID)
+	case adminActionBlock:
+		err = h.paymentService.SetCustomerBlocked(ctx, customer, true)
+	case adminActionUnblock:
+		err = h.paymentService.SetCustomerBlocked(ctx, customer, false)
+	default:
+		slog.Error("Unknown admin action", "action", action)
+		return
+	}
+
+	var result string
+	if err != nil {
+		slog.Error("Error applying admin action", "action", action, "customer_id", utils.MaskHalfInt64(customer.ID), "error", err)
+		result = fmt.Sprintf(h.translation.GetText(langCode, "admin_action_failed"), html.EscapeString(err.Error()))
+	} else {
+		slog.Info("admin action applied", "admin_id", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "action", action, "days", days, "customer_id", utils.MaskHalfInt64(customer.ID))
+		result = h.translation.GetText(langCode, "admin_action_done")
+	}
+
+	updated, findErr := h.customerRepository.FindById(ctx, customer.ID)
+	if findErr != nil || updated == nil {
+		slog.Error("Error reloading customer", "error", findErr)
+		updated = customer
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        result + "\n\n" + h.buildAdminCustomerText(ctx, updated, langCode),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.adminCustomerKeyboard(updated, update.CallbackQuery.From.ID, langCode)},
+	})
+	if err != nil {
+		slog.Error("Error sending admin action result", "error", err)
+	}
+}
+
+// checkAdminAction reports whether the staff member may apply the customer action and tells them if not.
+func (h Handler) checkAdminAction(ctx context.Context, b *bot.Bot, update *models.Update, action string) bool {
+	permission, ok := adminActionPermissions[action]
+	if !ok {
+		slog.Error("Unknown admin action", "action", action)
+		return false
+	}
+	if !h.staffService.Can(update.CallbackQuery.From.ID, permission) {
+		h.sendStaffForbidden(ctx, b, update)
+		return false
+	}
+	return true
+}
+
+func (h Handler) adminCustomerFromCallback(ctx context.Context, update *models.Update) *database.Customer {
+	data := parseCallbackData(update.CallbackQuery.Data)
+	customerId, err := strconv.ParseInt(data["id"], 10, 64)
+	if err != nil {
+		slog.Error("Error parsing customer id", "error", err)
+		return nil
+	}
+
+	customer, err := h.customerRepository.FindById(ctx, customerId)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return nil
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "customerId", utils.MaskHalfInt64(customerId))
+	}
+	return customer
+}
+
+// adminCustomerKeyboard shows the actions the staff member's role allows.
+func (h Handler) adminCustomerKeyboard(customer *database.Customer, staffID int64, langCode string) [][]models.InlineKeyboardButton {
+	var keyboard [][]models.InlineKeyboardButton
+	var actionRow []models.InlineKeyboardButton
+
+	if h.staffService.Can(staffID, staff.PermissionSubscriptions) {
+		var addRow, removeRow []models.InlineKeyboardButton
+		for _, days := range adminDaysOptions {
+			addRow = append(addRow, models.InlineKeyboardButton{
+				Text:         fmt.Sprintf(h.translation.GetText(langCode, "admin_add_days_button"), days),
+				CallbackData: adminActionCallback(CallbackAdminAction, customer.ID, adminActionAddDays, days),
+			})
+			removeRow = append(removeRow, models.InlineKeyboardButton{
+				Text:         fmt.Sprintf(h.translation.GetText(langCode, "admin_remove_days_button"), days),
+				CallbackData: adminActionCallback(CallbackAdminAction, customer.ID, adminActionRemoveDays, days),
+			})
+		}
+		keyboard = append(keyboard, addRow, removeRow)
+		actionRow = append(actionRow, models.InlineKeyboardButton{
+			Text:         h.translation.GetText(langCode, "admin_reset_trial_button"),
+			CallbackData: adminActionCallback(CallbackAdminAction, customer.ID, adminActionResetTrial, 0),
+		})
+		if config.TrialDays() > 0 {
+			actionRow = append(actionRow, models.InlineKeyboardButton{
+				Text:         h.translation.GetText(langCode, "admin_grant_trial_button"),
+				CallbackData: adminActionCallback(CallbackAdminAction, customer.ID, adminActionGrantTrial, 0),
+			})
+		}
+	}
+
+	if h.staffService.Can(staffID, staff.PermissionBlock) {
+		blockButton := models.InlineKeyboardButton{
+			Text:         h.translation.GetText(langCode, "admin_block_button"),
+			CallbackData: adminActionCallback(CallbackAdminAction, customer.ID, adminActionBlock, 0),
+		}
+		if customer.Blocked {
+			blockButton = models.InlineKeyboardButton{
+				Text:         h.translation.GetText(langCode, "admin_unblock_button"),
+				CallbackData: adminActionCallback(CallbackAdminAction, customer.ID, adminActionUnblock, 0),
+			}
+		}
+		actionRow = append(actionRow, blockButton)
+	}
+	if len(actionRow) > 0 {
+		keyboard = append(keyboard, actionRow)
+	}
+
+	return append(keyboard,
+		[]models.InlineKeyboardButton{
+			{Text: h.translation.GetText(langCode, "admin_purchases_button"), CallbackData: fmt.Sprintf("%s?id=%d", CallbackAdminPurchases, customer.ID)},
+			{Text: h.translation.GetText(langCode, "admin_refresh_button"), CallbackData: adminCustomerCallback(customer.ID)},
+		},
+		[]models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackAdmin}},
+	)
+}
+
+func (h Handler) buildAdminCustomerText(ctx context.Context, customer *database.Customer, langCode string) string {
+	yesNo := func(v bool) string {
+		if v {
+			return h.translation.GetText(langCode, "admin_yes")
+		}
+		return h.translation.GetText(langCode, "admin_no")
+	}
+
+	username := "—"
+	if customer.Username != nil && *customer.Username != "" {
+		username = "@" + html.EscapeString(*customer.Username)
+	}
+	expireAt := "—"
+	if customer.ExpireAt != nil {
+		expireAt = customer.ExpireAt.Format("02.01.2006 15:04")
+	}
+
+	trialAvailable, err := h.paymentService.TrialAvailable(ctx, customer)
+	if err != nil {
+		slog.Error("Error checking trial availability", "error", err)
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_customer_card"),
+		customer.TelegramID,
+		username,
+		html.EscapeString(customer.Language),
+		customer.CreatedAt.Format("02.01.2006 15:04"),
+		expireAt,
+		yesNo(trialAvailable),
+		yesNo(customer.PaymentMethodID != nil),
+		yesNo(customer.Blocked),
+	))
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	user, err := h.remnawaveClient.GetUserByTelegramId(ctxWithTimeout, customer.TelegramID)
+	if err != nil {
+		slog.Error("Error getting remnawave user", "error", err)
+		text.WriteString(h.translation.GetText(langCode, "admin_remnawave_unavailable"))
+		return text.String()
+	}
+	if user == nil {
+		text.WriteString(h.translation.GetText(langCode, "admin_remnawave_not_found"))
+		return text.String()
+	}
+
+	status := "—"
+	if s, ok := user.Status.Get(); ok {
+		status = string(s)
+	}
+	limit := h.translation.GetText(langCode, "admin_traffic_unlimited")
+	if l, ok := user.TrafficLimitBytes.Get(); ok && l > 0 {
+		limit = utils.FormatBytes(int64(l))
+	}
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_remnawave_user"),
+		html.EscapeString(user.Username),
+		status,
+		user.ExpireAt.Format("02.01.2006 15:04"),
+		utils.FormatBytes(int64(user.UserTraffic.UsedTrafficBytes)),
+		limit,
+	))
+
+	return text.String()
+}
+
+func adminCustomerCallback(customerId int64) string {
+	return fmt.Sprintf("%s?id=%d", CallbackAdminCustomer, customerId)
+}
+
+func adminActionCallback(prefix string, customerId int64, action string, days int) string {
+	return fmt.Sprintf("%s?id=%d&a=%s&days=%d", prefix, customerId, action, days)
+}
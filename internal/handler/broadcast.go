@@ -0,0 +1,337 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+// broadcastBuyTarget lets a broadcast button open the purchase menu instead of a URL.
+const broadcastBuyTarget = "buy"
+
+func (h Handler) BroadcastCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+
+	h.input.Set(update.Message.From.ID, inputBroadcastMessage, "")
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "broadcast_prompt"),
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast prompt", "error", err)
+	}
+}
+
+func (h Handler) AdminBroadcastCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	h.input.Set(update.CallbackQuery.From.ID, inputBroadcastMessage, "")
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "broadcast_prompt"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackAdmin}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast prompt", "error", err)
+	}
+}
+
+// createBroadcastDraft stores the admin's message as a draft, shows a preview and asks for the audience.
+func (h Handler) createBroadcastDraft(ctx context.Context, b *bot.Bot, msg *models.Message) {
+	langCode := msg.From.LanguageCode
+
+	text, entities := msg.Text, msg.Entities
+	var photo *string
+	if len(msg.Photo) > 0 {
+		text, entities = msg.Caption, msg.CaptionEntities
+		photo = &msg.Photo[len(msg.Photo)-1].FileID
+	}
+
+	text, entities, keyboard := parseBroadcastButtons(text, entities)
+	if text == "" && photo == nil {
+		h.input.Set(msg.From.ID, inputBroadcastMessage, "")
+		_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    msg.Chat.ID,
+			ParseMode: models.ParseModeHTML,
+			Text:      h.translation.GetText(langCode, "broadcast_empty"),
+		})
+		if err != nil {
+			slog.Error("Error sending broadcast prompt", "error", err)
+		}
+		return
+	}
+
+	draft := &database.Broadcast{AdminChatID: msg.Chat.ID, Text: text, PhotoFileID: photo}
+	if len(entities) > 0 {
+		draft.Entities, _ = json.Marshal(entities)
+	}
+	if len(keyboard) > 0 {
+		draft.Buttons, _ = json.Marshal(keyboard)
+	}
+
+	id, err := h.broadcastRepository.Create(ctx, draft)
+	if err != nil {
+		slog.Error("Error creating broadcast", "error", err)
+		return
+	}
+	draft.ID = id
+
+	if err := h.broadcastService.Send(ctx, draft, msg.Chat.ID); err != nil {
+		slog.Error("Error sending broadcast preview", "broadcast_id", id, "error", err)
+		_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID:    msg.Chat.ID,
+			ParseMode: models.ParseModeHTML,
+			Text:      h.translation.GetText(langCode, "broadcast_preview_failed"),
+		})
+		if err != nil {
+			slog.Error("Error sending broadcast preview error", "error", err)
+		}
+		return
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      msg.Chat.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.translation.GetText(langCode, "broadcast_choose_segment"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.broadcastSegmentKeyboard(id, langCode)},
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast segments", "error", err)
+	}
+}
+
+func (h Handler) broadcastSegmentKeyboard(id int64, langCode string) [][]models.InlineKeyboardButton {
+	var keyboard [][]models.InlineKeyboardButton
+	for _, segment := range database.BroadcastSegments {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{
+			Text:         h.translation.GetText(langCode, "broadcast_segment_"+string(segment)),
+			CallbackData: broadcastCallback(CallbackBroadcastSegment, id, segment),
+		}})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		{Text: h.translation.GetText(langCode, "admin_cancel_button"), CallbackData: fmt.Sprintf("%s?id=%d", CallbackBroadcastCancel, id)},
+	})
+	return keyboard
+}
+
+func (h Handler) BroadcastAudienceCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	id, _, ok := broadcastFromCallback(update.CallbackQuery.Data)
+	if !ok {
+		return
+	}
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.translation.GetText(langCode, "broadcast_choose_segment"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.broadcastSegmentKeyboard(id, langCode)},
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast segments", "error", err)
+	}
+}
+
+// BroadcastSegmentCallbackHandler shows how many customers the segment has and asks for confirmation.
+func (h Handler) BroadcastSegmentCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	id, segment, ok := broadcastFromCallback(update.CallbackQuery.Data)
+	if !ok || segment == "" {
+		return
+	}
+
+	count, err := h.broadcastRepository.CountSegment(ctx, segment)
+	if err != nil {
+		slog.Error("Error counting broadcast segment", "error", err)
+		return
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	if count > 0 {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: h.translation.GetText(langCode, "broadcast_send_button"), CallbackData: broadcastCallback(CallbackBroadcastStart, id, segment)},
+		})
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		{Text: h.translation.GetText(langCode, "back_button"), CallbackData: fmt.Sprintf("%s?id=%d", CallbackBroadcastAudience, id)},
+		{Text: h.translation.GetText(langCode, "admin_cancel_button"), CallbackData: fmt.Sprintf("%s?id=%d", CallbackBroadcastCancel, id)},
+	})
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        fmt.Sprintf(h.translation.GetText(langCode, "broadcast_confirm"), h.translation.GetText(langCode, "broadcast_segment_"+string(segment)), count),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast confirmation", "error", err)
+	}
+}
+
+func (h Handler) BroadcastStartCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	id, segment, ok := broadcastFromCallback(update.CallbackQuery.Data)
+	if !ok || segment == "" {
+		return
+	}
+
+	started, err := h.broadcastRepository.Start(ctx, id, segment)
+	if err != nil {
+		slog.Error("Error starting broadcast", "broadcast_id", id, "error", err)
+		return
+	}
+
+	text := h.translation.GetText(langCode, "broadcast_not_draft")
+	if started {
+		h.broadcastService.Enqueue(id)
+		text = fmt.Sprintf(h.translation.GetText(langCode, "broadcast_started"), id)
+		slog.Info("Broadcast started", "broadcast_id", id, "segment", segment)
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast started message", "error", err)
+	}
+}
+
+func (h Handler) BroadcastCancelCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	id, _, ok := broadcastFromCallback(update.CallbackQuery.Data)
+	if !ok {
+		return
+	}
+
+	cancelled, err := h.broadcastRepository.Cancel(ctx, id)
+	if err != nil {
+		slog.Error("Error cancelling broadcast", "broadcast_id", id, "error", err)
+		return
+	}
+
+	text := h.translation.GetText(langCode, "broadcast_not_draft")
+	if cancelled {
+		text = h.translation.GetText(langCode, "broadcast_cancelled")
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+	})
+	if err != nil {
+		slog.Error("Error sending broadcast cancelled message", "error", err)
+	}
+}
+
+func broadcastCallback(prefix string, id int64, segment database.BroadcastSegment) string {
+	return fmt.Sprintf("%s?id=%d&s=%s", prefix, id, segment)
+}
+
+// broadcastFromCallback returns the broadcast id and, if present, a known segment from callback data.
+func broadcastFromCallback(data string) (int64, database.BroadcastSegment, bool) {
+	params := parseCallbackData(data)
+	id, err := strconv.ParseInt(params["id"], 10, 64)
+	if err != nil {
+		slog.Error("Invalid broadcast id in callback", "data", data)
+		return 0, "", false
+	}
+
+	segment := database.BroadcastSegment(params["s"])
+	if segment == "" {
+		return id, "", true
+	}
+	for _, known := range database.BroadcastSegments {
+		if segment == known {
+			return id, segment, true
+		}
+	}
+	slog.Error("Unknown broadcast segment in callback", "segment", segment)
+	return 0, "", false
+}
+
+// parseBroadcastButtons takes trailing lines of the form "Text | https://link" (or "Text | buy")
+// off the message and turns them into inline keyboard rows, one button per line.
+// Entities that pointed into the removed lines are dropped or clipped.
+func parseBroadcastButtons(text string, entities []models.MessageEntity) (string, []models.MessageEntity, [][]models.InlineKeyboardButton) {
+	lines := strings.Split(text, "\n")
+
+	var keyboard [][]models.InlineKeyboardButton
+	for len(lines) > 0 {
+		button, ok := parseBroadcastButton(lines[len(lines)-1])
+		if !ok {
+			break
+		}
+		keyboard = append([][]models.InlineKeyboardButton{{button}}, keyboard...)
+		lines = lines[:len(lines)-1]
+	}
+	if len(keyboard) == 0 {
+		return text, entities, nil
+	}
+
+	text = strings.TrimRight(strings.Join(lines, "\n"), " \n")
+	length := len(utf16.Encode([]rune(text)))
+
+	var kept []models.MessageEntity
+	for _, entity := range entities {
+		if entity.Offset >= length {
+			continue
+		}
+		if entity.Offset+entity.Length > length {
+			entity.Length = length - entity.Offset
+		}
+		kept = append(kept, entity)
+	}
+	return text, kept, keyboard
+}
+
+func parseBroadcastButton(line string) (models.InlineKeyboardButton, bool) {
+	parts := strings.SplitN(line, "|", 2)
+	if len(parts) != 2 {
+		return models.InlineKeyboardButton{}, false
+	}
+	label, target := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+	if label == "" {
+		return models.InlineKeyboardButton{}, false
+	}
+
+	switch {
+	case target == broadcastBuyTarget:
+		return models.InlineKeyboardButton{Text: label, CallbackData: CallbackBuy}, true
+	case strings.HasPrefix(target, "https://"), strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "tg://"):
+		return models.InlineKeyboardButton{Text: label, URL: target}, true
+	default:
+		return models.InlineKeyboardButton{}, false
+	}
+}
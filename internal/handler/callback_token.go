@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// callbackTokenTTL is how long a purchase button stays valid after the keyboard was shown.
+const callbackTokenTTL = 24 * time.Hour
+
+// callbackTokens collects the purchase buttons of one keyboard. Callback data only carries a random
+// token and the tariff, payment method and promo code behind it are stored on the server.
+type callbackTokens struct {
+	telegramID int64
+	tokens     []database.CallbackToken
+}
+
+func newCallbackTokens(telegramID int64) *callbackTokens {
+	return &callbackTokens{telegramID: telegramID}
+}
+
+// Add registers the button state and returns the callback data for it.
+func (c *callbackTokens) Add(action string, payload map[string]string) string {
+	token := database.CallbackToken{
+		Token:      rand.Text(),
+		TelegramID: c.telegramID,
+		Action:     action,
+		Payload:    payload,
+		ExpiresAt:  time.Now().Add(callbackTokenTTL),
+	}
+	c.tokens = append(c.tokens, token)
+	return fmt.Sprintf("%s?t=%s", action, token.Token)
+}
+
+func (h Handler) saveCallbackTokens(ctx context.Context, tokens *callbackTokens) error {
+	return h.callbackTokenRepository.Create(ctx, tokens.tokens)
+}
+
+// resolveCallback returns the state stored for the pressed button. Unknown or expired tokens and tokens
+// issued to another user or for another action are rejected with an alert.
+func (h Handler) resolveCallback(ctx context.Context, b *bot.Bot, update *models.Update, action string) (map[string]string, bool) {
+	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
+
+	token, err := h.callbackTokenRepository.FindByToken(ctx, callbackQuery["t"])
+	if err != nil {
+		slog.Error("Error finding callback token", "error", err)
+		return nil, false
+	}
+	if token != nil && token.TelegramID == update.CallbackQuery.From.ID && token.Action == action {
+		return token.Payload, true
+	}
+
+	slog.Warn("rejected callback", "action", action, "user_id", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "known", token != nil)
+	_, err = b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            h.translation.GetText(update.CallbackQuery.From.LanguageCode, "callback_expired"),
+		ShowAlert:       true,
+	})
+	if err != nil {
+		slog.Error("Error answering rejected callback", "error", err)
+	}
+	return nil, false
+}
@@ -2,6 +2,7 @@ package handler
 
 const (
 	CallbackBuy           = "buy"
+	CallbackBuyGift       = "buy_gift"
 	CallbackSell          = "sell"
 	CallbackStart         = "start"
 	CallbackConnect       = "connect"
@@ -9,4 +10,32 @@ const (
 	CallbackTrial         = "trial"
 	CallbackActivateTrial = "activate_trial"
 	CallbackReferral      = "referral"
+	CallbackEnterPromo    = "enter_promo"
+
+	CallbackDisableAutoPayment = "disable_autopay"
+	CallbackChannelCheck       = "channel_check"
+
+	CallbackReferralRewards = "referral_rewards"
+	CallbackReferralCard    = "referral_card"
+
+	CallbackDevices             = "devices"
+	CallbackDeleteDevice        = "device_delete"
+	CallbackResetDevices        = "devices_reset"
+	CallbackResetDevicesConfirm = "devices_reset_confirm"
+
+	CallbackAdmin          = "admin"
+	CallbackAdminSearch    = "admin_search"
+	CallbackAdminSync      = "admin_sync"
+	CallbackAdminCustomer  = "admin_customer"
+	CallbackAdminPurchases = "admin_purchases"
+	CallbackAdminAction    = "admin_action"
+	CallbackAdminConfirm   = "admin_confirm"
+	CallbackAdminBroadcast = "admin_broadcast"
+	CallbackAdminRefund    = "admin_refund"
+	CallbackAdminStats     = "admin_stats"
+
+	CallbackBroadcastAudience = "broadcast_audience"
+	CallbackBroadcastSegment  = "broadcast_segment"
+	CallbackBroadcastStart    = "broadcast_start"
+	CallbackBroadcastCancel   = "broadcast_cancel"
 )
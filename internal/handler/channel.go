@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// ChannelCheckCallbackHandler re-checks the membership without the cache after the user pressed Check on the
+// subscribe screen, and returns them to the main menu once they joined.
+func (h Handler) ChannelCheckCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	userID := update.CallbackQuery.From.ID
+	if h.channelService == nil {
+		h.StartCallbackHandler(ctx, b, update)
+		return
+	}
+
+	joined, err := h.channelService.Check(ctx, userID)
+	if err != nil {
+		slog.Error("Error checking channel membership", "userId", utils.MaskHalfInt64(userID), "error", err)
+	}
+
+	answer := h.translation.GetText(langCode, "channel_subscription_confirmed")
+	if err != nil || !joined {
+		answer = h.translation.GetText(langCode, "channel_not_subscribed")
+	}
+	_, answerErr := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            answer,
+		ShowAlert:       err != nil || !joined,
+	})
+	if answerErr != nil {
+		slog.Error("Error answering channel check callback", "error", answerErr)
+	}
+
+	if err == nil && joined {
+		h.StartCallbackHandler(ctx, b, update)
+	}
+}
+
+func (h Handler) sendChannelSubscribe(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "channel_subscribe_required"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "channel_subscribe_button"), URL: config.RequiredChannelURL()}},
+			{{Text: h.translation.GetText(langCode, "channel_check_button"), CallbackData: CallbackChannelCheck}},
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending channel subscribe message", "error", err)
+	}
+}
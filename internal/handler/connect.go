@@ -3,15 +3,18 @@ package handler
 import (
 	"context"
 	"fmt"
+	"html"
 	"remnawave-tg-shop-bot/internal/config"
 	"strings"
 	"time"
 
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
 
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
 	"remnawave-tg-shop-bot/internal/translation"
 	"remnawave-tg-shop-bot/utils"
 )
@@ -43,12 +46,18 @@ func (h Handler) ConnectCommandHandler(ctx context.Context, b *bot.Bot, update *
 				}}})
 		}
 	}
+	if customer.SubscriptionLink != nil {
+		markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "devices_button"), CallbackData: CallbackDevices}})
+	}
+	if customer.PaymentMethodID != nil && config.IsAutoPaymentEnabled() {
+		markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "disable_autopay_button"), CallbackData: CallbackDisableAutoPayment}})
+	}
 	markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}})
 
 	isDisabled := true
 	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    update.Message.Chat.ID,
-		Text:      buildConnectText(customer, langCode),
+		Text:      h.connectText(ctx, customer, langCode),
 		ParseMode: models.ParseModeHTML,
 		LinkPreviewOptions: &models.LinkPreviewOptions{
 			IsDisabled: &isDisabled,
@@ -92,6 +101,12 @@ func (h Handler) ConnectCallbackHandler(ctx context.Context, b *bot.Bot, update
 				}}})
 		}
 	}
+	if customer.SubscriptionLink != nil {
+		markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "devices_button"), CallbackData: CallbackDevices}})
+	}
+	if customer.PaymentMethodID != nil && config.IsAutoPaymentEnabled() {
+		markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "disable_autopay_button"), CallbackData: CallbackDisableAutoPayment}})
+	}
 	markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}})
 
 	isDisabled := true
@@ -99,7 +114,7 @@ func (h Handler) ConnectCallbackHandler(ctx context.Context, b *bot.Bot, update
 		ChatID:    callback.Chat.ID,
 		MessageID: callback.ID,
 		ParseMode: models.ParseModeHTML,
-		Text:      buildConnectText(customer, langCode),
+		Text:      h.connectText(ctx, customer, langCode),
 		LinkPreviewOptions: &models.LinkPreviewOptions{
 			IsDisabled: &isDisabled,
 		},
@@ -113,7 +128,33 @@ func (h Handler) ConnectCallbackHandler(ctx context.Context, b *bot.Bot, update
 	}
 }
 
-func buildConnectText(customer *database.Customer, langCode string) string {
+// connectText describes the subscription with live usage from Remnawave. If the panel is unreachable it falls back
+// to the expiry date and link stored in the database.
+func (h Handler) connectText(ctx context.Context, customer *database.Customer, langCode string) string {
+	if customer.SubscriptionLink == nil {
+		return buildConnectText(customer, nil, langCode)
+	}
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	user, err := h.remnawaveClient.GetUserByTelegramId(ctxWithTimeout, customer.TelegramID)
+	if err != nil {
+		slog.Warn("Error getting remnawave user, showing cached subscription", "telegramId", utils.MaskHalfInt64(customer.TelegramID), "error", err)
+		return buildConnectText(customer, nil, langCode) + h.translation.GetText(langCode, "connect_live_unavailable")
+	}
+	if user == nil {
+		return buildConnectText(customer, nil, langCode)
+	}
+
+	live := *customer
+	live.ExpireAt = &user.ExpireAt
+	if user.SubscriptionUrl != "" {
+		live.SubscriptionLink = &user.SubscriptionUrl
+	}
+	return buildConnectText(&live, user, langCode)
+}
+
+func buildConnectText(customer *database.Customer, user *remapi.User, langCode string) string {
 	var info strings.Builder
 
 	tm := translation.GetInstance()
@@ -127,6 +168,10 @@ func buildConnectText(customer *database.Customer, langCode string) string {
 			subscriptionActiveText := tm.GetText(langCode, "subscription_active")
 			info.WriteString(fmt.Sprintf(subscriptionActiveText, formattedDate))
 
+			if user != nil {
+				info.WriteString(buildUsageText(tm, user, langCode, currentTime))
+			}
+
 			if customer.SubscriptionLink != nil && *customer.SubscriptionLink != "" {
 				if config.GetMiniAppURL() != "" || config.IsWepAppLinkEnabled() {
 				} else {
@@ -134,6 +179,10 @@ func buildConnectText(customer *database.Customer, langCode string) string {
 					info.WriteString(fmt.Sprintf(subscriptionLinkText, *customer.SubscriptionLink))
 				}
 			}
+
+			if customer.PaymentMethodID != nil && config.IsAutoPaymentEnabled() {
+				info.WriteString(tm.GetText(langCode, "autopay_enabled"))
+			}
 		} else {
 			noSubscriptionText := tm.GetText(langCode, "no_subscription")
 			info.WriteString(noSubscriptionText)
@@ -145,3 +194,44 @@ func buildConnectText(customer *database.Customer, langCode string) string {
 
 	return info.String()
 }
+
+func buildUsageText(tm *translation.Manager, user *remapi.User, langCode string, now time.Time) string {
+	var info strings.Builder
+
+	used := utils.FormatBytes(int64(user.UserTraffic.UsedTrafficBytes))
+	limit := user.TrafficLimitBytes.Or(0)
+	if limit > 0 {
+		info.WriteString(fmt.Sprintf(tm.GetText(langCode, "connect_traffic"), used, utils.FormatBytes(int64(limit))))
+	} else {
+		info.WriteString(fmt.Sprintf(tm.GetText(langCode, "connect_traffic_unlimited"), used))
+	}
+
+	// Unlimited traffic has nothing to reset.
+	if limit > 0 {
+		strategy := string(user.TrafficLimitStrategy.Or(""))
+		if next, ok := remnawave.NextTrafficReset(strategy, now); ok {
+			info.WriteString(fmt.Sprintf(tm.GetText(langCode, "connect_traffic_reset"),
+				tm.GetText(langCode, "connect_reset_"+strings.ToLower(strategy)), next.Local().Format("02.01.2006 15:04")))
+		} else {
+			info.WriteString(tm.GetText(langCode, "connect_traffic_no_reset"))
+		}
+	}
+
+	if remnawave.IsOnline(user, now) {
+		info.WriteString(tm.GetText(langCode, "connect_online"))
+	} else if onlineAt, ok := user.UserTraffic.OnlineAt.Get(); ok {
+		info.WriteString(fmt.Sprintf(tm.GetText(langCode, "connect_last_online"), onlineAt.Local().Format("02.01.2006 15:04")))
+	} else {
+		info.WriteString(tm.GetText(langCode, "connect_never_online"))
+	}
+
+	if len(user.ActiveInternalSquads) > 0 {
+		names := make([]string, 0, len(user.ActiveInternalSquads))
+		for _, squad := range user.ActiveInternalSquads {
+			names = append(names, html.EscapeString(squad.Name))
+		}
+		info.WriteString(fmt.Sprintf(tm.GetText(langCode, "connect_squads"), strings.Join(names, ", ")))
+	}
+
+	return info.String()
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// DevicesCallbackHandler lists the HWID devices registered in Remnawave for the customer.
+func (h Handler) DevicesCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.showDevices(ctx, b, update)
+}
+
+// DeleteDeviceCallbackHandler removes one device. The HWID is too long for callback data and is kept behind a callback token.
+func (h Handler) DeleteDeviceCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	payload, ok := h.resolveCallback(ctx, b, update, CallbackDeleteDevice)
+	if !ok {
+		return
+	}
+
+	err := h.remnawaveClient.DeleteUserDevice(ctx, update.CallbackQuery.From.ID, payload["hwid"])
+	if err != nil {
+		slog.Error("Error deleting device", "telegramId", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "error", err)
+		h.answerDevices(ctx, b, update, "devices_error")
+		return
+	}
+	h.answerDevices(ctx, b, update, "devices_deleted")
+	h.showDevices(ctx, b, update)
+}
+
+// ResetDevicesCallbackHandler asks to confirm removing every device.
+func (h Handler) ResetDevicesCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "devices_reset_confirm"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "devices_reset_confirm_button"), CallbackData: CallbackResetDevicesConfirm}},
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackDevices}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending reset devices message", "error", err)
+	}
+}
+
+// ResetDevicesConfirmCallbackHandler removes every device of the customer.
+func (h Handler) ResetDevicesConfirmCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	err := h.remnawaveClient.DeleteAllUserDevices(ctx, update.CallbackQuery.From.ID)
+	if err != nil {
+		slog.Error("Error deleting all devices", "telegramId", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "error", err)
+		h.answerDevices(ctx, b, update, "devices_error")
+		return
+	}
+	h.answerDevices(ctx, b, update, "devices_reset_done")
+	h.showDevices(ctx, b, update)
+}
+
+func (h Handler) showDevices(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+	telegramID := update.CallbackQuery.From.ID
+
+	ctxWithTimeout, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	devices, err := h.remnawaveClient.GetUserDevices(ctxWithTimeout, telegramID)
+
+	var text string
+	var markup [][]models.InlineKeyboardButton
+	switch {
+	case err != nil:
+		slog.Error("Error getting devices", "telegramId", utils.MaskHalfInt64(telegramID), "error", err)
+		text = h.translation.GetText(langCode, "devices_unavailable")
+	case devices == nil:
+		text = h.translation.GetText(langCode, "devices_no_subscription")
+	default:
+		text = h.devicesText(langCode, devices)
+		markup, err = h.devicesKeyboard(ctx, langCode, telegramID, devices)
+		if err != nil {
+			slog.Error("Error saving callback tokens", "error", err)
+			return
+		}
+	}
+	markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackConnect}})
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        text,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: markup},
+	})
+	if err != nil {
+		slog.Error("Error sending devices message", "error", err)
+	}
+}
+
+func (h Handler) devicesText(langCode string, devices *remnawave.UserDevices) string {
+	var text strings.Builder
+	if devices.Limit > 0 {
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "devices_title_limit"), len(devices.Devices), devices.Limit))
+	} else {
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "devices_title"), len(devices.Devices)))
+	}
+
+	if len(devices.Devices) == 0 {
+		text.WriteString(h.translation.GetText(langCode, "devices_empty"))
+		return text.String()
+	}
+	for i, device := range devices.Devices {
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "devices_row"),
+			i+1, html.EscapeString(remnawave.DeviceName(device)), device.UpdatedAt.Local().Format("02.01.2006 15:04")))
+	}
+	text.WriteString(h.translation.GetText(langCode, "devices_hint"))
+	return text.String()
+}
+
+func (h Handler) devicesKeyboard(ctx context.Context, langCode string, telegramID int64, devices *remnawave.UserDevices) ([][]models.InlineKeyboardButton, error) {
+	if len(devices.Devices) == 0 {
+		return nil, nil
+	}
+
+	tokens := newCallbackTokens(telegramID)
+	var markup [][]models.InlineKeyboardButton
+	for i, device := range devices.Devices {
+		markup = append(markup, []models.InlineKeyboardButton{{
+			Text:         fmt.Sprintf(h.translation.GetText(langCode, "devices_delete_button"), i+1, remnawave.DeviceName(device)),
+			CallbackData: tokens.Add(CallbackDeleteDevice, map[string]string{"hwid": device.Hwid}),
+		}})
+	}
+	if err := h.saveCallbackTokens(ctx, tokens); err != nil {
+		return nil, err
+	}
+	markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "devices_reset_button"), CallbackData: CallbackResetDevices}})
+	return markup, nil
+}
+
+func (h Handler) answerDevices(ctx context.Context, b *bot.Bot, update *models.Update, key string) {
+	_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: update.CallbackQuery.ID,
+		Text:            h.translation.GetText(update.CallbackQuery.From.LanguageCode, key),
+	})
+	if err != nil {
+		slog.Error("Error answering devices callback", "error", err)
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/utils"
+)
+
+// redeemGift applies the gift code of a /start gift_CODE link to the customer and tells them the outcome.
+func (h Handler) redeemGift(ctx context.Context, b *bot.Bot, update *models.Update, customer *database.Customer, code string) {
+	langCode := update.Message.From.LanguageCode
+
+	var text string
+	var markup [][]models.InlineKeyboardButton
+	gift, err := h.paymentService.RedeemGiftCode(ctx, code, customer)
+	switch {
+	case err == nil:
+		text = fmt.Sprintf(h.translation.GetText(langCode, "gift_redeemed"), gift.Days)
+		markup = append(markup, h.resolveConnectButton(langCode))
+	case errors.Is(err, payment.ErrGiftCodeNotFound):
+		text = h.translation.GetText(langCode, "gift_not_found")
+	case errors.Is(err, payment.ErrGiftCodeRedeemed):
+		text = h.translation.GetText(langCode, "gift_already_redeemed")
+	case errors.Is(err, payment.ErrGiftCodeExpired):
+		text = h.translation.GetText(langCode, "gift_expired")
+	default:
+		slog.Error("Error redeeming gift code", "telegramId", utils.MaskHalfInt64(customer.TelegramID), "error", err)
+		text = h.translation.GetText(langCode, "gift_redeem_failed")
+	}
+	markup = append(markup, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}})
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      update.Message.Chat.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        text,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: markup},
+	})
+	if err != nil {
+		slog.Error("Error sending gift message", "error", err)
+	}
+}
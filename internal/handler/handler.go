@@ -1,25 +1,42 @@
 package handler
 
 import (
+	"remnawave-tg-shop-bot/internal/broadcast"
 	"remnawave-tg-shop-bot/internal/cache"
+	"remnawave-tg-shop-bot/internal/channel"
 	"remnawave-tg-shop-bot/internal/cryptopay"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/payment"
+	"remnawave-tg-shop-bot/internal/referral"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/staff"
 	"remnawave-tg-shop-bot/internal/sync"
 	"remnawave-tg-shop-bot/internal/translation"
 	"remnawave-tg-shop-bot/internal/yookasa"
 )
 
 type Handler struct {
-	customerRepository *database.CustomerRepository
-	purchaseRepository *database.PurchaseRepository
-	cryptoPayClient    *cryptopay.Client
-	yookasaClient      *yookasa.Client
-	translation        *translation.Manager
-	paymentService     *payment.PaymentService
-	syncService        *sync.SyncService
-	referralRepository *database.ReferralRepository
-	cache              *cache.Cache
+	customerRepository        *database.CustomerRepository
+	purchaseRepository        *database.PurchaseRepository
+	cryptoPayClient           *cryptopay.Client
+	yookasaClient             *yookasa.Client
+	translation               *translation.Manager
+	paymentService            *payment.PaymentService
+	syncService               *sync.SyncService
+	referralRepository        *database.ReferralRepository
+	cache                     *cache.Cache
+	remnawaveClient           *remnawave.Client
+	broadcastRepository       *database.BroadcastRepository
+	broadcastService          *broadcast.Service
+	promoCodeRepository       *database.PromoCodeRepository
+	tariffRepository          *database.TariffRepository
+	callbackTokenRepository   *database.CallbackTokenRepository
+	provisioningJobRepository *database.ProvisioningJobRepository
+	staffService              *staff.Service
+	statsRepository           *database.StatsRepository
+	referralService           *referral.Service
+	channelService            *channel.Service
+	input                     *inputState
 }
 
 func NewHandler(
@@ -29,16 +46,39 @@ func NewHandler(
 	customerRepository *database.CustomerRepository,
 	purchaseRepository *database.PurchaseRepository,
 	cryptoPayClient *cryptopay.Client,
-	yookasaClient *yookasa.Client, referralRepository *database.ReferralRepository, cache *cache.Cache) *Handler {
+	yookasaClient *yookasa.Client, referralRepository *database.ReferralRepository, cache *cache.Cache,
+	remnawaveClient *remnawave.Client,
+	broadcastRepository *database.BroadcastRepository,
+	broadcastService *broadcast.Service,
+	promoCodeRepository *database.PromoCodeRepository,
+	tariffRepository *database.TariffRepository,
+	callbackTokenRepository *database.CallbackTokenRepository,
+	provisioningJobRepository *database.ProvisioningJobRepository,
+	staffService *staff.Service,
+	statsRepository *database.StatsRepository,
+	referralService *referral.Service,
+	channelService *channel.Service) *Handler {
 	return &Handler{
-		syncService:        syncService,
-		paymentService:     paymentService,
-		customerRepository: customerRepository,
-		purchaseRepository: purchaseRepository,
-		cryptoPayClient:    cryptoPayClient,
-		yookasaClient:      yookasaClient,
-		translation:        translation,
-		referralRepository: referralRepository,
-		cache:              cache,
+		syncService:               syncService,
+		paymentService:            paymentService,
+		customerRepository:        customerRepository,
+		purchaseRepository:        purchaseRepository,
+		cryptoPayClient:           cryptoPayClient,
+		yookasaClient:             yookasaClient,
+		translation:               translation,
+		referralRepository:        referralRepository,
+		cache:                     cache,
+		remnawaveClient:           remnawaveClient,
+		broadcastRepository:       broadcastRepository,
+		broadcastService:          broadcastService,
+		promoCodeRepository:       promoCodeRepository,
+		tariffRepository:          tariffRepository,
+		callbackTokenRepository:   callbackTokenRepository,
+		provisioningJobRepository: provisioningJobRepository,
+		staffService:              staffService,
+		statsRepository:           statsRepository,
+		referralService:           referralService,
+		channelService:            channelService,
+		input:                     newInputState(),
 	}
 }
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/staff"
+)
+
+const (
+	inputAdminSearch      = "admin_search"
+	inputBroadcastMessage = "broadcast_message"
+	inputPromoCode        = "promo_code"
+)
+
+// pendingInput is the action waiting for the user's answer and the context it was asked in.
+type pendingInput struct {
+	action  string
+	payload string
+}
+
+// inputState remembers which free-text answer the bot expects from a user next.
+type inputState struct {
+	mu      sync.Mutex
+	pending map[int64]pendingInput
+}
+
+func newInputState() *inputState {
+	return &inputState{pending: make(map[int64]pendingInput)}
+}
+
+func (s *inputState) Set(userID int64, action string, payload string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[userID] = pendingInput{action: action, payload: payload}
+}
+
+func (s *inputState) Has(userID int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.pending[userID]
+	return ok
+}
+
+func (s *inputState) Pop(userID int64) (pendingInput, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	input, ok := s.pending[userID]
+	delete(s.pending, userID)
+	return input, ok
+}
+
+// IsAwaitingInput matches plain text and photo messages from users the bot has asked for input.
+func (h Handler) IsAwaitingInput(update *models.Update) bool {
+	if update.Message == nil || update.Message.From == nil {
+		return false
+	}
+	if update.Message.Text == "" && len(update.Message.Photo) == 0 {
+		return false
+	}
+	if strings.HasPrefix(update.Message.Text, "/") {
+		return false
+	}
+	return h.input.Has(update.Message.From.ID)
+}
+
+func (h Handler) InputHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	input, ok := h.input.Pop(update.Message.From.ID)
+	if !ok {
+		return
+	}
+
+	// Admin actions are only ever set by admin handlers; the checks guard against a stale state or a role
+	// changed in the meantime.
+	userID := update.Message.From.ID
+
+	switch {
+	case input.action == inputPromoCode:
+		h.promoCodeInput(ctx, b, update.Message, input.payload)
+	case input.action == inputAdminSearch && h.staffService.Can(userID, staff.PermissionCustomers):
+		h.adminSearch(ctx, b, update.Message.Chat.ID, userID, update.Message.From.LanguageCode, update.Message.Text)
+	case input.action == inputBroadcastMessage && h.staffService.Can(userID, staff.PermissionBroadcast):
+		h.createBroadcastDraft(ctx, b, update.Message)
+	}
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"context"
+	"time"
 
 	"log/slog"
 
@@ -10,19 +11,23 @@ import (
 
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/staff"
 	"remnawave-tg-shop-bot/utils"
 )
 
 func (h Handler) CreateCustomerIfNotExistMiddleware(next bot.HandlerFunc) bot.HandlerFunc {
 	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
 		var telegramId int64
-		var langCode string
+		var langCode, username string
 		if update.Message != nil {
 			telegramId = update.Message.From.ID
 			langCode = update.Message.From.LanguageCode
+			username = update.Message.From.Username
 		} else if update.CallbackQuery != nil {
 			telegramId = update.CallbackQuery.From.ID
 			langCode = update.CallbackQuery.From.LanguageCode
+			username = update.CallbackQuery.From.Username
 		}
 		existingCustomer, err := h.customerRepository.FindByTelegramId(ctx, telegramId)
 		if err != nil {
@@ -34,6 +39,7 @@ func (h Handler) CreateCustomerIfNotExistMiddleware(next bot.HandlerFunc) bot.Ha
 			existingCustomer, err = h.customerRepository.Create(ctx, &database.Customer{
 				TelegramID: telegramId,
 				Language:   langCode,
+				Username:   customerUsername(username),
 			})
 			if err != nil {
 				slog.Error("error creating customer", "error", err)
@@ -42,6 +48,7 @@ func (h Handler) CreateCustomerIfNotExistMiddleware(next bot.HandlerFunc) bot.Ha
 		} else {
 			updates := map[string]interface{}{
 				"language": langCode,
+				"username": customerUsername(username),
 			}
 
 			err = h.customerRepository.UpdateFields(ctx, existingCustomer.ID, updates)
@@ -94,6 +101,26 @@ func (h Handler) SuspiciousUserFilterMiddleware(next bot.HandlerFunc) bot.Handle
 			return
 		}
 
+		if !h.staffService.IsStaff(userID) {
+			customer, err := h.customerRepository.FindByTelegramId(ctx, userID)
+			if err != nil {
+				slog.Error("error finding customer by telegram id", "error", err)
+				return
+			}
+			if customer != nil && customer.Blocked {
+				slog.Warn("blocked customer", "userId", utils.MaskHalfInt64(userID))
+				_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+					ChatID:    chatID,
+					Text:      h.translation.GetText(langCode, "access_denied"),
+					ParseMode: models.ParseModeHTML,
+				})
+				if err != nil {
+					slog.Error("error sending blocked user message", "error", err)
+				}
+				return
+			}
+		}
+
 		if config.GetWhitelistedTelegramIds()[userID] {
 			slog.Info("whitelisted user allowed", "userId", utils.MaskHalfInt64(userID))
 			next(ctx, b, update)
@@ -116,3 +143,98 @@ func (h Handler) SuspiciousUserFilterMiddleware(next bot.HandlerFunc) bot.Handle
 		next(ctx, b, update)
 	}
 }
+
+// ChannelSubscriptionMiddleware lets the callback through only when the user joined the channel required by
+// REQUIRED_CHANNEL_ID, otherwise it shows the subscribe screen. purchase marks purchase routes, which are only gated
+// with REQUIRED_CHANNEL_FOR_PURCHASE. When Telegram cannot be asked the user is let through, so an API outage does not
+// block the shop.
+func (h Handler) ChannelSubscriptionMiddleware(purchase bool) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			if h.channelService == nil || update.CallbackQuery == nil || (purchase && !config.IsChannelRequiredForPurchase()) {
+				next(ctx, b, update)
+				return
+			}
+
+			userID := update.CallbackQuery.From.ID
+			joined, err := h.channelService.IsMember(ctx, userID)
+			if err != nil {
+				slog.Error("error checking channel membership", "userId", utils.MaskHalfInt64(userID), "error", err)
+				next(ctx, b, update)
+				return
+			}
+			if !joined {
+				h.sendChannelSubscribe(ctx, b, update)
+				return
+			}
+			next(ctx, b, update)
+		}
+	}
+}
+
+// StaffMiddleware lets the update through only for staff members whose role has the permission.
+// Other staff members are told their role does not allow it, customers are ignored.
+func (h Handler) StaffMiddleware(permission staff.Permission) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			var userID int64
+			if update.Message != nil {
+				userID = update.Message.From.ID
+			} else if update.CallbackQuery != nil {
+				userID = update.CallbackQuery.From.ID
+			} else {
+				return
+			}
+
+			if h.staffService.Can(userID, permission) {
+				next(ctx, b, update)
+				return
+			}
+			if h.staffService.IsStaff(userID) {
+				slog.Warn("staff action denied", "userId", utils.MaskHalfInt64(userID), "permission", permission)
+				h.sendStaffForbidden(ctx, b, update)
+			}
+		}
+	}
+}
+
+func (h Handler) sendStaffForbidden(ctx context.Context, b *bot.Bot, update *models.Update) {
+	if update.CallbackQuery != nil {
+		_, err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+			CallbackQueryID: update.CallbackQuery.ID,
+			Text:            h.translation.GetText(update.CallbackQuery.From.LanguageCode, "admin_forbidden"),
+			ShowAlert:       true,
+		})
+		if err != nil {
+			slog.Error("Error answering forbidden callback", "error", err)
+		}
+		return
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(update.Message.From.LanguageCode, "admin_forbidden"),
+	})
+	if err != nil {
+		slog.Error("Error sending forbidden message", "error", err)
+	}
+}
+
+// MetricsMiddleware records how long the handler chain takes. Put it first so the other middlewares are timed too.
+func (h Handler) MetricsMiddleware(name string) bot.Middleware {
+	return func(next bot.HandlerFunc) bot.HandlerFunc {
+		return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+			start := time.Now()
+			next(ctx, b, update)
+			metrics.HandlerDuration.WithLabelValues(name).Observe(time.Since(start).Seconds())
+		}
+	}
+}
+
+func customerUsername(username string) *string {
+	if username == "" {
+		return nil
+	}
+	return &username
+}
@@ -2,7 +2,6 @@ package handler
 
 import (
 	"context"
-	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -13,63 +12,76 @@ import (
 
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
 )
 
 func (h Handler) BuyCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	callback := update.CallbackQuery.Message.Message
-	langCode := update.CallbackQuery.From.LanguageCode
+	h.showTariffs(ctx, b, update, false)
+}
 
-	var priceButtons []models.InlineKeyboardButton
+// BuyGiftCallbackHandler lists the tariffs for buying a gift code instead of extending the own subscription.
+func (h Handler) BuyGiftCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	h.showTariffs(ctx, b, update, true)
+}
 
-	if config.Price1() > 0 {
-		priceButtons = append(priceButtons, models.InlineKeyboardButton{
-			Text:         h.translation.GetText(langCode, "month_1"),
-			CallbackData: fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 1, config.Price1()),
-		})
-	}
+func (h Handler) showTariffs(ctx context.Context, b *bot.Bot, update *models.Update, gift bool) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
 
-	if config.Price3() > 0 {
-		priceButtons = append(priceButtons, models.InlineKeyboardButton{
-			Text:         h.translation.GetText(langCode, "month_3"),
-			CallbackData: fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 3, config.Price3()),
-		})
+	tariffs, err := h.tariffRepository.FindActive(ctx)
+	if err != nil {
+		slog.Error("Error finding tariffs", "error", err)
+		return
 	}
 
-	if config.Price6() > 0 {
+	tokens := newCallbackTokens(update.CallbackQuery.From.ID)
+	var priceButtons []models.InlineKeyboardButton
+	for _, tariff := range tariffs {
+		payload := map[string]string{"tariff": strconv.FormatInt(tariff.ID, 10)}
+		if gift {
+			payload["gift"] = "1"
+		}
 		priceButtons = append(priceButtons, models.InlineKeyboardButton{
-			Text:         h.translation.GetText(langCode, "month_6"),
-			CallbackData: fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 6, config.Price6()),
+			Text:         h.tariffName(langCode, &tariff),
+			CallbackData: tokens.Add(CallbackSell, payload),
 		})
 	}
-
-	if config.Price12() > 0 {
-		priceButtons = append(priceButtons, models.InlineKeyboardButton{
-			Text:         h.translation.GetText(langCode, "month_12"),
-			CallbackData: fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, 12, config.Price12()),
-		})
+	if err := h.saveCallbackTokens(ctx, tokens); err != nil {
+		slog.Error("Error saving callback tokens", "error", err)
+		return
 	}
 
 	keyboard := [][]models.InlineKeyboardButton{}
 
-	if len(priceButtons) == 4 {
-		keyboard = append(keyboard, priceButtons[:2])
-		keyboard = append(keyboard, priceButtons[2:])
-	} else if len(priceButtons) > 0 {
-		keyboard = append(keyboard, priceButtons)
+	for len(priceButtons) > 0 {
+		row := priceButtons[:min(2, len(priceButtons))]
+		keyboard = append(keyboard, row)
+		priceButtons = priceButtons[len(row):]
+	}
+
+	text := h.translation.GetText(langCode, "pricing_info")
+	back := CallbackStart
+	if gift {
+		text = h.translation.GetText(langCode, "gift_pricing_info")
+		back = CallbackBuy
+	} else {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: h.translation.GetText(langCode, "gift_button"), CallbackData: CallbackBuyGift},
+		})
 	}
 
 	keyboard = append(keyboard, []models.InlineKeyboardButton{
-		{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart},
+		{Text: h.translation.GetText(langCode, "back_button"), CallbackData: back},
 	})
 
-	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
 		ChatID:    callback.Chat.ID,
 		MessageID: callback.ID,
 		ParseMode: models.ParseModeHTML,
 		ReplyMarkup: models.InlineKeyboardMarkup{
 			InlineKeyboard: keyboard,
 		},
-		Text: h.translation.GetText(langCode, "pricing_info"),
+		Text: text,
 	})
 
 	if err != nil {
@@ -77,32 +89,109 @@ func (h Handler) BuyCallbackHandler(ctx context.Context, b *bot.Bot, update *mod
 	}
 }
 
+// tariffName translates the tariff name when it is a translation key and returns it as is otherwise.
+func (h Handler) tariffName(langCode string, tariff *database.Tariff) string {
+	return h.translation.GetText(langCode, tariff.Name)
+}
+
+// findTariff returns the active tariff referenced by the button, or nil if it is no longer offered.
+func (h Handler) findTariff(ctx context.Context, payload map[string]string) (*database.Tariff, error) {
+	tariffID, err := strconv.ParseInt(payload["tariff"], 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	tariff, err := h.tariffRepository.FindById(ctx, tariffID)
+	if err != nil || tariff == nil || !tariff.Active {
+		return nil, err
+	}
+	return tariff, nil
+}
+
 func (h Handler) SellCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	callback := update.CallbackQuery.Message.Message
-	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
 	langCode := update.CallbackQuery.From.LanguageCode
-	month := callbackQuery["month"]
-	amount := callbackQuery["amount"]
 
+	payload, ok := h.resolveCallback(ctx, b, update, CallbackSell)
+	if !ok {
+		return
+	}
+
+	tariff, err := h.findTariff(ctx, payload)
+	if err != nil {
+		slog.Error("Error finding tariff", "error", err)
+		return
+	}
+	if tariff == nil {
+		h.BuyCallbackHandler(ctx, b, update)
+		return
+	}
+
+	var promo *database.PromoCode
+	if promoID, err := strconv.ParseInt(payload["promo"], 10, 64); err == nil {
+		promo, err = h.promoCodeRepository.FindById(ctx, promoID)
+		if err != nil {
+			slog.Error("Error finding promo code", "error", err)
+			return
+		}
+	}
+
+	keyboard, err := h.paymentMethodsKeyboard(ctx, callback.Chat.ID, langCode, tariff, promo, payload["gift"] == "1")
+	if err != nil {
+		slog.Error("Error building payment methods", "error", err)
+		return
+	}
+
+	_, err = b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+	})
+
+	if err != nil {
+		slog.Error("Error sending sell message", "error", err)
+	}
+}
+
+// paymentMethodsKeyboard lists the enabled payment methods the tariff has a price for. With a promo code
+// only the methods the code allows are shown and the code is passed on to the payment callback. Gifts are
+// paid without promo codes and Tribute, which always extends the payer's own subscription.
+func (h Handler) paymentMethodsKeyboard(ctx context.Context, chatID int64, langCode string, tariff *database.Tariff, promo *database.PromoCode, gift bool) ([][]models.InlineKeyboardButton, error) {
 	var keyboard [][]models.InlineKeyboardButton
 
-	if config.IsCryptoPayEnabled() {
+	tokens := newCallbackTokens(chatID)
+	paymentCallback := func(invoiceType database.InvoiceType) string {
+		payload := map[string]string{"tariff": strconv.FormatInt(tariff.ID, 10), "invoiceType": string(invoiceType)}
+		if promo != nil {
+			payload["promo"] = strconv.FormatInt(promo.ID, 10)
+		}
+		if gift {
+			payload["gift"] = "1"
+		}
+		return tokens.Add(CallbackPayment, payload)
+	}
+	allowed := func(invoiceType database.InvoiceType) bool {
+		return tariff.Price(invoiceType) > 0 && (promo == nil || promo.AllowsInvoiceType(invoiceType))
+	}
+
+	if config.IsCryptoPayEnabled() && allowed(database.InvoiceTypeCrypto) {
 		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			{Text: h.translation.GetText(langCode, "crypto_button"), CallbackData: fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypeCrypto, amount)},
+			{Text: h.translation.GetText(langCode, "crypto_button"), CallbackData: paymentCallback(database.InvoiceTypeCrypto)},
 		})
 	}
 
-	if config.IsYookasaEnabled() {
+	if config.IsYookasaEnabled() && allowed(database.InvoiceTypeYookasa) {
 		keyboard = append(keyboard, []models.InlineKeyboardButton{
-			{Text: h.translation.GetText(langCode, "card_button"), CallbackData: fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypeYookasa, amount)},
+			{Text: h.translation.GetText(langCode, "card_button"), CallbackData: paymentCallback(database.InvoiceTypeYookasa)},
 		})
 	}
 
-	if config.IsTelegramStarsEnabled() {
+	if config.IsTelegramStarsEnabled() && allowed(database.InvoiceTypeTelegram) {
 		shouldShowStarsButton := true
 
 		if config.RequirePaidPurchaseForStars() {
-			customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
+			customer, err := h.customerRepository.FindByTelegramId(ctx, chatID)
 			if err != nil {
 				slog.Error("Error finding customer for stars check", "error", err)
 				shouldShowStarsButton = false
@@ -121,54 +210,61 @@ func (h Handler) SellCallbackHandler(ctx context.Context, b *bot.Bot, update *mo
 
 		if shouldShowStarsButton {
 			keyboard = append(keyboard, []models.InlineKeyboardButton{
-				{Text: h.translation.GetText(langCode, "stars_button"), CallbackData: fmt.Sprintf("%s?month=%s&invoiceType=%s&amount=%s", CallbackPayment, month, database.InvoiceTypeTelegram, amount)},
+				{Text: h.translation.GetText(langCode, "stars_button"), CallbackData: paymentCallback(database.InvoiceTypeTelegram)},
 			})
 		}
 	}
 
-	if config.GetTributeWebHookUrl() != "" {
+	// Tribute is paid on an external page, so promo codes cannot be applied to it.
+	if config.GetTributeWebHookUrl() != "" && promo == nil && !gift {
 		keyboard = append(keyboard, []models.InlineKeyboardButton{
 			{Text: h.translation.GetText(langCode, "tribute_button"), URL: config.GetTributePaymentUrl()},
 		})
 	}
 
-	keyboard = append(keyboard, []models.InlineKeyboardButton{
-		{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackBuy},
-	})
+	if promo == nil && !gift {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{
+			{Text: h.translation.GetText(langCode, "promo_button"), CallbackData: tokens.Add(CallbackEnterPromo, map[string]string{"tariff": strconv.FormatInt(tariff.ID, 10)})},
+		})
+	}
 
-	_, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
-		ChatID:    callback.Chat.ID,
-		MessageID: callback.ID,
-		ReplyMarkup: models.InlineKeyboardMarkup{
-			InlineKeyboard: keyboard,
-		},
+	back := CallbackBuy
+	if gift {
+		back = CallbackBuyGift
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{
+		{Text: h.translation.GetText(langCode, "back_button"), CallbackData: back},
 	})
 
-	if err != nil {
-		slog.Error("Error sending sell message", "error", err)
+	if err := h.saveCallbackTokens(ctx, tokens); err != nil {
+		return nil, err
 	}
+	return keyboard, nil
 }
 
 func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	callback := update.CallbackQuery.Message.Message
-	callbackQuery := parseCallbackData(update.CallbackQuery.Data)
-	month, err := strconv.Atoi(callbackQuery["month"])
-	if err != nil {
-		slog.Error("Error getting month from query", "error", err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	payload, ok := h.resolveCallback(ctx, b, update, CallbackPayment)
+	if !ok {
 		return
 	}
+	invoiceType := database.InvoiceType(payload["invoiceType"])
 
-	invoiceType := database.InvoiceType(callbackQuery["invoiceType"])
-
-	var price int
-	if invoiceType == database.InvoiceTypeTelegram {
-		price = config.StarsPrice(month)
-	} else {
-		price = config.Price(month)
+	tariff, err := h.findTariff(ctx, payload)
+	if err != nil {
+		slog.Error("Error finding tariff", "error", err)
+		return
+	}
+	if tariff == nil || tariff.Price(invoiceType) <= 0 {
+		h.BuyCallbackHandler(ctx, b, update)
+		return
 	}
+	price := tariff.Price(invoiceType)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
-	defer cancel()
 	customer, err := h.customerRepository.FindByTelegramId(ctx, callback.Chat.ID)
 	if err != nil {
 		slog.Error("Error finding customer", "error", err)
@@ -179,14 +275,40 @@ func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update
 		return
 	}
 
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	gift := payload["gift"] == "1"
+	var discount *payment.Discount
+	backPayload := map[string]string{"tariff": strconv.FormatInt(tariff.ID, 10)}
+	if gift {
+		backPayload["gift"] = "1"
+	} else if promoID, err := strconv.ParseInt(payload["promo"], 10, 64); err == nil {
+		discount, err = h.paymentService.ApplyPromoCode(ctx, promoID, customer, tariff, invoiceType)
+		if err != nil {
+			h.sendPromoCodeError(ctx, b, callback.Chat.ID, langCode, tariff.ID, err)
+			return
+		}
+		backPayload["promo"] = payload["promo"]
+		price -= discount.Amount
+	}
+
 	ctxWithUsername := context.WithValue(ctx, "username", update.CallbackQuery.From.Username)
-	paymentURL, purchaseId, err := h.paymentService.CreatePurchase(ctxWithUsername, float64(price), month, customer, invoiceType)
+	paymentURL, purchaseId, err := h.paymentService.CreatePurchase(ctxWithUsername, float64(price), tariff, customer, invoiceType, discount, gift)
 	if err != nil {
+		if discount != nil && isPromoCodeError(err) {
+			h.sendPromoCodeError(ctx, b, callback.Chat.ID, langCode, tariff.ID, err)
+			return
+		}
 		slog.Error("Error creating payment", "error", err)
 		return
 	}
 
-	langCode := update.CallbackQuery.From.LanguageCode
+	tokens := newCallbackTokens(callback.Chat.ID)
+	backCallback := tokens.Add(CallbackSell, backPayload)
+	if err := h.saveCallbackTokens(ctx, tokens); err != nil {
+		slog.Error("Error saving callback tokens", "error", err)
+		return
+	}
 
 	message, err := b.EditMessageReplyMarkup(ctx, &bot.EditMessageReplyMarkupParams{
 		ChatID:    callback.Chat.ID,
@@ -195,7 +317,7 @@ func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update
 			InlineKeyboard: [][]models.InlineKeyboardButton{
 				{
 					{Text: h.translation.GetText(langCode, "pay_button"), URL: paymentURL},
-					{Text: h.translation.GetText(langCode, "back_button"), CallbackData: fmt.Sprintf("%s?month=%d&amount=%d", CallbackSell, month, price)},
+					{Text: h.translation.GetText(langCode, "back_button"), CallbackData: backCallback},
 				},
 			},
 		},
@@ -207,27 +329,38 @@ func (h Handler) PaymentCallbackHandler(ctx context.Context, b *bot.Bot, update
 	h.cache.Set(purchaseId, message.ID)
 }
 
+// PreCheckoutCallbackHandler lets Telegram charge a Stars invoice only for a pending purchase of the same amount.
 func (h Handler) PreCheckoutCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	_, err := b.AnswerPreCheckoutQuery(ctx, &bot.AnswerPreCheckoutQueryParams{
-		PreCheckoutQueryID: update.PreCheckoutQuery.ID,
+	query := update.PreCheckoutQuery
+	params := &bot.AnswerPreCheckoutQueryParams{
+		PreCheckoutQueryID: query.ID,
 		OK:                 true,
-	})
+	}
+	if err := h.paymentService.CheckTelegramCheckout(ctx, query.InvoicePayload, query.Currency, query.TotalAmount); err != nil {
+		slog.Warn("Declining Telegram payment", "error", err)
+		langCode := ""
+		if query.From != nil {
+			langCode = query.From.LanguageCode
+		}
+		params.OK = false
+		params.ErrorMessage = h.translation.GetText(langCode, "payment_declined")
+	}
+
+	_, err := b.AnswerPreCheckoutQuery(ctx, params)
 	if err != nil {
 		slog.Error("Error sending answer pre checkout query", "error", err)
 	}
 }
 
 func (h Handler) SuccessPaymentHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	payload := strings.Split(update.Message.SuccessfulPayment.InvoicePayload, "&")
-	purchaseId, err := strconv.Atoi(payload[0])
-	username := payload[1]
+	purchaseId, username, err := payment.ParseTelegramInvoicePayload(update.Message.SuccessfulPayment.InvoicePayload)
 	if err != nil {
 		slog.Error("Error parsing purchase id", "error", err)
 		return
 	}
 
 	ctxWithUsername := context.WithValue(ctx, "username", username)
-	err = h.paymentService.ProcessPurchaseById(ctxWithUsername, int64(purchaseId))
+	err = h.paymentService.ProcessTelegramPayment(ctxWithUsername, purchaseId, update.Message.SuccessfulPayment.TelegramPaymentChargeID)
 	if err != nil {
 		slog.Error("Error processing purchase", "error", err)
 	}
@@ -0,0 +1,314 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/payment"
+)
+
+func (h Handler) EnterPromoCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	payload, ok := h.resolveCallback(ctx, b, update, CallbackEnterPromo)
+	if !ok {
+		return
+	}
+
+	h.input.Set(update.CallbackQuery.From.ID, inputPromoCode, payload["tariff"])
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, "promo_prompt"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackBuy}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending promo prompt", "error", err)
+	}
+}
+
+// promoCodeInput checks the code the customer sent and offers the payment methods it can be used with.
+func (h Handler) promoCodeInput(ctx context.Context, b *bot.Bot, message *models.Message, payload string) {
+	langCode := message.From.LanguageCode
+
+	tariff, err := h.findTariff(ctx, map[string]string{"tariff": payload})
+	if err != nil {
+		slog.Error("Error finding tariff", "error", err)
+		return
+	}
+	if tariff == nil {
+		slog.Warn("tariff for promo code is no longer offered", "tariff", payload)
+		return
+	}
+
+	customer, err := h.customerRepository.FindByTelegramId(ctx, message.Chat.ID)
+	if err != nil {
+		slog.Error("Error finding customer", "error", err)
+		return
+	}
+	if customer == nil {
+		slog.Error("customer not exist", "chatID", message.Chat.ID)
+		return
+	}
+
+	promo, err := h.paymentService.FindPromoCode(ctx, message.Text, customer, tariff)
+	if err != nil {
+		h.sendPromoCodeError(ctx, b, message.Chat.ID, langCode, tariff.ID, err)
+		return
+	}
+
+	text := fmt.Sprintf(h.translation.GetText(langCode, "promo_applied"), html.EscapeString(promo.Code), h.describePromoCode(langCode, promo))
+	keyboard, err := h.paymentMethodsKeyboard(ctx, message.Chat.ID, langCode, tariff, promo, false)
+	if err != nil {
+		slog.Error("Error building payment methods", "error", err)
+		return
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: keyboard,
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending promo applied message", "error", err)
+	}
+}
+
+func (h Handler) sendPromoCodeError(ctx context.Context, b *bot.Bot, chatID int64, langCode string, tariffID int64, cause error) {
+	key := promoCodeErrorKey(cause)
+	if key == "" {
+		slog.Error("Error checking promo code", "error", cause)
+		return
+	}
+
+	tokens := newCallbackTokens(chatID)
+	retryCallback := tokens.Add(CallbackEnterPromo, map[string]string{"tariff": strconv.FormatInt(tariffID, 10)})
+	if err := h.saveCallbackTokens(ctx, tokens); err != nil {
+		slog.Error("Error saving callback tokens", "error", err)
+		return
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    chatID,
+		ParseMode: models.ParseModeHTML,
+		Text:      h.translation.GetText(langCode, key),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "promo_retry_button"), CallbackData: retryCallback}},
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackBuy}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending promo error message", "error", err)
+	}
+}
+
+func isPromoCodeError(err error) bool {
+	return promoCodeErrorKey(err) != ""
+}
+
+// promoCodeErrorKey returns the message shown to the customer, or "" if err is not a promo code rejection.
+func promoCodeErrorKey(err error) string {
+	switch {
+	case errors.Is(err, payment.ErrPromoCodeNotFound):
+		return "promo_not_found"
+	case errors.Is(err, payment.ErrPromoCodeExpired):
+		return "promo_expired"
+	case errors.Is(err, payment.ErrPromoCodeNotApplicable):
+		return "promo_not_applicable"
+	case errors.Is(err, database.ErrPromoCodeLimitReached):
+		return "promo_limit_reached"
+	case errors.Is(err, database.ErrPromoCodeCustomerLimitReached):
+		return "promo_already_used"
+	default:
+		return ""
+	}
+}
+
+func (h Handler) describePromoCode(langCode string, promo *database.PromoCode) string {
+	switch promo.Type {
+	case database.PromoCodeTypePercent:
+		return fmt.Sprintf(h.translation.GetText(langCode, "promo_discount_percent"), promo.Value)
+	case database.PromoCodeTypeFixed:
+		return fmt.Sprintf(h.translation.GetText(langCode, "promo_discount_fixed"), promo.Value)
+	case database.PromoCodeTypeDays:
+		return fmt.Sprintf(h.translation.GetText(langCode, "promo_discount_days"), promo.Value)
+	default:
+		return ""
+	}
+}
+
+// PromoCommandHandler manages promo codes:
+//
+//	/promo
+//	/promo add CODE percent|fixed|days VALUE [uses=N] [per_user=N] [until=YYYY-MM-DD] [tariffs=1,3] [methods=crypto,yookasa,telegram]
+//	/promo on|off CODE
+func (h Handler) PromoCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/promo"))
+
+	var text string
+	switch {
+	case len(args) == 0:
+		text = h.promoCodeList(ctx, langCode)
+	case args[0] == "add":
+		promo, err := parsePromoCodeArgs(args[1:])
+		if err != nil {
+			text = fmt.Sprintf(h.translation.GetText(langCode, "admin_promo_invalid"), html.EscapeString(err.Error()))
+			break
+		}
+		if _, err := h.promoCodeRepository.Create(ctx, promo); err != nil {
+			slog.Error("Error creating promo code", "error", err)
+			text = h.translation.GetText(langCode, "admin_promo_error")
+			break
+		}
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_promo_created"), html.EscapeString(strings.ToUpper(promo.Code)))
+	case (args[0] == "on" || args[0] == "off") && len(args) == 2:
+		found, err := h.promoCodeRepository.SetActive(ctx, args[1], args[0] == "on")
+		if err != nil {
+			slog.Error("Error updating promo code", "error", err)
+			return
+		}
+		if !found {
+			text = h.translation.GetText(langCode, "admin_promo_not_found")
+			break
+		}
+		text = h.translation.GetText(langCode, "admin_promo_updated")
+	default:
+		text = h.translation.GetText(langCode, "admin_promo_usage")
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+	})
+	if err != nil {
+		slog.Error("Error sending promo message", "error", err)
+	}
+}
+
+func (h Handler) promoCodeList(ctx context.Context, langCode string) string {
+	promos, err := h.promoCodeRepository.FindAll(ctx)
+	if err != nil {
+		slog.Error("Error finding promo codes", "error", err)
+		return h.translation.GetText(langCode, "admin_promo_error")
+	}
+	if len(promos) == 0 {
+		return h.translation.GetText(langCode, "admin_promo_empty") + "\n\n" + h.translation.GetText(langCode, "admin_promo_usage")
+	}
+
+	var text strings.Builder
+	text.WriteString(h.translation.GetText(langCode, "admin_promo_title"))
+	for _, promo := range promos {
+		uses, _, err := h.promoCodeRepository.CountUses(ctx, promo.ID, 0)
+		if err != nil {
+			slog.Error("Error counting promo code uses", "error", err)
+		}
+		limit := "∞"
+		if promo.MaxUses != nil {
+			limit = strconv.Itoa(*promo.MaxUses)
+		}
+		status := "✅"
+		if !promo.Active || (promo.ExpiresAt != nil && promo.ExpiresAt.Before(time.Now())) {
+			status = "⛔"
+		}
+		text.WriteString(fmt.Sprintf("\n%s <code>%s</code> — %s, %d/%s", status, html.EscapeString(promo.Code), h.describePromoCode(langCode, &promo), uses, limit))
+	}
+	return text.String()
+}
+
+// parsePromoCodeArgs parses "CODE TYPE VALUE [key=value...]" from the /promo add command.
+func parsePromoCodeArgs(args []string) (*database.PromoCode, error) {
+	if len(args) < 3 {
+		return nil, errors.New("expected CODE TYPE VALUE")
+	}
+
+	promo := &database.PromoCode{Code: args[0], Type: database.PromoCodeType(args[1]), MaxUsesPerCustomer: 1}
+	if len(promo.Code) > 64 {
+		return nil, errors.New("code is too long")
+	}
+
+	value, err := strconv.Atoi(args[2])
+	if err != nil || value <= 0 {
+		return nil, fmt.Errorf("invalid value %q", args[2])
+	}
+	promo.Value = value
+
+	switch promo.Type {
+	case database.PromoCodeTypePercent:
+		if value >= 100 {
+			return nil, errors.New("percent must be below 100")
+		}
+	case database.PromoCodeTypeFixed, database.PromoCodeTypeDays:
+	default:
+		return nil, fmt.Errorf("unknown type %q", args[1])
+	}
+
+	for _, arg := range args[3:] {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid option %q", arg)
+		}
+		switch kv[0] {
+		case "uses":
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid uses %q", kv[1])
+			}
+			promo.MaxUses = &n
+		case "per_user":
+			n, err := strconv.Atoi(kv[1])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid per_user %q", kv[1])
+			}
+			promo.MaxUsesPerCustomer = n
+		case "until":
+			until, err := time.Parse("2006-01-02", kv[1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid until %q", kv[1])
+			}
+			// The code stays valid for the whole day.
+			until = until.AddDate(0, 0, 1)
+			promo.ExpiresAt = &until
+		case "tariffs":
+			for _, t := range strings.Split(kv[1], ",") {
+				id, err := strconv.ParseInt(t, 10, 64)
+				if err != nil || id <= 0 {
+					return nil, fmt.Errorf("invalid tariffs %q", kv[1])
+				}
+				promo.TariffIDs = append(promo.TariffIDs, id)
+			}
+		case "methods":
+			for _, method := range strings.Split(kv[1], ",") {
+				switch database.InvoiceType(method) {
+				case database.InvoiceTypeCrypto, database.InvoiceTypeYookasa, database.InvoiceTypeTelegram:
+					promo.InvoiceTypes = append(promo.InvoiceTypes, method)
+				default:
+					return nil, fmt.Errorf("invalid method %q", method)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("unknown option %q", kv[0])
+		}
+	}
+
+	return promo, nil
+}
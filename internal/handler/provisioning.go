@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/utils"
+)
+
+const (
+	provisioningListLimit = 20
+	provisioningErrorLen  = 120
+)
+
+// ProvisioningCommandHandler lists paid purchases whose subscription could not be extended and re-drives them:
+//
+//	/provisioning
+//	/provisioning retry PURCHASE_ID
+func (h Handler) ProvisioningCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/provisioning"))
+
+	var text string
+	switch {
+	case len(args) == 0:
+		text = h.provisioningList(ctx, langCode)
+	case args[0] == "retry" && len(args) == 2:
+		purchaseId, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			text = h.translation.GetText(langCode, "admin_provisioning_usage")
+			break
+		}
+		if err := h.paymentService.RetryProvisioningNow(ctx, purchaseId); err != nil {
+			slog.Error("Error retrying provisioning", "purchase_id", utils.MaskHalfInt64(purchaseId), "error", err)
+			text = fmt.Sprintf(h.translation.GetText(langCode, "admin_provisioning_failed"), html.EscapeString(err.Error()))
+			break
+		}
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_provisioning_done"), purchaseId)
+	default:
+		text = h.translation.GetText(langCode, "admin_provisioning_usage")
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+	})
+	if err != nil {
+		slog.Error("Error sending provisioning message", "error", err)
+	}
+}
+
+func (h Handler) provisioningList(ctx context.Context, langCode string) string {
+	jobs, err := h.provisioningJobRepository.FindFailed(ctx, provisioningListLimit)
+	if err != nil {
+		slog.Error("Error finding provisioning jobs", "error", err)
+		return fmt.Sprintf(h.translation.GetText(langCode, "admin_provisioning_failed"), html.EscapeString(err.Error()))
+	}
+	if len(jobs) == 0 {
+		return h.translation.GetText(langCode, "admin_provisioning_empty")
+	}
+
+	var text strings.Builder
+	text.WriteString(h.translation.GetText(langCode, "admin_provisioning_title"))
+	for _, job := range jobs {
+		lastError := ""
+		if job.LastError != nil {
+			lastError = *job.LastError
+			if len([]rune(lastError)) > provisioningErrorLen {
+				lastError = string([]rune(lastError)[:provisioningErrorLen]) + "…"
+			}
+		}
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_provisioning_row"),
+			job.PurchaseID, job.Attempts, job.NextAttemptAt.Format("02.01.2006 15:04"), html.EscapeString(lastError)))
+	}
+	text.WriteString("\n\n" + h.translation.GetText(langCode, "admin_provisioning_usage"))
+	return text.String()
+}
@@ -3,40 +3,220 @@ package handler
 import (
 	"context"
 	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/deeplink"
+	"remnawave-tg-shop-bot/utils"
 )
 
+const referralPageSize = 10
+
+// ReferralCallbackHandler shows the referral dashboard: totals, a page of invited customers with their status and
+// the referrer rewards they earned.
 func (h Handler) ReferralCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	customer, _ := h.customerRepository.FindByTelegramId(ctx, update.CallbackQuery.From.ID)
 	langCode := update.CallbackQuery.From.LanguageCode
-	refCode := customer.TelegramID
+	telegramID := update.CallbackQuery.From.ID
+	page := callbackPage(update.CallbackQuery.Data)
 
-	refLink := fmt.Sprintf("https://telegram.me/share/url?url=https://t.me/%s?start=ref_%d", update.CallbackQuery.Message.Message.From.Username, refCode)
-	count, err := h.referralRepository.CountByReferrer(ctx, customer.TelegramID)
+	count, err := h.referralRepository.CountByReferrer(ctx, telegramID)
 	if err != nil {
 		slog.Error("error counting referrals", "error", err)
 		return
 	}
-	text := fmt.Sprintf(h.translation.GetText(langCode, "referral_text"), count)
-	callbackMessage := update.CallbackQuery.Message.Message
-	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
-		ChatID:    callbackMessage.Chat.ID,
-		MessageID: callbackMessage.ID,
-		Text:      text,
+	paying, err := h.referralRepository.CountPayingReferrals(ctx, telegramID)
+	if err != nil {
+		slog.Error("error counting paying referrals", "error", err)
+		return
+	}
+	totals, err := h.referralRepository.FindRewardTotals(ctx, telegramID)
+	if err != nil {
+		slog.Error("error summing referral rewards", "error", err)
+		return
+	}
+	pages := pageCount(count, referralPageSize)
+	page = min(page, pages)
+	invitees, err := h.referralRepository.FindInvitees(ctx, telegramID, referralPageSize, (page-1)*referralPageSize)
+	if err != nil {
+		slog.Error("error finding invitees", "error", err)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "referral_text"), count, paying, totals.Days))
+	if len(invitees) == 0 {
+		text.WriteString(h.translation.GetText(langCode, "referral_invitees_empty"))
+	} else {
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "referral_invitees_title"), page, pages))
+	}
+	for i, invitee := range invitees {
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "referral_invitee_row"),
+			(page-1)*referralPageSize+i+1, html.EscapeString(inviteeName(invitee)), h.translation.GetText(langCode, inviteeStatusKey(invitee))))
+		if invitee.LastBonusAt != nil {
+			text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "referral_invitee_bonus"), invitee.BonusDays, invitee.LastBonusAt.Format("02.01.2006")))
+		}
+	}
+
+	link := referralLink(telegramID)
+	shareURL := fmt.Sprintf("https://t.me/share/url?url=%s&text=%s",
+		url.QueryEscape(link), url.QueryEscape(h.translation.GetText(langCode, "referral_share_text")))
+
+	keyboard := [][]models.InlineKeyboardButton{
+		{{Text: h.translation.GetText(langCode, "share_referral_button"), URL: shareURL}},
+		{{Text: h.translation.GetText(langCode, "referral_card_button"), CallbackData: CallbackReferralCard}},
+	}
+	if totals.Rewards > 0 {
+		keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "referral_rewards_button"), CallbackData: CallbackReferralRewards}})
+	}
+	if row := pageButtons(CallbackReferral, page, pages); row != nil {
+		keyboard = append(keyboard, row)
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}})
+
+	h.editReferralMessage(ctx, b, update, text.String(), keyboard)
+}
+
+// ReferralRewardsCallbackHandler lists the referral rewards received by the customer with the date each was granted.
+func (h Handler) ReferralRewardsCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	telegramID := update.CallbackQuery.From.ID
+	page := callbackPage(update.CallbackQuery.Data)
+
+	totals, err := h.referralRepository.FindRewardTotals(ctx, telegramID)
+	if err != nil {
+		slog.Error("error summing referral rewards", "error", err)
+		return
+	}
+	pages := pageCount(totals.Rewards, referralPageSize)
+	page = min(page, pages)
+	rewards, err := h.referralRepository.FindRewardsByRecipient(ctx, telegramID, referralPageSize, (page-1)*referralPageSize)
+	if err != nil {
+		slog.Error("error finding referral rewards", "error", err)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "referral_rewards_title"), totals.Days, page, pages))
+	if len(rewards) == 0 {
+		text.WriteString(h.translation.GetText(langCode, "referral_rewards_empty"))
+	}
+	for _, reward := range rewards {
+		text.WriteString(h.referralRewardRow(langCode, reward))
+	}
+
+	var keyboard [][]models.InlineKeyboardButton
+	if row := pageButtons(CallbackReferralRewards, page, pages); row != nil {
+		keyboard = append(keyboard, row)
+	}
+	keyboard = append(keyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackReferral}})
+
+	h.editReferralMessage(ctx, b, update, text.String(), keyboard)
+}
+
+// ReferralCardCallbackHandler sends an invitation card with the referral link that the customer can forward to friends.
+func (h Handler) ReferralCardCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.CallbackQuery.From.LanguageCode
+	link := referralLink(update.CallbackQuery.From.ID)
+
+	text := fmt.Sprintf(h.translation.GetText(langCode, "referral_card"), link)
+	if days := config.ReferralRefereeDays(); days > 0 {
+		text += fmt.Sprintf(h.translation.GetText(langCode, "referral_card_bonus"), days)
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.CallbackQuery.Message.Message.Chat.ID,
 		ParseMode: models.ParseModeHTML,
+		Text:      text,
 		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
-			{
-				{Text: h.translation.GetText(langCode, "share_referral_button"), URL: refLink},
-			},
-			{
-				{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart},
-			},
+			{{Text: h.translation.GetText(langCode, "referral_card_open_button"), URL: link}},
 		}},
 	})
+	if err != nil {
+		slog.Error("Error sending referral card", "error", err)
+	}
+}
+
+func (h Handler) editReferralMessage(ctx context.Context, b *bot.Bot, update *models.Update, text string, keyboard [][]models.InlineKeyboardButton) {
+	callbackMessage := update.CallbackQuery.Message.Message
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callbackMessage.Chat.ID,
+		MessageID:   callbackMessage.ID,
+		Text:        text,
+		ParseMode:   models.ParseModeHTML,
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
+	})
 	if err != nil {
 		slog.Error("Error sending referral message", "error", err)
 	}
 }
+
+func (h Handler) referralRewardRow(langCode string, reward database.ReferralReward) string {
+	date := reward.CreatedAt.Format("02.01.2006")
+	switch {
+	case reward.Days == 0:
+		// Bonuses granted before the ledger existed have no recorded length.
+		return fmt.Sprintf(h.translation.GetText(langCode, "referral_reward_row_legacy"), date)
+	case reward.Kind == database.ReferralRewardReferee:
+		return fmt.Sprintf(h.translation.GetText(langCode, "referral_reward_row_referee"), date, reward.Days)
+	case reward.Kind == database.ReferralRewardTier && reward.Tier != nil:
+		return fmt.Sprintf(h.translation.GetText(langCode, "referral_reward_row_tier"), date, reward.Days, *reward.Tier)
+	default:
+		return fmt.Sprintf(h.translation.GetText(langCode, "referral_reward_row_referrer"), date, reward.Days)
+	}
+}
+
+func referralLink(telegramID int64) string {
+	return fmt.Sprintf("%s?start=%s", config.BotURL(), deeplink.Referral(telegramID))
+}
+
+// inviteeName is the masked username of the invitee, or the masked telegram id when there is none.
+func inviteeName(invitee database.Invitee) string {
+	if invitee.Username != nil && *invitee.Username != "" {
+		return "@" + utils.MaskHalf(*invitee.Username)
+	}
+	return utils.MaskHalfInt64(invitee.TelegramID)
+}
+
+func inviteeStatusKey(invitee database.Invitee) string {
+	switch {
+	case invitee.Paid:
+		return "referral_status_paid"
+	case invitee.Trial:
+		return "referral_status_trial"
+	default:
+		return "referral_status_joined"
+	}
+}
+
+// callbackPage reads the 1-based page of a paginated callback, defaulting to the first page.
+func callbackPage(data string) int {
+	page, err := strconv.Atoi(parseCallbackData(data)["page"])
+	if err != nil || page < 1 {
+		return 1
+	}
+	return page
+}
+
+func pageCount(total, pageSize int) int {
+	return max(1, (total+pageSize-1)/pageSize)
+}
+
+// pageButtons returns the previous and next page buttons of a paginated screen, or nil when there is one page.
+func pageButtons(callback string, page, pages int) []models.InlineKeyboardButton {
+	var row []models.InlineKeyboardButton
+	if page > 1 {
+		row = append(row, models.InlineKeyboardButton{Text: "◀️", CallbackData: fmt.Sprintf("%s?page=%d", callback, page-1)})
+	}
+	if page < pages {
+		row = append(row, models.InlineKeyboardButton{Text: "▶️", CallbackData: fmt.Sprintf("%s?page=%d", callback, page+1)})
+	}
+	return row
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+const referralReviewListLimit = 20
+
+// ReferralReviewCommandHandler lists referrals flagged as possible abuse and records the admin's decision:
+//
+//	/referrals
+//	/referrals approve REFERRAL_ID
+//	/referrals reject REFERRAL_ID
+func (h Handler) ReferralReviewCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/referrals"))
+
+	var text string
+	switch {
+	case len(args) == 0:
+		text = h.referralReviewList(ctx, langCode)
+	case len(args) == 2 && (args[0] == "approve" || args[0] == "reject"):
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			text = h.translation.GetText(langCode, "admin_referrals_usage")
+			break
+		}
+		text = h.reviewReferral(ctx, langCode, id, args[0] == "approve", update.Message.From.ID)
+	default:
+		text = h.translation.GetText(langCode, "admin_referrals_usage")
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+	})
+	if err != nil {
+		slog.Error("Error sending referrals message", "error", err)
+	}
+}
+
+func (h Handler) referralReviewList(ctx context.Context, langCode string) string {
+	referrals, err := h.referralRepository.FindFlagged(ctx, referralReviewListLimit)
+	if err != nil {
+		slog.Error("Error finding flagged referrals", "error", err)
+		return fmt.Sprintf(h.translation.GetText(langCode, "admin_referrals_failed"), html.EscapeString(err.Error()))
+	}
+	if len(referrals) == 0 {
+		return h.translation.GetText(langCode, "admin_referrals_empty")
+	}
+
+	var text strings.Builder
+	text.WriteString(h.translation.GetText(langCode, "admin_referrals_title"))
+	for _, r := range referrals {
+		reason, pattern := "", ""
+		if r.FlagReason != nil {
+			reason = h.translation.GetText(langCode, "admin_referrals_reason_"+*r.FlagReason)
+		}
+		if r.Pattern != nil {
+			pattern = *r.Pattern
+		}
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_referrals_row"),
+			r.ID, r.ReferrerID, r.RefereeID, r.UsedAt.Format("02.01.2006 15:04"), reason, html.EscapeString(pattern)))
+	}
+	text.WriteString(h.translation.GetText(langCode, "admin_referrals_usage"))
+	return text.String()
+}
+
+func (h Handler) reviewReferral(ctx context.Context, langCode string, id int64, approve bool, reviewerID int64) string {
+	status := database.ReferralStatusRejected
+	if approve {
+		status = database.ReferralStatusApproved
+	}
+	referral, err := h.referralRepository.Review(ctx, id, status, reviewerID)
+	if err != nil {
+		slog.Error("Error reviewing referral", "referral_id", id, "error", err)
+		return fmt.Sprintf(h.translation.GetText(langCode, "admin_referrals_failed"), html.EscapeString(err.Error()))
+	}
+	if referral == nil {
+		return fmt.Sprintf(h.translation.GetText(langCode, "admin_referrals_not_flagged"), id)
+	}
+	slog.Info("referral reviewed", "referral_id", id, "status", status)
+
+	if !approve {
+		return fmt.Sprintf(h.translation.GetText(langCode, "admin_referrals_rejected"), id)
+	}
+	if err := h.paymentService.GrantApprovedReferralRewards(ctx, referral); err != nil {
+		slog.Error("Error granting approved referral rewards", "referral_id", id, "error", err)
+		return fmt.Sprintf(h.translation.GetText(langCode, "admin_referrals_approved_grant_failed"), id, html.EscapeString(err.Error()))
+	}
+	return fmt.Sprintf(h.translation.GetText(langCode, "admin_referrals_approved"), id)
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/utils"
+)
+
+// RefundCommandHandler shows what refunding a purchase changes and asks the admin to confirm it:
+//
+//	/refund PURCHASE_ID
+func (h Handler) RefundCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+
+	params := &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+	}
+
+	purchaseId, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(update.Message.Text, "/refund")), 10, 64)
+	if err != nil {
+		params.Text = h.translation.GetText(langCode, "admin_refund_usage")
+	} else if refund, err := h.paymentService.PrepareRefund(ctx, purchaseId); err != nil {
+		params.Text = fmt.Sprintf(h.translation.GetText(langCode, "admin_refund_failed"), html.EscapeString(err.Error()))
+	} else {
+		purchase := refund.Purchase
+		params.Text = fmt.Sprintf(h.translation.GetText(langCode, "admin_refund_confirm"),
+			purchase.ID, refund.Customer.TelegramID, purchase.InvoiceType, purchase.Amount, purchase.Currency, refund.UnusedDays)
+		params.ReplyMarkup = models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{
+				{Text: h.translation.GetText(langCode, "admin_refund_button"), CallbackData: fmt.Sprintf("%s?id=%d", CallbackAdminRefund, purchase.ID)},
+				{Text: h.translation.GetText(langCode, "admin_cancel_button"), CallbackData: adminCustomerCallback(refund.Customer.ID)},
+			},
+		}}
+	}
+
+	_, err = b.SendMessage(ctx, params)
+	if err != nil {
+		slog.Error("Error sending refund message", "error", err)
+	}
+}
+
+func (h Handler) AdminRefundCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	purchaseId, err := strconv.ParseInt(parseCallbackData(update.CallbackQuery.Data)["id"], 10, 64)
+	if err != nil {
+		slog.Error("Invalid purchase id in refund callback", "data", update.CallbackQuery.Data)
+		return
+	}
+
+	refund, err := h.paymentService.RefundPurchase(ctx, purchaseId)
+
+	var text strings.Builder
+	if err != nil {
+		slog.Error("Error refunding purchase", "purchase_id", utils.MaskHalfInt64(purchaseId), "error", err)
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_refund_failed"), html.EscapeString(err.Error())))
+	} else {
+		slog.Info("purchase refunded by admin", "admin_id", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "purchase_id", utils.MaskHalfInt64(purchaseId))
+		expireAt := "—"
+		if refund.ExpireAt != nil {
+			expireAt = refund.ExpireAt.Format("02.01.2006 15:04")
+		}
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_refund_done"), purchaseId, refund.UnusedDays, expireAt))
+		if refund.Purchase.Gift {
+			if refund.GiftCodeExpired {
+				text.WriteString(h.translation.GetText(langCode, "admin_refund_gift_expired"))
+			} else {
+				text.WriteString(h.translation.GetText(langCode, "admin_refund_gift_redeemed"))
+			}
+		}
+		if refund.Receipt != nil {
+			if refund.ReceiptCancelled {
+				text.WriteString(h.translation.GetText(langCode, "admin_refund_receipt_cancelled"))
+			} else {
+				text.WriteString(h.translation.GetText(langCode, "admin_refund_receipt_failed"))
+			}
+		}
+	}
+
+	back := CallbackAdmin
+	if refund != nil {
+		back = adminCustomerCallback(refund.Customer.ID)
+	}
+
+	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:    callback.Chat.ID,
+		MessageID: callback.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text.String(),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: back}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending refund result", "error", err)
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/staff"
+)
+
+// StaffCommandHandler manages who has access to admin commands:
+//
+//	/staff
+//	/staff add TELEGRAM_ID owner|admin|support|finance
+//	/staff remove TELEGRAM_ID
+func (h Handler) StaffCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+	actorID := update.Message.From.ID
+	args := strings.Fields(strings.TrimPrefix(update.Message.Text, "/staff"))
+
+	var text string
+	switch {
+	case len(args) == 0:
+		text = h.staffList(langCode)
+	case args[0] == "add" && len(args) == 3:
+		telegramID, err := strconv.ParseInt(args[1], 10, 64)
+		role, ok := staff.ParseRole(args[2])
+		if err != nil || !ok {
+			text = h.translation.GetText(langCode, "admin_staff_usage")
+			break
+		}
+		if err := h.staffService.Add(ctx, actorID, telegramID, role); err != nil {
+			text = h.staffErrorText(langCode, err)
+			break
+		}
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_staff_saved"), telegramID, role)
+	case args[0] == "remove" && len(args) == 2:
+		telegramID, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			text = h.translation.GetText(langCode, "admin_staff_usage")
+			break
+		}
+		removed, err := h.staffService.Remove(ctx, actorID, telegramID)
+		if err != nil {
+			text = h.staffErrorText(langCode, err)
+			break
+		}
+		if !removed {
+			text = h.translation.GetText(langCode, "admin_staff_not_found")
+			break
+		}
+		text = fmt.Sprintf(h.translation.GetText(langCode, "admin_staff_removed"), telegramID)
+	default:
+		text = h.translation.GetText(langCode, "admin_staff_usage")
+	}
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text,
+	})
+	if err != nil {
+		slog.Error("Error sending staff message", "error", err)
+	}
+}
+
+func (h Handler) staffList(langCode string) string {
+	var text strings.Builder
+	text.WriteString(h.translation.GetText(langCode, "admin_staff_title"))
+	for _, member := range h.staffService.Members() {
+		text.WriteString(fmt.Sprintf("\n<code>%d</code> — %s", member.TelegramID, member.Role))
+	}
+	text.WriteString("\n\n" + h.translation.GetText(langCode, "admin_staff_usage"))
+	return text.String()
+}
+
+func (h Handler) staffErrorText(langCode string, err error) string {
+	switch {
+	case errors.Is(err, staff.ErrForbidden):
+		return h.translation.GetText(langCode, "admin_staff_forbidden")
+	case errors.Is(err, staff.ErrProtected):
+		return h.translation.GetText(langCode, "admin_staff_protected")
+	default:
+		slog.Error("Error changing staff", "error", err)
+		return h.translation.GetText(langCode, "admin_staff_error")
+	}
+}
@@ -2,8 +2,7 @@ package handler
 
 import (
 	"context"
-	"strconv"
-	"strings"
+	"errors"
 	"time"
 
 	"github.com/go-telegram/bot"
@@ -12,6 +11,8 @@ import (
 
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/deeplink"
+	"remnawave-tg-shop-bot/internal/referral"
 	"remnawave-tg-shop-bot/utils"
 )
 
@@ -19,6 +20,7 @@ func (h Handler) StartCommandHandler(ctx context.Context, b *bot.Bot, update *mo
 	ctxWithTime, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 	langCode := update.Message.From.LanguageCode
+	payload := deeplink.Parse(update.Message.Text)
 	existingCustomer, err := h.customerRepository.FindByTelegramId(ctx, update.Message.Chat.ID)
 	if err != nil {
 		slog.Error("error finding customer by telegram id", "error", err)
@@ -29,35 +31,20 @@ func (h Handler) StartCommandHandler(ctx context.Context, b *bot.Bot, update *mo
 		existingCustomer, err = h.customerRepository.Create(ctxWithTime, &database.Customer{
 			TelegramID: update.Message.Chat.ID,
 			Language:   langCode,
+			Username:   customerUsername(update.Message.From.Username),
 		})
 		if err != nil {
 			slog.Error("error creating customer", "error", err)
 			return
 		}
 
-		if strings.Contains(update.Message.Text, "ref_") {
-			arg := strings.Split(update.Message.Text, " ")[1]
-			if strings.HasPrefix(arg, "ref_") {
-				code := strings.TrimPrefix(arg, "ref_")
-				referrerId, err := strconv.ParseInt(code, 10, 64)
-				if err != nil {
-					slog.Error("error parsing referrer id", "error", err)
-					return
-				}
-				_, err = h.customerRepository.FindByTelegramId(ctx, referrerId)
-				if err == nil {
-					_, err := h.referralRepository.Create(ctx, referrerId, existingCustomer.TelegramID)
-					if err != nil {
-						slog.Error("error creating referral", "error", err)
-						return
-					}
-					slog.Info("referral created", "referrerId", utils.MaskHalfInt64(referrerId), "refereeId", utils.MaskHalfInt64(existingCustomer.TelegramID))
-				}
-			}
+		if payload.Kind == deeplink.KindReferral {
+			h.registerReferral(ctxWithTime, update, payload.ReferrerID)
 		}
 	} else {
 		updates := map[string]interface{}{
 			"language": langCode,
+			"username": customerUsername(update.Message.From.Username),
 		}
 
 		err = h.customerRepository.UpdateFields(ctx, existingCustomer.ID, updates)
@@ -67,7 +54,12 @@ func (h Handler) StartCommandHandler(ctx context.Context, b *bot.Bot, update *mo
 		}
 	}
 
-	inlineKeyboard := h.buildStartKeyboard(existingCustomer, langCode)
+	if payload.Kind == deeplink.KindGift {
+		h.redeemGift(ctx, b, update, existingCustomer, payload.GiftCode)
+		return
+	}
+
+	inlineKeyboard := h.buildStartKeyboard(ctxWithTime, existingCustomer, langCode)
 
 	m, err := b.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID: update.Message.Chat.ID,
@@ -105,6 +97,27 @@ func (h Handler) StartCommandHandler(ctx context.Context, b *bot.Bot, update *mo
 	}
 }
 
+// registerReferral records the referral of a customer created by this /start. Invalid and abusive referrals are
+// only logged, the customer is greeted as usual.
+func (h Handler) registerReferral(ctx context.Context, update *models.Update, referrerID int64) {
+	from := update.Message.From
+	ref, err := h.referralService.Register(ctx, referrerID, referral.Referee{
+		TelegramID: from.ID,
+		Username:   from.Username,
+		FirstName:  from.FirstName,
+		LastName:   from.LastName,
+	})
+	switch {
+	case err == nil:
+		slog.Info("referral created", "referrerId", utils.MaskHalfInt64(referrerID), "refereeId", utils.MaskHalfInt64(from.ID), "status", ref.Status)
+	case errors.Is(err, referral.ErrSelfReferral), errors.Is(err, referral.ErrReferrerNotFound),
+		errors.Is(err, referral.ErrAlreadyReferred), errors.Is(err, referral.ErrNotNewCustomer):
+		slog.Info("referral not accepted", "referrerId", utils.MaskHalfInt64(referrerID), "refereeId", utils.MaskHalfInt64(from.ID), "reason", err)
+	default:
+		slog.Error("error creating referral", "error", err)
+	}
+}
+
 func (h Handler) StartCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
 	ctxWithTime, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
@@ -118,7 +131,7 @@ func (h Handler) StartCallbackHandler(ctx context.Context, b *bot.Bot, update *m
 		return
 	}
 
-	inlineKeyboard := h.buildStartKeyboard(existingCustomer, langCode)
+	inlineKeyboard := h.buildStartKeyboard(ctxWithTime, existingCustomer, langCode)
 
 	_, err = b.EditMessageText(ctxWithTime, &bot.EditMessageTextParams{
 		ChatID:    callback.Message.Message.Chat.ID,
@@ -151,10 +164,14 @@ func (h Handler) resolveConnectButton(lang string) []models.InlineKeyboardButton
 	return inlineKeyboard
 }
 
-func (h Handler) buildStartKeyboard(existingCustomer *database.Customer, langCode string) [][]models.InlineKeyboardButton {
+func (h Handler) buildStartKeyboard(ctx context.Context, existingCustomer *database.Customer, langCode string) [][]models.InlineKeyboardButton {
 	var inlineKeyboard [][]models.InlineKeyboardButton
 
-	if existingCustomer.SubscriptionLink == nil && config.TrialDays() > 0 {
+	trialAvailable, err := h.paymentService.TrialAvailable(ctx, existingCustomer)
+	if err != nil {
+		slog.Error("error checking trial availability", "error", err)
+	}
+	if trialAvailable {
 		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "trial_button"), CallbackData: CallbackTrial}})
 	}
 
@@ -164,7 +181,7 @@ func (h Handler) buildStartKeyboard(existingCustomer *database.Customer, langCod
 		inlineKeyboard = append(inlineKeyboard, h.resolveConnectButton(langCode))
 	}
 
-	if config.GetReferralDays() > 0 {
+	if config.IsReferralEnabled() {
 		inlineKeyboard = append(inlineKeyboard, []models.InlineKeyboardButton{{Text: h.translation.GetText(langCode, "referral_button"), CallbackData: CallbackReferral}})
 	}
 
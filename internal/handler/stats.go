@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+
+	"remnawave-tg-shop-bot/internal/database"
+)
+
+const (
+	statsPeriodDay   = "day"
+	statsPeriodWeek  = "week"
+	statsPeriodMonth = "month"
+
+	statsTopReferrersLimit = 5
+)
+
+var statsPeriods = []string{statsPeriodDay, statsPeriodWeek, statsPeriodMonth}
+
+var statsPeriodDurations = map[string]time.Duration{
+	statsPeriodDay:   24 * time.Hour,
+	statsPeriodWeek:  7 * 24 * time.Hour,
+	statsPeriodMonth: 30 * 24 * time.Hour,
+}
+
+// StatsCommandHandler shows sales, trial and referral statistics for the last day.
+func (h Handler) StatsCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:      update.Message.Chat.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.statsText(ctx, langCode, statsPeriodDay),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.statsKeyboard(langCode, statsPeriodDay)},
+	})
+	if err != nil {
+		slog.Error("Error sending stats message", "error", err)
+	}
+}
+
+// StatsCallbackHandler switches the statistics period.
+func (h Handler) StatsCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	callback := update.CallbackQuery.Message.Message
+	langCode := update.CallbackQuery.From.LanguageCode
+
+	period := parseCallbackData(update.CallbackQuery.Data)["p"]
+	if _, ok := statsPeriodDurations[period]; !ok {
+		period = statsPeriodDay
+	}
+
+	_, err := b.EditMessageText(ctx, &bot.EditMessageTextParams{
+		ChatID:      callback.Chat.ID,
+		MessageID:   callback.ID,
+		ParseMode:   models.ParseModeHTML,
+		Text:        h.statsText(ctx, langCode, period),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.statsKeyboard(langCode, period)},
+	})
+	if err != nil {
+		slog.Error("Error sending stats message", "error", err)
+	}
+}
+
+func (h Handler) statsKeyboard(langCode string, selected string) [][]models.InlineKeyboardButton {
+	var row []models.InlineKeyboardButton
+	for _, period := range statsPeriods {
+		text := h.translation.GetText(langCode, "admin_stats_period_"+period)
+		if period == selected {
+			text = "• " + text
+		}
+		row = append(row, models.InlineKeyboardButton{Text: text, CallbackData: fmt.Sprintf("%s?p=%s", CallbackAdminStats, period)})
+	}
+	return [][]models.InlineKeyboardButton{
+		row,
+		{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackAdmin}},
+	}
+}
+
+func (h Handler) statsText(ctx context.Context, langCode string, period string) string {
+	now := time.Now()
+	stats, err := h.statsRepository.Collect(ctx, now.Add(-statsPeriodDurations[period]), now, statsTopReferrersLimit)
+	if err != nil {
+		slog.Error("Error collecting stats", "error", err)
+		return fmt.Sprintf(h.translation.GetText(langCode, "admin_stats_error"), html.EscapeString(err.Error()))
+	}
+
+	var text strings.Builder
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_stats_title"),
+		h.translation.GetText(langCode, "admin_stats_period_"+period), stats.Since.Format("02.01.2006 15:04")))
+
+	text.WriteString(h.translation.GetText(langCode, "admin_stats_revenue"))
+	if len(stats.Revenue) == 0 {
+		text.WriteString(h.translation.GetText(langCode, "admin_stats_revenue_empty"))
+	}
+	totals := map[string]float64{}
+	for _, revenue := range stats.Revenue {
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_stats_revenue_row"),
+			revenue.InvoiceType, revenue.Purchases, revenue.Amount, revenue.Currency))
+		totals[revenue.Currency] += revenue.Amount
+	}
+	if len(totals) > 0 {
+		var parts []string
+		for _, currency := range slices.Sorted(maps.Keys(totals)) {
+			parts = append(parts, fmt.Sprintf("%.2f %s", totals[currency], currency))
+		}
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_stats_revenue_total"), strings.Join(parts, ", ")))
+	}
+
+	text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_stats_customers"),
+		stats.NewCustomers, stats.Trials, stats.TrialsConverted, conversionPercent(stats.TrialsConverted, stats.Trials),
+		stats.ActiveSubscribers, stats.ExpiredSubscribers))
+
+	text.WriteString(h.translation.GetText(langCode, "admin_stats_referrers"))
+	if len(stats.TopReferrers) == 0 {
+		text.WriteString(h.translation.GetText(langCode, "admin_stats_referrers_empty"))
+	}
+	for i, referrer := range stats.TopReferrers {
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_stats_referrer_row"),
+			i+1, statsReferrerName(referrer), referrer.Referrals, referrer.Paying))
+	}
+	return text.String()
+}
+
+func statsReferrerName(referrer database.ReferrerStat) string {
+	if referrer.Username != nil && *referrer.Username != "" {
+		return "@" + html.EscapeString(*referrer.Username)
+	}
+	return fmt.Sprintf("<code>%d</code>", referrer.TelegramID)
+}
+
+func conversionPercent(converted, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(converted) * 100 / float64(total)
+}
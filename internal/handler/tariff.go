@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"log/slog"
+)
+
+// TariffsCommandHandler lists the tariff catalogue with the IDs used by promo code restrictions.
+func (h Handler) TariffsCommandHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
+	langCode := update.Message.From.LanguageCode
+
+	tariffs, err := h.tariffRepository.FindAll(ctx)
+	if err != nil {
+		slog.Error("Error finding tariffs", "error", err)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString(h.translation.GetText(langCode, "admin_tariffs_title"))
+	if len(tariffs) == 0 {
+		text.WriteString(h.translation.GetText(langCode, "admin_tariffs_empty"))
+	}
+	for _, tariff := range tariffs {
+		status := "✅"
+		if !tariff.Active {
+			status = "⛔"
+		}
+		text.WriteString(fmt.Sprintf(h.translation.GetText(langCode, "admin_tariff_row"),
+			status, tariff.ID, html.EscapeString(h.tariffName(langCode, &tariff)), tariff.DurationDays, tariff.PriceRub, tariff.PriceStars, tariff.PriceCrypto))
+	}
+
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    update.Message.Chat.ID,
+		ParseMode: models.ParseModeHTML,
+		Text:      text.String(),
+	})
+	if err != nil {
+		slog.Error("Error sending tariffs message", "error", err)
+	}
+}
@@ -2,12 +2,14 @@ package handler
 
 import (
 	"context"
+	"errors"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
 
 	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/payment"
 	"remnawave-tg-shop-bot/utils"
 )
 
@@ -24,7 +26,12 @@ func (h Handler) TrialCallbackHandler(ctx context.Context, b *bot.Bot, update *m
 		slog.Error("customer not exist", "telegramId", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "error", err)
 		return
 	}
-	if c.SubscriptionLink != nil {
+	available, err := h.paymentService.TrialAvailable(ctx, c)
+	if err != nil {
+		slog.Error("Error checking trial availability", "error", err)
+		return
+	}
+	if !available {
 		return
 	}
 	callback := update.CallbackQuery.Message.Message
@@ -44,32 +51,32 @@ func (h Handler) TrialCallbackHandler(ctx context.Context, b *bot.Bot, update *m
 	}
 }
 
+// ActivateTrialCallbackHandler provisions the trial and reports the outcome; it only confirms the activation when
+// the subscription was created.
 func (h Handler) ActivateTrialCallbackHandler(ctx context.Context, b *bot.Bot, update *models.Update) {
-	if config.TrialDays() == 0 {
-		return
-	}
-	c, err := h.customerRepository.FindByTelegramId(ctx, update.CallbackQuery.From.ID)
-	if err != nil {
-		slog.Error("Error finding customer", "error", err)
-		return
-	}
-	if c == nil {
-		slog.Error("customer not exist", "telegramId", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "error", err)
-		return
-	}
-	if c.SubscriptionLink != nil {
-		return
-	}
 	callback := update.CallbackQuery.Message.Message
-	ctxWithUsername := context.WithValue(ctx, "username", update.CallbackQuery.From.Username)
-	_, err = h.paymentService.ActivateTrial(ctxWithUsername, update.CallbackQuery.From.ID)
 	langCode := update.CallbackQuery.From.LanguageCode
+	ctxWithUsername := context.WithValue(ctx, "username", update.CallbackQuery.From.Username)
+
+	text := h.translation.GetText(langCode, "trial_activated")
+	keyboard := h.createConnectKeyboard(langCode)
+	_, err := h.paymentService.ActivateTrial(ctxWithUsername, update.CallbackQuery.From.ID)
+	if err != nil {
+		keyboard = [][]models.InlineKeyboardButton{{{Text: h.translation.GetText(langCode, "back_button"), CallbackData: CallbackStart}}}
+		if errors.Is(err, payment.ErrTrialUnavailable) {
+			text = h.translation.GetText(langCode, "trial_unavailable")
+		} else {
+			slog.Error("Error activating trial", "telegramId", utils.MaskHalfInt64(update.CallbackQuery.From.ID), "error", err)
+			text = h.translation.GetText(langCode, "trial_activation_failed")
+		}
+	}
+
 	_, err = b.EditMessageText(ctx, &bot.EditMessageTextParams{
 		ChatID:      callback.Chat.ID,
 		MessageID:   callback.ID,
-		Text:        h.translation.GetText(langCode, "trial_activated"),
+		Text:        text,
 		ParseMode:   models.ParseModeHTML,
-		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: h.createConnectKeyboard(langCode)},
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: keyboard},
 	})
 	if err != nil {
 		slog.Error("Error sending /trial message", "error", err)
@@ -0,0 +1,95 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	PurchasesCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shop_purchases_created_total",
+		Help: "Purchases created, by payment provider and plan.",
+	}, []string{"provider", "plan"})
+
+	PurchasesPaid = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shop_purchases_paid_total",
+		Help: "Purchases paid and applied in Remnawave, by payment provider and plan.",
+	}, []string{"provider", "plan"})
+
+	Revenue = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shop_revenue_total",
+		Help: "Amount paid for purchases after discounts, by currency.",
+	}, []string{"currency"})
+
+	TrialActivations = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "shop_trial_activations_total",
+		Help: "Trials activated.",
+	})
+
+	ReferralBonuses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shop_referral_bonuses_total",
+		Help: "Referral rewards granted, by kind (referrer, referee or tier).",
+	}, []string{"kind"})
+
+	RemnawaveRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "shop_remnawave_request_duration_seconds",
+		Help:    "Duration of Remnawave client calls, by method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method"})
+
+	RemnawaveRequestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shop_remnawave_request_errors_total",
+		Help: "Failed Remnawave client calls, by method.",
+	}, []string{"method"})
+
+	PaymentPollingErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shop_payment_polling_errors_total",
+		Help: "Errors while polling pending invoices, by payment provider.",
+	}, []string{"provider"})
+
+	Notifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "shop_notifications_total",
+		Help: "Notifications sent to customers, by type and status (sent or failed).",
+	}, []string{"type", "status"})
+
+	HandlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "shop_telegram_handler_duration_seconds",
+		Help:    "Time spent handling Telegram updates, by handler.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"handler"})
+)
+
+// Plan is the plan label of a purchase: the tariff ID, or the length in months for purchases outside
+// the tariff catalogue such as Tribute subscriptions.
+func Plan(tariffID *int64, months int) string {
+	if tariffID != nil {
+		return strconv.FormatInt(*tariffID, 10)
+	}
+	return strconv.Itoa(months) + "m"
+}
+
+// ObserveRemnawave records a Remnawave call started at start that returned err.
+func ObserveRemnawave(method string, start time.Time, err error) {
+	RemnawaveRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		RemnawaveRequestErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// NotificationStatus is the status label of a notification send.
+func NotificationStatus(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "sent"
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,13 @@
+package metrics
+
+import "testing"
+
+func TestPlan(t *testing.T) {
+	tariffID := int64(7)
+	if got := Plan(&tariffID, 3); got != "7" {
+		t.Fatalf("tariff plan: want 7, got %s", got)
+	}
+	if got := Plan(nil, 3); got != "3m" {
+		t.Fatalf("plan without tariff: want 3m, got %s", got)
+	}
+}
@@ -127,6 +127,31 @@ func (c *Client) authenticateOnce() error {
 }
 
 func (c *Client) CreateIncome(ctx context.Context, amount float64, comment string) (*CreateIncomeResponse, error) {
+	var incomeResp *CreateIncomeResponse
+	err := c.withRetries(ctx, func() error {
+		var err error
+		incomeResp, err = c.createIncomeOnce(ctx, amount, comment)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create income failed: %w", err)
+	}
+	return incomeResp, nil
+}
+
+// CancelIncome annuls a receipt created by CreateIncome. reason is one of the CancelReason values.
+func (c *Client) CancelIncome(ctx context.Context, receiptUUID string, reason string) error {
+	err := c.withRetries(ctx, func() error {
+		return c.cancelIncomeOnce(ctx, receiptUUID, reason)
+	})
+	if err != nil {
+		return fmt.Errorf("cancel income failed: %w", err)
+	}
+	return nil
+}
+
+// withRetries runs the request, authenticating again when the token expired and backing off on retryable errors.
+func (c *Client) withRetries(ctx context.Context, request func() error) error {
 	const (
 		maxRetries     = 3
 		baseDelay      = 500 * time.Millisecond
@@ -141,24 +166,24 @@ func (c *Client) CreateIncome(ctx context.Context, amount float64, comment strin
 	for attempt := 1; attempt <= maxRetries; attempt++ {
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		default:
 		}
 
-		resp, err := c.createIncomeOnce(ctx, amount, comment)
+		err := request()
 		if err == nil {
-			return resp, nil
+			return nil
 		}
 
 		if errors.Is(err, ErrAuth) {
 			if authRetries >= maxAuthRetries {
-				return nil, err
+				return err
 			}
 
 			c.token.Store("")
 
 			if err := c.authenticate(); err != nil {
-				return nil, fmt.Errorf("reauth failed: %w", err)
+				return fmt.Errorf("reauth failed: %w", err)
 			}
 
 			authRetries++
@@ -167,26 +192,26 @@ func (c *Client) CreateIncome(ctx context.Context, amount float64, comment strin
 		}
 
 		if !errors.Is(err, ErrRetryable) {
-			return nil, err
+			return err
 		}
 
 		lastErr = err
 
 		select {
 		case <-ctx.Done():
-			return nil, ctx.Err()
+			return ctx.Err()
 		case <-time.After(baseDelay * time.Duration(1<<(attempt-1))):
 		}
 	}
 
-	return nil, fmt.Errorf("create income failed after retries: %w", lastErr)
+	return fmt.Errorf("failed after retries: %w", lastErr)
 }
 
 func (c *Client) createIncomeOnce(ctx context.Context, amount float64, comment string) (*CreateIncomeResponse, error) {
-	incomeURL := fmt.Sprintf("%s/income", c.baseURL)
 	now := time.Now()
 
-	reqBody, err := json.Marshal(CreateIncomeRequest{
+	var incomeResp CreateIncomeResponse
+	err := c.post(ctx, "/income", CreateIncomeRequest{
 		OperationTime: now,
 		RequestTime:   now,
 		Services: []Service{
@@ -202,14 +227,36 @@ func (c *Client) createIncomeOnce(ctx context.Context, amount float64, comment s
 		},
 		PaymentType:                     "CASH",
 		IgnoreMaxTotalIncomeRestriction: false,
-	})
+	}, &incomeResp)
 	if err != nil {
 		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", incomeURL, bytes.NewBuffer(reqBody))
+	return &incomeResp, nil
+}
+
+func (c *Client) cancelIncomeOnce(ctx context.Context, receiptUUID string, reason string) error {
+	now := time.Now()
+
+	return c.post(ctx, "/cancel", CancelIncomeRequest{
+		OperationTime: now,
+		RequestTime:   now,
+		Comment:       reason,
+		ReceiptUUID:   receiptUUID,
+	}, nil)
+}
+
+// post sends an authorized request and sorts failures into ErrAuth, ErrRetryable and ErrClient.
+// The response is decoded into out unless it is nil.
+func (c *Client) post(ctx context.Context, path string, body any, out any) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, bytes.NewBuffer(reqBody))
 	if err != nil {
-		return nil, err
+		return err
 	}
 
 	token := c.token.Load().(string)
@@ -222,29 +269,27 @@ func (c *Client) createIncomeOnce(ctx context.Context, amount float64, comment s
 	if err != nil {
 		var netErr net.Error
 		if errors.As(err, &netErr) {
-			return nil, fmt.Errorf("%w: %v", ErrRetryable, err)
+			return fmt.Errorf("%w: %v", ErrRetryable, err)
 		}
-		return nil, err
+		return err
 	}
 	defer resp.Body.Close()
 
 	switch {
 	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
-		return nil, fmt.Errorf("%w: status %d", ErrAuth, resp.StatusCode)
+		return fmt.Errorf("%w: status %d", ErrAuth, resp.StatusCode)
 
 	case resp.StatusCode >= 500:
 		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%w: status %d: %s", ErrRetryable, resp.StatusCode, b)
+		return fmt.Errorf("%w: status %d: %s", ErrRetryable, resp.StatusCode, b)
 
 	case resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated:
 		b, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("%w: status %d: %s", ErrClient, resp.StatusCode, b)
+		return fmt.Errorf("%w: status %d: %s", ErrClient, resp.StatusCode, b)
 	}
 
-	var incomeResp CreateIncomeResponse
-	if err := json.NewDecoder(resp.Body).Decode(&incomeResp); err != nil {
-		return nil, err
+	if out == nil {
+		return nil
 	}
-
-	return &incomeResp, nil
+	return json.NewDecoder(resp.Body).Decode(out)
 }
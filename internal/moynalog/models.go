@@ -65,4 +65,29 @@ type CreateIncomeResponse struct {
 	Client        IncomeClient `json:"client"`
 	PaymentType   string       `json:"paymentType"`
 	Status        string       `json:"status"`
+
+	ApprovedReceiptUUID string `json:"approvedReceiptUuid"`
+}
+
+// ReceiptUUID возвращает идентификатор чека, нужный для его аннулирования
+func (r *CreateIncomeResponse) ReceiptUUID() string {
+	if r.ApprovedReceiptUUID != "" {
+		return r.ApprovedReceiptUUID
+	}
+	return r.ID
+}
+
+// Причины аннулирования чека
+const (
+	CancelReasonRefund  = "Возврат средств"
+	CancelReasonMistake = "Чек сформирован ошибочно"
+)
+
+// CancelIncomeRequest - структура для запроса аннулирования чека
+type CancelIncomeRequest struct {
+	OperationTime time.Time `json:"operationTime"`
+	RequestTime   time.Time `json:"requestTime"`
+	Comment       string    `json:"comment"`
+	ReceiptUUID   string    `json:"receiptUuid"`
+	PartnerCode   *string   `json:"partnerCode"`
 }
@@ -0,0 +1,126 @@
+package notification
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"html"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+	"remnawave-tg-shop-bot/utils"
+	"strings"
+)
+
+type panelCustomerRepository interface {
+	FindByTelegramId(ctx context.Context, telegramId int64) (*database.Customer, error)
+	UpdateFields(ctx context.Context, id int64, updates map[string]interface{}) error
+}
+
+type messageSender interface {
+	SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error)
+}
+
+// panelEventMessages are the translation keys of the messages sent for panel events. Other events only update the customer.
+var panelEventMessages = map[string]string{
+	remnawave.EventUserExpired:        "panel_user_expired",
+	remnawave.EventUserDisabled:       "panel_user_disabled",
+	remnawave.EventUserLimited:        "panel_user_limited",
+	remnawave.EventUserFirstConnected: "panel_user_first_connected",
+	remnawave.EventHwidDeviceAdded:    "panel_hwid_device_added",
+}
+
+// PanelEventService applies Remnawave webhooks: it keeps expire_at and the subscription status of the customer
+// in sync and tells the customer about events that need their attention.
+type PanelEventService struct {
+	customerRepository panelCustomerRepository
+	sender             messageSender
+	tm                 *translation.Manager
+}
+
+func NewPanelEventService(customerRepository panelCustomerRepository, sender messageSender, tm *translation.Manager) *PanelEventService {
+	return &PanelEventService{customerRepository: customerRepository, sender: sender, tm: tm}
+}
+
+func (s *PanelEventService) ProcessRemnawaveEvent(ctx context.Context, event *remnawave.WebhookEvent) error {
+	user, device, err := event.DecodeUser()
+	if err != nil {
+		return err
+	}
+	if user.TelegramID == nil {
+		slog.Info("remnawave event for user without telegram id", "event", event.Event, "user", utils.MaskHalf(user.Username))
+		return nil
+	}
+
+	customer, err := s.customerRepository.FindByTelegramId(ctx, *user.TelegramID)
+	if err != nil {
+		return err
+	}
+	if customer == nil {
+		slog.Info("remnawave event for unknown customer", "event", event.Event, "telegramId", utils.MaskHalfInt64(*user.TelegramID))
+		return nil
+	}
+
+	// Deleted users are removed from the bot by /sync, the payload no longer describes a subscription.
+	if event.Event != remnawave.EventUserDeleted && user.Status != "" {
+		updates := map[string]interface{}{
+			"subscription_status": user.Status,
+		}
+		if user.ExpireAt != nil {
+			updates["expire_at"] = *user.ExpireAt
+		}
+		if err := s.customerRepository.UpdateFields(ctx, customer.ID, updates); err != nil {
+			return err
+		}
+	}
+
+	key, ok := panelEventMessages[event.Event]
+	if !ok {
+		return nil
+	}
+	err = s.sendEventMessage(ctx, customer, event.Event, key, device)
+	metrics.Notifications.WithLabelValues(event.Event, metrics.NotificationStatus(err)).Inc()
+	if err != nil {
+		// The panel does not need to resend the event because the customer blocked the bot.
+		slog.Error("Error sending remnawave event message", "event", event.Event, "customer_id", customer.ID, "error", err)
+	}
+	return nil
+}
+
+func (s *PanelEventService) sendEventMessage(ctx context.Context, customer *database.Customer, event, key string, device *remnawave.WebhookHwidDevice) error {
+	text := s.tm.GetText(customer.Language, key)
+	if device != nil {
+		text = fmt.Sprintf(text, html.EscapeString(deviceName(device)))
+	}
+
+	params := &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		Text:      text,
+		ParseMode: models.ParseModeHTML,
+	}
+	if event == remnawave.EventUserExpired || event == remnawave.EventUserLimited {
+		params.ReplyMarkup = models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: s.tm.GetText(customer.Language, "buy_button"), CallbackData: handler.CallbackBuy}},
+		}}
+	}
+
+	_, err := s.sender.SendMessage(ctx, params)
+	return err
+}
+
+func deviceName(device *remnawave.WebhookHwidDevice) string {
+	var parts []string
+	for _, part := range []*string{device.Platform, device.DeviceModel, device.OsVersion} {
+		if part != nil && *part != "" {
+			parts = append(parts, *part)
+		}
+	}
+	if len(parts) == 0 {
+		return device.Hwid
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,80 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/translation"
+)
+
+type panelCustomerRepoMock struct {
+	customer *database.Customer
+	updates  map[string]interface{}
+}
+
+func (m *panelCustomerRepoMock) FindByTelegramId(ctx context.Context, telegramId int64) (*database.Customer, error) {
+	if m.customer == nil || m.customer.TelegramID != telegramId {
+		return nil, nil
+	}
+	return m.customer, nil
+}
+
+func (m *panelCustomerRepoMock) UpdateFields(ctx context.Context, id int64, updates map[string]interface{}) error {
+	m.updates = updates
+	return nil
+}
+
+type senderMock struct {
+	sent []*bot.SendMessageParams
+}
+
+func (m *senderMock) SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+	m.sent = append(m.sent, params)
+	return &models.Message{}, nil
+}
+
+func TestProcessRemnawaveEvent(t *testing.T) {
+	repo := &panelCustomerRepoMock{customer: &database.Customer{ID: 1, TelegramID: 42, Language: "en"}}
+	sender := &senderMock{}
+	s := NewPanelEventService(repo, sender, translation.GetInstance())
+
+	event := &remnawave.WebhookEvent{
+		Scope: "user",
+		Event: remnawave.EventUserLimited,
+		Data:  json.RawMessage(`{"status": "LIMITED", "expireAt": "2026-02-01T00:00:00Z", "telegramId": 42}`),
+	}
+	if err := s.ProcessRemnawaveEvent(context.Background(), event); err != nil {
+		t.Fatalf("ProcessRemnawaveEvent() returned error: %v", err)
+	}
+	if repo.updates["subscription_status"] != "LIMITED" || repo.updates["expire_at"] == nil {
+		t.Fatalf("customer is not updated: %v", repo.updates)
+	}
+	if len(sender.sent) != 1 || sender.sent[0].ChatID != int64(42) || sender.sent[0].ReplyMarkup == nil {
+		t.Fatalf("expected one message with a buy button, got %+v", sender.sent)
+	}
+
+	repo.updates, sender.sent = nil, nil
+	event.Event = remnawave.EventUserModified
+	if err := s.ProcessRemnawaveEvent(context.Background(), event); err != nil {
+		t.Fatalf("ProcessRemnawaveEvent() returned error: %v", err)
+	}
+	if repo.updates == nil || len(sender.sent) != 0 {
+		t.Fatalf("modified event must only update the customer, updates=%v, sent=%d", repo.updates, len(sender.sent))
+	}
+
+	repo.updates = nil
+	event.Data = json.RawMessage(`{"status": "EXPIRED", "telegramId": 7}`)
+	event.Event = remnawave.EventUserExpired
+	if err := s.ProcessRemnawaveEvent(context.Background(), event); err != nil {
+		t.Fatalf("ProcessRemnawaveEvent() returned error: %v", err)
+	}
+	if repo.updates != nil || len(sender.sent) != 0 {
+		t.Fatal("events of unknown customers must be ignored")
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/database"
 	"remnawave-tg-shop-bot/internal/handler"
+	"remnawave-tg-shop-bot/internal/metrics"
 	"remnawave-tg-shop-bot/internal/translation"
 	"time"
 )
@@ -18,10 +20,12 @@ type customerRepository interface {
 
 type tributeRepository interface {
 	FindLatestActiveTributesByCustomerIDs(ctx context.Context, customerIDs []int64) (*[]database.Purchase, error)
+	FindLatestPaidByCustomerIDsAndInvoiceType(ctx context.Context, customerIDs []int64, invoiceType database.InvoiceType) (*[]database.Purchase, error)
 }
 
 type paymentProcessor interface {
-	CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType) (string, int64, error)
+	CreateTributePurchase(ctx context.Context, amount float64, months int, customer *database.Customer) (int64, error)
+	CreateRecurringPurchase(ctx context.Context, lastPurchase *database.Purchase, customer *database.Customer) (int64, bool, error)
 	ProcessPurchaseById(ctx context.Context, purchaseId int64) error
 }
 
@@ -32,6 +36,7 @@ type SubscriptionService struct {
 	telegramBot        *bot.Bot
 	tm                 *translation.Manager
 	notify             func(context.Context, database.Customer) error
+	autoPaymentEnabled func() bool
 }
 
 func NewSubscriptionService(customerRepository customerRepository,
@@ -41,6 +46,7 @@ func NewSubscriptionService(customerRepository customerRepository,
 	tm *translation.Manager) *SubscriptionService {
 	svc := &SubscriptionService{customerRepository: customerRepository, purchaseRepository: purchaseRepository, paymentService: paymentService, telegramBot: telegramBot, tm: tm}
 	svc.notify = svc.sendNotification
+	svc.autoPaymentEnabled = config.IsAutoPaymentEnabled
 	return svc
 }
 func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
@@ -76,6 +82,13 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 
 	tributesProcessed := make(map[int64]bool, len(*latestActiveTributes))
 
+	customerIdRecurring, err := s.getLatestRecurringPurchases(ctx, *customers)
+	if err != nil {
+		slog.Error("Failed to query recurring purchases", "error", err)
+		return err
+	}
+	autoPaymentsProcessed := make(map[int64]bool, len(customerIdRecurring))
+
 	for _, customer := range *customers {
 		daysUntilExpiration := s.getDaysUntilExpiration(now, *customer.ExpireAt)
 
@@ -83,7 +96,7 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 			if daysUntilExpiration != 1 {
 				continue
 			}
-			_, purchaseId, err := s.paymentService.CreatePurchase(ctx, p.Amount, p.Month, &customer, database.InvoiceTypeTribute)
+			purchaseId, err := s.paymentService.CreateTributePurchase(ctx, p.Amount, p.Month, &customer)
 			if err != nil {
 				slog.Error("Failed to create tribute purchase", "error", err)
 				continue
@@ -101,12 +114,20 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 			continue
 		}
 
+		if p, ok := customerIdRecurring[customer.ID]; ok && daysUntilExpiration == 1 {
+			if s.processAutoPayment(ctx, &customer, p) {
+				autoPaymentsProcessed[customer.ID] = true
+				continue
+			}
+		}
+
 		send := s.notify
 		if send == nil {
 			send = s.sendNotification
 		}
 
 		err := send(ctx, customer)
+		metrics.Notifications.WithLabelValues("subscription_expiring", metrics.NotificationStatus(err)).Inc()
 		if err != nil {
 			slog.Error("Failed to send notification",
 				"customer_id", customer.ID,
@@ -121,10 +142,64 @@ func (s *SubscriptionService) ProcessSubscriptionExpiration() error {
 	}
 
 	slog.Info(fmt.Sprintf("Processed tributes customers %d with expiring subscriptions", len(tributesProcessed)))
-	slog.Info(fmt.Sprintf("Sent notifications to %d customers with expiring subscriptions", len(*customers)-len(tributesProcessed)))
+	slog.Info(fmt.Sprintf("Processed auto payments for %d customers with expiring subscriptions", len(autoPaymentsProcessed)))
+	slog.Info(fmt.Sprintf("Sent notifications to %d customers with expiring subscriptions", len(*customers)-len(tributesProcessed)-len(autoPaymentsProcessed)))
 	return nil
 }
 
+// getLatestRecurringPurchases returns the latest paid YooKassa purchase of every
+// customer that has a saved payment method, keyed by customer id.
+func (s *SubscriptionService) getLatestRecurringPurchases(ctx context.Context, customers []database.Customer) (map[int64]*database.Purchase, error) {
+	result := make(map[int64]*database.Purchase)
+	if s.autoPaymentEnabled == nil || !s.autoPaymentEnabled() {
+		return result, nil
+	}
+
+	var customerIds []int64
+	for _, customer := range customers {
+		if customer.PaymentMethodID != nil {
+			customerIds = append(customerIds, customer.ID)
+		}
+	}
+	if len(customerIds) == 0 {
+		return result, nil
+	}
+
+	purchases, err := s.purchaseRepository.FindLatestPaidByCustomerIDsAndInvoiceType(ctx, customerIds, database.InvoiceTypeYookasa)
+	if err != nil {
+		return nil, err
+	}
+	for i := range *purchases {
+		p := &(*purchases)[i]
+		result[p.CustomerID] = p
+	}
+	return result, nil
+}
+
+// processAutoPayment charges the saved payment method for the plan of the last purchase.
+// It returns true only when the renewal was paid and the subscription extended; a pending, declined
+// or unprocessed charge leaves the customer to the regular expiration notification.
+func (s *SubscriptionService) processAutoPayment(ctx context.Context, customer *database.Customer, lastPurchase *database.Purchase) bool {
+	purchaseId, paid, err := s.paymentService.CreateRecurringPurchase(ctx, lastPurchase, customer)
+	if err != nil {
+		slog.Error("Failed to create recurring purchase", "error", err, "customer_id", customer.ID)
+		return false
+	}
+
+	if !paid {
+		slog.Info("Recurring purchase is not paid yet", "purchase_id", purchaseId)
+		return false
+	}
+
+	err = s.paymentService.ProcessPurchaseById(ctx, purchaseId)
+	if err != nil {
+		slog.Error("Failed to process recurring purchase", "error", err)
+		return false
+	}
+	slog.Info("Recurring purchase processed successfully", "purchase_id", purchaseId)
+	return true
+}
+
 func (s *SubscriptionService) getCustomersWithExpiringSubscriptions() (*[]database.Customer, error) {
 	now := time.Now()
 	endDate := now.AddDate(0, 0, 3)
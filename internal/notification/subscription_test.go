@@ -2,10 +2,13 @@ package notification
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
 	"remnawave-tg-shop-bot/internal/database"
+
+	"github.com/google/uuid"
 )
 
 type customerRepoMock struct {
@@ -19,6 +22,7 @@ func (m *customerRepoMock) FindByExpirationRange(ctx context.Context, startDate,
 
 type purchaseRepoMock struct {
 	tributes    *[]database.Purchase
+	recurring   []database.Purchase
 	err         error
 	receivedIDs []int64
 }
@@ -28,6 +32,18 @@ func (m *purchaseRepoMock) FindLatestActiveTributesByCustomerIDs(ctx context.Con
 	return m.tributes, m.err
 }
 
+func (m *purchaseRepoMock) FindLatestPaidByCustomerIDsAndInvoiceType(ctx context.Context, customerIDs []int64, invoiceType database.InvoiceType) (*[]database.Purchase, error) {
+	purchases := make([]database.Purchase, 0, len(m.recurring))
+	for _, p := range m.recurring {
+		for _, id := range customerIDs {
+			if p.CustomerID == id {
+				purchases = append(purchases, p)
+			}
+		}
+	}
+	return &purchases, nil
+}
+
 type paymentServiceMock struct {
 	createCalls        int
 	processCalls       int
@@ -38,9 +54,11 @@ type paymentServiceMock struct {
 	createErr          error
 	processErr         error
 	purchaseIDToReturn int64
+	// pending makes CreateRecurringPurchase report a charge that is not confirmed yet.
+	pending bool
 }
 
-func (m *paymentServiceMock) CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType) (string, int64, error) {
+func (m *paymentServiceMock) CreateTributePurchase(ctx context.Context, amount float64, months int, customer *database.Customer) (int64, error) {
 	m.createCalls++
 	m.amounts = append(m.amounts, amount)
 	m.months = append(m.months, months)
@@ -50,7 +68,14 @@ func (m *paymentServiceMock) CreatePurchase(ctx context.Context, amount float64,
 	if m.purchaseIDToReturn == 0 {
 		m.purchaseIDToReturn = int64(m.createCalls)
 	}
-	return "", m.purchaseIDToReturn, m.createErr
+	return m.purchaseIDToReturn, m.createErr
+}
+
+func (m *paymentServiceMock) CreateRecurringPurchase(ctx context.Context, lastPurchase *database.Purchase, customer *database.Customer) (int64, bool, error) {
+	m.createCalls++
+	m.amounts = append(m.amounts, lastPurchase.Amount)
+	m.months = append(m.months, lastPurchase.Month)
+	return m.purchaseIDToReturn, !m.pending, m.createErr
 }
 
 func (m *paymentServiceMock) ProcessPurchaseById(ctx context.Context, purchaseId int64) error {
@@ -161,3 +186,50 @@ func TestSubscriptionService_ProcessSubscriptionExpiration_SkipsAutoRenewWhenLas
 		t.Fatalf("expected purchase repository to query by customer id %d, got %#v", customers[0].ID, pRepo.receivedIDs)
 	}
 }
+
+func TestSubscriptionService_ProcessSubscriptionExpiration_AutoPayment(t *testing.T) {
+	tests := []struct {
+		name         string
+		payMock      *paymentServiceMock
+		processCalls int
+		notifyCalls  int
+	}{
+		{name: "renewal paid", payMock: &paymentServiceMock{purchaseIDToReturn: 31}, processCalls: 1, notifyCalls: 0},
+		{name: "charge pending", payMock: &paymentServiceMock{purchaseIDToReturn: 31, pending: true}, processCalls: 0, notifyCalls: 1},
+		{name: "charge declined", payMock: &paymentServiceMock{purchaseIDToReturn: 31, createErr: errors.New("recurring payment was canceled")}, processCalls: 0, notifyCalls: 1},
+		{name: "processing failed", payMock: &paymentServiceMock{purchaseIDToReturn: 31, processErr: errors.New("remnawave unavailable")}, processCalls: 1, notifyCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expireAt := time.Now().Add(24 * time.Hour)
+			paymentMethodID := uuid.New()
+			customers := []database.Customer{{ID: 3, ExpireAt: &expireAt, PaymentMethodID: &paymentMethodID}}
+			tributes := []database.Purchase{}
+
+			cRepo := &customerRepoMock{customers: &customers}
+			pRepo := &purchaseRepoMock{tributes: &tributes, recurring: []database.Purchase{{CustomerID: 3, Amount: 300, Month: 1}}}
+			notifyCalls := 0
+
+			svc := NewSubscriptionService(cRepo, pRepo, tt.payMock, nil, nil)
+			svc.autoPaymentEnabled = func() bool { return true }
+			svc.notify = func(ctx context.Context, customer database.Customer) error {
+				notifyCalls++
+				return nil
+			}
+
+			if err := svc.ProcessSubscriptionExpiration(); err != nil {
+				t.Fatalf("ProcessSubscriptionExpiration returned error: %v", err)
+			}
+
+			if tt.payMock.createCalls != 1 {
+				t.Fatalf("expected recurring purchase to be created once, got %d", tt.payMock.createCalls)
+			}
+			if tt.payMock.processCalls != tt.processCalls {
+				t.Fatalf("expected process purchase to be called %d times, got %d", tt.processCalls, tt.payMock.processCalls)
+			}
+			if notifyCalls != tt.notifyCalls {
+				t.Fatalf("expected %d notifications, got %d", tt.notifyCalls, notifyCalls)
+			}
+		})
+	}
+}
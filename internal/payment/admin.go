@@ -0,0 +1,87 @@
+package payment
+
+import (
+	"context"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+)
+
+// AddSubscriptionDays extends (days > 0) or shortens (days < 0) the customer's subscription in Remnawave
+// and stores the new expiration in the bot database.
+func (s PaymentService) AddSubscriptionDays(ctx context.Context, customer *database.Customer, days int) (*time.Time, error) {
+	updates := map[string]interface{}{}
+	var expireAt time.Time
+
+	if days < 0 {
+		expire, err := s.remnawaveClient.DecreaseSubscription(ctx, customer.TelegramID, days)
+		if err != nil {
+			return nil, err
+		}
+		expireAt = *expire
+	} else {
+		user, err := s.remnawaveClient.AddDays(ctx, customer.ID, customer.TelegramID, days)
+		if err != nil {
+			return nil, err
+		}
+		expireAt = user.ExpireAt
+		updates["subscription_link"] = user.SubscriptionUrl
+	}
+	updates["expire_at"] = expireAt
+
+	if err := s.customerRepository.UpdateFields(ctx, customer.ID, updates); err != nil {
+		return nil, err
+	}
+
+	slog.Info("subscription changed by admin", "customer_id", utils.MaskHalfInt64(customer.ID), "days", days)
+	return &expireAt, nil
+}
+
+// ResetTrial forgets the customer's trial activation, making the trial available again once no subscription is active.
+func (s PaymentService) ResetTrial(ctx context.Context, customer *database.Customer) error {
+	if _, err := s.trialActivationRepository.Delete(ctx, customer.TelegramID); err != nil {
+		return err
+	}
+
+	slog.Info("trial reset by admin", "customer_id", utils.MaskHalfInt64(customer.ID))
+	return nil
+}
+
+// GrantTrial provisions the trial for the customer whether or not they already used it, records the staff member
+// who granted it and notifies the customer.
+func (s PaymentService) GrantTrial(ctx context.Context, customer *database.Customer, grantedBy int64) error {
+	if config.TrialDays() == 0 {
+		return ErrTrialUnavailable
+	}
+	user, err := s.provisionTrial(ctx, customer)
+	if err != nil {
+		return err
+	}
+	if err := s.trialActivationRepository.Grant(ctx, customer.TelegramID, grantedBy, user.GetExpireAt()); err != nil {
+		return err
+	}
+
+	slog.Info("trial granted by admin", "customer_id", utils.MaskHalfInt64(customer.ID), "admin_id", utils.MaskHalfInt64(grantedBy))
+	s.sendTrialGranted(ctx, customer)
+	return nil
+}
+
+// SetCustomerBlocked blocks or unblocks the customer in the bot and disables or enables the Remnawave user.
+func (s PaymentService) SetCustomerBlocked(ctx context.Context, customer *database.Customer, blocked bool) error {
+	err := s.remnawaveClient.SetUserEnabled(ctx, customer.TelegramID, !blocked)
+	if err != nil {
+		return err
+	}
+
+	err = s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"blocked": blocked,
+	})
+	if err != nil {
+		return err
+	}
+
+	slog.Info("customer block status changed by admin", "customer_id", utils.MaskHalfInt64(customer.ID), "blocked", blocked)
+	return nil
+}
@@ -0,0 +1,149 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/deeplink"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// giftCodeLength keeps gift links short while leaving 80 bits of randomness.
+const giftCodeLength = 16
+
+var (
+	ErrGiftCodeNotFound = errors.New("gift code not found")
+	ErrGiftCodeRedeemed = errors.New("gift code already redeemed")
+	ErrGiftCodeExpired  = errors.New("gift code expired")
+)
+
+func newGiftCode() string {
+	return rand.Text()[:giftCodeLength]
+}
+
+// GiftLink is the deep link that redeems the code in the bot.
+func GiftLink(code string) string {
+	return fmt.Sprintf("%s?start=%s", config.BotURL(), deeplink.Gift(code))
+}
+
+// giftCodeUnavailable explains why the code could not be redeemed; gift is nil when the code does not exist.
+func giftCodeUnavailable(gift *database.GiftCode) error {
+	switch {
+	case gift == nil:
+		return ErrGiftCodeNotFound
+	case gift.RedeemedAt != nil:
+		return ErrGiftCodeRedeemed
+	default:
+		return ErrGiftCodeExpired
+	}
+}
+
+// giftPlan returns the Remnawave settings of the gifted tariff, or the default plan if the tariff was deleted.
+func giftPlan(ctx context.Context, tariffs tariffFinder, gift *database.GiftCode) (remnawave.Plan, error) {
+	if gift.TariffID == nil {
+		return remnawave.DefaultPlan(), nil
+	}
+	tariff, err := tariffs.FindById(ctx, *gift.TariffID)
+	if err != nil {
+		return remnawave.Plan{}, err
+	}
+	if tariff == nil {
+		slog.Warn("gift tariff not found, using default plan", "gift_id", gift.ID)
+		return remnawave.DefaultPlan(), nil
+	}
+	return tariffPlan(tariff), nil
+}
+
+// RedeemGiftCode creates or extends the customer's subscription by the gifted period. The code is claimed before
+// Remnawave is called and released if that fails, so it cannot be redeemed twice.
+func (s PaymentService) RedeemGiftCode(ctx context.Context, code string, customer *database.Customer) (*database.GiftCode, error) {
+	gift, err := s.giftCodeRepository.Redeem(ctx, code, customer.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if gift == nil {
+		existing, err := s.giftCodeRepository.FindByCode(ctx, code)
+		if err != nil {
+			return nil, err
+		}
+		return nil, giftCodeUnavailable(existing)
+	}
+
+	release := func(cause error) error {
+		if err := s.giftCodeRepository.ReleaseRedemption(ctx, gift.ID, customer.TelegramID); err != nil {
+			slog.Error("Error releasing gift code", "gift_id", gift.ID, "error", err)
+		}
+		return cause
+	}
+
+	plan, err := giftPlan(ctx, s.tariffRepository, gift)
+	if err != nil {
+		return nil, release(err)
+	}
+	user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, plan, gift.Days, !customer.Blocked)
+	if err != nil {
+		return nil, release(err)
+	}
+
+	err = s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"subscription_link": user.GetSubscriptionUrl(),
+		"expire_at":         user.GetExpireAt(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("gift code redeemed", "gift_id", gift.ID, "telegramId", utils.MaskHalfInt64(customer.TelegramID), "days", gift.Days)
+
+	if gift.BuyerTelegramID != customer.TelegramID {
+		s.notifyGiftBuyer(ctx, gift)
+	}
+	return gift, nil
+}
+
+func (s PaymentService) sendGiftCode(ctx context.Context, customer *database.Customer, gift *database.GiftCode) error {
+	link := GiftLink(gift.Code)
+	shareURL := fmt.Sprintf("https://t.me/share/url?url=%s&text=%s",
+		url.QueryEscape(link), url.QueryEscape(s.translation.GetText(customer.Language, "gift_share_text")))
+
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text: fmt.Sprintf(s.translation.GetText(customer.Language, "gift_paid"),
+			gift.Days, link, gift.Code, gift.ExpiresAt.Format("02.01.2006")),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: s.translation.GetText(customer.Language, "gift_share_button"), URL: shareURL}},
+			{{Text: s.translation.GetText(customer.Language, "back_button"), CallbackData: "start"}},
+		}},
+	})
+	return err
+}
+
+func (s PaymentService) notifyGiftBuyer(ctx context.Context, gift *database.GiftCode) {
+	language := config.DefaultLanguage()
+	buyer, err := s.customerRepository.FindByTelegramId(ctx, gift.BuyerTelegramID)
+	if err != nil {
+		slog.Error("Error finding gift buyer", "gift_id", gift.ID, "error", err)
+	}
+	if buyer != nil {
+		language = buyer.Language
+	}
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    gift.BuyerTelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      fmt.Sprintf(s.translation.GetText(language, "gift_redeemed_buyer"), gift.Code, time.Now().Format("02.01.2006 15:04")),
+	})
+	if err != nil {
+		slog.Error("Error sending gift redeemed message", "gift_id", gift.ID, "error", err)
+	}
+}
@@ -0,0 +1,48 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+	"time"
+)
+
+func TestGiftCodeUnavailable(t *testing.T) {
+	redeemedAt := time.Now()
+	tests := []struct {
+		name string
+		gift *database.GiftCode
+		want error
+	}{
+		{"unknown", nil, ErrGiftCodeNotFound},
+		{"redeemed", &database.GiftCode{RedeemedAt: &redeemedAt}, ErrGiftCodeRedeemed},
+		{"expired", &database.GiftCode{ExpiresAt: time.Now().Add(-time.Hour)}, ErrGiftCodeExpired},
+	}
+	for _, tt := range tests {
+		if err := giftCodeUnavailable(tt.gift); !errors.Is(err, tt.want) {
+			t.Fatalf("%s: want %v, got %v", tt.name, tt.want, err)
+		}
+	}
+}
+
+func TestGiftPlanUsesTariff(t *testing.T) {
+	tariffID := int64(2)
+	deviceLimit := 3
+	tariffs := fakeTariffs{tariffID: {ID: tariffID, TrafficResetStrategy: "WEEK", DeviceLimit: &deviceLimit}}
+
+	plan, err := giftPlan(context.Background(), tariffs, &database.GiftCode{ID: 1, TariffID: &tariffID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plan.ResetStrategy != "WEEK" || plan.DeviceLimit != 3 {
+		t.Fatalf("tariff settings not applied: %+v", plan)
+	}
+}
+
+func TestNewGiftCode(t *testing.T) {
+	first, second := newGiftCode(), newGiftCode()
+	if len(first) != giftCodeLength || first == second {
+		t.Fatalf("expected distinct codes of %d characters, got %q and %q", giftCodeLength, first, second)
+	}
+}
@@ -9,28 +9,40 @@ import (
 	"remnawave-tg-shop-bot/internal/config"
 	"remnawave-tg-shop-bot/internal/cryptopay"
 	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/metrics"
 	"remnawave-tg-shop-bot/internal/moynalog"
 	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/internal/staff"
 	"remnawave-tg-shop-bot/internal/translation"
 	"remnawave-tg-shop-bot/internal/yookasa"
 	"remnawave-tg-shop-bot/utils"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
+	"github.com/google/uuid"
 )
 
 type PaymentService struct {
-	purchaseRepository *database.PurchaseRepository
-	remnawaveClient    *remnawave.Client
-	customerRepository *database.CustomerRepository
-	telegramBot        *bot.Bot
-	translation        *translation.Manager
-	cryptoPayClient    *cryptopay.Client
-	yookasaClient      *yookasa.Client
-	referralRepository *database.ReferralRepository
-	cache              *cache.Cache
-	moynalogClient     *moynalog.Client
+	purchaseRepository        *database.PurchaseRepository
+	remnawaveClient           *remnawave.Client
+	customerRepository        *database.CustomerRepository
+	telegramBot               *bot.Bot
+	translation               *translation.Manager
+	cryptoPayClient           *cryptopay.Client
+	yookasaClient             *yookasa.Client
+	referralRepository        *database.ReferralRepository
+	cache                     *cache.Cache
+	moynalogClient            *moynalog.Client
+	promoCodeRepository       *database.PromoCodeRepository
+	tariffRepository          *database.TariffRepository
+	provisioningJobRepository *database.ProvisioningJobRepository
+	receiptRepository         *database.ReceiptRepository
+	staffService              *staff.Service
+	giftCodeRepository        *database.GiftCodeRepository
+	trialActivationRepository *database.TrialActivationRepository
 }
 
 func NewPaymentService(
@@ -44,37 +56,54 @@ func NewPaymentService(
 	referralRepository *database.ReferralRepository,
 	cache *cache.Cache,
 	moynalogClient *moynalog.Client,
+	promoCodeRepository *database.PromoCodeRepository,
+	tariffRepository *database.TariffRepository,
+	provisioningJobRepository *database.ProvisioningJobRepository,
+	receiptRepository *database.ReceiptRepository,
+	staffService *staff.Service,
+	giftCodeRepository *database.GiftCodeRepository,
+	trialActivationRepository *database.TrialActivationRepository,
 ) *PaymentService {
 	return &PaymentService{
-		purchaseRepository: purchaseRepository,
-		remnawaveClient:    remnawaveClient,
-		customerRepository: customerRepository,
-		telegramBot:        telegramBot,
-		translation:        translation,
-		cryptoPayClient:    cryptoPayClient,
-		yookasaClient:      yookasaClient,
-		referralRepository: referralRepository,
-		cache:              cache,
-		moynalogClient:     moynalogClient,
+		purchaseRepository:        purchaseRepository,
+		remnawaveClient:           remnawaveClient,
+		customerRepository:        customerRepository,
+		telegramBot:               telegramBot,
+		translation:               translation,
+		cryptoPayClient:           cryptoPayClient,
+		yookasaClient:             yookasaClient,
+		referralRepository:        referralRepository,
+		cache:                     cache,
+		moynalogClient:            moynalogClient,
+		promoCodeRepository:       promoCodeRepository,
+		tariffRepository:          tariffRepository,
+		provisioningJobRepository: provisioningJobRepository,
+		receiptRepository:         receiptRepository,
+		staffService:              staffService,
+		giftCodeRepository:        giftCodeRepository,
+		trialActivationRepository: trialActivationRepository,
 	}
 }
 
+// ProcessPurchaseById is called once the payment is confirmed. The purchase is queued for provisioning
+// first, so a failed Remnawave update is retried by RetryProvisioning instead of being lost.
 func (s PaymentService) ProcessPurchaseById(ctx context.Context, purchaseId int64) error {
-	purchase, err := s.purchaseRepository.FindById(ctx, purchaseId)
-	if err != nil {
+	username, _ := ctx.Value("username").(string)
+	if err := s.provisioningJobRepository.Enqueue(ctx, purchaseId, username); err != nil {
 		return err
 	}
-	if purchase == nil {
-		return fmt.Errorf("purchase with crypto invoice id %s not found", utils.MaskHalfInt64(purchaseId))
-	}
 
-	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	processed, err := processPurchase(ctx, s.purchaseRepository, s.customerRepository, s.tariffRepository, s.remnawaveClient, s, purchaseId)
 	if err != nil {
+		s.recordProvisioningFailure(ctx, purchaseId, err)
 		return err
 	}
-	if customer == nil {
-		return fmt.Errorf("customer %s not found", utils.MaskHalfInt64(purchase.CustomerID))
+	if processed == nil {
+		return nil
 	}
+	purchase, customer := processed.purchase, processed.customer
+	metrics.PurchasesPaid.WithLabelValues(string(purchase.InvoiceType), metrics.Plan(purchase.TariffID, purchase.Month)).Inc()
+	metrics.Revenue.WithLabelValues(purchase.Currency).Add(purchase.Amount)
 
 	if messageId, b := s.cache.Get(purchase.ID); b {
 		_, err = s.telegramBot.DeleteMessage(ctx, &bot.DeleteMessageParams{
@@ -86,105 +115,34 @@ func (s PaymentService) ProcessPurchaseById(ctx context.Context, purchaseId int6
 		}
 	}
 
-	user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, config.TrafficLimit(), purchase.Month*config.DaysInMonth(), false)
-	if err != nil {
-		return err
-	}
-
-	err = s.purchaseRepository.MarkAsPaid(ctx, purchase.ID)
-	if err != nil {
-		return err
-	}
-
-	customerFilesToUpdate := map[string]interface{}{
-		"subscription_link": user.SubscriptionUrl,
-		"expire_at":         user.ExpireAt,
+	if processed.gift != nil {
+		err = s.sendGiftCode(ctx, customer, processed.gift)
+	} else {
+		_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: customer.TelegramID,
+			Text:   s.translation.GetText(customer.Language, "subscription_activated"),
+			ReplyMarkup: models.InlineKeyboardMarkup{
+				InlineKeyboard: s.createConnectKeyboard(customer),
+			},
+		})
 	}
-
-	err = s.customerRepository.UpdateFields(ctx, customer.ID, customerFilesToUpdate)
 	if err != nil {
-		return err
+		// The purchase is already paid and provisioned; the receipt and referral rewards below must not be lost
+		// because the customer could not be notified.
+		slog.Error("Error sending purchase notification", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
 	}
 
-	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
-		ChatID: customer.TelegramID,
-		Text:   s.translation.GetText(customer.Language, "subscription_activated"),
-		ReplyMarkup: models.InlineKeyboardMarkup{
-			InlineKeyboard: s.createConnectKeyboard(customer),
-		},
-	})
-	if err != nil {
-		return err
+	if purchase.PromoLimitExceeded {
+		s.alertPromoLimitExceeded(ctx, purchase)
 	}
 
-	slog.Info("checking conditions for Moynalog receipt", "invoice_type", purchase.InvoiceType, "moynalog_client", s.moynalogClient != nil)
-	if purchase.InvoiceType == database.InvoiceTypeYookasa && s.moynalogClient != nil {
-		slog.Info("attempting to send receipt to Moynalog", "purchase_id", utils.MaskHalfInt64(purchase.ID), "amount", purchase.Amount, "month", purchase.Month)
-		go func() {
-			moynalogCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-			defer cancel()
-			err := s.sendReceiptToMoynalog(moynalogCtx, purchase)
-			if err != nil {
-				slog.Error("error sending receipt to Moynalog", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
-				_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
-					ChatID: config.GetAdminTelegramId(),
-					Text:   "Ошибка при отправке чека в Мой налог. Проверьте логи.",
-				})
-				if err != nil {
-					slog.Error("error while sending moy nalog error message", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
-				}
-			} else {
-				slog.Info("successfully sent receipt to Moynalog", "purchase_id", utils.MaskHalfInt64(purchase.ID))
-			}
-		}()
-	} else {
-		if purchase.InvoiceType != database.InvoiceTypeYookasa {
-			slog.Info("not sending receipt to Moynalog - not a Yookasa invoice", "invoice_type", purchase.InvoiceType, "purchase_id", utils.MaskHalfInt64(purchase.ID))
-		} else if s.moynalogClient == nil {
-			slog.Error("not sending receipt to Moynalog - client is nil", "purchase_id", utils.MaskHalfInt64(purchase.ID))
-		}
+	if s.moynalogClient != nil && config.IsMoynalogReceiptEnabled(string(purchase.InvoiceType)) {
+		go s.issueReceipt(purchase.ID)
 	}
 
-	ctxReferee := context.Background()
-	referee, err := s.referralRepository.FindByReferee(ctxReferee, customer.TelegramID)
-	if referee == nil {
-		return nil
-	}
-	if referee.BonusGranted {
-		return nil
-	}
-	if err != nil {
-		return err
-	}
-	refereeCustomer, err := s.customerRepository.FindByTelegramId(ctxReferee, referee.ReferrerID)
-	if err != nil {
-		return err
-	}
-	refereeUser, err := s.remnawaveClient.CreateOrUpdateUser(ctxReferee, refereeCustomer.ID, refereeCustomer.TelegramID, config.TrafficLimit(), config.GetReferralDays(), false)
-	if err != nil {
-		return err
-	}
-	refereeUserFilesToUpdate := map[string]interface{}{
-		"subscription_link": refereeUser.GetSubscriptionUrl(),
-		"expire_at":         refereeUser.GetExpireAt(),
-	}
-	err = s.customerRepository.UpdateFields(ctxReferee, refereeCustomer.ID, refereeUserFilesToUpdate)
-	if err != nil {
-		return err
+	if err := s.grantReferralRewards(context.Background(), customer, purchase); err != nil {
+		slog.Error("Error granting referral rewards", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
 	}
-	err = s.referralRepository.MarkBonusGranted(ctxReferee, referee.ID)
-	if err != nil {
-		return err
-	}
-	slog.Info("Granted referral bonus", "customer_id", utils.MaskHalfInt64(refereeCustomer.ID))
-	_, err = s.telegramBot.SendMessage(ctxReferee, &bot.SendMessageParams{
-		ChatID:    refereeCustomer.TelegramID,
-		ParseMode: models.ParseModeHTML,
-		Text:      s.translation.GetText(refereeCustomer.Language, "referral_bonus_granted"),
-		ReplyMarkup: models.InlineKeyboardMarkup{
-			InlineKeyboard: s.createConnectKeyboard(refereeCustomer),
-		},
-	})
 
 	slog.Info("purchase processed", "purchase_id", utils.MaskHalfInt64(purchase.ID), "type", purchase.InvoiceType, "customer_id", utils.MaskHalfInt64(customer.ID))
 
@@ -212,19 +170,25 @@ func (s PaymentService) createConnectKeyboard(customer *database.Customer) [][]m
 	return inlineCustomerKeyboard
 }
 
-func (s PaymentService) CreatePurchase(ctx context.Context, amount float64, months int, customer *database.Customer, invoiceType database.InvoiceType) (url string, purchaseId int64, err error) {
+// CreatePurchase creates a purchase of the tariff and an invoice for it. amount is the price after the discount;
+// discount is nil when no promo code was applied. A gift purchase issues a gift code once paid instead of
+// extending the customer's subscription.
+func (s PaymentService) CreatePurchase(ctx context.Context, amount float64, tariff *database.Tariff, customer *database.Customer, invoiceType database.InvoiceType, discount *Discount, gift bool) (url string, purchaseId int64, err error) {
 	switch invoiceType {
 	case database.InvoiceTypeCrypto:
-		return s.createCryptoInvoice(ctx, amount, months, customer)
+		url, purchaseId, err = s.createCryptoInvoice(ctx, amount, tariff, customer, discount, gift)
 	case database.InvoiceTypeYookasa:
-		return s.createYookasaInvoice(ctx, amount, months, customer)
+		url, purchaseId, err = s.createYookasaInvoice(ctx, amount, tariff, customer, discount, gift)
 	case database.InvoiceTypeTelegram:
-		return s.createTelegramInvoice(ctx, amount, months, customer)
-	case database.InvoiceTypeTribute:
-		return s.createTributeInvoice(ctx, amount, months, customer)
+		url, purchaseId, err = s.createTelegramInvoice(ctx, amount, tariff, customer, discount, gift)
 	default:
 		return "", 0, fmt.Errorf("unknown invoice type: %s", invoiceType)
 	}
+
+	if purchaseId != 0 {
+		metrics.PurchasesCreated.WithLabelValues(string(invoiceType), metrics.Plan(&tariff.ID, tariffMonths(tariff))).Inc()
+	}
+	return url, purchaseId, err
 }
 
 var ErrCustomerNotFound = errors.New("customer not found")
@@ -245,7 +209,11 @@ func (s PaymentService) CancelTributePurchase(ctx context.Context, telegramId in
 	if tributePurchase == nil {
 		return errors.New("tribute purchase not found")
 	}
-	expireAt, err := s.remnawaveClient.DecreaseSubscription(ctx, telegramId, config.TrafficLimit(), -tributePurchase.Month*config.DaysInMonth())
+	_, days, err := purchasePlan(ctx, s.tariffRepository, tributePurchase)
+	if err != nil {
+		return err
+	}
+	expireAt, err := s.remnawaveClient.DecreaseSubscription(ctx, telegramId, -days)
 	if err != nil {
 		return err
 	}
@@ -261,6 +229,8 @@ func (s PaymentService) CancelTributePurchase(ctx context.Context, telegramId in
 	}); err != nil {
 		return err
 	}
+	s.cancelReceipt(ctx, tributePurchase.ID)
+
 	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
 		ChatID:    telegramId,
 		ParseMode: models.ParseModeHTML,
@@ -273,27 +243,31 @@ func (s PaymentService) CancelTributePurchase(ctx context.Context, telegramId in
 	return nil
 }
 
-func (s PaymentService) createCryptoInvoice(ctx context.Context, amount float64, months int, customer *database.Customer) (url string, purchaseId int64, err error) {
-	purchaseId, err = s.purchaseRepository.Create(ctx, &database.Purchase{
+func (s PaymentService) createCryptoInvoice(ctx context.Context, amount float64, tariff *database.Tariff, customer *database.Customer, discount *Discount, gift bool) (url string, purchaseId int64, err error) {
+	months := tariffMonths(tariff)
+	purchaseId, err = s.purchaseRepository.Create(ctx, discount.applyTo(&database.Purchase{
 		InvoiceType: database.InvoiceTypeCrypto,
 		Status:      database.PurchaseStatusNew,
 		Amount:      amount,
 		Currency:    "RUB",
 		CustomerID:  customer.ID,
 		Month:       months,
-	})
+		TariffID:    &tariff.ID,
+		Gift:        gift,
+	}))
 	if err != nil {
 		slog.Error("Error creating purchase", "error", err)
 		return "", 0, err
 	}
 
+	username, _ := ctx.Value("username").(string)
 	invoice, err := s.cryptoPayClient.CreateInvoice(&cryptopay.InvoiceRequest{
 		CurrencyType:   "fiat",
 		Fiat:           "RUB",
 		Amount:         fmt.Sprintf("%d", int(amount)),
 		AcceptedAssets: "USDT",
-		Payload:        fmt.Sprintf("purchaseId=%d&username=%s", purchaseId, ctx.Value("username")),
-		Description:    fmt.Sprintf("Subscription on %d month", months),
+		Payload:        cryptopay.InvoicePayload{PurchaseID: purchaseId, Username: username}.Encode(),
+		Description:    fmt.Sprintf("Subscription for %d days", tariff.DurationDays),
 		PaidBtnName:    "callback",
 		PaidBtnUrl:     config.BotURL(),
 	})
@@ -317,21 +291,24 @@ func (s PaymentService) createCryptoInvoice(ctx context.Context, amount float64,
 	return invoice.BotInvoiceUrl, purchaseId, nil
 }
 
-func (s PaymentService) createYookasaInvoice(ctx context.Context, amount float64, months int, customer *database.Customer) (url string, purchaseId int64, err error) {
-	purchaseId, err = s.purchaseRepository.Create(ctx, &database.Purchase{
+func (s PaymentService) createYookasaInvoice(ctx context.Context, amount float64, tariff *database.Tariff, customer *database.Customer, discount *Discount, gift bool) (url string, purchaseId int64, err error) {
+	months := tariffMonths(tariff)
+	purchaseId, err = s.purchaseRepository.Create(ctx, discount.applyTo(&database.Purchase{
 		InvoiceType: database.InvoiceTypeYookasa,
 		Status:      database.PurchaseStatusNew,
 		Amount:      amount,
 		Currency:    "RUB",
 		CustomerID:  customer.ID,
 		Month:       months,
-	})
+		TariffID:    &tariff.ID,
+		Gift:        gift,
+	}))
 	if err != nil {
 		slog.Error("Error creating purchase", "error", err)
 		return "", 0, err
 	}
 
-	invoice, err := s.yookasaClient.CreateInvoice(ctx, int(amount), months, customer.ID, purchaseId)
+	invoice, err := s.yookasaClient.CreateInvoice(ctx, int(amount), tariff.DurationDays, customer.ID, purchaseId)
 	if err != nil {
 		slog.Error("Error creating invoice", "error", err)
 		return "", 0, err
@@ -352,15 +329,107 @@ func (s PaymentService) createYookasaInvoice(ctx context.Context, amount float64
 	return invoice.Confirmation.ConfirmationURL, purchaseId, nil
 }
 
-func (s PaymentService) createTelegramInvoice(ctx context.Context, amount float64, months int, customer *database.Customer) (url string, purchaseId int64, err error) {
+// CreateRecurringPurchase charges the customer's saved YooKassa payment method for the tariff of lastPurchase.
+// paid is true when the provider confirmed the charge synchronously; otherwise
+// the purchase stays pending and is picked up by the invoice checker.
+func (s PaymentService) CreateRecurringPurchase(ctx context.Context, lastPurchase *database.Purchase, customer *database.Customer) (purchaseId int64, paid bool, err error) {
+	if customer.PaymentMethodID == nil {
+		return 0, false, errors.New("customer has no saved payment method")
+	}
+
+	tariff, err := renewalTariff(ctx, s.tariffRepository, lastPurchase)
+	if err != nil {
+		return 0, false, err
+	}
+	amount := tariff.PriceRub
+	months := tariffMonths(tariff)
+
 	purchaseId, err = s.purchaseRepository.Create(ctx, &database.Purchase{
+		InvoiceType: database.InvoiceTypeYookasa,
+		Status:      database.PurchaseStatusNew,
+		Amount:      float64(amount),
+		Currency:    "RUB",
+		CustomerID:  customer.ID,
+		Month:       months,
+		TariffID:    &tariff.ID,
+	})
+	if err != nil {
+		slog.Error("Error creating purchase", "error", err)
+		return 0, false, err
+	}
+	metrics.PurchasesCreated.WithLabelValues(string(database.InvoiceTypeYookasa), metrics.Plan(&tariff.ID, months)).Inc()
+
+	invoice, err := s.yookasaClient.CreateRecurringPayment(ctx, amount, tariff.DurationDays, customer.ID, purchaseId, *customer.PaymentMethodID)
+	if err != nil {
+		if updateErr := s.purchaseRepository.UpdateFields(ctx, purchaseId, map[string]interface{}{
+			"status": database.PurchaseStatusCancel,
+		}); updateErr != nil {
+			slog.Error("Error updating purchase", "error", updateErr)
+		}
+		return purchaseId, false, err
+	}
+
+	if invoice.IsCancelled() {
+		if err := s.purchaseRepository.UpdateFields(ctx, purchaseId, map[string]interface{}{
+			"yookasa_id": invoice.ID,
+			"status":     database.PurchaseStatusCancel,
+		}); err != nil {
+			slog.Error("Error updating purchase", "error", err)
+		}
+		if invoice.IsPaymentMethodRevoked() {
+			if err := s.DisableAutoPayment(ctx, customer.ID); err != nil {
+				slog.Error("Error disabling auto payment", "error", err, "customer_id", utils.MaskHalfInt64(customer.ID))
+			}
+		}
+		return purchaseId, false, fmt.Errorf("recurring payment %s was canceled", invoice.ID)
+	}
+
+	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, map[string]interface{}{
+		"yookasa_id": invoice.ID,
+		"status":     database.PurchaseStatusPending,
+	})
+	if err != nil {
+		slog.Error("Error updating purchase", "error", err)
+		return purchaseId, false, err
+	}
+
+	return purchaseId, invoice.Paid, nil
+}
+
+func (s PaymentService) SavePaymentMethod(ctx context.Context, customerId int64, paymentMethodId uuid.UUID) error {
+	err := s.customerRepository.UpdateFields(ctx, customerId, map[string]interface{}{
+		"payment_method_id": paymentMethodId,
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Saved payment method for auto payment", "customer_id", utils.MaskHalfInt64(customerId))
+	return nil
+}
+
+func (s PaymentService) DisableAutoPayment(ctx context.Context, customerId int64) error {
+	err := s.customerRepository.UpdateFields(ctx, customerId, map[string]interface{}{
+		"payment_method_id": nil,
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Disabled auto payment", "customer_id", utils.MaskHalfInt64(customerId))
+	return nil
+}
+
+func (s PaymentService) createTelegramInvoice(ctx context.Context, amount float64, tariff *database.Tariff, customer *database.Customer, discount *Discount, gift bool) (url string, purchaseId int64, err error) {
+	months := tariffMonths(tariff)
+	purchaseId, err = s.purchaseRepository.Create(ctx, discount.applyTo(&database.Purchase{
 		InvoiceType: database.InvoiceTypeTelegram,
 		Status:      database.PurchaseStatusNew,
 		Amount:      amount,
 		Currency:    "STARS",
 		CustomerID:  customer.ID,
 		Month:       months,
-	})
+		TariffID:    &tariff.ID,
+		Gift:        gift,
+	}))
 	if err != nil {
 		slog.Error("Error creating purchase", "error", err)
 		return "", 0, nil
@@ -392,62 +461,226 @@ func (s PaymentService) createTelegramInvoice(ctx context.Context, amount float6
 	return invoiceUrl, purchaseId, nil
 }
 
-func (s PaymentService) ActivateTrial(ctx context.Context, telegramId int64) (string, error) {
-	if config.TrialDays() == 0 {
-		return "", nil
+func (s PaymentService) CancelYookassaPayment(purchaseId int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseId)
+	if err != nil {
+		return err
 	}
-	customer, err := s.customerRepository.FindByTelegramId(ctx, telegramId)
+	if purchase == nil {
+		return fmt.Errorf("purchase with crypto invoice id %s not found", utils.MaskHalfInt64(purchaseId))
+	}
+
+	purchaseFieldsToUpdate := map[string]interface{}{
+		"status": database.PurchaseStatusCancel,
+	}
+
+	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, purchaseFieldsToUpdate)
 	if err != nil {
-		slog.Error("Error finding customer", "error", err)
-		return "", err
+		return err
 	}
-	if customer == nil {
-		return "", fmt.Errorf("customer %d not found", telegramId)
+
+	return nil
+}
+
+// ProcessCryptoPayInvoice completes the purchase referenced by a paid Crypto Pay invoice.
+// It is shared by the webhook handler and the reconciliation poller.
+func (s PaymentService) ProcessCryptoPayInvoice(ctx context.Context, invoice *cryptopay.InvoiceResponse) error {
+	if invoice.InvoiceID == nil || !invoice.IsPaid() {
+		return nil
 	}
-	user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, customer.ID, telegramId, config.TrialTrafficLimit(), config.TrialDays(), true)
+
+	payload, err := cryptopay.ParseInvoicePayload(invoice.Payload)
 	if err != nil {
-		slog.Error("Error creating user", "error", err)
-		return "", err
+		return fmt.Errorf("invoice %d: %w", *invoice.InvoiceID, err)
 	}
 
-	customerFilesToUpdate := map[string]interface{}{
-		"subscription_link": user.GetSubscriptionUrl(),
-		"expire_at":         user.GetExpireAt(),
+	purchase, err := s.purchaseRepository.FindById(ctx, payload.PurchaseID)
+	if err != nil {
+		return err
+	}
+	if purchase == nil {
+		return fmt.Errorf("purchase %s for invoice %d not found", utils.MaskHalfInt64(payload.PurchaseID), *invoice.InvoiceID)
+	}
+	if purchase.InvoiceType != database.InvoiceTypeCrypto || purchase.CryptoInvoiceID == nil || *purchase.CryptoInvoiceID != *invoice.InvoiceID {
+		return fmt.Errorf("purchase %s does not belong to invoice %d", utils.MaskHalfInt64(payload.PurchaseID), *invoice.InvoiceID)
+	}
+	if purchase.Status == database.PurchaseStatusPaid {
+		return nil
 	}
 
-	err = s.customerRepository.UpdateFields(ctx, customer.ID, customerFilesToUpdate)
+	ctxWithUsername := context.WithValue(ctx, "username", payload.Username)
+	err = s.ProcessPurchaseById(ctxWithUsername, purchase.ID)
 	if err != nil {
-		return "", err
+		return err
 	}
+	slog.Info("Invoice processed", "invoiceId", *invoice.InvoiceID, "purchaseId", purchase.ID)
 
-	return user.GetSubscriptionUrl(), nil
+	return nil
+}
+
+// ProcessYookasaPayment applies the current state of a YooKassa payment to its purchase.
+// It is shared by the webhook handler and the reconciliation poller.
+func (s PaymentService) ProcessYookasaPayment(ctx context.Context, invoice *yookasa.Payment) error {
+	purchase, err := s.findYookasaPurchase(ctx, invoice)
+	if err != nil {
+		return err
+	}
+	if purchase.Status == database.PurchaseStatusPaid || purchase.Status == database.PurchaseStatusCancel || purchase.Status == database.PurchaseStatusRefunded {
+		return nil
+	}
 
+	if invoice.IsCancelled() {
+		return s.CancelYookassaPayment(purchase.ID)
+	}
+
+	if !invoice.Paid {
+		return nil
+	}
+
+	ctxWithValue := context.WithValue(ctx, "username", invoice.Metadata["username"])
+	err = s.ProcessPurchaseById(ctxWithValue, purchase.ID)
+	if err != nil {
+		return err
+	}
+	slog.Info("Invoice processed", "invoiceId", invoice.ID, "purchaseId", purchase.ID)
+
+	// The saved card renews the buyer's own subscription, so it is not kept from a gift payment.
+	if config.IsAutoPaymentEnabled() && invoice.HasSavedPaymentMethod() && !purchase.Gift {
+		err = s.SavePaymentMethod(ctx, purchase.CustomerID, invoice.PaymentMethod.ID)
+		if err != nil {
+			slog.Error("Error saving payment method", "invoiceId", invoice.ID, "purchaseId", purchase.ID, "error", err)
+		}
+	}
+
+	return nil
 }
 
-func (s PaymentService) CancelYookassaPayment(purchaseId int64) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	purchase, err := s.purchaseRepository.FindById(ctx, purchaseId)
+// ProcessYookasaRefund handles a refund made for a YooKassa payment. A full refund started in the YooKassa dashboard
+// marks the purchase refunded and rolls it back like /refund; the staff is told either way.
+func (s PaymentService) ProcessYookasaRefund(ctx context.Context, invoice *yookasa.Payment) error {
+	purchase, err := s.findYookasaPurchase(ctx, invoice)
 	if err != nil {
 		return err
 	}
+
+	if purchase.Status == database.PurchaseStatusRefunded {
+		// Refunded from the bot, the admin has already been told.
+		return nil
+	}
+
+	refunded := ""
+	if invoice.RefundedAmount != nil {
+		refunded = invoice.RefundedAmount.Value
+	}
+	slog.Info("Yookasa refund succeeded", "invoiceId", invoice.ID, "purchaseId", utils.MaskHalfInt64(purchase.ID), "refunded", refunded)
+
+	lang := config.DefaultLanguage()
+	text := fmt.Sprintf(s.translation.GetText(lang, "yookasa_refund_alert"), invoice.ID, purchase.ID, refunded)
+
+	var refundErr error
+	if purchase.Status == database.PurchaseStatusPaid && isFullYookasaRefund(purchase, refunded) {
+		var refund *Refund
+		refund, refundErr = s.refundYookasaPurchase(ctx, purchase.ID)
+		if refund == nil && refundErr == nil {
+			// Refunded from the bot in the meantime.
+			return nil
+		}
+		if refundErr != nil {
+			text += fmt.Sprintf(s.translation.GetText(lang, "yookasa_refund_rollback_failed"), refundErr.Error())
+		} else {
+			text += fmt.Sprintf(s.translation.GetText(lang, "yookasa_refund_rolled_back"), refund.UnusedDays)
+		}
+	} else {
+		text += s.translation.GetText(lang, "yookasa_refund_not_rolled_back")
+	}
+
+	err = s.staffService.Notify(ctx, staff.PermissionReceipts, text)
+	if err != nil {
+		slog.Error("Error sending refund message", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+	}
+
+	return refundErr
+}
+
+// findYookasaPurchase returns the purchase the payment was created for, or an error wrapping
+// yookasa.ErrUnknownPayment when there is none.
+func (s PaymentService) findYookasaPurchase(ctx context.Context, invoice *yookasa.Payment) (*database.Purchase, error) {
+	purchaseId, err := strconv.ParseInt(invoice.Metadata["purchaseId"], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid purchaseId in payment %s metadata: %w", yookasa.ErrUnknownPayment, invoice.ID, err)
+	}
+
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseId)
+	if err != nil {
+		return nil, err
+	}
 	if purchase == nil {
-		return fmt.Errorf("purchase with crypto invoice id %s not found", utils.MaskHalfInt64(purchaseId))
+		return nil, fmt.Errorf("%w: purchase %s for payment %s not found", yookasa.ErrUnknownPayment, utils.MaskHalfInt64(purchaseId), invoice.ID)
+	}
+	if purchase.InvoiceType != database.InvoiceTypeYookasa || purchase.YookasaID == nil || *purchase.YookasaID != invoice.ID {
+		return nil, fmt.Errorf("%w: purchase %s does not belong to payment %s", yookasa.ErrUnknownPayment, utils.MaskHalfInt64(purchaseId), invoice.ID)
 	}
 
-	purchaseFieldsToUpdate := map[string]interface{}{
-		"status": database.PurchaseStatusCancel,
+	return purchase, nil
+}
+
+// ParseTelegramInvoicePayload returns the purchase id and username stored in the payload of a Telegram Stars
+// invoice as "<purchase id>&<username>". The username may be missing.
+func ParseTelegramInvoicePayload(payload string) (purchaseId int64, username string, err error) {
+	id, username, _ := strings.Cut(payload, "&")
+	purchaseId, err = strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("invalid invoice payload %q: %w", payload, err)
 	}
+	return purchaseId, username, nil
+}
 
-	err = s.purchaseRepository.UpdateFields(ctx, purchaseId, purchaseFieldsToUpdate)
+// CheckTelegramCheckout is called before Telegram charges a Stars invoice. It returns an error when the payment must
+// be declined because the purchase does not exist, is not awaiting payment or its amount differs.
+func (s PaymentService) CheckTelegramCheckout(ctx context.Context, payload string, currency string, totalAmount int) error {
+	purchaseId, _, err := ParseTelegramInvoicePayload(payload)
 	if err != nil {
 		return err
 	}
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseId)
+	if err != nil {
+		return err
+	}
+	return checkTelegramCheckout(purchase, currency, totalAmount)
+}
 
+func checkTelegramCheckout(purchase *database.Purchase, currency string, totalAmount int) error {
+	switch {
+	case purchase == nil:
+		return errors.New("purchase not found")
+	case purchase.InvoiceType != database.InvoiceTypeTelegram:
+		return fmt.Errorf("purchase %s is a %s purchase", utils.MaskHalfInt64(purchase.ID), purchase.InvoiceType)
+	case purchase.Status != database.PurchaseStatusPending:
+		return fmt.Errorf("purchase %s is %s", utils.MaskHalfInt64(purchase.ID), purchase.Status)
+	case currency != "XTR" || int(purchase.Amount) != totalAmount:
+		return fmt.Errorf("purchase %s costs %d XTR, got %d %s", utils.MaskHalfInt64(purchase.ID), int(purchase.Amount), totalAmount, currency)
+	}
 	return nil
 }
 
-func (s PaymentService) createTributeInvoice(ctx context.Context, amount float64, months int, customer *database.Customer) (url string, purchaseId int64, err error) {
+// ProcessTelegramPayment completes a purchase paid with Telegram Stars. The charge id is kept
+// because RefundStarPayment needs it.
+func (s PaymentService) ProcessTelegramPayment(ctx context.Context, purchaseId int64, chargeID string) error {
+	err := s.purchaseRepository.UpdateFields(ctx, purchaseId, map[string]interface{}{
+		"telegram_charge_id": chargeID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.ProcessPurchaseById(ctx, purchaseId)
+}
+
+// CreateTributePurchase records a Tribute subscription payment. Tribute plans are set up on the Tribute side,
+// so these purchases are not tied to a tariff and use the default plan.
+func (s PaymentService) CreateTributePurchase(ctx context.Context, amount float64, months int, customer *database.Customer) (purchaseId int64, err error) {
 	purchaseId, err = s.purchaseRepository.Create(ctx, &database.Purchase{
 		InvoiceType: database.InvoiceTypeTribute,
 		Status:      database.PurchaseStatusPending,
@@ -458,34 +691,9 @@ func (s PaymentService) createTributeInvoice(ctx context.Context, amount float64
 	})
 	if err != nil {
 		slog.Error("Error creating purchase", "error", err)
-		return "", 0, err
+		return 0, err
 	}
+	metrics.PurchasesCreated.WithLabelValues(string(database.InvoiceTypeTribute), metrics.Plan(nil, months)).Inc()
 
-	return "", purchaseId, nil
-}
-
-func (s PaymentService) sendReceiptToMoynalog(ctx context.Context, purchase *database.Purchase) error {
-	if s.moynalogClient == nil {
-		return fmt.Errorf("moynalog client not initialized")
-	}
-
-	var monthString string
-	switch purchase.Month {
-	case 1:
-		monthString = "месяц"
-	case 3, 4:
-		monthString = "месяца"
-	default:
-		monthString = "месяцев"
-	}
-	comment := fmt.Sprintf("Подписка на %d %s", purchase.Month, monthString)
-	amount := purchase.Amount
-
-	_, err := s.moynalogClient.CreateIncome(ctx, amount, comment)
-	if err != nil {
-		return fmt.Errorf("failed to create income in Moynalog: %w", err)
-	}
-
-	slog.Info("Receipt sent to Moynalog", "purchase_id", utils.MaskHalfInt64(purchase.ID), "amount", amount, "comment", comment)
-	return nil
+	return purchaseId, nil
 }
@@ -0,0 +1,65 @@
+package payment
+
+import (
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+)
+
+func TestParseTelegramInvoicePayload(t *testing.T) {
+	tests := []struct {
+		payload  string
+		id       int64
+		username string
+		wantErr  bool
+	}{
+		{payload: "42&alice", id: 42, username: "alice"},
+		{payload: "42&", id: 42},
+		{payload: "42", id: 42},
+		{payload: "42&a&b", id: 42, username: "a&b"},
+		{payload: "", wantErr: true},
+		{payload: "&alice", wantErr: true},
+		{payload: "abc&alice", wantErr: true},
+	}
+	for _, tt := range tests {
+		id, username, err := ParseTelegramInvoicePayload(tt.payload)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("payload %q: unexpected error %v", tt.payload, err)
+		}
+		if id != tt.id || username != tt.username {
+			t.Fatalf("payload %q: want %d %q, got %d %q", tt.payload, tt.id, tt.username, id, username)
+		}
+	}
+}
+
+func TestCheckTelegramCheckout(t *testing.T) {
+	pending := func(amount float64) *database.Purchase {
+		return &database.Purchase{ID: 1, Amount: amount, InvoiceType: database.InvoiceTypeTelegram, Status: database.PurchaseStatusPending}
+	}
+	paid := pending(100)
+	paid.Status = database.PurchaseStatusPaid
+	yookasa := pending(100)
+	yookasa.InvoiceType = database.InvoiceTypeYookasa
+
+	tests := []struct {
+		name     string
+		purchase *database.Purchase
+		currency string
+		amount   int
+		wantErr  bool
+	}{
+		{name: "pending", purchase: pending(100), currency: "XTR", amount: 100},
+		{name: "not found", currency: "XTR", amount: 100, wantErr: true},
+		{name: "already paid", purchase: paid, currency: "XTR", amount: 100, wantErr: true},
+		{name: "other provider", purchase: yookasa, currency: "XTR", amount: 100, wantErr: true},
+		{name: "amount differs", purchase: pending(100), currency: "XTR", amount: 1, wantErr: true},
+		{name: "currency differs", purchase: pending(100), currency: "USD", amount: 100, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkTelegramCheckout(tt.purchase, tt.currency, tt.amount)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkTelegramCheckout() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+type purchaseClaimStore interface {
+	FindById(ctx context.Context, id int64) (*database.Purchase, error)
+	ClaimForProcessing(ctx context.Context, purchaseID int64) (*database.Purchase, error)
+	SetProvisionBase(ctx context.Context, purchaseID int64, expireAt time.Time) error
+	MarkProvisioned(ctx context.Context, purchaseID int64, subscriptionLink string, expireAt time.Time) error
+	ReleaseClaim(ctx context.Context, purchaseID int64) error
+	CompletePurchase(ctx context.Context, purchaseID int64, customerID int64, subscriptionLink string, expireAt time.Time, receipt *database.Receipt) error
+	CompleteGiftPurchase(ctx context.Context, purchaseID int64, gift *database.GiftCode, receipt *database.Receipt) error
+}
+
+type customerFinder interface {
+	FindById(ctx context.Context, id int64) (*database.Customer, error)
+}
+
+type tariffFinder interface {
+	FindById(ctx context.Context, id int64) (*database.Tariff, error)
+}
+
+type subscriptionProvisioner interface {
+	GetUserByTelegramId(ctx context.Context, telegramId int64) (*remapi.User, error)
+	CreateOrUpdateUser(ctx context.Context, customerId int64, telegramId int64, plan remnawave.Plan, days int, enable bool) (*remapi.User, error)
+}
+
+// receiptDrafter prepares the Moynalog receipt that is queued together with the paid purchase. It returns nil when
+// the purchase gets no receipt.
+type receiptDrafter interface {
+	draftReceipt(ctx context.Context, purchase *database.Purchase) *database.Receipt
+}
+
+// noPanelUser is stored as the provisioning base when the customer had no Remnawave user yet.
+var noPanelUser = time.Unix(0, 0).UTC()
+
+type processedPurchase struct {
+	purchase *database.Purchase
+	customer *database.Customer
+	// gift is the code issued for a gift purchase, nil otherwise.
+	gift *database.GiftCode
+}
+
+// processPurchase claims the purchase, extends the subscription once and marks the purchase as paid.
+// It returns nil without an error when the purchase is already paid or is being processed by another call.
+func processPurchase(
+	ctx context.Context,
+	purchases purchaseClaimStore,
+	customers customerFinder,
+	tariffs tariffFinder,
+	provisioner subscriptionProvisioner,
+	receipts receiptDrafter,
+	purchaseId int64,
+) (*processedPurchase, error) {
+	purchase, err := purchases.ClaimForProcessing(ctx, purchaseId)
+	if err != nil {
+		return nil, err
+	}
+	if purchase == nil {
+		existing, err := purchases.FindById(ctx, purchaseId)
+		if err != nil {
+			return nil, err
+		}
+		if existing == nil {
+			return nil, fmt.Errorf("purchase %s not found", utils.MaskHalfInt64(purchaseId))
+		}
+		slog.Info("purchase already processed or in progress", "purchase_id", utils.MaskHalfInt64(purchaseId), "status", existing.Status)
+		return nil, nil
+	}
+
+	release := func(cause error) error {
+		if err := purchases.ReleaseClaim(ctx, purchase.ID); err != nil {
+			slog.Error("Error releasing purchase claim", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
+		}
+		return cause
+	}
+
+	customer, err := customers.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return nil, release(err)
+	}
+	if customer == nil {
+		return nil, release(fmt.Errorf("customer %s not found", utils.MaskHalfInt64(purchase.CustomerID)))
+	}
+
+	if purchase.Gift {
+		gift, err := issueGiftCode(ctx, purchases, tariffs, purchase, customer, receipts.draftReceipt(ctx, purchase))
+		if err != nil {
+			return nil, release(err)
+		}
+		return &processedPurchase{purchase: purchase, customer: customer, gift: gift}, nil
+	}
+
+	if purchase.ProvisionedAt == nil {
+		user, err := provisionPurchase(ctx, purchases, tariffs, provisioner, purchase, customer)
+		if err != nil {
+			return nil, release(err)
+		}
+		purchase.SubscriptionLink = &user.SubscriptionUrl
+		purchase.SubscriptionExpireAt = &user.ExpireAt
+	} else {
+		slog.Info("purchase already provisioned, resuming", "purchase_id", utils.MaskHalfInt64(purchase.ID))
+	}
+
+	receipt := receipts.draftReceipt(ctx, purchase)
+	err = purchases.CompletePurchase(ctx, purchase.ID, customer.ID, *purchase.SubscriptionLink, *purchase.SubscriptionExpireAt, receipt)
+	if err != nil {
+		return nil, release(err)
+	}
+
+	return &processedPurchase{purchase: purchase, customer: customer}, nil
+}
+
+// provisionPurchase extends the Remnawave subscription and records the outcome on the purchase.
+// If a previous attempt already changed the user's expiration but failed before recording it,
+// the current user is taken as the outcome instead of extending the subscription again.
+func provisionPurchase(
+	ctx context.Context,
+	purchases purchaseClaimStore,
+	tariffs tariffFinder,
+	provisioner subscriptionProvisioner,
+	purchase *database.Purchase,
+	customer *database.Customer,
+) (*remapi.User, error) {
+	current, err := provisioner.GetUserByTelegramId(ctx, customer.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+
+	var user *remapi.User
+	if purchase.ProvisionBaseExpireAt != nil && current != nil && !current.ExpireAt.Equal(*purchase.ProvisionBaseExpireAt) {
+		slog.Warn("subscription was already extended by a previous attempt", "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		user = current
+	} else {
+		base := noPanelUser
+		if current != nil {
+			base = current.ExpireAt
+		}
+		if err := purchases.SetProvisionBase(ctx, purchase.ID, base); err != nil {
+			return nil, err
+		}
+
+		plan, days, err := purchasePlan(ctx, tariffs, purchase)
+		if err != nil {
+			return nil, err
+		}
+
+		user, err = provisioner.CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, plan, days, !customer.Blocked)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := purchases.MarkProvisioned(ctx, purchase.ID, user.SubscriptionUrl, user.ExpireAt); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// issueGiftCode completes a gift purchase with a new gift code for the purchased days. The subscription is
+// provisioned when the code is redeemed.
+func issueGiftCode(
+	ctx context.Context,
+	purchases purchaseClaimStore,
+	tariffs tariffFinder,
+	purchase *database.Purchase,
+	customer *database.Customer,
+	receipt *database.Receipt,
+) (*database.GiftCode, error) {
+	_, days, err := purchasePlan(ctx, tariffs, purchase)
+	if err != nil {
+		return nil, err
+	}
+
+	gift := &database.GiftCode{
+		Code:            newGiftCode(),
+		PurchaseID:      &purchase.ID,
+		BuyerTelegramID: customer.TelegramID,
+		TariffID:        purchase.TariffID,
+		Days:            days,
+		ExpiresAt:       time.Now().AddDate(0, 0, config.GiftCodeValidDays()),
+	}
+	if err := purchases.CompleteGiftPurchase(ctx, purchase.ID, gift, receipt); err != nil {
+		return nil, err
+	}
+	return gift, nil
+}
+
+// purchasePlan returns the Remnawave settings and the number of days the purchase grants. Purchases
+// without a tariff, or whose tariff was deleted, get the default plan for the purchased months.
+func purchasePlan(ctx context.Context, tariffs tariffFinder, purchase *database.Purchase) (remnawave.Plan, int, error) {
+	if purchase.TariffID != nil {
+		tariff, err := tariffs.FindById(ctx, *purchase.TariffID)
+		if err != nil {
+			return remnawave.Plan{}, 0, err
+		}
+		if tariff != nil {
+			return tariffPlan(tariff), tariff.DurationDays + purchase.BonusDays, nil
+		}
+		slog.Warn("purchase tariff not found, using default plan", "purchase_id", utils.MaskHalfInt64(purchase.ID))
+	}
+	return remnawave.DefaultPlan(), purchase.Month*config.DaysInMonth() + purchase.BonusDays, nil
+}
@@ -0,0 +1,444 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"sync"
+	"testing"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+// fakePurchaseStore mirrors the conditional updates PurchaseRepository runs in Postgres.
+type fakePurchaseStore struct {
+	mu            sync.Mutex
+	purchases     map[int64]*database.Purchase
+	customerLinks map[int64]string
+	gifts         map[int64]*database.GiftCode
+	receipts      map[int64]*database.Receipt
+	completeErr   error
+}
+
+func newFakePurchaseStore(purchases ...database.Purchase) *fakePurchaseStore {
+	store := &fakePurchaseStore{purchases: map[int64]*database.Purchase{}, customerLinks: map[int64]string{}, gifts: map[int64]*database.GiftCode{}, receipts: map[int64]*database.Receipt{}}
+	for i := range purchases {
+		p := purchases[i]
+		store.purchases[p.ID] = &p
+	}
+	return store
+}
+
+func (f *fakePurchaseStore) FindById(_ context.Context, id int64) (*database.Purchase, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.purchases[id]
+	if !ok {
+		return nil, nil
+	}
+	copied := *p
+	return &copied, nil
+}
+
+func (f *fakePurchaseStore) ClaimForProcessing(_ context.Context, id int64) (*database.Purchase, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.purchases[id]
+	if !ok {
+		return nil, nil
+	}
+	stale := p.Status == database.PurchaseStatusProcessing &&
+		p.ProcessingStartedAt != nil && p.ProcessingStartedAt.Before(time.Now().Add(-database.ProcessingTimeout))
+	if p.Status != database.PurchaseStatusNew && p.Status != database.PurchaseStatusPending && !stale {
+		return nil, nil
+	}
+	now := time.Now()
+	p.Status = database.PurchaseStatusProcessing
+	p.ProcessingStartedAt = &now
+	copied := *p
+	return &copied, nil
+}
+
+func (f *fakePurchaseStore) processing(id int64) (*database.Purchase, error) {
+	p, ok := f.purchases[id]
+	if !ok || p.Status != database.PurchaseStatusProcessing {
+		return nil, database.ErrPurchaseNotClaimed
+	}
+	return p, nil
+}
+
+func (f *fakePurchaseStore) SetProvisionBase(_ context.Context, id int64, expireAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.processing(id)
+	if err != nil {
+		return err
+	}
+	p.ProvisionBaseExpireAt = &expireAt
+	return nil
+}
+
+func (f *fakePurchaseStore) MarkProvisioned(_ context.Context, id int64, link string, expireAt time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.processing(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	p.ProvisionedAt = &now
+	p.SubscriptionLink = &link
+	p.SubscriptionExpireAt = &expireAt
+	return nil
+}
+
+func (f *fakePurchaseStore) ReleaseClaim(_ context.Context, id int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.processing(id)
+	if err != nil {
+		return err
+	}
+	p.Status = database.PurchaseStatusPending
+	p.ProcessingStartedAt = nil
+	return nil
+}
+
+func (f *fakePurchaseStore) CompletePurchase(_ context.Context, id int64, customerID int64, link string, _ time.Time, receipt *database.Receipt) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.completeErr != nil {
+		err := f.completeErr
+		f.completeErr = nil
+		return err
+	}
+	p, err := f.processing(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	p.Status = database.PurchaseStatusPaid
+	p.PaidAt = &now
+	f.customerLinks[customerID] = link
+	if receipt != nil {
+		f.receipts[id] = receipt
+	}
+	return nil
+}
+
+func (f *fakePurchaseStore) CompleteGiftPurchase(_ context.Context, id int64, gift *database.GiftCode, receipt *database.Receipt) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, err := f.processing(id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	p.Status = database.PurchaseStatusPaid
+	p.PaidAt = &now
+	f.gifts[id] = gift
+	if receipt != nil {
+		f.receipts[id] = receipt
+	}
+	return nil
+}
+
+// fakeReceipts drafts a receipt for the purchase amount, or none when disabled.
+type fakeReceipts struct {
+	disabled bool
+}
+
+func (f fakeReceipts) draftReceipt(_ context.Context, purchase *database.Purchase) *database.Receipt {
+	if f.disabled {
+		return nil
+	}
+	return &database.Receipt{PurchaseID: purchase.ID, Amount: purchase.Amount, Comment: "Подписка"}
+}
+
+type fakeCustomers struct{}
+
+func (fakeCustomers) FindById(_ context.Context, id int64) (*database.Customer, error) {
+	return &database.Customer{ID: id, TelegramID: id * 100}, nil
+}
+
+type fakeTariffs map[int64]database.Tariff
+
+func (f fakeTariffs) FindById(_ context.Context, id int64) (*database.Tariff, error) {
+	t, ok := f[id]
+	if !ok {
+		return nil, nil
+	}
+	return &t, nil
+}
+
+// fakeProvisioner extends the user's expiration by a month on every CreateOrUpdateUser call;
+// the requested days depend on config, which is not initialised in tests.
+type fakeProvisioner struct {
+	mu           sync.Mutex
+	user         *remapi.User
+	credits      int
+	failAfterRun bool
+}
+
+func (f *fakeProvisioner) GetUserByTelegramId(_ context.Context, _ int64) (*remapi.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.user == nil {
+		return nil, nil
+	}
+	copied := *f.user
+	return &copied, nil
+}
+
+func (f *fakeProvisioner) CreateOrUpdateUser(_ context.Context, _ int64, _ int64, _ remnawave.Plan, _ int, _ bool) (*remapi.User, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Give concurrent callers a chance to interleave.
+	time.Sleep(time.Millisecond)
+	if f.user == nil {
+		f.user = &remapi.User{SubscriptionUrl: "https://sub.example/link", ExpireAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	}
+	f.user.ExpireAt = f.user.ExpireAt.AddDate(0, 1, 0)
+	f.credits++
+	if f.failAfterRun {
+		f.failAfterRun = false
+		return nil, errors.New("timeout")
+	}
+	copied := *f.user
+	return &copied, nil
+}
+
+func pendingPurchase(id int64) database.Purchase {
+	return database.Purchase{ID: id, CustomerID: 7, Month: 1, Status: database.PurchaseStatusPending}
+}
+
+func TestProcessPurchaseConcurrentCallsCreditOnce(t *testing.T) {
+	store := newFakePurchaseStore(pendingPurchase(1))
+	provisioner := &fakeProvisioner{}
+
+	const callers = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	processedCount := 0
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			processed, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, provisioner, fakeReceipts{}, 1)
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if processed != nil {
+				mu.Lock()
+				processedCount++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if processedCount != 1 {
+		t.Fatalf("expected exactly one caller to process the purchase, got %d", processedCount)
+	}
+	if provisioner.credits != 1 {
+		t.Fatalf("expected subscription to be extended once, got %d", provisioner.credits)
+	}
+	if p, _ := store.FindById(context.Background(), 1); p.Status != database.PurchaseStatusPaid {
+		t.Fatalf("expected purchase to be paid, got %s", p.Status)
+	}
+}
+
+func TestProcessPurchaseAlreadyPaid(t *testing.T) {
+	paid := pendingPurchase(1)
+	paid.Status = database.PurchaseStatusPaid
+	store := newFakePurchaseStore(paid)
+	provisioner := &fakeProvisioner{}
+
+	processed, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, provisioner, fakeReceipts{}, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if processed != nil || provisioner.credits != 0 {
+		t.Fatalf("paid purchase must not be processed again")
+	}
+}
+
+func TestProcessPurchaseNotFound(t *testing.T) {
+	_, err := processPurchase(context.Background(), newFakePurchaseStore(), fakeCustomers{}, fakeTariffs{}, &fakeProvisioner{}, fakeReceipts{}, 1)
+	if err == nil {
+		t.Fatal("expected error for unknown purchase")
+	}
+}
+
+func TestProcessPurchaseResumesAfterCompleteFailure(t *testing.T) {
+	store := newFakePurchaseStore(pendingPurchase(1))
+	store.completeErr = errors.New("db is down")
+	provisioner := &fakeProvisioner{}
+
+	if _, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, provisioner, fakeReceipts{}, 1); err == nil {
+		t.Fatal("expected first attempt to fail")
+	}
+	if p, _ := store.FindById(context.Background(), 1); p.Status != database.PurchaseStatusPending || p.ProvisionedAt == nil {
+		t.Fatalf("expected provisioned purchase to be released to pending, got %s", p.Status)
+	}
+
+	processed, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, provisioner, fakeReceipts{}, 1)
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if processed == nil {
+		t.Fatal("expected retry to complete the purchase")
+	}
+	if provisioner.credits != 1 {
+		t.Fatalf("expected subscription to be extended once, got %d", provisioner.credits)
+	}
+	if store.customerLinks[7] != "https://sub.example/link" {
+		t.Fatalf("expected customer subscription link to be stored, got %q", store.customerLinks[7])
+	}
+}
+
+func TestProcessPurchaseDetectsUnrecordedCredit(t *testing.T) {
+	store := newFakePurchaseStore(pendingPurchase(1))
+	provisioner := &fakeProvisioner{
+		user:         &remapi.User{SubscriptionUrl: "https://sub.example/link", ExpireAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)},
+		failAfterRun: true,
+	}
+
+	if _, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, provisioner, fakeReceipts{}, 1); err == nil {
+		t.Fatal("expected first attempt to fail")
+	}
+
+	processed, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, provisioner, fakeReceipts{}, 1)
+	if err != nil {
+		t.Fatalf("unexpected error on retry: %v", err)
+	}
+	if processed == nil {
+		t.Fatal("expected retry to complete the purchase")
+	}
+	if provisioner.credits != 1 {
+		t.Fatalf("expected subscription to be extended once, got %d", provisioner.credits)
+	}
+}
+
+func TestProcessPurchaseReclaimsStaleProcessing(t *testing.T) {
+	stale := pendingPurchase(1)
+	stale.Status = database.PurchaseStatusProcessing
+	startedAt := time.Now().Add(-2 * database.ProcessingTimeout)
+	stale.ProcessingStartedAt = &startedAt
+	store := newFakePurchaseStore(stale)
+	provisioner := &fakeProvisioner{}
+
+	processed, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, provisioner, fakeReceipts{}, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if processed == nil || provisioner.credits != 1 {
+		t.Fatalf("expected stale purchase to be reclaimed and processed once")
+	}
+}
+
+func TestProcessGiftPurchaseIssuesCode(t *testing.T) {
+	tariffID := int64(2)
+	gift := pendingPurchase(1)
+	gift.Gift = true
+	gift.TariffID = &tariffID
+	store := newFakePurchaseStore(gift)
+	provisioner := &fakeProvisioner{}
+	tariffs := fakeTariffs{tariffID: {ID: tariffID, DurationDays: 30}}
+
+	processed, err := processPurchase(context.Background(), store, fakeCustomers{}, tariffs, provisioner, fakeReceipts{}, 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if processed == nil || processed.gift == nil {
+		t.Fatal("expected a gift code to be issued")
+	}
+	if provisioner.credits != 0 || len(store.customerLinks) != 0 {
+		t.Fatal("gift purchase must not extend the buyer's subscription")
+	}
+	issued := store.gifts[1]
+	if issued == nil || issued.Code == "" || issued.Days != 30 || issued.BuyerTelegramID != 700 || *issued.TariffID != tariffID {
+		t.Fatalf("unexpected gift code: %+v", issued)
+	}
+	if p, _ := store.FindById(context.Background(), 1); p.Status != database.PurchaseStatusPaid {
+		t.Fatalf("expected purchase to be paid, got %s", p.Status)
+	}
+
+	again, err := processPurchase(context.Background(), store, fakeCustomers{}, tariffs, provisioner, fakeReceipts{}, 1)
+	if err != nil || again != nil {
+		t.Fatalf("paid gift must not issue a second code, got %+v, %v", again, err)
+	}
+}
+
+func TestPurchasePlanUsesTariff(t *testing.T) {
+	tariffID := int64(2)
+	deviceLimit := 3
+	tariffs := fakeTariffs{tariffID: {ID: tariffID, DurationDays: 14, TrafficLimitGB: 50, TrafficResetStrategy: "WEEK", DeviceLimit: &deviceLimit}}
+
+	plan, days, err := purchasePlan(context.Background(), tariffs, &database.Purchase{ID: 1, TariffID: &tariffID, BonusDays: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if days != 16 {
+		t.Fatalf("want 16 days, got %d", days)
+	}
+	if plan.TrafficLimit != 50*1073741824 || plan.ResetStrategy != "WEEK" || plan.DeviceLimit != 3 {
+		t.Fatalf("tariff settings not applied: %+v", plan)
+	}
+}
+
+func TestPurchasePlanFallsBackWithoutTariff(t *testing.T) {
+	missing := int64(9)
+	_, days, err := purchasePlan(context.Background(), fakeTariffs{}, &database.Purchase{ID: 1, TariffID: &missing, BonusDays: 5})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// DaysInMonth is zero in tests, so only the bonus days are left.
+	if days != 5 {
+		t.Fatalf("want 5 days, got %d", days)
+	}
+}
+
+func TestProcessPurchaseQueuesReceiptWithPayment(t *testing.T) {
+	purchase := pendingPurchase(1)
+	purchase.Amount = 249
+	store := newFakePurchaseStore(purchase)
+
+	if _, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, &fakeProvisioner{}, fakeReceipts{}, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	receipt := store.receipts[1]
+	if receipt == nil || receipt.PurchaseID != 1 || receipt.Amount != 249 {
+		t.Fatalf("expected the receipt to be queued with the paid purchase, got %+v", receipt)
+	}
+}
+
+func TestProcessGiftPurchaseQueuesReceipt(t *testing.T) {
+	gift := pendingPurchase(1)
+	gift.Gift = true
+	store := newFakePurchaseStore(gift)
+
+	if _, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, &fakeProvisioner{}, fakeReceipts{}, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if store.receipts[1] == nil {
+		t.Fatal("expected the receipt to be queued with the paid gift purchase")
+	}
+}
+
+func TestProcessPurchaseWithoutReceipt(t *testing.T) {
+	store := newFakePurchaseStore(pendingPurchase(1))
+
+	if _, err := processPurchase(context.Background(), store, fakeCustomers{}, fakeTariffs{}, &fakeProvisioner{}, fakeReceipts{disabled: true}, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p, _ := store.FindById(context.Background(), 1); p.Status != database.PurchaseStatusPaid {
+		t.Fatalf("expected purchase to be paid, got %s", p.Status)
+	}
+	if len(store.receipts) != 0 {
+		t.Fatalf("expected no receipt, got %v", store.receipts)
+	}
+}
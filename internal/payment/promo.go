@@ -0,0 +1,135 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/staff"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+)
+
+var (
+	ErrPromoCodeNotFound      = errors.New("promo code not found")
+	ErrPromoCodeExpired       = errors.New("promo code expired")
+	ErrPromoCodeNotApplicable = errors.New("promo code not applicable")
+)
+
+// Discount is a promo code applied to a purchase.
+type Discount struct {
+	PromoCodeID int64
+	Amount      int
+	BonusDays   int
+}
+
+// applyTo records the discount on a purchase that is about to be created. It is a no-op for a nil discount.
+func (d *Discount) applyTo(p *database.Purchase) *database.Purchase {
+	if d == nil {
+		return p
+	}
+	p.PromoCodeID = &d.PromoCodeID
+	p.DiscountAmount = float64(d.Amount)
+	p.BonusDays = d.BonusDays
+	return p
+}
+
+// FindPromoCode returns the code entered by the customer if it can be used for the tariff.
+func (s PaymentService) FindPromoCode(ctx context.Context, code string, customer *database.Customer, tariff *database.Tariff) (*database.PromoCode, error) {
+	promo, err := s.promoCodeRepository.FindByCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPromoCode(ctx, promo, customer, tariff); err != nil {
+		return nil, err
+	}
+	return promo, nil
+}
+
+// ApplyPromoCode checks the code again for the chosen payment method and calculates the discount on the
+// tariff price in that method's currency.
+func (s PaymentService) ApplyPromoCode(ctx context.Context, promoCodeID int64, customer *database.Customer, tariff *database.Tariff, invoiceType database.InvoiceType) (*Discount, error) {
+	promo, err := s.promoCodeRepository.FindById(ctx, promoCodeID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPromoCode(ctx, promo, customer, tariff); err != nil {
+		return nil, err
+	}
+	if !promo.AllowsInvoiceType(invoiceType) {
+		return nil, ErrPromoCodeNotApplicable
+	}
+
+	// Fixed discounts are set in RUB and are converted with the ratio of the tariff prices.
+	discount := calculateDiscount(promo, tariff.Price(invoiceType), tariff.PriceRub)
+	slog.Info("promo code applied", "promo_code_id", promo.ID, "customer_id", utils.MaskHalfInt64(customer.ID), "discount", discount.Amount, "bonus_days", discount.BonusDays)
+	return discount, nil
+}
+
+func (s PaymentService) checkPromoCode(ctx context.Context, promo *database.PromoCode, customer *database.Customer, tariff *database.Tariff) error {
+	if err := validatePromoCode(promo, tariff.ID, time.Now()); err != nil {
+		return err
+	}
+
+	total, byCustomer, err := s.promoCodeRepository.CountUses(ctx, promo.ID, customer.ID)
+	if err != nil {
+		return err
+	}
+	if promo.MaxUses != nil && total >= *promo.MaxUses {
+		return database.ErrPromoCodeLimitReached
+	}
+	if promo.MaxUsesPerCustomer > 0 && byCustomer >= promo.MaxUsesPerCustomer {
+		return database.ErrPromoCodeCustomerLimitReached
+	}
+	return nil
+}
+
+func validatePromoCode(promo *database.PromoCode, tariffID int64, now time.Time) error {
+	if promo == nil || !promo.Active {
+		return ErrPromoCodeNotFound
+	}
+	if promo.ExpiresAt != nil && !now.Before(*promo.ExpiresAt) {
+		return ErrPromoCodeExpired
+	}
+	if !promo.AllowsTariff(tariffID) {
+		return ErrPromoCodeNotApplicable
+	}
+	return nil
+}
+
+// calculateDiscount never discounts the price below 1 because payment providers reject free invoices.
+func calculateDiscount(promo *database.PromoCode, price int, basePrice int) *Discount {
+	discount := &Discount{PromoCodeID: promo.ID}
+
+	switch promo.Type {
+	case database.PromoCodeTypePercent:
+		discount.Amount = price * promo.Value / 100
+	case database.PromoCodeTypeFixed:
+		discount.Amount = promo.Value
+		if basePrice > 0 && basePrice != price {
+			discount.Amount = promo.Value * price / basePrice
+		}
+	case database.PromoCodeTypeDays:
+		discount.BonusDays = promo.Value
+	}
+
+	if discount.Amount > price-1 {
+		discount.Amount = price - 1
+	}
+	if discount.Amount < 0 {
+		discount.Amount = 0
+	}
+	return discount
+}
+
+// alertPromoLimitExceeded tells staff that a purchase was paid although its promo code had no uses left,
+// so they can decide whether to refund it.
+func (s PaymentService) alertPromoLimitExceeded(ctx context.Context, purchase *database.Purchase) {
+	slog.Warn("purchase paid over promo code limit", "purchase_id", utils.MaskHalfInt64(purchase.ID), "promo_code_id", *purchase.PromoCodeID)
+	err := s.staffService.Notify(ctx, staff.PermissionPromo, fmt.Sprintf(s.translation.GetText(config.DefaultLanguage(), "promo_limit_exceeded_alert"), purchase.ID, *purchase.PromoCodeID, purchase.ID))
+	if err != nil {
+		slog.Error("Error sending promo code limit alert", "purchase_id", utils.MaskHalfInt64(purchase.ID), "error", err)
+	}
+}
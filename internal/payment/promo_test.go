@@ -0,0 +1,74 @@
+package payment
+
+import (
+	"errors"
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+	"time"
+)
+
+func TestCalculateDiscount(t *testing.T) {
+	tests := []struct {
+		name      string
+		promo     database.PromoCode
+		price     int
+		basePrice int
+		amount    int
+		bonusDays int
+	}{
+		{name: "percent", promo: database.PromoCode{Type: database.PromoCodeTypePercent, Value: 20}, price: 300, basePrice: 300, amount: 60},
+		{name: "fixed", promo: database.PromoCode{Type: database.PromoCodeTypeFixed, Value: 50}, price: 300, basePrice: 300, amount: 50},
+		{name: "fixed in stars", promo: database.PromoCode{Type: database.PromoCodeTypeFixed, Value: 100}, price: 150, basePrice: 300, amount: 50},
+		{name: "fixed above price", promo: database.PromoCode{Type: database.PromoCodeTypeFixed, Value: 500}, price: 300, basePrice: 300, amount: 299},
+		{name: "days", promo: database.PromoCode{Type: database.PromoCodeTypeDays, Value: 7}, price: 300, basePrice: 300, bonusDays: 7},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			discount := calculateDiscount(&tt.promo, tt.price, tt.basePrice)
+			if discount.Amount != tt.amount || discount.BonusDays != tt.bonusDays {
+				t.Fatalf("want amount %d and %d bonus days, got %d and %d", tt.amount, tt.bonusDays, discount.Amount, discount.BonusDays)
+			}
+		})
+	}
+}
+
+func TestValidatePromoCode(t *testing.T) {
+	now := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		promo  *database.PromoCode
+		tariff int64
+		want   error
+	}{
+		{name: "missing", promo: nil, tariff: 1, want: ErrPromoCodeNotFound},
+		{name: "inactive", promo: &database.PromoCode{Active: false}, tariff: 1, want: ErrPromoCodeNotFound},
+		{name: "expired", promo: &database.PromoCode{Active: true, ExpiresAt: &past}, tariff: 1, want: ErrPromoCodeExpired},
+		{name: "other tariff", promo: &database.PromoCode{Active: true, TariffIDs: []int64{3, 6}}, tariff: 1, want: ErrPromoCodeNotApplicable},
+		{name: "valid", promo: &database.PromoCode{Active: true, ExpiresAt: &future, TariffIDs: []int64{1}}, tariff: 1, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePromoCode(tt.promo, tt.tariff, now); !errors.Is(err, tt.want) {
+				t.Fatalf("want %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestDiscountApplyTo(t *testing.T) {
+	var none *Discount
+	purchase := none.applyTo(&database.Purchase{Amount: 300})
+	if purchase.PromoCodeID != nil || purchase.DiscountAmount != 0 {
+		t.Fatalf("nil discount changed the purchase: %+v", purchase)
+	}
+
+	purchase = (&Discount{PromoCodeID: 4, Amount: 60, BonusDays: 3}).applyTo(&database.Purchase{Amount: 240})
+	if purchase.PromoCodeID == nil || *purchase.PromoCodeID != 4 || purchase.DiscountAmount != 60 || purchase.BonusDays != 3 {
+		t.Fatalf("discount not recorded on purchase: %+v", purchase)
+	}
+}
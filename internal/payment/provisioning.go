@@ -0,0 +1,112 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/staff"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+)
+
+// Provisioning jobs and Moynalog receipts are retried in the background with the same schedule.
+const (
+	retryBaseDelay = time.Minute
+	retryMaxDelay  = time.Hour
+	// retryAlertAttempts is the number of failed attempts after which the admin is alerted.
+	retryAlertAttempts = 5
+	retryBatchSize     = 20
+)
+
+// retryBackoff is the delay before the next attempt after the given number of failed ones.
+func retryBackoff(attempts int) time.Duration {
+	if attempts < 1 {
+		return retryBaseDelay
+	}
+	if attempts > 10 {
+		return retryMaxDelay
+	}
+	return min(retryBaseDelay*time.Duration(1<<(attempts-1)), retryMaxDelay)
+}
+
+func (s PaymentService) recordProvisioningFailure(ctx context.Context, purchaseId int64, cause error) {
+	job, err := s.provisioningJobRepository.FindByPurchaseID(ctx, purchaseId)
+	if err != nil || job == nil {
+		if err != nil {
+			slog.Error("Error finding provisioning job", "purchase_id", utils.MaskHalfInt64(purchaseId), "error", err)
+		}
+		return
+	}
+
+	job, err = s.provisioningJobRepository.RecordFailure(ctx, purchaseId, cause.Error(), time.Now().Add(retryBackoff(job.Attempts+1)))
+	if err != nil {
+		slog.Error("Error recording provisioning failure", "purchase_id", utils.MaskHalfInt64(purchaseId), "error", err)
+		return
+	}
+	if job == nil {
+		return
+	}
+	slog.Warn("provisioning failed", "purchase_id", utils.MaskHalfInt64(purchaseId), "attempts", job.Attempts, "next_attempt_at", job.NextAttemptAt, "error", cause)
+
+	if job.Attempts < retryAlertAttempts || job.AlertedAt != nil {
+		return
+	}
+
+	err = s.staffService.Notify(ctx, staff.PermissionProvisioning, fmt.Sprintf(s.translation.GetText(config.DefaultLanguage(), "provisioning_alert"), purchaseId, job.Attempts, cause.Error(), purchaseId))
+	if err != nil {
+		slog.Error("Error sending provisioning alert", "purchase_id", utils.MaskHalfInt64(purchaseId), "error", err)
+		return
+	}
+	if err := s.provisioningJobRepository.MarkAlerted(ctx, purchaseId); err != nil {
+		slog.Error("Error marking provisioning job alerted", "purchase_id", utils.MaskHalfInt64(purchaseId), "error", err)
+	}
+}
+
+// RetryProvisioning re-drives the queued purchases whose next attempt is due.
+func (s PaymentService) RetryProvisioning(ctx context.Context) {
+	jobs, err := s.provisioningJobRepository.FindDue(ctx, time.Now(), retryBatchSize)
+	if err != nil {
+		slog.Error("Error finding due provisioning jobs", "error", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if err := s.retryProvisioningJob(ctx, &job); err != nil {
+			slog.Error("Error retrying provisioning", "purchase_id", utils.MaskHalfInt64(job.PurchaseID), "error", err)
+		}
+	}
+}
+
+// RetryProvisioningNow re-drives one queued purchase right away, regardless of its backoff.
+func (s PaymentService) RetryProvisioningNow(ctx context.Context, purchaseId int64) error {
+	job, err := s.provisioningJobRepository.FindByPurchaseID(ctx, purchaseId)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return fmt.Errorf("purchase %d is not waiting for provisioning", purchaseId)
+	}
+	return s.retryProvisioningJob(ctx, job)
+}
+
+func (s PaymentService) retryProvisioningJob(ctx context.Context, job *database.ProvisioningJob) error {
+	if job.Username != nil {
+		ctx = context.WithValue(ctx, "username", *job.Username)
+	}
+	if err := s.ProcessPurchaseById(ctx, job.PurchaseID); err != nil {
+		return err
+	}
+
+	// A completed purchase has already left the queue. Drop jobs of purchases that were cancelled or refunded
+	// meanwhile, and wait for a purchase another call is still processing.
+	purchase, err := s.purchaseRepository.FindById(ctx, job.PurchaseID)
+	if err != nil {
+		return err
+	}
+	if purchase != nil && purchase.Status == database.PurchaseStatusProcessing {
+		return s.provisioningJobRepository.Postpone(ctx, job.PurchaseID, time.Now().Add(retryBaseDelay))
+	}
+	return s.provisioningJobRepository.Delete(ctx, job.PurchaseID)
+}
@@ -0,0 +1,22 @@
+package payment
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	tests := map[int]time.Duration{
+		0:   time.Minute,
+		1:   time.Minute,
+		2:   2 * time.Minute,
+		4:   8 * time.Minute,
+		7:   time.Hour,
+		100: time.Hour,
+	}
+	for attempts, want := range tests {
+		if got := retryBackoff(attempts); got != want {
+			t.Fatalf("attempts %d: want %v, got %v", attempts, want, got)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/moynalog"
+	"remnawave-tg-shop-bot/internal/staff"
+	"remnawave-tg-shop-bot/utils"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// receiptComment fills the receipt comment template. It supports {tariff}, {days}, {months} and {purchase_id}.
+func receiptComment(template string, purchase *database.Purchase, tariffName string, days int) string {
+	return strings.NewReplacer(
+		"{tariff}", tariffName,
+		"{days}", strconv.Itoa(days),
+		"{months}", strconv.Itoa(purchase.Month),
+		"{purchase_id}", strconv.FormatInt(purchase.ID, 10),
+	).Replace(template)
+}
+
+// receiptAmount is the purchase amount in RUB. Stars are converted with MOYNALOG_STARS_RATE or, when it is
+// not set, with the RUB price of the tariff, so a promo code discount is kept.
+func receiptAmount(purchase *database.Purchase, tariff *database.Tariff, starsRate float64) (float64, error) {
+	switch purchase.Currency {
+	case "RUB":
+		return purchase.Amount, nil
+	case "STARS":
+	default:
+		return 0, fmt.Errorf("unsupported receipt currency %q", purchase.Currency)
+	}
+
+	var amount float64
+	switch {
+	case starsRate > 0:
+		amount = purchase.Amount * starsRate
+	case tariff != nil && tariff.PriceRub > 0 && tariff.PriceStars > 0:
+		amount = purchase.Amount * float64(tariff.PriceRub) / float64(tariff.PriceStars)
+	default:
+		return 0, errors.New("no RUB price to convert Stars, set MOYNALOG_STARS_RATE")
+	}
+	return math.Round(amount*100) / 100, nil
+}
+
+// draftReceipt prepares the Moynalog receipt of the purchase, nil when receipts are not issued for it. A receipt
+// that cannot be prepared is reported to the staff, since it will not be queued.
+func (s PaymentService) draftReceipt(ctx context.Context, purchase *database.Purchase) *database.Receipt {
+	if s.moynalogClient == nil || !config.IsMoynalogReceiptEnabled(string(purchase.InvoiceType)) {
+		return nil
+	}
+
+	amount, comment, err := s.prepareReceipt(ctx, purchase)
+	if err != nil {
+		slog.Error("Error preparing Moynalog receipt", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		err = s.staffService.Notify(ctx, staff.PermissionReceipts, fmt.Sprintf(s.translation.GetText(config.DefaultLanguage(), "receipt_prepare_alert"), purchase.ID, err.Error()))
+		if err != nil {
+			slog.Error("Error sending Moynalog receipt alert", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		}
+		return nil
+	}
+	return &database.Receipt{PurchaseID: purchase.ID, Amount: amount, Comment: comment}
+}
+
+// issueReceipt tries to send the receipt queued with the paid purchase right away. If Moynalog fails,
+// ProcessReceipts retries it.
+func (s PaymentService) issueReceipt(purchaseId int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	s.processPurchaseReceipt(ctx, purchaseId)
+}
+
+// prepareReceipt returns the RUB amount and the comment of the purchase receipt.
+func (s PaymentService) prepareReceipt(ctx context.Context, purchase *database.Purchase) (float64, string, error) {
+	var tariff *database.Tariff
+	if purchase.TariffID != nil {
+		var err error
+		tariff, err = s.tariffRepository.FindById(ctx, *purchase.TariffID)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	amount, err := receiptAmount(purchase, tariff, config.MoynalogStarsRate())
+	if err != nil {
+		return 0, "", err
+	}
+
+	template := config.MoynalogReceiptComment()
+	tariffName := ""
+	days := purchase.Month*config.DaysInMonth() + purchase.BonusDays
+	if tariff != nil {
+		if tariff.ReceiptComment != nil {
+			template = *tariff.ReceiptComment
+		}
+		tariffName = s.translation.GetText(config.DefaultLanguage(), tariff.Name)
+		days = tariff.DurationDays + purchase.BonusDays
+	}
+	return amount, receiptComment(template, purchase, tariffName, days), nil
+}
+
+// cancelReceipt asks for the Moynalog receipt of the purchase to be cancelled and tries to cancel it right away.
+// It reports whether the receipt is cancelled already; otherwise ProcessReceipts retries it.
+func (s PaymentService) cancelReceipt(ctx context.Context, purchaseId int64) bool {
+	requested, err := s.receiptRepository.RequestCancel(ctx, purchaseId)
+	if err != nil {
+		slog.Error("Error requesting Moynalog receipt cancellation", "error", err, "purchase_id", utils.MaskHalfInt64(purchaseId))
+		return false
+	}
+	if !requested || s.moynalogClient == nil {
+		return false
+	}
+	return s.processPurchaseReceipt(ctx, purchaseId)
+}
+
+// ProcessReceipts sends and cancels the Moynalog receipts whose next attempt is due.
+func (s PaymentService) ProcessReceipts(ctx context.Context) {
+	receipts, err := s.receiptRepository.ClaimDue(ctx, retryBatchSize)
+	if err != nil {
+		slog.Error("Error claiming Moynalog receipts", "error", err)
+		return
+	}
+
+	for _, receipt := range receipts {
+		_ = s.processReceipt(ctx, &receipt)
+	}
+}
+
+func (s PaymentService) processPurchaseReceipt(ctx context.Context, purchaseId int64) bool {
+	receipt, err := s.receiptRepository.ClaimByPurchaseID(ctx, purchaseId)
+	if err != nil {
+		slog.Error("Error claiming Moynalog receipt", "error", err, "purchase_id", utils.MaskHalfInt64(purchaseId))
+		return false
+	}
+	if receipt == nil {
+		return false
+	}
+	return s.processReceipt(ctx, receipt) == nil
+}
+
+func (s PaymentService) processReceipt(ctx context.Context, receipt *database.Receipt) error {
+	var err error
+	switch receipt.Status {
+	case database.ReceiptStatusPending:
+		err = s.sendReceipt(ctx, receipt)
+	case database.ReceiptStatusCancelPending:
+		err = s.cancelSentReceipt(ctx, receipt)
+	default:
+		return nil
+	}
+
+	if err != nil {
+		s.recordReceiptFailure(ctx, receipt, err)
+	}
+	return err
+}
+
+func (s PaymentService) sendReceipt(ctx context.Context, receipt *database.Receipt) error {
+	income, err := s.moynalogClient.CreateIncome(ctx, receipt.Amount, receipt.Comment)
+	if err != nil {
+		return fmt.Errorf("failed to create income in Moynalog: %w", err)
+	}
+
+	if err := s.receiptRepository.MarkSent(ctx, receipt.ID, income.ReceiptUUID()); err != nil {
+		// Retrying would issue a second receipt, so only log it.
+		slog.Error("Error saving sent Moynalog receipt", "error", err, "purchase_id", utils.MaskHalfInt64(receipt.PurchaseID), "receipt_uuid", income.ReceiptUUID())
+		return nil
+	}
+
+	slog.Info("Receipt sent to Moynalog", "purchase_id", utils.MaskHalfInt64(receipt.PurchaseID), "amount", receipt.Amount, "comment", receipt.Comment)
+	return nil
+}
+
+func (s PaymentService) cancelSentReceipt(ctx context.Context, receipt *database.Receipt) error {
+	if receipt.ReceiptUUID == nil || *receipt.ReceiptUUID == "" {
+		if receipt.SentAt != nil {
+			slog.Error("Moynalog receipt has no UUID, cancel it manually", "purchase_id", utils.MaskHalfInt64(receipt.PurchaseID))
+		}
+		return s.receiptRepository.MarkCancelled(ctx, receipt.ID)
+	}
+
+	if err := s.moynalogClient.CancelIncome(ctx, *receipt.ReceiptUUID, moynalog.CancelReasonRefund); err != nil {
+		return fmt.Errorf("failed to cancel income in Moynalog: %w", err)
+	}
+	if err := s.receiptRepository.MarkCancelled(ctx, receipt.ID); err != nil {
+		return err
+	}
+
+	slog.Info("Receipt cancelled in Moynalog", "purchase_id", utils.MaskHalfInt64(receipt.PurchaseID))
+	return nil
+}
+
+func (s PaymentService) recordReceiptFailure(ctx context.Context, receipt *database.Receipt, cause error) {
+	attempts := receipt.Attempts + 1
+	slog.Error("Moynalog receipt failed", "error", cause, "purchase_id", utils.MaskHalfInt64(receipt.PurchaseID), "status", receipt.Status, "attempts", attempts)
+
+	if err := s.receiptRepository.RecordFailure(ctx, receipt.ID, cause.Error(), time.Now().Add(retryBackoff(attempts))); err != nil {
+		slog.Error("Error recording Moynalog receipt failure", "error", err, "purchase_id", utils.MaskHalfInt64(receipt.PurchaseID))
+		return
+	}
+	if attempts < retryAlertAttempts || receipt.AlertedAt != nil {
+		return
+	}
+
+	key := "receipt_send_alert"
+	if receipt.Status == database.ReceiptStatusCancelPending {
+		key = "receipt_cancel_alert"
+	}
+	err := s.staffService.Notify(ctx, staff.PermissionReceipts, fmt.Sprintf(s.translation.GetText(config.DefaultLanguage(), key), receipt.PurchaseID, attempts, cause.Error()))
+	if err != nil {
+		slog.Error("Error sending Moynalog receipt alert", "error", err, "purchase_id", utils.MaskHalfInt64(receipt.PurchaseID))
+		return
+	}
+	if err := s.receiptRepository.MarkAlerted(ctx, receipt.ID); err != nil {
+		slog.Error("Error marking Moynalog receipt alerted", "error", err, "purchase_id", utils.MaskHalfInt64(receipt.PurchaseID))
+	}
+}
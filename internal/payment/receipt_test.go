@@ -0,0 +1,58 @@
+package payment
+
+import (
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+)
+
+func TestReceiptComment(t *testing.T) {
+	purchase := &database.Purchase{ID: 42, Month: 3}
+
+	tests := map[string]string{
+		"Подписка на {days} дн.":                 "Подписка на 97 дн.",
+		"Подписка «{tariff}»":                    "Подписка «3 месяца»",
+		"VPN {months} мес., заказ {purchase_id}": "VPN 3 мес., заказ 42",
+		"Подписка":                               "Подписка",
+	}
+	for template, want := range tests {
+		if got := receiptComment(template, purchase, "3 месяца", 97); got != want {
+			t.Fatalf("template %q: want %q, got %q", template, want, got)
+		}
+	}
+}
+
+func TestReceiptAmount(t *testing.T) {
+	tariff := &database.Tariff{PriceRub: 300, PriceStars: 200}
+
+	tests := []struct {
+		name      string
+		purchase  database.Purchase
+		tariff    *database.Tariff
+		starsRate float64
+		want      float64
+		wantErr   bool
+	}{
+		{name: "rub", purchase: database.Purchase{Amount: 249.5, Currency: "RUB"}, want: 249.5},
+		{name: "stars by rate", purchase: database.Purchase{Amount: 200, Currency: "STARS"}, tariff: tariff, starsRate: 1.333, want: 266.6},
+		{name: "stars by tariff price", purchase: database.Purchase{Amount: 200, Currency: "STARS"}, tariff: tariff, want: 300},
+		{name: "discounted stars", purchase: database.Purchase{Amount: 150, Currency: "STARS"}, tariff: tariff, want: 225},
+		{name: "stars without rate", purchase: database.Purchase{Amount: 200, Currency: "STARS"}, wantErr: true},
+		{name: "stars without rub price", purchase: database.Purchase{Amount: 200, Currency: "STARS"}, tariff: &database.Tariff{PriceStars: 200}, wantErr: true},
+		{name: "unknown currency", purchase: database.Purchase{Amount: 5, Currency: "USDT"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := receiptAmount(&tt.purchase, tt.tariff, tt.starsRate)
+		if tt.wantErr {
+			if err == nil {
+				t.Fatalf("%s: want error, got %v", tt.name, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Fatalf("%s: want %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/utils"
+	"slices"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// referralRules are the referral settings applied to a paid purchase of an invited customer.
+type referralRules struct {
+	// referrerDays is granted to the referrer unless referrerPercent of the purchased days is configured.
+	referrerDays    int
+	referrerPercent int
+	refereeDays     int
+	// recurring rewards the referrer for every paid purchase instead of only the first one.
+	recurring bool
+	tiers     []config.ReferralTier
+}
+
+func currentReferralRules() referralRules {
+	return referralRules{
+		referrerDays:    config.GetReferralDays(),
+		referrerPercent: config.ReferralPercent(),
+		refereeDays:     config.ReferralRefereeDays(),
+		recurring:       config.IsReferralRecurring(),
+		tiers:           config.ReferralTiers(),
+	}
+}
+
+// referralState is what the ledger knows about the referral when the purchase is paid.
+type referralState struct {
+	// referrerRewarded and refereeRewarded are set when another purchase of the referee already earned that reward.
+	referrerRewarded bool
+	refereeRewarded  bool
+	// payingReferrals includes the referee of this purchase.
+	payingReferrals int
+	rewardedTiers   []int
+}
+
+func (r referralRules) referrerRewardDays(purchaseDays int) int {
+	if r.referrerPercent > 0 {
+		return purchaseDays * r.referrerPercent / 100
+	}
+	return r.referrerDays
+}
+
+// referralRewards returns the rewards earned by a paid purchase of purchaseDays days made by the referee.
+func referralRewards(rules referralRules, referral *database.Referral, purchaseID int64, purchaseDays int, state referralState) []database.ReferralReward {
+	var rewards []database.ReferralReward
+
+	if days := rules.referrerRewardDays(purchaseDays); days > 0 && (rules.recurring || !state.referrerRewarded) {
+		rewards = append(rewards, database.ReferralReward{
+			ReferralID:          &referral.ID,
+			RecipientTelegramID: referral.ReferrerID,
+			Kind:                database.ReferralRewardReferrer,
+			PurchaseID:          &purchaseID,
+			Days:                days,
+		})
+	}
+
+	if rules.refereeDays > 0 && !state.refereeRewarded {
+		rewards = append(rewards, database.ReferralReward{
+			ReferralID:          &referral.ID,
+			RecipientTelegramID: referral.RefereeID,
+			Kind:                database.ReferralRewardReferee,
+			PurchaseID:          &purchaseID,
+			Days:                rules.refereeDays,
+		})
+	}
+
+	for _, tier := range rules.tiers {
+		if tier.Referrals > state.payingReferrals || slices.Contains(state.rewardedTiers, tier.Referrals) {
+			continue
+		}
+		rewards = append(rewards, database.ReferralReward{
+			ReferralID:          &referral.ID,
+			RecipientTelegramID: referral.ReferrerID,
+			Kind:                database.ReferralRewardTier,
+			Days:                tier.Days,
+			Tier:                &tier.Referrals,
+		})
+	}
+	return rewards
+}
+
+// grantReferralRewards grants the rewards earned by a paid purchase of an invited customer.
+func (s PaymentService) grantReferralRewards(ctx context.Context, customer *database.Customer, purchase *database.Purchase) error {
+	referral, err := s.referralRepository.FindByReferee(ctx, customer.TelegramID)
+	if err != nil || referral == nil {
+		return err
+	}
+	if referral.RewardsWithheld() {
+		slog.Info("referral rewards withheld", "referral_id", referral.ID, "status", referral.Status, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		return nil
+	}
+	return s.grantPurchaseReferralRewards(ctx, referral, purchase)
+}
+
+// GrantApprovedReferralRewards grants the rewards withheld while the referral was flagged for the referee's latest
+// paid purchase. Earlier purchases made during the review are not rewarded.
+func (s PaymentService) GrantApprovedReferralRewards(ctx context.Context, referral *database.Referral) error {
+	customer, err := s.customerRepository.FindByTelegramId(ctx, referral.RefereeID)
+	if err != nil || customer == nil {
+		return err
+	}
+	purchase, err := s.purchaseRepository.FindLatestPaidByCustomer(ctx, customer.ID)
+	if err != nil || purchase == nil {
+		return err
+	}
+	return s.grantPurchaseReferralRewards(ctx, referral, purchase)
+}
+
+func (s PaymentService) grantPurchaseReferralRewards(ctx context.Context, referral *database.Referral, purchase *database.Purchase) error {
+	rules := currentReferralRules()
+	_, purchaseDays, err := purchasePlan(ctx, s.tariffRepository, purchase)
+	if err != nil {
+		return err
+	}
+
+	var state referralState
+	if state.referrerRewarded, err = s.referralRepository.HasReward(ctx, referral.ID, database.ReferralRewardReferrer, purchase.ID); err != nil {
+		return err
+	}
+	if state.refereeRewarded, err = s.referralRepository.HasReward(ctx, referral.ID, database.ReferralRewardReferee, purchase.ID); err != nil {
+		return err
+	}
+	if len(rules.tiers) > 0 {
+		if state.payingReferrals, err = s.referralRepository.CountPayingReferrals(ctx, referral.ReferrerID); err != nil {
+			return err
+		}
+		if state.rewardedTiers, err = s.referralRepository.FindRewardedTiers(ctx, referral.ReferrerID); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for _, reward := range referralRewards(rules, referral, purchase.ID, purchaseDays, state) {
+		if err := s.grantReferralReward(ctx, &reward); err != nil {
+			errs = append(errs, fmt.Errorf("%s reward: %w", reward.Kind, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// grantReferralReward records the reward in the ledger before adding the days, and removes it again if Remnawave
+// could not be updated, so the ledger only holds granted rewards.
+func (s PaymentService) grantReferralReward(ctx context.Context, reward *database.ReferralReward) error {
+	recipient, err := s.customerRepository.FindByTelegramId(ctx, reward.RecipientTelegramID)
+	if err != nil {
+		return err
+	}
+	if recipient == nil {
+		slog.Info("referral reward recipient not found", "kind", reward.Kind, "telegramId", utils.MaskHalfInt64(reward.RecipientTelegramID))
+		return nil
+	}
+
+	created, err := s.referralRepository.CreateReward(ctx, reward)
+	if err != nil || !created {
+		return err
+	}
+
+	user, err := s.remnawaveClient.AddDays(ctx, recipient.ID, recipient.TelegramID, reward.Days)
+	if err != nil {
+		if err := s.referralRepository.DeleteReward(ctx, reward.ID); err != nil {
+			slog.Error("Error deleting referral reward", "reward_id", reward.ID, "error", err)
+		}
+		return err
+	}
+	err = s.customerRepository.UpdateFields(ctx, recipient.ID, map[string]interface{}{
+		"subscription_link": user.GetSubscriptionUrl(),
+		"expire_at":         user.GetExpireAt(),
+	})
+	if err != nil {
+		return err
+	}
+	metrics.ReferralBonuses.WithLabelValues(string(reward.Kind)).Inc()
+	slog.Info("Granted referral reward", "kind", reward.Kind, "days", reward.Days, "customer_id", utils.MaskHalfInt64(recipient.ID))
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    recipient.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      s.referralRewardText(recipient.Language, reward),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: s.createConnectKeyboard(recipient),
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending referral reward message", "customer_id", utils.MaskHalfInt64(recipient.ID), "error", err)
+	}
+	return nil
+}
+
+func (s PaymentService) referralRewardText(language string, reward *database.ReferralReward) string {
+	switch reward.Kind {
+	case database.ReferralRewardReferee:
+		return fmt.Sprintf(s.translation.GetText(language, "referral_reward_referee"), reward.Days)
+	case database.ReferralRewardTier:
+		return fmt.Sprintf(s.translation.GetText(language, "referral_reward_tier"), *reward.Tier, reward.Days)
+	default:
+		return fmt.Sprintf(s.translation.GetText(language, "referral_reward_referrer"), reward.Days)
+	}
+}
@@ -0,0 +1,71 @@
+package payment
+
+import (
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+)
+
+func rewardKinds(rewards []database.ReferralReward) []database.ReferralRewardKind {
+	kinds := make([]database.ReferralRewardKind, 0, len(rewards))
+	for _, r := range rewards {
+		kinds = append(kinds, r.Kind)
+	}
+	return kinds
+}
+
+func TestReferralRewardsFirstPurchase(t *testing.T) {
+	referral := &database.Referral{ID: 1, ReferrerID: 100, RefereeID: 200}
+	rules := referralRules{referrerDays: 7, refereeDays: 3}
+
+	rewards := referralRewards(rules, referral, 5, 30, referralState{payingReferrals: 1})
+	if len(rewards) != 2 {
+		t.Fatalf("want referrer and referee rewards, got %v", rewardKinds(rewards))
+	}
+	if r := rewards[0]; r.Kind != database.ReferralRewardReferrer || r.RecipientTelegramID != 100 || r.Days != 7 || *r.PurchaseID != 5 {
+		t.Fatalf("unexpected referrer reward: %+v", r)
+	}
+	if r := rewards[1]; r.Kind != database.ReferralRewardReferee || r.RecipientTelegramID != 200 || r.Days != 3 {
+		t.Fatalf("unexpected referee reward: %+v", r)
+	}
+}
+
+func TestReferralRewardsRepeatPurchase(t *testing.T) {
+	referral := &database.Referral{ID: 1, ReferrerID: 100, RefereeID: 200}
+	state := referralState{referrerRewarded: true, refereeRewarded: true, payingReferrals: 1}
+
+	if rewards := referralRewards(referralRules{referrerDays: 7, refereeDays: 3}, referral, 6, 30, state); len(rewards) != 0 {
+		t.Fatalf("want no rewards for a repeat purchase, got %v", rewardKinds(rewards))
+	}
+
+	rewards := referralRewards(referralRules{referrerDays: 7, refereeDays: 3, recurring: true}, referral, 6, 30, state)
+	if len(rewards) != 1 || rewards[0].Kind != database.ReferralRewardReferrer {
+		t.Fatalf("want a recurring referrer reward only, got %v", rewardKinds(rewards))
+	}
+}
+
+func TestReferralRewardsPercent(t *testing.T) {
+	referral := &database.Referral{ID: 1, ReferrerID: 100, RefereeID: 200}
+
+	rewards := referralRewards(referralRules{referrerDays: 7, referrerPercent: 10}, referral, 5, 95, referralState{})
+	if len(rewards) != 1 || rewards[0].Days != 9 {
+		t.Fatalf("want 10%% of 95 days rounded down, got %+v", rewards)
+	}
+
+	if rewards := referralRewards(referralRules{referrerPercent: 10}, referral, 5, 7, referralState{}); len(rewards) != 0 {
+		t.Fatalf("want no reward below one day, got %+v", rewards)
+	}
+}
+
+func TestReferralRewardsTiers(t *testing.T) {
+	referral := &database.Referral{ID: 1, ReferrerID: 100, RefereeID: 200}
+	rules := referralRules{tiers: []config.ReferralTier{{Referrals: 1, Days: 2}, {Referrals: 5, Days: 7}, {Referrals: 10, Days: 14}}}
+
+	rewards := referralRewards(rules, referral, 5, 30, referralState{payingReferrals: 5, rewardedTiers: []int{1}})
+	if len(rewards) != 1 {
+		t.Fatalf("want one tier reward, got %v", rewardKinds(rewards))
+	}
+	if r := rewards[0]; r.Kind != database.ReferralRewardTier || *r.Tier != 5 || r.Days != 7 || r.RecipientTelegramID != 100 || r.PurchaseID != nil {
+		t.Fatalf("unexpected tier reward: %+v", r)
+	}
+}
@@ -0,0 +1,251 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+	"strconv"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+var ErrPurchaseNotRefundable = errors.New("purchase cannot be refunded")
+
+// Refund describes a refund of one purchase.
+type Refund struct {
+	Purchase *database.Purchase
+	Customer *database.Customer
+	// UnusedDays is how many days are taken off the subscription.
+	UnusedDays int
+	// ExpireAt is the subscription expiration after the refund, nil until the subscription was shortened.
+	ExpireAt *time.Time
+	// Receipt is the Moynalog receipt of the purchase, nil if none was issued.
+	Receipt *database.Receipt
+	// ReceiptCancelled reports whether the receipt is already cancelled. Otherwise it is cancelled in the background.
+	ReceiptCancelled bool
+	// GiftCodeExpired reports whether the gift code of a gift purchase was expired. It stays false when the code
+	// was already redeemed.
+	GiftCodeExpired bool
+}
+
+// PrepareRefund checks that the purchase can be refunded and calculates the unused days without changing anything.
+func (s PaymentService) PrepareRefund(ctx context.Context, purchaseId int64) (*Refund, error) {
+	purchase, err := s.purchaseRepository.FindById(ctx, purchaseId)
+	if err != nil {
+		return nil, err
+	}
+	if purchase == nil {
+		return nil, fmt.Errorf("%w: purchase %d not found", ErrPurchaseNotRefundable, purchaseId)
+	}
+	if err := checkRefundable(purchase); err != nil {
+		return nil, err
+	}
+
+	customer, err := s.customerRepository.FindById(ctx, purchase.CustomerID)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		return nil, ErrCustomerNotFound
+	}
+
+	_, days, err := purchasePlan(ctx, s.tariffRepository, purchase)
+	if err != nil {
+		return nil, err
+	}
+
+	receipt, err := s.receiptRepository.FindByPurchaseID(ctx, purchase.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	refund := &Refund{Purchase: purchase, Customer: customer, Receipt: receipt}
+	// A gift did not extend the buyer's subscription; its code is expired instead.
+	if !purchase.Gift {
+		refund.UnusedDays = unusedDays(purchase, days, time.Now())
+	}
+	return refund, nil
+}
+
+// RefundPurchase returns the money through the payment provider, takes the unused days off the subscription
+// and cancels the Moynalog receipt. The purchase is marked refunded first, so it cannot be refunded twice.
+func (s PaymentService) RefundPurchase(ctx context.Context, purchaseId int64) (*Refund, error) {
+	refund, err := s.PrepareRefund(ctx, purchaseId)
+	if err != nil {
+		return nil, err
+	}
+	purchase, customer := refund.Purchase, refund.Customer
+
+	marked, err := s.purchaseRepository.MarkRefunded(ctx, purchase.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, fmt.Errorf("%w: purchase %d is no longer paid", ErrPurchaseNotRefundable, purchase.ID)
+	}
+
+	if err := s.refundPayment(ctx, purchase, customer); err != nil {
+		if revertErr := s.purchaseRepository.RevertRefund(ctx, purchase.ID); revertErr != nil {
+			slog.Error("Error reverting refund status", "error", revertErr, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+		}
+		return nil, err
+	}
+	slog.Info("purchase refunded", "purchase_id", utils.MaskHalfInt64(purchase.ID), "type", purchase.InvoiceType, "amount", purchase.Amount, "unused_days", refund.UnusedDays)
+
+	if err := s.rollbackRefund(ctx, refund); err != nil {
+		return refund, err
+	}
+	return refund, nil
+}
+
+// rollbackRefund takes back what a refunded purchase granted: the unused days are taken off the subscription, the
+// gift code is expired and the Moynalog receipt cancelled. The purchase must already be marked refunded.
+func (s PaymentService) rollbackRefund(ctx context.Context, refund *Refund) error {
+	purchase, customer := refund.Purchase, refund.Customer
+
+	if refund.UnusedDays > 0 {
+		expireAt, err := s.remnawaveClient.DecreaseSubscription(ctx, customer.TelegramID, -refund.UnusedDays)
+		if err != nil {
+			return fmt.Errorf("payment refunded, but the subscription was not shortened: %w", err)
+		}
+		if err := s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+			"expire_at": expireAt,
+		}); err != nil {
+			return err
+		}
+		refund.ExpireAt = expireAt
+	}
+
+	if purchase.Gift {
+		var err error
+		refund.GiftCodeExpired, err = s.giftCodeRepository.ExpireByPurchaseID(ctx, purchase.ID)
+		if err != nil {
+			return fmt.Errorf("payment refunded, but the gift code was not expired: %w", err)
+		}
+	}
+
+	if refund.Receipt != nil {
+		refund.ReceiptCancelled = s.cancelReceipt(ctx, purchase.ID)
+	}
+
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      fmt.Sprintf(s.translation.GetText(customer.Language, "purchase_refunded"), purchase.Amount, purchase.Currency),
+	})
+	if err != nil {
+		slog.Error("Error sending refund message", "error", err, "purchase_id", utils.MaskHalfInt64(purchase.ID))
+	}
+	return nil
+}
+
+// refundYookasaPurchase marks a purchase refunded from the YooKassa dashboard and rolls it back like a refund made
+// from the bot. It returns nil when the purchase was refunded concurrently.
+func (s PaymentService) refundYookasaPurchase(ctx context.Context, purchaseId int64) (*Refund, error) {
+	refund, err := s.PrepareRefund(ctx, purchaseId)
+	if err != nil {
+		return nil, err
+	}
+
+	marked, err := s.purchaseRepository.MarkRefunded(ctx, purchaseId)
+	if err != nil {
+		return nil, err
+	}
+	if !marked {
+		return nil, nil
+	}
+	slog.Info("purchase refunded in YooKassa", "purchase_id", utils.MaskHalfInt64(purchaseId), "amount", refund.Purchase.Amount, "unused_days", refund.UnusedDays)
+
+	return refund, s.rollbackRefund(ctx, refund)
+}
+
+// isFullYookasaRefund reports whether the refunded amount covers the whole payment. YooKassa is charged the
+// purchase amount without kopecks.
+func isFullYookasaRefund(purchase *database.Purchase, refunded string) bool {
+	amount, err := strconv.ParseFloat(refunded, 64)
+	if err != nil {
+		return false
+	}
+	return int(amount) >= int(purchase.Amount)
+}
+
+func checkRefundable(purchase *database.Purchase) error {
+	if purchase.Status != database.PurchaseStatusPaid {
+		return fmt.Errorf("%w: purchase %d is %s", ErrPurchaseNotRefundable, purchase.ID, purchase.Status)
+	}
+
+	switch purchase.InvoiceType {
+	case database.InvoiceTypeYookasa:
+		if purchase.YookasaID == nil {
+			return fmt.Errorf("%w: purchase %d has no YooKassa payment", ErrPurchaseNotRefundable, purchase.ID)
+		}
+	case database.InvoiceTypeTelegram:
+		if purchase.TelegramChargeID == nil {
+			return fmt.Errorf("%w: purchase %d has no Telegram charge id", ErrPurchaseNotRefundable, purchase.ID)
+		}
+	default:
+		return fmt.Errorf("%w: %s payments are refunded outside the bot", ErrPurchaseNotRefundable, purchase.InvoiceType)
+	}
+	return nil
+}
+
+func (s PaymentService) refundPayment(ctx context.Context, purchase *database.Purchase, customer *database.Customer) error {
+	switch purchase.InvoiceType {
+	case database.InvoiceTypeYookasa:
+		_, days, err := purchasePlan(ctx, s.tariffRepository, purchase)
+		if err != nil {
+			return err
+		}
+		// The refund receipt repeats the payment receipt, which did not count bonus days.
+		refund, err := s.yookasaClient.RefundPayment(ctx, *purchase.YookasaID, int(math.Round(purchase.Amount)), days-purchase.BonusDays, purchase.ID)
+		if err != nil {
+			return err
+		}
+		if refund.IsCancelled() {
+			return fmt.Errorf("YooKassa cancelled refund %s", refund.ID)
+		}
+		return nil
+	case database.InvoiceTypeTelegram:
+		_, err := s.telegramBot.RefundStarPayment(ctx, &bot.RefundStarPaymentParams{
+			UserID:                  customer.TelegramID,
+			TelegramPaymentChargeID: *purchase.TelegramChargeID,
+		})
+		return err
+	default:
+		return fmt.Errorf("%w: %s payments are refunded outside the bot", ErrPurchaseNotRefundable, purchase.InvoiceType)
+	}
+}
+
+// unusedDays is the part of the purchase the customer has not used yet, rounded to whole days. A purchase
+// covers the time from its provisioning, or from the end of the subscription it extended, up to the
+// expiration it set. days is the length of the purchase and caps the result.
+func unusedDays(purchase *database.Purchase, days int, now time.Time) int {
+	start := now
+	if purchase.ProvisionedAt != nil {
+		start = *purchase.ProvisionedAt
+	} else if purchase.PaidAt != nil {
+		start = *purchase.PaidAt
+	}
+	if purchase.ProvisionBaseExpireAt != nil && purchase.ProvisionBaseExpireAt.After(start) {
+		start = *purchase.ProvisionBaseExpireAt
+	}
+
+	end := start.AddDate(0, 0, days)
+	if purchase.SubscriptionExpireAt != nil {
+		end = *purchase.SubscriptionExpireAt
+	}
+
+	if now.After(start) {
+		start = now
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return min(days, int(math.Round(end.Sub(start).Hours()/24)))
+}
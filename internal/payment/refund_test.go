@@ -0,0 +1,105 @@
+package payment
+
+import (
+	"errors"
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestUnusedDays(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	at := func(days int) *time.Time {
+		v := now.AddDate(0, 0, days)
+		return &v
+	}
+
+	tests := []struct {
+		name     string
+		purchase database.Purchase
+		want     int
+	}{
+		{
+			name:     "partly used",
+			purchase: database.Purchase{ProvisionedAt: at(-10), ProvisionBaseExpireAt: &noPanelUser, SubscriptionExpireAt: at(20)},
+			want:     20,
+		},
+		{
+			name:     "added after an active subscription",
+			purchase: database.Purchase{ProvisionedAt: at(-1), ProvisionBaseExpireAt: at(5), SubscriptionExpireAt: at(35)},
+			want:     30,
+		},
+		{
+			name:     "expired",
+			purchase: database.Purchase{ProvisionedAt: at(-40), ProvisionBaseExpireAt: &noPanelUser, SubscriptionExpireAt: at(-10)},
+			want:     0,
+		},
+		{
+			name:     "processed before provisioning was recorded",
+			purchase: database.Purchase{PaidAt: at(-5)},
+			want:     25,
+		},
+		{
+			name:     "capped by purchase length",
+			purchase: database.Purchase{ProvisionedAt: at(0), ProvisionBaseExpireAt: &noPanelUser, SubscriptionExpireAt: at(45)},
+			want:     30,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unusedDays(&tt.purchase, 30, now); got != tt.want {
+				t.Fatalf("want %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCheckRefundable(t *testing.T) {
+	paymentID := uuid.New()
+	chargeID := "charge"
+
+	tests := []struct {
+		name       string
+		purchase   database.Purchase
+		refundable bool
+	}{
+		{"yookasa", database.Purchase{Status: database.PurchaseStatusPaid, InvoiceType: database.InvoiceTypeYookasa, YookasaID: &paymentID}, true},
+		{"stars", database.Purchase{Status: database.PurchaseStatusPaid, InvoiceType: database.InvoiceTypeTelegram, TelegramChargeID: &chargeID}, true},
+		{"stars without charge id", database.Purchase{Status: database.PurchaseStatusPaid, InvoiceType: database.InvoiceTypeTelegram}, false},
+		{"crypto", database.Purchase{Status: database.PurchaseStatusPaid, InvoiceType: database.InvoiceTypeCrypto}, false},
+		{"already refunded", database.Purchase{Status: database.PurchaseStatusRefunded, InvoiceType: database.InvoiceTypeYookasa, YookasaID: &paymentID}, false},
+		{"pending", database.Purchase{Status: database.PurchaseStatusPending, InvoiceType: database.InvoiceTypeYookasa, YookasaID: &paymentID}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkRefundable(&tt.purchase)
+			if tt.refundable && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.refundable && !errors.Is(err, ErrPurchaseNotRefundable) {
+				t.Fatalf("want ErrPurchaseNotRefundable, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIsFullYookasaRefund(t *testing.T) {
+	purchase := &database.Purchase{Amount: 249.5}
+
+	tests := map[string]bool{
+		"249.00": true,
+		"250.00": true,
+		"100.00": false,
+		"":       false,
+		"abc":    false,
+	}
+	for refunded, want := range tests {
+		if got := isFullYookasaRefund(purchase, refunded); got != want {
+			t.Fatalf("isFullYookasaRefund(%q) = %v, want %v", refunded, got, want)
+		}
+	}
+}
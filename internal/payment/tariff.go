@@ -0,0 +1,127 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+
+	"github.com/google/uuid"
+)
+
+// tariffPlan converts the tariff settings to the Remnawave user settings.
+func tariffPlan(t *database.Tariff) remnawave.Plan {
+	plan := remnawave.Plan{
+		TrafficLimit:  t.TrafficLimitGB * config.BytesInGigabyte,
+		ResetStrategy: t.TrafficResetStrategy,
+		Tag:           config.RemnawaveTag(),
+	}
+
+	if len(t.InternalSquads) > 0 {
+		plan.InternalSquads = make(map[uuid.UUID]uuid.UUID, len(t.InternalSquads))
+		for _, s := range t.InternalSquads {
+			id, err := uuid.Parse(s)
+			if err != nil {
+				slog.Error("invalid internal squad in tariff", "tariff_id", t.ID, "squad", s)
+				continue
+			}
+			plan.InternalSquads[id] = id
+		}
+	}
+	if t.ExternalSquad != nil {
+		plan.ExternalSquad = *t.ExternalSquad
+	}
+	if t.DeviceLimit != nil {
+		plan.DeviceLimit = *t.DeviceLimit
+	}
+	return plan
+}
+
+// tariffMonths is the tariff duration in whole months, 0 for tariffs shorter than a month. It is stored on the
+// purchase for the {months} receipt placeholder and metrics; the purchase length always comes from DurationDays.
+func tariffMonths(t *database.Tariff) int {
+	return t.DurationDays / config.DaysInMonth()
+}
+
+// SeedTariffs fills an empty tariff catalogue with the plans set through PRICE_* and STARS_PRICE_*
+// so existing installations keep their prices after the upgrade.
+func SeedTariffs(ctx context.Context, repository *database.TariffRepository) error {
+	defaults := remnawave.DefaultPlan()
+
+	var squads []string
+	for id := range defaults.InternalSquads {
+		squads = append(squads, id.String())
+	}
+	var externalSquad *uuid.UUID
+	if defaults.ExternalSquad != uuid.Nil {
+		externalSquad = &defaults.ExternalSquad
+	}
+
+	var tariffs []database.Tariff
+	for i, price := range config.LegacyPrices() {
+		if price.Price <= 0 {
+			continue
+		}
+		tariffs = append(tariffs, database.Tariff{
+			Name:                 fmt.Sprintf("month_%d", price.Months),
+			DurationDays:         price.Months * config.DaysInMonth(),
+			PriceRub:             price.Price,
+			PriceStars:           price.StarsPrice,
+			PriceCrypto:          price.Price,
+			TrafficLimitGB:       defaults.TrafficLimit / config.BytesInGigabyte,
+			TrafficResetStrategy: defaults.ResetStrategy,
+			InternalSquads:       squads,
+			ExternalSquad:        externalSquad,
+			SortOrder:            i,
+			Active:               true,
+		})
+	}
+	if len(tariffs) == 0 {
+		return nil
+	}
+
+	seeded, err := repository.SeedIfEmpty(ctx, tariffs)
+	if err != nil {
+		return err
+	}
+	if seeded {
+		slog.Info("tariff catalogue created from PRICE_* variables", "count", len(tariffs))
+	}
+	return nil
+}
+
+// renewalTariffFinder looks up the tariff an automatic renewal charges for.
+type renewalTariffFinder interface {
+	tariffFinder
+	FindActiveByDuration(ctx context.Context, days int) (*database.Tariff, error)
+}
+
+// renewalTariff is the tariff an automatic renewal charges for. Purchases made before the catalogue
+// existed, or whose tariff was disabled, are matched to an active tariff of the same length.
+func renewalTariff(ctx context.Context, tariffs renewalTariffFinder, lastPurchase *database.Purchase) (*database.Tariff, error) {
+	days := lastPurchase.Month * config.DaysInMonth()
+	if lastPurchase.TariffID != nil {
+		tariff, err := tariffs.FindById(ctx, *lastPurchase.TariffID)
+		if err != nil {
+			return nil, err
+		}
+		if tariff != nil && tariff.Active && tariff.PriceRub > 0 {
+			return tariff, nil
+		}
+		if tariff != nil {
+			days = tariff.DurationDays
+		}
+	}
+
+	tariff, err := tariffs.FindActiveByDuration(ctx, days)
+	if err != nil {
+		return nil, err
+	}
+	if tariff == nil || tariff.PriceRub <= 0 {
+		return nil, fmt.Errorf("no active tariff to renew purchase %s", utils.MaskHalfInt64(lastPurchase.ID))
+	}
+	return tariff, nil
+}
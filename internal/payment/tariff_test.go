@@ -0,0 +1,71 @@
+package payment
+
+import (
+	"context"
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+)
+
+// fakeRenewalTariffs returns the first active tariff of the requested length and records the lengths asked for.
+type fakeRenewalTariffs struct {
+	fakeTariffs
+	durations []int
+}
+
+func (f *fakeRenewalTariffs) FindActiveByDuration(_ context.Context, days int) (*database.Tariff, error) {
+	f.durations = append(f.durations, days)
+	for _, t := range f.fakeTariffs {
+		if t.Active && t.DurationDays == days {
+			return &t, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestPurchasePlanWeekTariff(t *testing.T) {
+	tariffID := int64(3)
+	tariffs := fakeTariffs{tariffID: {ID: tariffID, DurationDays: 7, Active: true}}
+
+	_, days, err := purchasePlan(context.Background(), tariffs, &database.Purchase{ID: 1, TariffID: &tariffID, Month: 0, BonusDays: 1})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if days != 8 {
+		t.Fatalf("expected 8 days, got %d", days)
+	}
+}
+
+func TestRenewalTariffWeekTariff(t *testing.T) {
+	tariffID := int64(3)
+	tariffs := &fakeRenewalTariffs{fakeTariffs: fakeTariffs{tariffID: {ID: tariffID, DurationDays: 7, PriceRub: 99, Active: true}}}
+
+	tariff, err := renewalTariff(context.Background(), tariffs, &database.Purchase{ID: 1, TariffID: &tariffID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tariff.ID != tariffID {
+		t.Fatalf("expected tariff %d, got %d", tariffID, tariff.ID)
+	}
+	if len(tariffs.durations) != 0 {
+		t.Fatalf("expected no lookup by duration, got %v", tariffs.durations)
+	}
+}
+
+func TestRenewalTariffReplacesDisabledWeekTariff(t *testing.T) {
+	disabledID, replacementID := int64(3), int64(4)
+	tariffs := &fakeRenewalTariffs{fakeTariffs: fakeTariffs{
+		disabledID:    {ID: disabledID, DurationDays: 7, PriceRub: 99},
+		replacementID: {ID: replacementID, DurationDays: 7, PriceRub: 119, Active: true},
+	}}
+
+	tariff, err := renewalTariff(context.Background(), tariffs, &database.Purchase{ID: 1, TariffID: &disabledID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tariff.ID != replacementID {
+		t.Fatalf("expected tariff %d, got %d", replacementID, tariff.ID)
+	}
+	if len(tariffs.durations) != 1 || tariffs.durations[0] != 7 {
+		t.Fatalf("expected a lookup of 7-day tariffs, got %v", tariffs.durations)
+	}
+}
@@ -0,0 +1,155 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/internal/metrics"
+	"remnawave-tg-shop-bot/internal/remnawave"
+	"remnawave-tg-shop-bot/utils"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// ErrTrialUnavailable is returned when the trial is disabled or the customer already received it or has an active
+// subscription.
+var ErrTrialUnavailable = errors.New("trial unavailable")
+
+// trialAvailable reports whether the customer can activate the trial: they never received one and have no active
+// subscription that the trial would replace.
+func trialAvailable(customer *database.Customer, activation *database.TrialActivation, now time.Time) bool {
+	return activation == nil && (customer.ExpireAt == nil || !customer.ExpireAt.After(now))
+}
+
+// TrialAvailable reports whether the trial button should be offered to the customer.
+func (s PaymentService) TrialAvailable(ctx context.Context, customer *database.Customer) (bool, error) {
+	if config.TrialDays() == 0 {
+		return false, nil
+	}
+	activation, err := s.trialActivationRepository.FindByTelegramId(ctx, customer.TelegramID)
+	if err != nil {
+		return false, err
+	}
+	return trialAvailable(customer, activation, time.Now()), nil
+}
+
+// ActivateTrial provisions the trial for the customer and returns the subscription link. The activation is recorded
+// before Remnawave is called and removed if that fails, so the trial cannot be activated twice.
+func (s PaymentService) ActivateTrial(ctx context.Context, telegramId int64) (string, error) {
+	if config.TrialDays() == 0 {
+		return "", ErrTrialUnavailable
+	}
+	customer, err := s.customerRepository.FindByTelegramId(ctx, telegramId)
+	if err != nil {
+		return "", err
+	}
+	if customer == nil {
+		return "", fmt.Errorf("customer %s not found", utils.MaskHalfInt64(telegramId))
+	}
+	if !trialAvailable(customer, nil, time.Now()) {
+		return "", ErrTrialUnavailable
+	}
+
+	claimed, err := s.trialActivationRepository.Claim(ctx, telegramId)
+	if err != nil {
+		return "", err
+	}
+	if !claimed {
+		return "", ErrTrialUnavailable
+	}
+
+	user, err := s.provisionTrial(ctx, customer)
+	if err != nil {
+		if _, err := s.trialActivationRepository.Delete(ctx, telegramId); err != nil {
+			slog.Error("Error releasing trial activation", "telegramId", utils.MaskHalfInt64(telegramId), "error", err)
+		}
+		return "", err
+	}
+	if err := s.trialActivationRepository.SetExpireAt(ctx, telegramId, user.GetExpireAt()); err != nil {
+		slog.Error("Error recording trial expiry", "telegramId", utils.MaskHalfInt64(telegramId), "error", err)
+	}
+	return user.GetSubscriptionUrl(), nil
+}
+
+func (s PaymentService) provisionTrial(ctx context.Context, customer *database.Customer) (*remapi.User, error) {
+	user, err := s.remnawaveClient.CreateOrUpdateUser(ctx, customer.ID, customer.TelegramID, remnawave.TrialPlan(), config.TrialDays(), !customer.Blocked)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.customerRepository.UpdateFields(ctx, customer.ID, map[string]interface{}{
+		"subscription_link": user.GetSubscriptionUrl(),
+		"expire_at":         user.GetExpireAt(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.TrialActivations.Inc()
+	return user, nil
+}
+
+func (s PaymentService) sendTrialGranted(ctx context.Context, customer *database.Customer) {
+	_, err := s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      fmt.Sprintf(s.translation.GetText(customer.Language, "trial_granted"), config.TrialDays()),
+		ReplyMarkup: models.InlineKeyboardMarkup{
+			InlineKeyboard: s.createConnectKeyboard(customer),
+		},
+	})
+	if err != nil {
+		slog.Error("Error sending trial granted message", "customer_id", utils.MaskHalfInt64(customer.ID), "error", err)
+	}
+}
+
+// trialRunning reports whether the customer's subscription is still the trial: it was not revoked and nothing extended
+// it, since a purchase, gift, referral reward or admin change moves the expiry away from the one the trial set.
+func trialRunning(customer *database.Customer, activation *database.TrialActivation) bool {
+	return activation != nil && activation.RevokedAt == nil && activation.ExpireAt != nil &&
+		customer.ExpireAt != nil && customer.ExpireAt.Equal(*activation.ExpireAt)
+}
+
+// RevokeTrial disables the Remnawave user of a customer who left the channel required for the trial and reports
+// whether it did. Customers whose subscription is no longer just the trial are left alone. A later purchase enables
+// the user again.
+func (s PaymentService) RevokeTrial(ctx context.Context, customer *database.Customer) (bool, error) {
+	// The customer may have bought or received days since the active trials were listed.
+	customer, err := s.customerRepository.FindByTelegramId(ctx, customer.TelegramID)
+	if err != nil || customer == nil {
+		return false, err
+	}
+	activation, err := s.trialActivationRepository.FindByTelegramId(ctx, customer.TelegramID)
+	if err != nil {
+		return false, err
+	}
+	if !trialRunning(customer, activation) {
+		return false, nil
+	}
+
+	if err := s.remnawaveClient.SetUserEnabled(ctx, customer.TelegramID, false); err != nil {
+		return false, err
+	}
+	if err := s.trialActivationRepository.Revoke(ctx, customer.TelegramID); err != nil {
+		return false, err
+	}
+	slog.Info("trial revoked", "customer_id", utils.MaskHalfInt64(customer.ID))
+
+	_, err = s.telegramBot.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID:    customer.TelegramID,
+		ParseMode: models.ParseModeHTML,
+		Text:      s.translation.GetText(customer.Language, "trial_revoked"),
+		ReplyMarkup: models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{
+			{{Text: s.translation.GetText(customer.Language, "channel_subscribe_button"), URL: config.RequiredChannelURL()}},
+		}},
+	})
+	if err != nil {
+		slog.Error("Error sending trial revoked message", "customer_id", utils.MaskHalfInt64(customer.ID), "error", err)
+	}
+	return true, nil
+}
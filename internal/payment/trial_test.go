@@ -0,0 +1,67 @@
+package payment
+
+import (
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+	"time"
+)
+
+func TestTrialAvailable(t *testing.T) {
+	now := time.Now()
+	link := "https://sub.example/abc"
+	expired := now.Add(-time.Hour)
+	active := now.Add(24 * time.Hour)
+	activation := &database.TrialActivation{TelegramID: 7, ActivatedAt: now}
+	// Recorded by the migration for customers who had a subscription before activations were tracked.
+	backfilled := &database.TrialActivation{TelegramID: 7, ActivatedAt: now.AddDate(-1, 0, 0)}
+
+	tests := []struct {
+		name       string
+		customer   *database.Customer
+		activation *database.TrialActivation
+		want       bool
+	}{
+		{name: "new customer", customer: &database.Customer{TelegramID: 7}, want: true},
+		{name: "trial already used", customer: &database.Customer{TelegramID: 7}, activation: activation, want: false},
+		{name: "active subscription", customer: &database.Customer{TelegramID: 7, SubscriptionLink: &link, ExpireAt: &active}, want: false},
+		{name: "expired former subscriber", customer: &database.Customer{TelegramID: 7, SubscriptionLink: &link, ExpireAt: &expired}, activation: backfilled, want: false},
+		{name: "expired after trial reset", customer: &database.Customer{TelegramID: 7, SubscriptionLink: &link, ExpireAt: &expired}, want: true},
+		{name: "reset with link kept", customer: &database.Customer{TelegramID: 7, SubscriptionLink: &link}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trialAvailable(tt.customer, tt.activation, now); got != tt.want {
+				t.Fatalf("trialAvailable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTrialRunning(t *testing.T) {
+	trialEnd := time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)
+	gifted := trialEnd.AddDate(0, 1, 0)
+	rewarded := trialEnd.AddDate(0, 0, 3)
+	revokedAt := trialEnd.AddDate(0, 0, -1)
+
+	tests := []struct {
+		name       string
+		expireAt   *time.Time
+		activation *database.TrialActivation
+		want       bool
+	}{
+		{name: "trial running", expireAt: &trialEnd, activation: &database.TrialActivation{ExpireAt: &trialEnd}, want: true},
+		{name: "gift code redeemed", expireAt: &gifted, activation: &database.TrialActivation{ExpireAt: &trialEnd}, want: false},
+		{name: "referral reward added", expireAt: &rewarded, activation: &database.TrialActivation{ExpireAt: &trialEnd}, want: false},
+		{name: "already revoked", expireAt: &trialEnd, activation: &database.TrialActivation{ExpireAt: &trialEnd, RevokedAt: &revokedAt}, want: false},
+		{name: "expiry not recorded", expireAt: &trialEnd, activation: &database.TrialActivation{}, want: false},
+		{name: "no trial", expireAt: &trialEnd, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			customer := &database.Customer{TelegramID: 7, ExpireAt: tt.expireAt}
+			if got := trialRunning(customer, tt.activation); got != tt.want {
+				t.Fatalf("trialRunning() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
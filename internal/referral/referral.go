@@ -0,0 +1,170 @@
+package referral
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+	"strings"
+	"time"
+	"unicode"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+const (
+	// burstSize referees with the same name pattern invited by one referrer within burstWindow are flagged for review.
+	burstSize   = 3
+	burstWindow = time.Hour
+
+	maxPatternLength = 64
+)
+
+var (
+	ErrSelfReferral     = errors.New("customer cannot refer themselves")
+	ErrReferrerNotFound = errors.New("referrer not found")
+	ErrAlreadyReferred  = errors.New("customer was already referred")
+	ErrNotNewCustomer   = errors.New("customer already has a panel user")
+)
+
+type referralStore interface {
+	Create(ctx context.Context, referral *database.Referral) (*database.Referral, error)
+	FindByReferee(ctx context.Context, refereeID int64) (*database.Referral, error)
+	FindRecentByReferrer(ctx context.Context, referrerID int64, since time.Time) ([]database.Referral, error)
+	Flag(ctx context.Context, ids []int64, reason string) error
+}
+
+type customerFinder interface {
+	FindByTelegramId(ctx context.Context, telegramId int64) (*database.Customer, error)
+}
+
+type panelUserFinder interface {
+	GetUserByTelegramId(ctx context.Context, telegramId int64) (*remapi.User, error)
+}
+
+// Referee is the Telegram account that opened a referral link.
+type Referee struct {
+	TelegramID int64
+	Username   string
+	FirstName  string
+	LastName   string
+}
+
+// Service accepts referrals of new customers and flags the ones that look like abuse. Flagged referrals earn no
+// rewards until an admin approves them.
+type Service struct {
+	referrals referralStore
+	customers customerFinder
+	panel     panelUserFinder
+	now       func() time.Time
+}
+
+func NewService(referrals referralStore, customers customerFinder, panel panelUserFinder) *Service {
+	return &Service{referrals: referrals, customers: customers, panel: panel, now: time.Now}
+}
+
+// Register records that the referrer invited the referee, who must have just been created in the bot.
+func (s *Service) Register(ctx context.Context, referrerID int64, referee Referee) (*database.Referral, error) {
+	if referrerID == referee.TelegramID {
+		return nil, ErrSelfReferral
+	}
+	referrer, err := s.customers.FindByTelegramId(ctx, referrerID)
+	if err != nil {
+		return nil, err
+	}
+	if referrer == nil || referrer.Blocked {
+		return nil, ErrReferrerNotFound
+	}
+	existing, err := s.referrals.FindByReferee(ctx, referee.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrAlreadyReferred
+	}
+	// Customers removed by /sync start over in the bot, the panel still knows the ones who had a subscription.
+	user, err := s.panel.GetUserByTelegramId(ctx, referee.TelegramID)
+	if err != nil {
+		return nil, err
+	}
+	if user != nil {
+		return nil, ErrNotNewCustomer
+	}
+
+	recent, err := s.referrals.FindRecentByReferrer(ctx, referrerID, s.now().Add(-burstWindow))
+	if err != nil {
+		return nil, err
+	}
+	pattern := Pattern(referee.Username, referee.FirstName)
+	reason, burst := review(referee, pattern, recent)
+
+	referral := &database.Referral{
+		ReferrerID: referrerID,
+		RefereeID:  referee.TelegramID,
+		Status:     database.ReferralStatusAccepted,
+		Pattern:    &pattern,
+	}
+	if reason != "" {
+		referral.Status = database.ReferralStatusFlagged
+		referral.FlagReason = &reason
+	}
+	created, err := s.referrals.Create(ctx, referral)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(burst) > 0 {
+		if err := s.referrals.Flag(ctx, burst, database.ReferralFlagBurst); err != nil {
+			slog.Error("Error flagging referral burst", "referrerId", utils.MaskHalfInt64(referrerID), "error", err)
+		}
+	}
+	if reason != "" {
+		slog.Warn("referral flagged for review", "referral_id", created.ID, "reason", reason, "referrerId", utils.MaskHalfInt64(referrerID))
+	}
+	return created, nil
+}
+
+// review returns why the new referral must be flagged, or "", and the earlier referrals of the same burst.
+func review(referee Referee, pattern string, recent []database.Referral) (string, []int64) {
+	var burst []int64
+	for _, r := range recent {
+		if r.Pattern != nil && *r.Pattern == pattern {
+			burst = append(burst, r.ID)
+		}
+	}
+	if len(burst)+1 < burstSize {
+		burst = nil
+	}
+
+	switch {
+	case utils.IsSuspiciousUser(&referee.Username, &referee.FirstName, &referee.LastName):
+		return database.ReferralFlagSuspicious, burst
+	case burst != nil:
+		return database.ReferralFlagBurst, burst
+	default:
+		return "", nil
+	}
+}
+
+// Pattern normalizes the referee's name so that accounts created in bulk, such as anna_1990 and Anna2024, share
+// a pattern. Usernames and first names never match each other.
+func Pattern(username, firstName string) string {
+	name, prefix := username, "@"
+	if name == "" {
+		name, prefix = firstName, ""
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) {
+			b.WriteRune(r)
+		}
+	}
+	pattern := []rune(b.String())
+	if len(pattern) > maxPatternLength {
+		pattern = pattern[:maxPatternLength]
+	}
+	return string(pattern)
+}
@@ -0,0 +1,140 @@
+package referral
+
+import (
+	"context"
+	"errors"
+	"remnawave-tg-shop-bot/internal/database"
+	"testing"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+type fakeReferrals struct {
+	existing *database.Referral
+	recent   []database.Referral
+	created  *database.Referral
+	flagged  []int64
+}
+
+func (f *fakeReferrals) Create(_ context.Context, referral *database.Referral) (*database.Referral, error) {
+	created := *referral
+	created.ID = 99
+	f.created = &created
+	return &created, nil
+}
+
+func (f *fakeReferrals) FindByReferee(context.Context, int64) (*database.Referral, error) {
+	return f.existing, nil
+}
+
+func (f *fakeReferrals) FindRecentByReferrer(context.Context, int64, time.Time) ([]database.Referral, error) {
+	return f.recent, nil
+}
+
+func (f *fakeReferrals) Flag(_ context.Context, ids []int64, _ string) error {
+	f.flagged = append(f.flagged, ids...)
+	return nil
+}
+
+type fakeCustomers map[int64]*database.Customer
+
+func (f fakeCustomers) FindByTelegramId(_ context.Context, telegramId int64) (*database.Customer, error) {
+	return f[telegramId], nil
+}
+
+type fakePanel map[int64]*remapi.User
+
+func (f fakePanel) GetUserByTelegramId(_ context.Context, telegramId int64) (*remapi.User, error) {
+	return f[telegramId], nil
+}
+
+func newTestService(referrals *fakeReferrals, panel fakePanel) *Service {
+	customers := fakeCustomers{1: {ID: 10, TelegramID: 1}, 3: {ID: 30, TelegramID: 3, Blocked: true}}
+	return NewService(referrals, customers, panel)
+}
+
+func TestRegisterRejectsInvalidReferrals(t *testing.T) {
+	tests := []struct {
+		name       string
+		referrerID int64
+		referrals  *fakeReferrals
+		panel      fakePanel
+		want       error
+	}{
+		{"self", 2, &fakeReferrals{}, fakePanel{}, ErrSelfReferral},
+		{"unknown referrer", 7, &fakeReferrals{}, fakePanel{}, ErrReferrerNotFound},
+		{"blocked referrer", 3, &fakeReferrals{}, fakePanel{}, ErrReferrerNotFound},
+		{"already referred", 1, &fakeReferrals{existing: &database.Referral{ID: 5}}, fakePanel{}, ErrAlreadyReferred},
+		{"panel user", 1, &fakeReferrals{}, fakePanel{2: {}}, ErrNotNewCustomer},
+	}
+	for _, tt := range tests {
+		s := newTestService(tt.referrals, tt.panel)
+		_, err := s.Register(context.Background(), tt.referrerID, Referee{TelegramID: 2, Username: "anna"})
+		if !errors.Is(err, tt.want) {
+			t.Fatalf("%s: want %v, got %v", tt.name, tt.want, err)
+		}
+		if tt.referrals.created != nil {
+			t.Fatalf("%s: referral must not be created", tt.name)
+		}
+	}
+}
+
+func TestRegisterAcceptsNewCustomer(t *testing.T) {
+	referrals := &fakeReferrals{}
+	referral, err := newTestService(referrals, fakePanel{}).Register(context.Background(), 1, Referee{TelegramID: 2, Username: "anna"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if referral.Status != database.ReferralStatusAccepted || referral.FlagReason != nil || *referral.Pattern != "@anna" {
+		t.Fatalf("unexpected referral: %+v", referral)
+	}
+}
+
+func TestRegisterFlagsBurstOfSimilarReferees(t *testing.T) {
+	anna, bob := "@anna", "@bob"
+	referrals := &fakeReferrals{recent: []database.Referral{
+		{ID: 4, Pattern: &anna}, {ID: 5, Pattern: &bob}, {ID: 6, Pattern: &anna},
+	}}
+
+	referral, err := newTestService(referrals, fakePanel{}).Register(context.Background(), 1, Referee{TelegramID: 2, Username: "anna_2024"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if referral.Status != database.ReferralStatusFlagged || *referral.FlagReason != database.ReferralFlagBurst {
+		t.Fatalf("referral not flagged: %+v", referral)
+	}
+	if len(referrals.flagged) != 2 || referrals.flagged[0] != 4 || referrals.flagged[1] != 6 {
+		t.Fatalf("earlier referrals of the burst not flagged: %v", referrals.flagged)
+	}
+}
+
+func TestRegisterFlagsSuspiciousReferee(t *testing.T) {
+	referrals := &fakeReferrals{}
+	referee := Referee{TelegramID: 2, FirstName: "Free VPN t.me/spam"}
+
+	referral, err := newTestService(referrals, fakePanel{}).Register(context.Background(), 1, referee)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if referral.Status != database.ReferralStatusFlagged || *referral.FlagReason != database.ReferralFlagSuspicious {
+		t.Fatalf("referral not flagged: %+v", referral)
+	}
+}
+
+func TestPattern(t *testing.T) {
+	tests := []struct {
+		username, firstName, want string
+	}{
+		{"Anna_1990", "Anna", "@anna"},
+		{"anna2024", "", "@anna"},
+		{"", "Анна 7", "анна"},
+		{"", "anna", "anna"},
+		{"", "", ""},
+	}
+	for _, tt := range tests {
+		if got := Pattern(tt.username, tt.firstName); got != tt.want {
+			t.Errorf("Pattern(%q, %q) = %q, want %q", tt.username, tt.firstName, got, tt.want)
+		}
+	}
+}
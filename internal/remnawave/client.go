@@ -7,6 +7,7 @@ import (
 	"log/slog"
 	"net/http"
 	"remnawave-tg-shop-bot/internal/config"
+	"remnawave-tg-shop-bot/internal/metrics"
 	"remnawave-tg-shop-bot/utils"
 	"strconv"
 	"strings"
@@ -60,12 +61,22 @@ func NewClient(baseURL, token, mode string) *Client {
 	return &Client{client: remapi.NewClientExt(api)}
 }
 
-func (r *Client) Ping(ctx context.Context) error {
-	_, err := r.client.Users().GetAllUsers(ctx, 1, 0)
+// observe records the latency of a client call and counts it as failed when err is set. It is deferred
+// with a pointer because the error is only known when the call returns.
+func observe(method string, start time.Time, err *error) {
+	metrics.ObserveRemnawave(method, start, *err)
+}
+
+func (r *Client) Ping(ctx context.Context) (err error) {
+	defer observe("Ping", time.Now(), &err)
+
+	_, err = r.client.Users().GetAllUsers(ctx, 1, 0)
 	return err
 }
 
-func (r *Client) GetUsers(ctx context.Context) (*[]remapi.User, error) {
+func (r *Client) GetUsers(ctx context.Context) (_ *[]remapi.User, err error) {
+	defer observe("GetUsers", time.Now(), &err)
+
 	pager := remapi.NewPaginationHelper(250)
 	users := make([]remapi.User, 0)
 
@@ -90,38 +101,19 @@ func (r *Client) GetUsers(ctx context.Context) (*[]remapi.User, error) {
 	return &users, nil
 }
 
-func (r *Client) DecreaseSubscription(ctx context.Context, telegramId int64, trafficLimit int, days int) (*time.Time, error) {
+// DecreaseSubscription moves the user's expiration back by days and leaves the rest of the user unchanged.
+func (r *Client) DecreaseSubscription(ctx context.Context, telegramId int64, days int) (_ *time.Time, err error) {
+	defer observe("DecreaseSubscription", time.Now(), &err)
 
-	resp, err := r.client.Users().GetUserByTelegramId(ctx, strconv.FormatInt(telegramId, 10))
+	existingUser, err := r.GetUserByTelegramId(ctx, telegramId)
 	if err != nil {
 		return nil, err
 	}
-
-	usersResp, ok := resp.(*remapi.UsersResponse)
-	if !ok {
-		return nil, errors.New("unknown response type")
-	}
-
-	users := usersResp.GetResponse()
-	if len(users) == 0 {
-		return nil, fmt.Errorf("user with telegramId %d not found", telegramId)
-	}
-
-	var existingUser *remapi.User
-	suffix := fmt.Sprintf("_%d", telegramId)
-
-	for i := range users {
-		if strings.Contains(users[i].Username, suffix) {
-			existingUser = &users[i]
-			break
-		}
-	}
-
 	if existingUser == nil {
-		existingUser = &users[0]
+		return nil, fmt.Errorf("user with telegramId %d not found", telegramId)
 	}
 
-	updated, err := r.updateUser(ctx, existingUser, trafficLimit, days)
+	updated, err := r.updateUser(ctx, existingUser, nil, days, false)
 	if err != nil {
 		return nil, err
 	}
@@ -129,7 +121,10 @@ func (r *Client) DecreaseSubscription(ctx context.Context, telegramId int64, tra
 	return &updated.ExpireAt, nil
 }
 
-func (r *Client) CreateOrUpdateUser(ctx context.Context, customerId int64, telegramId int64, trafficLimit int, days int, isTrialUser bool) (*remapi.User, error) {
+// GetUserByTelegramId returns the panel user bound to the telegram id, or nil if there is none.
+func (r *Client) GetUserByTelegramId(ctx context.Context, telegramId int64) (_ *remapi.User, err error) {
+	defer observe("GetUserByTelegramId", time.Now(), &err)
+
 	resp, err := r.client.Users().GetUserByTelegramId(ctx, strconv.FormatInt(telegramId, 10))
 	if err != nil {
 		return nil, err
@@ -142,30 +137,82 @@ func (r *Client) CreateOrUpdateUser(ctx context.Context, customerId int64, teleg
 
 	users := usersResp.GetResponse()
 	if len(users) == 0 {
-		return r.createUser(ctx, customerId, telegramId, trafficLimit, days, isTrialUser)
+		return nil, nil
 	}
 
-	var existingUser *remapi.User
 	suffix := fmt.Sprintf("_%d", telegramId)
-
 	for i := range users {
 		if strings.Contains(users[i].Username, suffix) {
-			existingUser = &users[i]
-			break
+			return &users[i], nil
 		}
 	}
 
+	return &users[0], nil
+}
+
+// SetUserEnabled enables or disables the panel user bound to the telegram id.
+func (r *Client) SetUserEnabled(ctx context.Context, telegramId int64, enabled bool) (err error) {
+	defer observe("SetUserEnabled", time.Now(), &err)
+
+	user, err := r.GetUserByTelegramId(ctx, telegramId)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	var resp interface{}
+	if enabled {
+		resp, err = r.client.Users().EnableUser(ctx, user.UUID.String())
+	} else {
+		resp, err = r.client.Users().DisableUser(ctx, user.UUID.String())
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := resp.(*remapi.UserResponse); !ok {
+		return fmt.Errorf("unexpected response while changing user status: %T", resp)
+	}
+
+	slog.Info("changed user status", "telegramId", utils.MaskHalfInt64(telegramId), "enabled", enabled)
+	return nil
+}
+
+// CreateOrUpdateUser adds days to the user's subscription and applies the plan, creating the user if needed. With
+// enable false, as for blocked customers, a disabled user stays disabled and a new user is created disabled.
+func (r *Client) CreateOrUpdateUser(ctx context.Context, customerId int64, telegramId int64, plan Plan, days int, enable bool) (_ *remapi.User, err error) {
+	defer observe("CreateOrUpdateUser", time.Now(), &err)
+
+	existingUser, err := r.GetUserByTelegramId(ctx, telegramId)
+	if err != nil {
+		return nil, err
+	}
 	if existingUser == nil {
-		existingUser = &users[0]
+		return r.createUser(ctx, customerId, telegramId, plan, days, enable)
 	}
 
-	return r.updateUser(ctx, existingUser, trafficLimit, days)
+	return r.updateUser(ctx, existingUser, &plan, days, enable)
 }
 
-func (r *Client) updateUser(ctx context.Context, existingUser *remapi.User, trafficLimit int, days int) (*remapi.User, error) {
+// AddDays extends the user's subscription and leaves the rest of the user unchanged, so bonus days do not
+// replace the settings of the customer's tariff. A user that does not exist yet is created with the default plan.
+func (r *Client) AddDays(ctx context.Context, customerId int64, telegramId int64, days int) (_ *remapi.User, err error) {
+	defer observe("AddDays", time.Now(), &err)
 
-	newExpire := getNewExpire(days, existingUser.ExpireAt)
+	existingUser, err := r.GetUserByTelegramId(ctx, telegramId)
+	if err != nil {
+		return nil, err
+	}
+	if existingUser == nil {
+		return r.createUser(ctx, customerId, telegramId, DefaultPlan(), days, true)
+	}
 
+	return r.updateUser(ctx, existingUser, nil, days, false)
+}
+
+// selectSquads returns the UUIDs of the panel's internal squads that are selected by the plan.
+func (r *Client) selectSquads(ctx context.Context, selectedSquads map[uuid.UUID]uuid.UUID) ([]uuid.UUID, error) {
 	resp, err := r.client.InternalSquad().GetInternalSquads(ctx)
 	if err != nil {
 		return nil, err
@@ -173,38 +220,49 @@ func (r *Client) updateUser(ctx context.Context, existingUser *remapi.User, traf
 
 	squads := resp.(*remapi.InternalSquadsResponse).GetResponse()
 
-	selectedSquads := config.SquadUUIDs()
-
 	squadId := make([]uuid.UUID, 0, len(selectedSquads))
 	for _, squad := range squads.GetInternalSquads() {
-		if selectedSquads != nil && len(selectedSquads) > 0 {
+		if len(selectedSquads) > 0 {
 			if _, isExist := selectedSquads[squad.UUID]; !isExist {
 				continue
-			} else {
-				squadId = append(squadId, squad.UUID)
 			}
-		} else {
-			squadId = append(squadId, squad.UUID)
 		}
+		squadId = append(squadId, squad.UUID)
 	}
+	return squadId, nil
+}
+
+// updateUser moves the expiration by days. A nil plan keeps the user's traffic, squads and tag as they are.
+// A disabled user is only enabled again when enable is set.
+func (r *Client) updateUser(ctx context.Context, existingUser *remapi.User, plan *Plan, days int, enable bool) (*remapi.User, error) {
+
+	newExpire := getNewExpire(days, existingUser.ExpireAt)
 
 	userUpdate := &remapi.UpdateUserRequestDto{
-		UUID:                 remapi.NewOptUUID(existingUser.UUID),
-		ExpireAt:             remapi.NewOptDateTime(newExpire),
-		Status:               remapi.NewOptUpdateUserRequestDtoStatus(remapi.UpdateUserRequestDtoStatusACTIVE),
-		TrafficLimitBytes:    remapi.NewOptInt(trafficLimit),
-		ActiveInternalSquads: squadId,
-		TrafficLimitStrategy: remapi.NewOptUpdateUserRequestDtoTrafficLimitStrategy(getUpdateStrategy(config.TrafficLimitResetStrategy())),
+		UUID:     remapi.NewOptUUID(existingUser.UUID),
+		ExpireAt: remapi.NewOptDateTime(newExpire),
+		Status:   updateStatus(existingUser.Status, enable),
 	}
 
-	externalSquad := config.ExternalSquadUUID()
-	if externalSquad != uuid.Nil {
-		userUpdate.ExternalSquadUuid = remapi.NewOptNilUUID(externalSquad)
-	}
+	if plan != nil {
+		squadId, err := r.selectSquads(ctx, plan.InternalSquads)
+		if err != nil {
+			return nil, err
+		}
+
+		userUpdate.TrafficLimitBytes = remapi.NewOptInt(plan.TrafficLimit)
+		userUpdate.ActiveInternalSquads = squadId
+		userUpdate.TrafficLimitStrategy = remapi.NewOptUpdateUserRequestDtoTrafficLimitStrategy(getUpdateStrategy(plan.ResetStrategy))
 
-	tag := config.RemnawaveTag()
-	if tag != "" {
-		userUpdate.Tag = remapi.NewOptNilString(tag)
+		if plan.ExternalSquad != uuid.Nil {
+			userUpdate.ExternalSquadUuid = remapi.NewOptNilUUID(plan.ExternalSquad)
+		}
+		if plan.DeviceLimit > 0 {
+			userUpdate.HwidDeviceLimit = remapi.NewOptNilInt(plan.DeviceLimit)
+		}
+		if plan.Tag != "" {
+			userUpdate.Tag = remapi.NewOptNilString(plan.Tag)
+		}
 	}
 
 	var username string
@@ -228,63 +286,32 @@ func (r *Client) updateUser(ctx context.Context, existingUser *remapi.User, traf
 	return &updateUser.(*remapi.UserResponse).Response, nil
 }
 
-func (r *Client) createUser(ctx context.Context, customerId int64, telegramId int64, trafficLimit int, days int, isTrialUser bool) (*remapi.User, error) {
+func (r *Client) createUser(ctx context.Context, customerId int64, telegramId int64, plan Plan, days int, enable bool) (*remapi.User, error) {
 	expireAt := time.Now().UTC().AddDate(0, 0, days)
 	username := generateUsername(customerId, telegramId)
 
-	resp, err := r.client.InternalSquad().GetInternalSquads(ctx)
+	squadId, err := r.selectSquads(ctx, plan.InternalSquads)
 	if err != nil {
 		return nil, err
 	}
 
-	squads := resp.(*remapi.InternalSquadsResponse).GetResponse()
-
-	selectedSquads := config.SquadUUIDs()
-	if isTrialUser {
-		selectedSquads = config.TrialInternalSquads()
-	}
-
-	squadId := make([]uuid.UUID, 0, len(selectedSquads))
-	for _, squad := range squads.GetInternalSquads() {
-		if selectedSquads != nil && len(selectedSquads) > 0 {
-			if _, isExist := selectedSquads[squad.UUID]; !isExist {
-				continue
-			} else {
-				squadId = append(squadId, squad.UUID)
-			}
-		} else {
-			squadId = append(squadId, squad.UUID)
-		}
-	}
-
-	externalSquad := config.ExternalSquadUUID()
-	if isTrialUser {
-		externalSquad = config.TrialExternalSquadUUID()
-	}
-
-	strategy := config.TrafficLimitResetStrategy()
-	if isTrialUser {
-		strategy = config.TrialTrafficLimitResetStrategy()
-	}
-
 	createUserRequestDto := remapi.CreateUserRequestDto{
 		Username:             username,
 		ActiveInternalSquads: squadId,
-		Status:               remapi.NewOptCreateUserRequestDtoStatus(remapi.CreateUserRequestDtoStatusACTIVE),
+		Status:               remapi.NewOptCreateUserRequestDtoStatus(createStatus(enable)),
 		TelegramId:           remapi.NewOptNilInt(int(telegramId)),
 		ExpireAt:             expireAt,
-		TrafficLimitStrategy: remapi.NewOptCreateUserRequestDtoTrafficLimitStrategy(getCreateStrategy(strategy)),
-		TrafficLimitBytes:    remapi.NewOptInt(trafficLimit),
+		TrafficLimitStrategy: remapi.NewOptCreateUserRequestDtoTrafficLimitStrategy(getCreateStrategy(plan.ResetStrategy)),
+		TrafficLimitBytes:    remapi.NewOptInt(plan.TrafficLimit),
 	}
-	if externalSquad != uuid.Nil {
-		createUserRequestDto.ExternalSquadUuid = remapi.NewOptNilUUID(externalSquad)
+	if plan.ExternalSquad != uuid.Nil {
+		createUserRequestDto.ExternalSquadUuid = remapi.NewOptNilUUID(plan.ExternalSquad)
 	}
-	tag := config.RemnawaveTag()
-	if isTrialUser {
-		tag = config.TrialRemnawaveTag()
+	if plan.DeviceLimit > 0 {
+		createUserRequestDto.HwidDeviceLimit = remapi.NewOptInt(plan.DeviceLimit)
 	}
-	if tag != "" {
-		createUserRequestDto.Tag = remapi.NewOptNilString(tag)
+	if plan.Tag != "" {
+		createUserRequestDto.Tag = remapi.NewOptNilString(plan.Tag)
 	}
 
 	var tgUsername string
@@ -307,6 +334,22 @@ func generateUsername(customerId int64, telegramId int64) string {
 	return fmt.Sprintf("%d_%d", customerId, telegramId)
 }
 
+// updateStatus activates the user, except that a disabled user is left disabled unless enable is set, so adding or
+// removing days does not lift an admin block or a revoked trial.
+func updateStatus(current remapi.OptUserStatus, enable bool) remapi.OptUpdateUserRequestDtoStatus {
+	if !enable && current.Set && current.Value == remapi.UserStatusDISABLED {
+		return remapi.OptUpdateUserRequestDtoStatus{}
+	}
+	return remapi.NewOptUpdateUserRequestDtoStatus(remapi.UpdateUserRequestDtoStatusACTIVE)
+}
+
+func createStatus(enable bool) remapi.CreateUserRequestDtoStatus {
+	if enable {
+		return remapi.CreateUserRequestDtoStatusACTIVE
+	}
+	return remapi.CreateUserRequestDtoStatusDISABLED
+}
+
 func getNewExpire(daysToAdd int, currentExpire time.Time) time.Time {
 	if daysToAdd <= 0 {
 		if currentExpire.AddDate(0, 0, daysToAdd).Before(time.Now()) {
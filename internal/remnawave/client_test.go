@@ -0,0 +1,30 @@
+package remnawave
+
+import (
+	"testing"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+func TestUpdateStatusKeepsDisabledUsers(t *testing.T) {
+	active := remapi.NewOptUpdateUserRequestDtoStatus(remapi.UpdateUserRequestDtoStatusACTIVE)
+	tests := []struct {
+		name    string
+		current remapi.OptUserStatus
+		enable  bool
+		want    remapi.OptUpdateUserRequestDtoStatus
+	}{
+		{name: "disabled keeps status", current: remapi.NewOptUserStatus(remapi.UserStatusDISABLED), want: remapi.OptUpdateUserRequestDtoStatus{}},
+		{name: "disabled enabled by purchase", current: remapi.NewOptUserStatus(remapi.UserStatusDISABLED), enable: true, want: active},
+		{name: "expired activated", current: remapi.NewOptUserStatus(remapi.UserStatusEXPIRED), want: active},
+		{name: "limited activated", current: remapi.NewOptUserStatus(remapi.UserStatusLIMITED), want: active},
+		{name: "unknown status", want: active},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := updateStatus(tt.current, tt.enable); got != tt.want {
+				t.Fatalf("updateStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
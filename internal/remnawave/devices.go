@@ -0,0 +1,113 @@
+package remnawave
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/utils"
+	"strings"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+// UserDevices are the HWID devices registered for a panel user.
+type UserDevices struct {
+	Devices []remapi.Device
+	// Limit is the device limit of the user, zero when it is not set and the panel default applies.
+	Limit int
+}
+
+// GetUserDevices returns the devices of the panel user bound to the telegram id, or nil if there is no user.
+func (r *Client) GetUserDevices(ctx context.Context, telegramId int64) (_ *UserDevices, err error) {
+	defer observe("GetUserDevices", time.Now(), &err)
+
+	user, err := r.GetUserByTelegramId(ctx, telegramId)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, nil
+	}
+
+	resp, err := r.client.HwidUserDevices().GetUserHwidDevices(ctx, user.UUID.String())
+	if err != nil {
+		return nil, err
+	}
+	devicesResp, ok := resp.(*remapi.HwidDevicesResponse)
+	if !ok {
+		return nil, fmt.Errorf("unexpected response while getting user devices: %T", resp)
+	}
+
+	return &UserDevices{
+		Devices: devicesResp.GetResponse().Devices,
+		Limit:   user.HwidDeviceLimit.Or(0),
+	}, nil
+}
+
+// DeleteUserDevice removes one device of the panel user bound to the telegram id.
+func (r *Client) DeleteUserDevice(ctx context.Context, telegramId int64, hwid string) (err error) {
+	defer observe("DeleteUserDevice", time.Now(), &err)
+
+	user, err := r.GetUserByTelegramId(ctx, telegramId)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	resp, err := r.client.HwidUserDevices().DeleteUserHwidDevice(ctx, &remapi.DeleteUserHwidDeviceRequestDto{
+		UserUuid: user.UUID,
+		Hwid:     hwid,
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := resp.(*remapi.HwidDevicesResponse); !ok {
+		return fmt.Errorf("unexpected response while deleting user device: %T", resp)
+	}
+
+	slog.Info("deleted user device", "telegramId", utils.MaskHalfInt64(telegramId))
+	return nil
+}
+
+// DeleteAllUserDevices removes every device of the panel user bound to the telegram id.
+func (r *Client) DeleteAllUserDevices(ctx context.Context, telegramId int64) (err error) {
+	defer observe("DeleteAllUserDevices", time.Now(), &err)
+
+	user, err := r.GetUserByTelegramId(ctx, telegramId)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	resp, err := r.client.HwidUserDevices().DeleteAllUserHwidDevices(ctx, &remapi.DeleteAllUserHwidDevicesRequestDto{
+		UserUuid: user.UUID,
+	})
+	if err != nil {
+		return err
+	}
+	if _, ok := resp.(*remapi.HwidDevicesResponse); !ok {
+		return fmt.Errorf("unexpected response while deleting user devices: %T", resp)
+	}
+
+	slog.Info("deleted all user devices", "telegramId", utils.MaskHalfInt64(telegramId))
+	return nil
+}
+
+// DeviceName describes a device by platform, model and OS version, falling back to the HWID when the client sent none of them.
+func DeviceName(device remapi.Device) string {
+	var parts []string
+	for _, part := range []remapi.NilString{device.Platform, device.DeviceModel, device.OsVersion} {
+		if value, ok := part.Get(); ok && value != "" {
+			parts = append(parts, value)
+		}
+	}
+	if len(parts) == 0 {
+		return device.Hwid
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,48 @@
+package remnawave
+
+import (
+	"testing"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+func TestDeviceName(t *testing.T) {
+	tests := []struct {
+		name   string
+		device remapi.Device
+		want   string
+	}{
+		{
+			name: "all fields",
+			device: remapi.Device{
+				Hwid:        "abc",
+				Platform:    remapi.NewNilString("iOS"),
+				DeviceModel: remapi.NewNilString("iPhone 15"),
+				OsVersion:   remapi.NewNilString("18.1"),
+			},
+			want: "iOS iPhone 15 18.1",
+		},
+		{
+			name: "empty and null fields are skipped",
+			device: remapi.Device{
+				Hwid:        "abc",
+				Platform:    remapi.NewNilString("Android"),
+				DeviceModel: remapi.NewNilString(""),
+			},
+			want: "Android",
+		},
+		{
+			name:   "hwid fallback",
+			device: remapi.Device{Hwid: "abc"},
+			want:   "abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DeviceName(tt.device); got != tt.want {
+				t.Errorf("DeviceName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package remnawave
+
+import (
+	"remnawave-tg-shop-bot/internal/config"
+
+	"github.com/google/uuid"
+)
+
+// Plan holds the user settings a subscription grants in Remnawave.
+type Plan struct {
+	// TrafficLimit is in bytes, zero means unlimited.
+	TrafficLimit  int
+	ResetStrategy string
+	// InternalSquads selects squads by UUID. An empty set selects every squad.
+	InternalSquads map[uuid.UUID]uuid.UUID
+	ExternalSquad  uuid.UUID
+	// DeviceLimit is not sent to the panel when it is zero.
+	DeviceLimit int
+	Tag         string
+}
+
+// DefaultPlan is used for subscriptions that do not come from a tariff, e.g. referral bonuses and Tribute.
+func DefaultPlan() Plan {
+	return Plan{
+		TrafficLimit:   config.TrafficLimit(),
+		ResetStrategy:  config.TrafficLimitResetStrategy(),
+		InternalSquads: config.SquadUUIDs(),
+		ExternalSquad:  config.ExternalSquadUUID(),
+		Tag:            config.RemnawaveTag(),
+	}
+}
+
+func TrialPlan() Plan {
+	return Plan{
+		TrafficLimit:   config.TrialTrafficLimit(),
+		ResetStrategy:  config.TrialTrafficLimitResetStrategy(),
+		InternalSquads: config.TrialInternalSquads(),
+		ExternalSquad:  config.TrialExternalSquadUUID(),
+		Tag:            config.TrialRemnawaveTag(),
+	}
+}
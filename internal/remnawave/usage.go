@@ -0,0 +1,38 @@
+package remnawave
+
+import (
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+// onlineWindow is how long a user counts as online after a node last reported them. Nodes report online users
+// about once a minute.
+const onlineWindow = 2 * time.Minute
+
+// IsOnline reports whether a node has recently seen the user connected.
+func IsOnline(user *remapi.User, now time.Time) bool {
+	onlineAt, ok := user.UserTraffic.OnlineAt.Get()
+	return ok && now.Sub(onlineAt) < onlineWindow
+}
+
+// NextTrafficReset returns when the panel resets used traffic next for the strategy, or false if it never does.
+// The panel resets traffic at midnight UTC: every day, every Monday or on the first day of the month.
+func NextTrafficReset(strategy string, now time.Time) (time.Time, bool) {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch remapi.UserTrafficLimitStrategy(strategy) {
+	case remapi.UserTrafficLimitStrategyDAY:
+		return midnight.AddDate(0, 0, 1), true
+	case remapi.UserTrafficLimitStrategyWEEK:
+		days := (8 - int(midnight.Weekday())) % 7
+		if days == 0 {
+			days = 7
+		}
+		return midnight.AddDate(0, 0, days), true
+	case remapi.UserTrafficLimitStrategyMONTH:
+		return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC), true
+	default:
+		return time.Time{}, false
+	}
+}
@@ -0,0 +1,53 @@
+package remnawave
+
+import (
+	"testing"
+	"time"
+
+	remapi "github.com/Jolymmiles/remnawave-api-go/v2/api"
+)
+
+func TestNextTrafficReset(t *testing.T) {
+	// Wednesday
+	now := time.Date(2026, 12, 30, 15, 4, 0, 0, time.UTC)
+	tests := []struct {
+		strategy string
+		want     time.Time
+		ok       bool
+	}{
+		{"DAY", time.Date(2026, 12, 31, 0, 0, 0, 0, time.UTC), true},
+		{"WEEK", time.Date(2027, 1, 4, 0, 0, 0, 0, time.UTC), true},
+		{"MONTH", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"NO_RESET", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := NextTrafficReset(tt.strategy, now)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Fatalf("NextTrafficReset(%q): want %v %v, got %v %v", tt.strategy, tt.want, tt.ok, got, ok)
+		}
+	}
+
+	monday := time.Date(2027, 1, 4, 10, 0, 0, 0, time.UTC)
+	if got, _ := NextTrafficReset("WEEK", monday); !got.Equal(time.Date(2027, 1, 11, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("weekly reset on a Monday must be the next Monday, got %v", got)
+	}
+}
+
+func TestIsOnline(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	user := &remapi.User{}
+	if IsOnline(user, now) {
+		t.Fatal("user who never connected must be offline")
+	}
+
+	user.UserTraffic.OnlineAt = remapi.NewNilDateTime(now.Add(-30 * time.Second))
+	if !IsOnline(user, now) {
+		t.Fatal("user seen 30 seconds ago must be online")
+	}
+
+	user.UserTraffic.OnlineAt = remapi.NewNilDateTime(now.Add(-time.Hour))
+	if IsOnline(user, now) {
+		t.Fatal("user seen an hour ago must be offline")
+	}
+}
@@ -0,0 +1,131 @@
+package remnawave
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const (
+	EventUserCreated        = "user.created"
+	EventUserModified       = "user.modified"
+	EventUserDeleted        = "user.deleted"
+	EventUserEnabled        = "user.enabled"
+	EventUserDisabled       = "user.disabled"
+	EventUserLimited        = "user.limited"
+	EventUserExpired        = "user.expired"
+	EventUserTrafficReset   = "user.traffic_reset"
+	EventUserFirstConnected = "user.first_connected"
+	EventHwidDeviceAdded    = "user_hwid_devices.added"
+	EventHwidDeviceDeleted  = "user_hwid_devices.deleted"
+
+	scopeHwidDevices = "user_hwid_devices"
+)
+
+// WebhookEvent is a panel webhook. Data holds a user for the user scope and a user with a device for
+// the user_hwid_devices scope; use DecodeUser to read either.
+type WebhookEvent struct {
+	Scope     string          `json:"scope"`
+	Event     string          `json:"event"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type WebhookUser struct {
+	UUID            string     `json:"uuid"`
+	Username        string     `json:"username"`
+	Status          string     `json:"status"`
+	ExpireAt        *time.Time `json:"expireAt"`
+	TelegramID      *int64     `json:"telegramId"`
+	SubscriptionURL string     `json:"subscriptionUrl"`
+}
+
+type WebhookHwidDevice struct {
+	Hwid        string  `json:"hwid"`
+	Platform    *string `json:"platform"`
+	OsVersion   *string `json:"osVersion"`
+	DeviceModel *string `json:"deviceModel"`
+}
+
+// DecodeUser returns the user of the event and, for device events, the device.
+func (e WebhookEvent) DecodeUser() (*WebhookUser, *WebhookHwidDevice, error) {
+	if e.Scope == scopeHwidDevices {
+		var data struct {
+			User   WebhookUser       `json:"user"`
+			Device WebhookHwidDevice `json:"hwidUserDevice"`
+		}
+		if err := json.Unmarshal(e.Data, &data); err != nil {
+			return nil, nil, fmt.Errorf("failed to decode %s data: %w", e.Event, err)
+		}
+		return &data.User, &data.Device, nil
+	}
+
+	var user WebhookUser
+	if err := json.Unmarshal(e.Data, &user); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode %s data: %w", e.Event, err)
+	}
+	return &user, nil, nil
+}
+
+// EventProcessor applies a panel event to the bot's customers.
+type EventProcessor interface {
+	ProcessRemnawaveEvent(ctx context.Context, event *WebhookEvent) error
+}
+
+// VerifyWebhookSignature checks the X-Remnawave-Signature header: HMAC-SHA256 of the body keyed with WEBHOOK_SECRET_HEADER.
+func VerifyWebhookSignature(secret string, body []byte, signature string) bool {
+	if signature == "" {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	expected := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+func WebHookHandler(secret string, processor EventProcessor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*60)
+		defer cancel()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("remnawave webhook: read body error", "error", err)
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		if !VerifyWebhookSignature(secret, body, r.Header.Get("X-Remnawave-Signature")) {
+			slog.Warn("remnawave webhook: bad signature")
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			slog.Error("remnawave webhook: unmarshal error", "error", err)
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		if err := processor.ProcessRemnawaveEvent(ctx, &event); err != nil {
+			slog.Error("remnawave webhook: processing error", "error", err, "event", event.Event)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
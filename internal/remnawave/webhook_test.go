@@ -0,0 +1,69 @@
+package remnawave
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"scope":"user","event":"user.expired"}`)
+	secret := "secret"
+
+	if !VerifyWebhookSignature(secret, body, sign(secret, body)) {
+		t.Error("expected valid signature")
+	}
+	if VerifyWebhookSignature(secret, body, sign("other", body)) {
+		t.Error("expected signature with other secret to be rejected")
+	}
+	if VerifyWebhookSignature(secret, []byte(`{}`), sign(secret, body)) {
+		t.Error("expected signature for other body to be rejected")
+	}
+	if VerifyWebhookSignature(secret, body, "") {
+		t.Error("expected empty signature to be rejected")
+	}
+}
+
+func TestWebhookEventDecodeUser(t *testing.T) {
+	var event WebhookEvent
+	err := json.Unmarshal([]byte(`{
+		"scope": "user_hwid_devices",
+		"event": "user_hwid_devices.added",
+		"timestamp": "2026-01-02T10:00:00.000Z",
+		"data": {
+			"user": {"uuid": "u1", "username": "user_1", "status": "ACTIVE", "expireAt": "2026-02-01T00:00:00.000Z", "telegramId": 42},
+			"hwidUserDevice": {"hwid": "abc", "platform": "iOS", "osVersion": "18.1", "deviceModel": null}
+		}
+	}`), &event)
+	if err != nil {
+		t.Fatalf("failed to unmarshal event: %v", err)
+	}
+
+	user, device, err := event.DecodeUser()
+	if err != nil {
+		t.Fatalf("DecodeUser() returned error: %v", err)
+	}
+	if user.TelegramID == nil || *user.TelegramID != 42 || user.Status != "ACTIVE" || user.ExpireAt == nil {
+		t.Fatalf("unexpected user: %+v", user)
+	}
+	if device == nil || device.Hwid != "abc" || device.Platform == nil || *device.Platform != "iOS" || device.DeviceModel != nil {
+		t.Fatalf("unexpected device: %+v", device)
+	}
+
+	event = WebhookEvent{Scope: "user", Event: EventUserLimited, Data: json.RawMessage(`{"status": "LIMITED", "telegramId": null}`)}
+	user, device, err = event.DecodeUser()
+	if err != nil {
+		t.Fatalf("DecodeUser() returned error: %v", err)
+	}
+	if user.Status != "LIMITED" || user.TelegramID != nil || device != nil {
+		t.Fatalf("unexpected user event: %+v, %+v", user, device)
+	}
+}
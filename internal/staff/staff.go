@@ -0,0 +1,284 @@
+package staff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"remnawave-tg-shop-bot/internal/database"
+	"remnawave-tg-shop-bot/utils"
+	"slices"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Permission is an admin capability. Commands, buttons and notifications require a permission, roles grant them.
+type Permission string
+
+const (
+	// PermissionCustomers allows searching customers and viewing their card and purchases.
+	PermissionCustomers Permission = "customers"
+	// PermissionSubscriptions allows adding and removing subscription days and resetting the trial.
+	PermissionSubscriptions Permission = "subscriptions"
+	PermissionBlock         Permission = "block"
+	PermissionSync          Permission = "sync"
+	PermissionBroadcast     Permission = "broadcast"
+	PermissionPromo         Permission = "promo"
+	PermissionTariffs       Permission = "tariffs"
+	PermissionRefund        Permission = "refund"
+	// PermissionProvisioning allows re-driving paid purchases and receives provisioning alerts.
+	PermissionProvisioning Permission = "provisioning"
+	// PermissionReceipts receives Moynalog receipt alerts and provider refund notices.
+	PermissionReceipts Permission = "receipts"
+	PermissionStaff    Permission = "staff"
+	// PermissionStats allows viewing revenue, conversion and referral statistics.
+	PermissionStats Permission = "stats"
+	// PermissionReferrals allows approving and rejecting referrals flagged as possible abuse.
+	PermissionReferrals Permission = "referrals"
+)
+
+var (
+	ErrForbidden = errors.New("role cannot manage this staff member")
+	// ErrProtected is returned for ADMIN_TELEGRAM_ID, which is always an owner.
+	ErrProtected = errors.New("staff member is set by ADMIN_TELEGRAM_ID")
+)
+
+var rolePermissions = map[database.StaffRole][]Permission{
+	database.StaffRoleOwner: {
+		PermissionCustomers, PermissionSubscriptions, PermissionBlock, PermissionSync, PermissionBroadcast, PermissionPromo,
+		PermissionTariffs, PermissionRefund, PermissionProvisioning, PermissionReceipts, PermissionStaff,
+		PermissionStats, PermissionReferrals,
+	},
+	database.StaffRoleAdmin: {
+		PermissionCustomers, PermissionSubscriptions, PermissionBlock, PermissionSync, PermissionBroadcast, PermissionPromo,
+		PermissionTariffs, PermissionRefund, PermissionProvisioning, PermissionReceipts, PermissionStaff,
+		PermissionStats, PermissionReferrals,
+	},
+	database.StaffRoleSupport: {
+		PermissionCustomers, PermissionSubscriptions, PermissionProvisioning, PermissionReferrals,
+	},
+	database.StaffRoleFinance: {
+		PermissionCustomers, PermissionPromo, PermissionTariffs, PermissionRefund, PermissionProvisioning, PermissionReceipts,
+		PermissionStats,
+	},
+}
+
+// ParseRole returns the role with the given name.
+func ParseRole(name string) (database.StaffRole, bool) {
+	role := database.StaffRole(name)
+	_, ok := rolePermissions[role]
+	return role, ok
+}
+
+// HasPermission reports whether the role grants the permission.
+func HasPermission(role database.StaffRole, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// CanManage reports whether a staff member with the actor role may give or take away the target role.
+// Owners manage everyone, admins only manage support and finance staff.
+func CanManage(actor, target database.StaffRole) bool {
+	switch actor {
+	case database.StaffRoleOwner:
+		return true
+	case database.StaffRoleAdmin:
+		return target == database.StaffRoleSupport || target == database.StaffRoleFinance
+	default:
+		return false
+	}
+}
+
+type staffRepository interface {
+	Save(ctx context.Context, telegramID int64, role database.StaffRole, addedBy int64) error
+	Delete(ctx context.Context, telegramID int64) (bool, error)
+	FindAll(ctx context.Context) ([]database.StaffMember, error)
+}
+
+type messageSender interface {
+	SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error)
+}
+
+// Service keeps the staff roles in memory, so access checks do not hit the database on every update.
+// The bot is the only writer of the staff table, and it updates the cache after every change.
+type Service struct {
+	repository staffRepository
+	sender     messageSender
+	ownerID    int64
+
+	mu    sync.RWMutex
+	roles map[int64]database.StaffRole
+}
+
+// NewService creates the staff service. ownerID is ADMIN_TELEGRAM_ID, which is always an owner.
+func NewService(repository staffRepository, sender messageSender, ownerID int64) *Service {
+	return &Service{
+		repository: repository,
+		sender:     sender,
+		ownerID:    ownerID,
+		roles:      map[int64]database.StaffRole{},
+	}
+}
+
+// Load reads the staff roles from the database.
+func (s *Service) Load(ctx context.Context) error {
+	members, err := s.repository.FindAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	roles := make(map[int64]database.StaffRole, len(members))
+	for _, m := range members {
+		if _, ok := ParseRole(string(m.Role)); !ok {
+			slog.Warn("unknown staff role", "telegram_id", utils.MaskHalfInt64(m.TelegramID), "role", m.Role)
+			continue
+		}
+		roles[m.TelegramID] = m.Role
+	}
+
+	s.mu.Lock()
+	s.roles = roles
+	s.mu.Unlock()
+	return nil
+}
+
+// Role returns the role of the Telegram user, or false if the user is not staff.
+func (s *Service) Role(telegramID int64) (database.StaffRole, bool) {
+	if telegramID == s.ownerID {
+		return database.StaffRoleOwner, true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, ok := s.roles[telegramID]
+	return role, ok
+}
+
+func (s *Service) IsStaff(telegramID int64) bool {
+	_, ok := s.Role(telegramID)
+	return ok
+}
+
+// Can reports whether the Telegram user has the permission.
+func (s *Service) Can(telegramID int64, permission Permission) bool {
+	role, ok := s.Role(telegramID)
+	return ok && HasPermission(role, permission)
+}
+
+// Members returns all staff, starting with ADMIN_TELEGRAM_ID.
+func (s *Service) Members() []database.StaffMember {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	members := []database.StaffMember{{TelegramID: s.ownerID, Role: database.StaffRoleOwner}}
+	for _, id := range s.sortedIDs() {
+		if id != s.ownerID {
+			members = append(members, database.StaffMember{TelegramID: id, Role: s.roles[id]})
+		}
+	}
+	return members
+}
+
+// Add gives the role to the Telegram user on behalf of actorID.
+func (s *Service) Add(ctx context.Context, actorID, telegramID int64, role database.StaffRole) error {
+	if err := s.checkManage(actorID, telegramID, role); err != nil {
+		return err
+	}
+	if err := s.repository.Save(ctx, telegramID, role, actorID); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.roles[telegramID] = role
+	s.mu.Unlock()
+
+	slog.Info("staff member saved", "actor_id", utils.MaskHalfInt64(actorID), "telegram_id", utils.MaskHalfInt64(telegramID), "role", role)
+	return nil
+}
+
+// Remove takes the role away from the Telegram user on behalf of actorID. It reports whether the user was staff.
+func (s *Service) Remove(ctx context.Context, actorID, telegramID int64) (bool, error) {
+	role, ok := s.Role(telegramID)
+	if !ok {
+		return false, nil
+	}
+	if err := s.checkManage(actorID, telegramID, role); err != nil {
+		return false, err
+	}
+
+	deleted, err := s.repository.Delete(ctx, telegramID)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	delete(s.roles, telegramID)
+	s.mu.Unlock()
+
+	slog.Info("staff member removed", "actor_id", utils.MaskHalfInt64(actorID), "telegram_id", utils.MaskHalfInt64(telegramID))
+	return deleted, nil
+}
+
+func (s *Service) checkManage(actorID, telegramID int64, role database.StaffRole) error {
+	if telegramID == s.ownerID {
+		return ErrProtected
+	}
+
+	actor, ok := s.Role(actorID)
+	if !ok || !CanManage(actor, role) {
+		return ErrForbidden
+	}
+	if current, ok := s.Role(telegramID); ok && !CanManage(actor, current) {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Notify sends the text to every staff member with the permission. It fails only if nobody got the message.
+func (s *Service) Notify(ctx context.Context, permission Permission, text string) error {
+	var errs []error
+	delivered := false
+	for _, id := range s.recipients(permission) {
+		_, err := s.sender.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: id,
+			Text:   text,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to notify staff member %s: %w", utils.MaskHalfInt64(id), err))
+			continue
+		}
+		delivered = true
+	}
+
+	if delivered {
+		for _, err := range errs {
+			slog.Error("Error sending staff notification", "error", err)
+		}
+		return nil
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Service) recipients(permission Permission) []int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := []int64{s.ownerID}
+	for _, id := range s.sortedIDs() {
+		if id != s.ownerID && HasPermission(s.roles[id], permission) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// sortedIDs must be called with s.mu held.
+func (s *Service) sortedIDs() []int64 {
+	ids := make([]int64, 0, len(s.roles))
+	for id := range s.roles {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	return ids
+}
@@ -0,0 +1,187 @@
+package staff
+
+import (
+	"context"
+	"errors"
+	"remnawave-tg-shop-bot/internal/database"
+	"slices"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const ownerID = 1
+
+type fakeRepository struct {
+	members map[int64]database.StaffRole
+}
+
+func (f *fakeRepository) Save(_ context.Context, telegramID int64, role database.StaffRole, _ int64) error {
+	f.members[telegramID] = role
+	return nil
+}
+
+func (f *fakeRepository) Delete(_ context.Context, telegramID int64) (bool, error) {
+	_, ok := f.members[telegramID]
+	delete(f.members, telegramID)
+	return ok, nil
+}
+
+func (f *fakeRepository) FindAll(_ context.Context) ([]database.StaffMember, error) {
+	var list []database.StaffMember
+	for id, role := range f.members {
+		list = append(list, database.StaffMember{TelegramID: id, Role: role})
+	}
+	return list, nil
+}
+
+type fakeSender struct {
+	chats  []int64
+	failed map[int64]bool
+}
+
+func (f *fakeSender) SendMessage(_ context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+	chatID := params.ChatID.(int64)
+	if f.failed[chatID] {
+		return nil, errors.New("bot was blocked by the user")
+	}
+	f.chats = append(f.chats, chatID)
+	return &models.Message{}, nil
+}
+
+func newTestService(t *testing.T, members map[int64]database.StaffRole) (*Service, *fakeRepository, *fakeSender) {
+	t.Helper()
+	repo := &fakeRepository{members: members}
+	sender := &fakeSender{failed: map[int64]bool{}}
+	s := NewService(repo, sender, ownerID)
+	if err := s.Load(context.Background()); err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	return s, repo, sender
+}
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		role       database.StaffRole
+		permission Permission
+		want       bool
+	}{
+		{database.StaffRoleOwner, PermissionStaff, true},
+		{database.StaffRoleAdmin, PermissionBroadcast, true},
+		{database.StaffRoleSupport, PermissionCustomers, true},
+		{database.StaffRoleSupport, PermissionSubscriptions, true},
+		{database.StaffRoleSupport, PermissionRefund, false},
+		{database.StaffRoleSupport, PermissionBroadcast, false},
+		{database.StaffRoleFinance, PermissionRefund, true},
+		{database.StaffRoleFinance, PermissionSubscriptions, false},
+		{database.StaffRoleFinance, PermissionStats, true},
+		{database.StaffRoleSupport, PermissionStats, false},
+		{database.StaffRole("guest"), PermissionCustomers, false},
+	}
+	for _, tt := range tests {
+		if got := HasPermission(tt.role, tt.permission); got != tt.want {
+			t.Fatalf("HasPermission(%s, %s): want %v, got %v", tt.role, tt.permission, tt.want, got)
+		}
+	}
+}
+
+func TestServiceCan(t *testing.T) {
+	s, _, _ := newTestService(t, map[int64]database.StaffRole{2: database.StaffRoleSupport})
+
+	if !s.Can(ownerID, PermissionStaff) {
+		t.Fatal("ADMIN_TELEGRAM_ID must be an owner")
+	}
+	if !s.Can(2, PermissionSubscriptions) || s.Can(2, PermissionRefund) {
+		t.Fatal("support permissions are not applied")
+	}
+	if s.IsStaff(3) || s.Can(3, PermissionCustomers) {
+		t.Fatal("customers must not have admin permissions")
+	}
+}
+
+func TestServiceAdd(t *testing.T) {
+	s, repo, _ := newTestService(t, map[int64]database.StaffRole{
+		2: database.StaffRoleAdmin,
+		3: database.StaffRoleSupport,
+		4: database.StaffRoleAdmin,
+	})
+	ctx := context.Background()
+
+	if err := s.Add(ctx, 2, 10, database.StaffRoleFinance); err != nil {
+		t.Fatalf("admin adding finance: %v", err)
+	}
+	if repo.members[10] != database.StaffRoleFinance || !s.Can(10, PermissionRefund) {
+		t.Fatal("new staff member is not saved")
+	}
+
+	if err := s.Add(ctx, 2, 11, database.StaffRoleAdmin); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("admin adding admin: want ErrForbidden, got %v", err)
+	}
+	if err := s.Add(ctx, 2, 4, database.StaffRoleSupport); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("admin demoting admin: want ErrForbidden, got %v", err)
+	}
+	if err := s.Add(ctx, 3, 12, database.StaffRoleSupport); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("support adding staff: want ErrForbidden, got %v", err)
+	}
+	if err := s.Add(ctx, ownerID, ownerID, database.StaffRoleSupport); !errors.Is(err, ErrProtected) {
+		t.Fatalf("changing ADMIN_TELEGRAM_ID: want ErrProtected, got %v", err)
+	}
+	if err := s.Add(ctx, ownerID, 4, database.StaffRoleSupport); err != nil {
+		t.Fatalf("owner demoting admin: %v", err)
+	}
+}
+
+func TestServiceRemove(t *testing.T) {
+	s, repo, _ := newTestService(t, map[int64]database.StaffRole{
+		2: database.StaffRoleAdmin,
+		3: database.StaffRoleSupport,
+	})
+	ctx := context.Background()
+
+	if _, err := s.Remove(ctx, 3, 2); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("support removing admin: want ErrForbidden, got %v", err)
+	}
+	if _, err := s.Remove(ctx, 2, ownerID); !errors.Is(err, ErrProtected) {
+		t.Fatalf("removing ADMIN_TELEGRAM_ID: want ErrProtected, got %v", err)
+	}
+
+	removed, err := s.Remove(ctx, 2, 3)
+	if err != nil || !removed {
+		t.Fatalf("admin removing support: removed=%v, err=%v", removed, err)
+	}
+	if _, ok := repo.members[3]; ok || s.IsStaff(3) {
+		t.Fatal("removed staff member still has access")
+	}
+
+	removed, err = s.Remove(ctx, 2, 99)
+	if err != nil || removed {
+		t.Fatalf("removing a customer: removed=%v, err=%v", removed, err)
+	}
+}
+
+func TestServiceNotify(t *testing.T) {
+	s, _, sender := newTestService(t, map[int64]database.StaffRole{
+		2: database.StaffRoleFinance,
+		3: database.StaffRoleSupport,
+		4: database.StaffRoleAdmin,
+	})
+
+	if err := s.Notify(context.Background(), PermissionReceipts, "alert"); err != nil {
+		t.Fatalf("Notify() returned error: %v", err)
+	}
+	if want := []int64{ownerID, 2, 4}; !slices.Equal(sender.chats, want) {
+		t.Fatalf("want recipients %v, got %v", want, sender.chats)
+	}
+
+	sender.chats = nil
+	sender.failed[ownerID] = true
+	if err := s.Notify(context.Background(), PermissionReceipts, "alert"); err != nil {
+		t.Fatalf("Notify() must succeed when someone got the message: %v", err)
+	}
+
+	sender.failed[2], sender.failed[4] = true, true
+	if err := s.Notify(context.Background(), PermissionReceipts, "alert"); err == nil {
+		t.Fatal("Notify() must fail when nobody got the message")
+	}
+}
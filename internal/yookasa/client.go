@@ -38,23 +38,75 @@ func NewClient(baseURL, shopID, secretKey string) *Client {
 	}
 }
 
-func (c *Client) CreateInvoice(ctx context.Context, amount int, month int, customerId int64, purchaseId int64) (*Payment, error) {
+func (c *Client) CreateInvoice(ctx context.Context, amount int, days int, customerId int64, purchaseId int64) (*Payment, error) {
+	rub, description, receipt := buildSubscriptionReceipt(amount, days)
+
+	paymentRequest := NewPaymentRequest(
+		rub,
+		config.BotURL(),
+		description,
+		receipt,
+		buildMetadata(ctx, customerId, purchaseId),
+	)
+	paymentRequest.SavePaymentMethod = config.IsAutoPaymentEnabled()
+
+	idempotencyKey := uuid.New().String()
+
+	payment, err := c.CreatePayment(ctx, paymentRequest, idempotencyKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment: %w", err)
+	}
+
+	return payment, nil
+}
+
+// CreateRecurringPayment charges a previously saved payment method without user confirmation.
+func (c *Client) CreateRecurringPayment(ctx context.Context, amount int, days int, customerId int64, purchaseId int64, paymentMethodID uuid.UUID) (*Payment, error) {
+	rub, description, receipt := buildSubscriptionReceipt(amount, days)
+
+	paymentRequest := NewRecurringPaymentRequest(
+		rub,
+		paymentMethodID,
+		description,
+		receipt,
+		buildMetadata(ctx, customerId, purchaseId),
+	)
+
+	payment, err := c.CreatePayment(ctx, paymentRequest, fmt.Sprintf("recurring-%d", purchaseId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create recurring payment: %w", err)
+	}
+
+	return payment, nil
+}
+
+// RefundPayment returns the purchase amount to the customer. The receipt repeats the one sent with
+// the payment, as YooKassa requires it for refunds of payments with receipts.
+func (c *Client) RefundPayment(ctx context.Context, paymentID uuid.UUID, amount int, days int, purchaseId int64) (*Refund, error) {
+	rub, description, receipt := buildSubscriptionReceipt(amount, days)
+
+	request := RefundRequest{
+		PaymentID:   paymentID,
+		Amount:      rub,
+		Description: description,
+		Receipt:     receipt,
+	}
+
+	refund, err := c.CreateRefund(ctx, request, fmt.Sprintf("refund-%d", purchaseId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	return refund, nil
+}
+
+func buildSubscriptionReceipt(amount int, days int) (Amount, string, *Receipt) {
 	rub := Amount{
 		Value:    strconv.Itoa(amount),
 		Currency: "RUB",
 	}
 
-	var monthString string
-	switch month {
-	case 1:
-		monthString = "месяц"
-	case 3, 4:
-		monthString = "месяца"
-	default:
-		monthString = "месяцев"
-	}
-
-	description := fmt.Sprintf("Подписка на %d %s", month, monthString)
+	description := subscriptionDescription(days, config.DaysInMonth())
 	receipt := &Receipt{
 		Customer: &Customer{
 			Email: config.YookasaEmail(),
@@ -71,28 +123,37 @@ func (c *Client) CreateInvoice(ctx context.Context, amount int, month int, custo
 		},
 	}
 
-	metaData := map[string]any{
-		"customerId": customerId,
-		"purchaseId": purchaseId,
-		"username":   ctx.Value("username"),
-	}
-
-	paymentRequest := NewPaymentRequest(
-		rub,
-		config.BotURL(),
-		description,
-		receipt,
-		metaData,
-	)
+	return rub, description, receipt
+}
 
-	idempotencyKey := uuid.New().String()
+// subscriptionDescription names the subscription length in months when it is a whole number of them, and in days
+// otherwise, so tariffs shorter than a month are described too.
+func subscriptionDescription(days int, daysInMonth int) string {
+	if daysInMonth > 0 && days >= daysInMonth && days%daysInMonth == 0 {
+		months := days / daysInMonth
+		return fmt.Sprintf("Подписка на %d %s", months, pluralRu(months, "месяц", "месяца", "месяцев"))
+	}
+	return fmt.Sprintf("Подписка на %d %s", days, pluralRu(days, "день", "дня", "дней"))
+}
 
-	payment, err := c.CreatePayment(ctx, paymentRequest, idempotencyKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create payment: %w", err)
+// pluralRu picks the Russian word form for n: one for 1, 21, 31..., few for 2-4, 22-24... and many otherwise.
+func pluralRu(n int, one, few, many string) string {
+	switch {
+	case n%10 == 1 && n%100 != 11:
+		return one
+	case n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14):
+		return few
+	default:
+		return many
 	}
+}
 
-	return payment, nil
+func buildMetadata(ctx context.Context, customerId int64, purchaseId int64) map[string]any {
+	return map[string]any{
+		"customerId": customerId,
+		"purchaseId": purchaseId,
+		"username":   ctx.Value("username"),
+	}
 }
 
 func (c *Client) CreatePayment(ctx context.Context, request PaymentRequest, idempotencyKey string) (*Payment, error) {
@@ -134,6 +195,45 @@ func (c *Client) CreatePayment(ctx context.Context, request PaymentRequest, idem
 	return &payment, nil
 }
 
+func (c *Client) CreateRefund(ctx context.Context, request RefundRequest, idempotencyKey string) (*Refund, error) {
+	refundURL := fmt.Sprintf("%s/refunds", c.baseURL)
+
+	reqBody, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal refund request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", refundURL, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", c.authHeader)
+	req.Header.Set("Idempotence-Key", idempotencyKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading refund resp: %w", err)
+		}
+		return nil, fmt.Errorf("API return error. Status: %d, Body: %s", resp.StatusCode, string(body))
+	}
+
+	var refund Refund
+	if err := json.NewDecoder(resp.Body).Decode(&refund); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return &refund, nil
+}
+
 func (c *Client) GetPayment(ctx context.Context, paymentID uuid.UUID) (*Payment, error) {
 	paymentURL := fmt.Sprintf("%s/payments/%s", c.baseURL, paymentID)
 
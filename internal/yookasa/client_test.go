@@ -0,0 +1,24 @@
+package yookasa
+
+import "testing"
+
+func TestSubscriptionDescription(t *testing.T) {
+	tests := []struct {
+		days int
+		want string
+	}{
+		{days: 30, want: "Подписка на 1 месяц"},
+		{days: 90, want: "Подписка на 3 месяца"},
+		{days: 180, want: "Подписка на 6 месяцев"},
+		{days: 7, want: "Подписка на 7 дней"},
+		{days: 1, want: "Подписка на 1 день"},
+		{days: 3, want: "Подписка на 3 дня"},
+		{days: 14, want: "Подписка на 14 дней"},
+		{days: 45, want: "Подписка на 45 дней"},
+	}
+	for _, tt := range tests {
+		if got := subscriptionDescription(tt.days, 30); got != tt.want {
+			t.Fatalf("subscriptionDescription(%d) = %q, want %q", tt.days, got, tt.want)
+		}
+	}
+}
@@ -21,20 +21,72 @@ type Payment struct {
 	Refundable    bool              `json:"refundable,omitempty"`
 	Test          bool              `json:"test,omitempty"`
 	RedirectURL   string            `json:"redirect_url,omitempty"`
+
+	CancellationDetails *CancellationDetails `json:"cancellation_details,omitempty"`
+	RefundedAmount      *Amount              `json:"refunded_amount,omitempty"`
+}
+
+type CancellationDetails struct {
+	Party  string `json:"party,omitempty"`
+	Reason string `json:"reason,omitempty"`
 }
 
 func (p *Payment) IsCancelled() bool {
 	return p.Status == "canceled"
 }
 
+// IsPaymentMethodRevoked reports whether the saved payment method can no longer be charged.
+func (p *Payment) IsPaymentMethodRevoked() bool {
+	return p.CancellationDetails != nil && p.CancellationDetails.Reason == "permission_revoked"
+}
+
+func (p *Payment) HasSavedPaymentMethod() bool {
+	return p.PaymentMethod.Saved && p.PaymentMethod.ID != uuid.Nil
+}
+
+func NewRecurringPaymentRequest(
+	amount Amount,
+	paymentMethodID uuid.UUID,
+	description string,
+	receipt *Receipt,
+	metadata map[string]any) PaymentRequest {
+	return PaymentRequest{
+		Amount:          amount,
+		Receipt:         receipt,
+		Metadata:        metadata,
+		PaymentMethodID: &paymentMethodID,
+		Capture:         true,
+		Description:     description,
+	}
+}
+
+type RefundRequest struct {
+	PaymentID   uuid.UUID `json:"payment_id"`
+	Amount      Amount    `json:"amount"`
+	Description string    `json:"description,omitempty"`
+	Receipt     *Receipt  `json:"receipt,omitempty"`
+}
+
+type Refund struct {
+	ID        uuid.UUID `json:"id"`
+	PaymentID uuid.UUID `json:"payment_id"`
+	Status    string    `json:"status"`
+	Amount    Amount    `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r *Refund) IsCancelled() bool {
+	return r.Status == "canceled"
+}
+
 type PaymentRequest struct {
 	Amount            Amount             `json:"amount"`
-	Confirmation      ConfirmationType   `json:"confirmation"`
+	Confirmation      *ConfirmationType  `json:"confirmation,omitempty"`
 	Capture           bool               `json:"capture"`
 	Description       string             `json:"description,omitempty"`
 	PaymentMethodData *PaymentMethodData `json:"payment_method_data,omitempty"`
 	SavePaymentMethod bool               `json:"save_payment_method"`
-	PaymentMethodID   *uuid.UUID         `json:"payment_method_id"`
+	PaymentMethodID   *uuid.UUID         `json:"payment_method_id,omitempty"`
 	Receipt           *Receipt           `json:"receipt,omitempty"`
 	Metadata          map[string]any     `json:"metadata,omitempty"`
 }
@@ -49,7 +101,7 @@ func NewPaymentRequest(
 		Amount:   amount,
 		Receipt:  receipt,
 		Metadata: metadata,
-		Confirmation: ConfirmationType{
+		Confirmation: &ConfirmationType{
 			Type:      "redirect",
 			ReturnURL: urlRedirect,
 		},
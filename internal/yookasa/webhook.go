@@ -0,0 +1,121 @@
+package yookasa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventPaymentSucceeded = "payment.succeeded"
+	EventPaymentCanceled  = "payment.canceled"
+	EventRefundSucceeded  = "refund.succeeded"
+)
+
+// ErrUnknownPayment is returned by a PaymentProcessor when the payment does not belong to any purchase. Retrying
+// the notification cannot change that, so the webhook acknowledges it instead of asking YooKassa to resend it.
+var ErrUnknownPayment = errors.New("payment does not belong to a purchase")
+
+type Notification struct {
+	Type   string          `json:"type"`
+	Event  string          `json:"event"`
+	Object json.RawMessage `json:"object"`
+}
+
+type notificationObject struct {
+	ID        uuid.UUID `json:"id"`
+	PaymentID uuid.UUID `json:"payment_id"`
+	Status    string    `json:"status"`
+}
+
+// PaymentProcessor applies the confirmed state of a payment to the purchase it belongs to.
+type PaymentProcessor interface {
+	ProcessYookasaPayment(ctx context.Context, payment *Payment) error
+	ProcessYookasaRefund(ctx context.Context, payment *Payment) error
+}
+
+// WebHookHandler handles YooKassa HTTP notifications. Notifications are not signed,
+// so the body is only used to find the payment; its state is always re-read with GetPayment.
+func (c *Client) WebHookHandler(processor PaymentProcessor) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Second*60)
+		defer cancel()
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			slog.Error("yookasa webhook: read body error", "error", err)
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+
+		var notification Notification
+		if err := json.Unmarshal(body, &notification); err != nil {
+			slog.Error("yookasa webhook: unmarshal error", "error", err)
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		var object notificationObject
+		if err := json.Unmarshal(notification.Object, &object); err != nil {
+			slog.Error("yookasa webhook: unmarshal object error", "error", err, "event", notification.Event)
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+
+		var paymentID uuid.UUID
+		switch notification.Event {
+		case EventPaymentSucceeded, EventPaymentCanceled:
+			paymentID = object.ID
+		case EventRefundSucceeded:
+			paymentID = object.PaymentID
+		default:
+			slog.Info("yookasa webhook: unsupported event", "event", notification.Event)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if paymentID == uuid.Nil {
+			http.Error(w, "missing payment id", http.StatusBadRequest)
+			return
+		}
+
+		payment, err := c.GetPayment(ctx, paymentID)
+		if err != nil {
+			slog.Error("yookasa webhook: get payment error", "error", err, "event", notification.Event, "payment_id", paymentID)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if notification.Event == EventRefundSucceeded {
+			err = processor.ProcessYookasaRefund(ctx, payment)
+		} else {
+			if (notification.Event == EventPaymentSucceeded && !payment.Paid) ||
+				(notification.Event == EventPaymentCanceled && !payment.IsCancelled()) {
+				slog.Warn("yookasa webhook: event does not match payment status", "event", notification.Event, "payment_id", payment.ID, "status", payment.Status)
+			}
+			err = processor.ProcessYookasaPayment(ctx, payment)
+		}
+		if errors.Is(err, ErrUnknownPayment) {
+			slog.Error("yookasa webhook: payment ignored", "error", err, "event", notification.Event, "payment_id", payment.ID)
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		if err != nil {
+			slog.Error("yookasa webhook: processing error", "error", err, "event", notification.Event, "payment_id", payment.ID)
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,143 @@
+package yookasa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+type fakeProcessor struct {
+	payments []*Payment
+	refunds  []*Payment
+	err      error
+}
+
+func (f *fakeProcessor) ProcessYookasaPayment(_ context.Context, payment *Payment) error {
+	f.payments = append(f.payments, payment)
+	return f.err
+}
+
+func (f *fakeProcessor) ProcessYookasaRefund(_ context.Context, payment *Payment) error {
+	f.refunds = append(f.refunds, payment)
+	return f.err
+}
+
+// newPaymentAPI serves GetPayment with the given payment, as the YooKassa API would.
+func newPaymentAPI(t *testing.T, payment *Payment) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/payments/"+payment.ID.String() {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(payment)
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(server.URL, "shop", "secret")
+}
+
+func notify(t *testing.T, client *Client, processor PaymentProcessor, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/yookasa", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	client.WebHookHandler(processor).ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestWebHookHandlerRefetchesPaymentStatus(t *testing.T) {
+	payment := &Payment{ID: uuid.New(), Status: "pending", Metadata: map[string]string{"purchaseId": "42"}}
+	client := newPaymentAPI(t, payment)
+	processor := &fakeProcessor{}
+
+	// The notification claims the payment succeeded, but the API says it is still pending.
+	body := fmt.Sprintf(`{"type":"notification","event":"payment.succeeded","object":{"id":"%s","status":"succeeded","paid":true}}`, payment.ID)
+	if code := notify(t, client, processor, body); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if len(processor.payments) != 1 {
+		t.Fatalf("processed %d payments, want 1", len(processor.payments))
+	}
+	if got := processor.payments[0]; got.Status != "pending" || got.Paid {
+		t.Fatalf("processed payment with status %q, paid %v; want the state returned by the API", got.Status, got.Paid)
+	}
+}
+
+func TestWebHookHandlerRefund(t *testing.T) {
+	payment := &Payment{ID: uuid.New(), Status: "succeeded", Paid: true}
+	client := newPaymentAPI(t, payment)
+	processor := &fakeProcessor{}
+
+	body := fmt.Sprintf(`{"type":"notification","event":"refund.succeeded","object":{"id":"%s","payment_id":"%s","status":"succeeded"}}`, uuid.New(), payment.ID)
+	if code := notify(t, client, processor, body); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	if len(processor.refunds) != 1 || processor.refunds[0].ID != payment.ID {
+		t.Fatalf("refunds = %v, want payment %s", processor.refunds, payment.ID)
+	}
+}
+
+func TestWebHookHandlerErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "unknown purchase", err: fmt.Errorf("%w: purchase 42 for payment not found", ErrUnknownPayment), want: http.StatusOK},
+		{name: "processing error", err: errors.New("database is down"), want: http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payment := &Payment{ID: uuid.New(), Status: "succeeded", Paid: true}
+			client := newPaymentAPI(t, payment)
+			processor := &fakeProcessor{err: tt.err}
+
+			body := fmt.Sprintf(`{"type":"notification","event":"payment.succeeded","object":{"id":"%s"}}`, payment.ID)
+			if code := notify(t, client, processor, body); code != tt.want {
+				t.Fatalf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebHookHandlerUnknownPaymentAtAPI(t *testing.T) {
+	client := newPaymentAPI(t, &Payment{ID: uuid.New()})
+	processor := &fakeProcessor{}
+
+	// GetPayment fails, which may be transient, so YooKassa is asked to resend the notification.
+	body := fmt.Sprintf(`{"type":"notification","event":"payment.succeeded","object":{"id":"%s"}}`, uuid.New())
+	if code := notify(t, client, processor, body); code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want %d", code, http.StatusInternalServerError)
+	}
+	if len(processor.payments) != 0 {
+		t.Fatalf("processed %d payments, want 0", len(processor.payments))
+	}
+}
+
+func TestWebHookHandlerRejectsInvalidRequests(t *testing.T) {
+	client := NewClient("http://127.0.0.1:0", "shop", "secret")
+	processor := &fakeProcessor{}
+
+	if code := notify(t, client, processor, `{"event":`); code != http.StatusBadRequest {
+		t.Fatalf("broken json: status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := notify(t, client, processor, `{"event":"payment.succeeded","object":{}}`); code != http.StatusBadRequest {
+		t.Fatalf("missing payment id: status = %d, want %d", code, http.StatusBadRequest)
+	}
+	if code := notify(t, client, processor, `{"event":"payout.succeeded","object":{}}`); code != http.StatusOK {
+		t.Fatalf("unsupported event: status = %d, want %d", code, http.StatusOK)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/yookasa", nil)
+	rec := httptest.NewRecorder()
+	client.WebHookHandler(processor).ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("GET: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}